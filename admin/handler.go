@@ -0,0 +1,368 @@
+// Package admin provides an http handler exposing a cache in json for operations and debugging.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	keysPath = "/keys"
+	keyPath  = "/keys/"
+)
+
+var (
+	errUnauthorized  = errors.New("cachego: unauthorized")
+	errNotFound      = errors.New("cachego: not found")
+	errKeyNotFound   = errors.New("cachego: key not found")
+	errEmptyKey      = errors.New("cachego: key is empty")
+	errNoReporter    = errors.New("cachego: cache has no reporter")
+	errValueTooLarge = errors.New("cachego: value is too large")
+)
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+type keyJSON struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+type mgetJSON struct {
+	Keys []string `json:"keys"`
+}
+
+type valuesJSON struct {
+	Values map[string]interface{} `json:"values"`
+}
+
+type scanJSON struct {
+	Keys   []string `json:"keys"`
+	Cursor uint64   `json:"cursor"`
+}
+
+type gcJSON struct {
+	Cleans int `json:"cleans"`
+}
+
+type namespaceJSON struct {
+	Name         string `json:"name"`
+	Size         int    `json:"size"`
+	Quota        int    `json:"quota"`
+	HitCount     uint64 `json:"hit_count"`
+	MissedCount  uint64 `json:"missed_count"`
+	EvictedCount uint64 `json:"evicted_count"`
+}
+
+type tenantJSON struct {
+	Tenant       string `json:"tenant"`
+	Size         int    `json:"size"`
+	HitCount     uint64 `json:"hit_count"`
+	MissedCount  uint64 `json:"missed_count"`
+	EvictedCount uint64 `json:"evicted_count"`
+}
+
+type statsJSON struct {
+	Size        int             `json:"size"`
+	HitCount    uint64          `json:"hit_count"`
+	MissedCount uint64          `json:"missed_count"`
+	GCCount     uint64          `json:"gc_count"`
+	LoadCount   uint64          `json:"load_count"`
+	HitRate     float64         `json:"hit_rate"`
+	MissedRate  float64         `json:"missed_rate"`
+	Namespaces  []namespaceJSON `json:"namespaces,omitempty"`
+	Tenants     []tenantJSON    `json:"tenants,omitempty"`
+}
+
+type configJSON struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Shardings  int    `json:"shardings"`
+	GC         string `json:"gc"`
+	MaxEntries int    `json:"max_entries"`
+}
+
+// Handler is an http handler exposing a cache in json.
+// It can be mounted in other servers with http.StripPrefix, and all paths below are relative to its mount point.
+//
+//	GET    /keys/{key}                            gets the value of key, and 404 if not found
+//	PUT    /keys/{key}?ttl=10s                    sets the body as a string value of key with an optional ttl
+//	DELETE /keys/{key}                            removes key, and 404 if not found
+//	GET    /keys?match=user:*&cursor=0&count=100  scans keys matching the glob pattern, see memcache.Cache.Scan
+//	POST   /mget                                  gets the values of {"keys": [...]}, and missing keys are omitted
+//	GET    /stats                                 gets stats of cache, see WithReporter
+//	GET    /config                                gets config of cache, which needs a reporter
+//	POST   /gc                                    cleans expired keys
+//	POST   /reset                                 removes all keys
+//
+// Keys in paths should be escaped, so a key having "/" is like "/keys/a%2Fb".
+// Values are encoded by encoding/json, and errors are responded as {"error": "..."}.
+type Handler struct {
+	*config
+
+	cache memcache.Cache
+}
+
+// NewHandler returns a handler of cache with options.
+func NewHandler(cache memcache.Cache, opts ...Option) *Handler {
+	conf := newDefaultConfig()
+	applyOptions(conf, opts)
+
+	return &Handler{
+		config: conf,
+		cache:  cache,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(errorJSON{Error: err.Error()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorJSON{Error: err.Error()})
+}
+
+// allowMethods reports if the method of r is one of methods, and responds 405 if not.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("cachego: method "+r.Method+" is not allowed"))
+	return false
+}
+
+// readBody reads the body of r which is limited by the max value size.
+func (h *Handler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxValueSize))
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, errValueTooLarge)
+		return nil, false
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	return body, true
+}
+
+// ServeHTTP serves r after it passes the auth hook.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil && !h.auth(r) {
+		writeError(w, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	if strings.HasPrefix(path, keyPath) {
+		h.serveKey(w, r, strings.TrimPrefix(path, keyPath))
+		return
+	}
+
+	switch path {
+	case keysPath:
+		if allowMethods(w, r, http.MethodGet) {
+			h.serveScan(w, r)
+		}
+	case "/mget":
+		if allowMethods(w, r, http.MethodPost) {
+			h.serveMGet(w, r)
+		}
+	case "/stats":
+		if allowMethods(w, r, http.MethodGet) {
+			h.serveStats(w)
+		}
+	case "/config":
+		if allowMethods(w, r, http.MethodGet) {
+			h.serveConfig(w)
+		}
+	case "/gc":
+		if allowMethods(w, r, http.MethodPost) {
+			writeJSON(w, http.StatusOK, gcJSON{Cleans: h.cache.GC()})
+		}
+	case "/reset":
+		if allowMethods(w, r, http.MethodPost) {
+			h.cache.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+// serveKey serves requests of a key whose escaped form is escapedKey.
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, escapedKey string) {
+	key, err := url.PathUnescape(escapedKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errEmptyKey)
+		return
+	}
+
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		value, found := h.cache.Get(key, nil)
+		if !found {
+			writeError(w, http.StatusNotFound, errKeyNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, keyJSON{Key: key, Value: value})
+	case http.MethodPut:
+		ttl := time.Duration(memcache.NoTTL)
+		if s := r.URL.Query().Get("ttl"); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		body, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+
+		h.cache.Set(key, string(body), ttl)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if removedValue := h.cache.Remove(key); removedValue == nil {
+			writeError(w, http.StatusNotFound, errKeyNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// serveScan serves scanning keys with the query of match, cursor and count.
+func (h *Handler) serveScan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var cursor uint64
+	var count int
+	var err error
+
+	if s := query.Get("cursor"); s != "" {
+		if cursor, err = strconv.ParseUint(s, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if s := query.Get("count"); s != "" {
+		if count, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	keys, next := h.cache.Scan(cursor, query.Get("match"), count)
+	if keys == nil {
+		keys = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, scanJSON{Keys: keys, Cursor: next})
+}
+
+// serveMGet serves getting the values of keys in the body.
+func (h *Handler) serveMGet(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req mgetJSON
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := valuesJSON{Values: make(map[string]interface{}, len(req.Keys))}
+
+	values, founds := h.cache.MGet(req.Keys, nil)
+	for i, found := range founds {
+		if found {
+			resp.Values[req.Keys[i]] = values[i]
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveStats serves stats of cache, which only has the size if there is no reporter.
+func (h *Handler) serveStats(w http.ResponseWriter) {
+	if h.reporter == nil {
+		writeJSON(w, http.StatusOK, statsJSON{Size: h.cache.Size()})
+		return
+	}
+
+	stats := statsJSON{
+		Size:        h.reporter.CacheSize(),
+		HitCount:    h.reporter.CountHit(),
+		MissedCount: h.reporter.CountMissed(),
+		GCCount:     h.reporter.CountGC(),
+		LoadCount:   h.reporter.CountLoad(),
+		HitRate:     h.reporter.HitRate(),
+		MissedRate:  h.reporter.MissedRate(),
+	}
+
+	for _, ns := range h.reporter.Namespaces() {
+		stats.Namespaces = append(stats.Namespaces, namespaceJSON(ns))
+	}
+
+	for _, ts := range h.reporter.Tenants() {
+		stats.Tenants = append(stats.Tenants, tenantJSON(ts))
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// serveConfig serves config of cache reported by the reporter.
+func (h *Handler) serveConfig(w http.ResponseWriter) {
+	if h.reporter == nil {
+		writeError(w, http.StatusNotFound, errNoReporter)
+		return
+	}
+
+	conf := configJSON{
+		Name:       h.reporter.CacheName(),
+		Type:       h.reporter.CacheType().String(),
+		Shardings:  h.reporter.CacheShardings(),
+		GC:         h.reporter.CacheGC().String(),
+		MaxEntries: h.reporter.CacheMaxEntries(),
+	}
+
+	writeJSON(w, http.StatusOK, conf)
+}
@@ -0,0 +1,289 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+func newTestHandler(t *testing.T, opts ...memcache.Option) (handler *Handler, cache memcache.Cache, reporter *memcache.Reporter) {
+	opts = append([]memcache.Option{memcache.WithCacheName("admin"), memcache.WithLRU(64), memcache.WithGC(0)}, opts...)
+
+	cache, reporter = memcache.NewCacheWithReport(opts...)
+	t.Cleanup(func() {
+		cache.Close()
+	})
+
+	return NewHandler(cache, WithReporter(reporter), WithMaxValueSize(32)), cache, reporter
+}
+
+// serve serves a request to handler and returns the status and body of response.
+func serve(handler http.Handler, method string, target string, body string) (status int, respBody string, header http.Header) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, reader))
+	return recorder.Code, strings.TrimSpace(recorder.Body.String()), recorder.Header()
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHandlerKeys$
+func TestHandlerKeys(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	handler, cache, _ := newTestHandler(t, memcache.WithNow(fakeClock.Now))
+
+	testCases := []struct {
+		method string
+		target string
+		body   string
+		status int
+		want   string
+	}{
+		{method: http.MethodGet, target: "/keys/key", status: http.StatusNotFound, want: `{"error":"cachego: key not found"}`},
+		{method: http.MethodPut, target: "/keys/key", body: "value", status: http.StatusNoContent},
+		{method: http.MethodGet, target: "/keys/key", status: http.StatusOK, want: `{"key":"key","value":"value"}`},
+		{method: http.MethodPut, target: "/keys/a%2Fb%20c?ttl=1s", body: "ttl", status: http.StatusNoContent},
+		{method: http.MethodGet, target: "/keys/a%2Fb%20c", status: http.StatusOK, want: `{"key":"a/b c","value":"ttl"}`},
+		{method: http.MethodPut, target: "/keys/key?ttl=x", body: "value", status: http.StatusBadRequest},
+		{method: http.MethodPut, target: "/keys/key", body: strings.Repeat("x", 33), status: http.StatusRequestEntityTooLarge, want: `{"error":"cachego: value is too large"}`},
+		{method: http.MethodGet, target: "/keys/", status: http.StatusBadRequest, want: `{"error":"cachego: key is empty"}`},
+		{method: http.MethodPost, target: "/keys/key", status: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, target: "/keys/key", status: http.StatusNoContent},
+		{method: http.MethodDelete, target: "/keys/key", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/keys/key", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/unknown", status: http.StatusNotFound, want: `{"error":"cachego: not found"}`},
+	}
+
+	for _, testCase := range testCases {
+		status, body, _ := serve(handler, testCase.method, testCase.target, testCase.body)
+		if status != testCase.status {
+			t.Fatalf("%s %s: status %d != %d, body %s", testCase.method, testCase.target, status, testCase.status, body)
+		}
+
+		if testCase.want != "" && body != testCase.want {
+			t.Fatalf("%s %s: body %s != %s", testCase.method, testCase.target, body, testCase.want)
+		}
+	}
+
+	_, _, header := serve(handler, http.MethodPost, "/keys/key", "")
+	if allow := header.Get("Allow"); allow != "GET, PUT, DELETE" {
+		t.Fatalf("allow %q is wrong", allow)
+	}
+
+	fakeClock.Advance(2 * time.Second)
+	if status, body, _ := serve(handler, http.MethodGet, "/keys/a%2Fb%20c", ""); status != http.StatusNotFound {
+		t.Fatalf("status %d != %d, body %s", status, http.StatusNotFound, body)
+	}
+
+	cache.Set("number", 123)
+	cache.Set("func", func() {})
+
+	if _, body, _ := serve(handler, http.MethodGet, "/keys/number", ""); body != `{"key":"number","value":123}` {
+		t.Fatalf("body %s is wrong", body)
+	}
+
+	if status, body, _ := serve(handler, http.MethodGet, "/keys/func", ""); status != http.StatusInternalServerError {
+		t.Fatalf("status %d != %d, body %s", status, http.StatusInternalServerError, body)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHandlerMGet$
+func TestHandlerMGet(t *testing.T) {
+	handler, cache, _ := newTestHandler(t)
+	cache.Set("a", "1")
+	cache.Set("b", 2)
+
+	status, body, _ := serve(handler, http.MethodPost, "/mget", `{"keys":["a","b","c"]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status %d != %d, body %s", status, http.StatusOK, body)
+	}
+
+	if want := `{"values":{"a":"1","b":2}}`; body != want {
+		t.Fatalf("body %s != %s", body, want)
+	}
+
+	if status, _, _ = serve(handler, http.MethodPost, "/mget", `{"keys":`); status != http.StatusBadRequest {
+		t.Fatalf("status %d != %d", status, http.StatusBadRequest)
+	}
+
+	if status, _, _ = serve(handler, http.MethodGet, "/mget", ""); status != http.StatusMethodNotAllowed {
+		t.Fatalf("status %d != %d", status, http.StatusMethodNotAllowed)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHandlerScan$
+func TestHandlerScan(t *testing.T) {
+	handler, cache, _ := newTestHandler(t)
+	for _, key := range []string{"user:1", "user:2", "user:3", "order:1"} {
+		cache.Set(key, key)
+	}
+
+	var keys []string
+	var cursor uint64
+
+	for {
+		status, body, _ := serve(handler, http.MethodGet, "/keys?match=user:*&count=1&cursor="+jsonOf(t, cursor), "")
+		if status != http.StatusOK {
+			t.Fatalf("status %d != %d, body %s", status, http.StatusOK, body)
+		}
+
+		var resp scanJSON
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Keys == nil {
+			t.Fatalf("keys of body %s is null", body)
+		}
+
+		keys = append(keys, resp.Keys...)
+		if cursor = resp.Cursor; cursor == 0 {
+			break
+		}
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("keys %v is wrong", keys)
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "user:") {
+			t.Fatalf("key %s is wrong", key)
+		}
+	}
+
+	if status, _, _ := serve(handler, http.MethodGet, "/keys?cursor=x", ""); status != http.StatusBadRequest {
+		t.Fatalf("status %d != %d", status, http.StatusBadRequest)
+	}
+
+	if status, _, _ := serve(handler, http.MethodGet, "/keys?count=x", ""); status != http.StatusBadRequest {
+		t.Fatalf("status %d != %d", status, http.StatusBadRequest)
+	}
+}
+
+func jsonOf(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHandlerStats$
+func TestHandlerStats(t *testing.T) {
+	handler, cache, _ := newTestHandler(t)
+	cache.Set("key", "value")
+	cache.Get("key", nil)
+	cache.Get("missed", nil)
+
+	status, body, _ := serve(handler, http.MethodGet, "/stats", "")
+	if status != http.StatusOK {
+		t.Fatalf("status %d != %d, body %s", status, http.StatusOK, body)
+	}
+
+	var stats statsJSON
+	if err := json.Unmarshal([]byte(body), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Size != 1 || stats.HitCount != 1 || stats.MissedCount != 1 || stats.HitRate != 0.5 {
+		t.Fatalf("stats %+v is wrong", stats)
+	}
+
+	status, body, _ = serve(handler, http.MethodGet, "/config", "")
+	if status != http.StatusOK {
+		t.Fatalf("status %d != %d, body %s", status, http.StatusOK, body)
+	}
+
+	want := jsonOf(t, configJSON{Name: "admin", Type: "lru", Shardings: 0, GC: "0s", MaxEntries: 64})
+	if body != want {
+		t.Fatalf("body %s != %s", body, want)
+	}
+
+	handler = NewHandler(cache)
+	if _, body, _ = serve(handler, http.MethodGet, "/stats", ""); !strings.HasPrefix(body, `{"size":1,`) {
+		t.Fatalf("body %s is wrong", body)
+	}
+
+	if status, _, _ = serve(handler, http.MethodGet, "/config", ""); status != http.StatusNotFound {
+		t.Fatalf("status %d != %d", status, http.StatusNotFound)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHandlerGCAndReset$
+func TestHandlerGCAndReset(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	handler, cache, _ := newTestHandler(t, memcache.WithNow(fakeClock.Now))
+	cache.Set("a", "a", time.Second)
+	cache.Set("b", "b", time.Second)
+	cache.Set("c", "c")
+
+	fakeClock.Advance(2 * time.Second)
+	status, body, _ := serve(handler, http.MethodPost, "/gc", "")
+	if status != http.StatusOK {
+		t.Fatalf("status %d != %d, body %s", status, http.StatusOK, body)
+	}
+
+	if body != `{"cleans":2}` {
+		t.Fatalf("body %s is wrong", body)
+	}
+
+	if status, _, _ = serve(handler, http.MethodGet, "/reset", ""); status != http.StatusMethodNotAllowed {
+		t.Fatalf("status %d != %d", status, http.StatusMethodNotAllowed)
+	}
+
+	if status, _, _ = serve(handler, http.MethodPost, "/reset", ""); status != http.StatusNoContent {
+		t.Fatalf("status %d != %d", status, http.StatusNoContent)
+	}
+
+	if size := cache.Size(); size != 0 {
+		t.Fatalf("size %d != 0", size)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHandlerAuth$
+func TestHandlerAuth(t *testing.T) {
+	_, cache, _ := newTestHandler(t)
+
+	auth := func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer token"
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/admin", NewHandler(cache, WithAuth(auth))))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/admin/stats", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %d != %d", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	request.Header.Set("Authorization", "Bearer token")
+	if response, err = http.DefaultClient.Do(request); err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status %d != %d", response.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	// defaultMaxValueSize is the default max size of values put by requests.
+	defaultMaxValueSize = 1024 * 1024
+)
+
+type config struct {
+	reporter     *memcache.Reporter
+	auth         func(r *http.Request) bool
+	maxValueSize int64
+}
+
+func newDefaultConfig() *config {
+	return &config{
+		reporter:     nil,
+		auth:         nil,
+		maxValueSize: defaultMaxValueSize,
+	}
+}
+
+// Option applies to config and sets some values to config.
+type Option func(conf *config)
+
+func (o Option) applyTo(conf *config) {
+	o(conf)
+}
+
+func applyOptions(conf *config, opts []Option) {
+	for _, opt := range opts {
+		opt.applyTo(conf)
+	}
+}
+
+// WithReporter returns an option setting the reporter of cache, which serves stats and config of cache.
+// Without a reporter, stats only have the size of cache and config isn't served.
+// See memcache.NewCacheWithReport.
+func WithReporter(reporter *memcache.Reporter) Option {
+	return func(conf *config) {
+		conf.reporter = reporter
+	}
+}
+
+// WithAuth returns an option setting the auth hook of requests.
+// A request is refused with 401 if auth returns false, so it can check tokens, basic auth or client addresses.
+func WithAuth(auth func(r *http.Request) bool) Option {
+	return func(conf *config) {
+		conf.auth = auth
+	}
+}
+
+// WithMaxValueSize returns an option setting the max size in bytes of values put by requests.
+// Putting a larger value is refused with 413.
+func WithMaxValueSize(maxValueSize int64) Option {
+	return func(conf *config) {
+		conf.maxValueSize = maxValueSize
+	}
+}
@@ -0,0 +1,941 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/task"
+)
+
+// FsyncPolicy is the policy of syncing the append-only log to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncEverySecond syncs the log every second, so at most one second of writes may be lost.
+	FsyncEverySecond FsyncPolicy = iota
+
+	// FsyncAlways syncs the log after every write, which is the safest and the slowest.
+	FsyncAlways
+
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever
+)
+
+const (
+	logOpSet byte = iota + 1
+	logOpRemove
+	logOpRemovePrefix
+	logOpRemoveMatch
+	logOpInvalidateTag
+	logOpReset
+)
+
+const (
+	// logTaskDuration is the duration of syncing and compacting the log in background.
+	logTaskDuration = time.Second
+)
+
+// keyState is the state of a key which is written to the log.
+type keyState struct {
+	value      interface{}
+	expiration int64
+	tags       []string
+}
+
+// stateCache is a cache which can return the state of key without recording an access.
+type stateCache interface {
+	stateOf(key string) (state keyState, found bool)
+}
+
+// stateOfEntry returns the state of e if it's unexpired.
+// A nil value has no state because it can't be encoded.
+func stateOfEntry(e *entry, index *keyIndex) (state keyState, found bool) {
+	value, found := valueOf(e)
+	if !found || e.expired(0) {
+		return state, false
+	}
+
+	state = keyState{value: value, expiration: e.expiration}
+	if tags := index.keyTags[e.key]; len(tags) > 0 {
+		state.tags = append([]string(nil), tags...)
+	}
+
+	return state, true
+}
+
+func stateOfCache(cache Cache, key string) (state keyState, found bool) {
+	if sc, ok := cache.(stateCache); ok {
+		return sc.stateOf(key)
+	}
+
+	return state, false
+}
+
+// logEncoder encodes the payload of a log record.
+type logEncoder struct {
+	bytes.Buffer
+	varint [binary.MaxVarintLen64]byte
+}
+
+func (le *logEncoder) putVarint(x int64) {
+	le.Write(le.varint[:binary.PutVarint(le.varint[:], x)])
+}
+
+func (le *logEncoder) putBytes(b []byte) {
+	le.Write(le.varint[:binary.PutUvarint(le.varint[:], uint64(len(b)))])
+	le.Write(b)
+}
+
+func (le *logEncoder) putString(s string) {
+	le.putBytes([]byte(s))
+}
+
+// record returns the record of payload in format: length (uvarint) | payload | crc32 of payload (4 bytes, big endian).
+func (le *logEncoder) record() []byte {
+	payload := le.Bytes()
+
+	record := make([]byte, 0, binary.MaxVarintLen64+len(payload)+4)
+	record = binary.AppendUvarint(record, uint64(len(payload)))
+	record = append(record, payload...)
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+}
+
+// logDecoder decodes the payload of a log record.
+type logDecoder struct {
+	*bytes.Reader
+}
+
+func (ld logDecoder) varint() (int64, error) {
+	return binary.ReadVarint(ld)
+}
+
+func (ld logDecoder) bytes() ([]byte, error) {
+	length, err := binary.ReadUvarint(ld)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > uint64(ld.Len()) {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	b := make([]byte, length)
+	_, err = io.ReadFull(ld, b)
+	return b, err
+}
+
+func (ld logDecoder) string() (string, error) {
+	b, err := ld.bytes()
+	return string(b), err
+}
+
+// logCache writes all mutations of cache to an append-only log and replays them when opening.
+// Single key mutations are written as the state of key after mutating, so replaying is idempotent.
+// Mutations of a key are serialized by its striped lock, and mutations of many keys like RemovePrefix block all others,
+// so the order of records of a key is the order of its mutations.
+// Records are buffered with the locks held and written by group commits after releasing them,
+// so syncing the log never blocks mutations of other keys.
+type logCache struct {
+	*config
+	cache Cache
+
+	// opLock is held for reading by single key mutations and for writing by mutations of many keys.
+	opLock   sync.RWMutex
+	keyLocks *keyLocks
+
+	// file is nil if the log isn't opened, and nothing will be written.
+	file  *os.File
+	size  int64
+	dirty bool
+	lock  sync.Mutex
+
+	// buffer stores records appended but not written yet, and appended and written are the total sizes of them.
+	// Only one writer writes the file at a time, and others wait for writtenCond.
+	buffer      *bytes.Buffer
+	appended    int64
+	written     int64
+	writing     bool
+	writtenCond *sync.Cond
+
+	// compactedSize is the size of log after the last compaction.
+	compactedSize int64
+
+	// rewrites buffers records written during a rewriting, which are appended to the new log after rewriting.
+	rewrites *bytes.Buffer
+}
+
+func newLogCache(conf *config, cache Cache) *logCache {
+	lc := &logCache{
+		config:   conf,
+		cache:    cache,
+		keyLocks: newKeyLocks(conf.hash),
+		buffer:   new(bytes.Buffer),
+	}
+
+	lc.writtenCond = sync.NewCond(&lc.lock)
+	return lc
+}
+
+func (lc *logCache) reportError(err error) {
+	if err != nil && lc.logError != nil {
+		lc.logError(err)
+	}
+}
+
+// encodeState encodes the state of key to a set record, or a remove record if key isn't found.
+func (lc *logCache) encodeState(key string) (record []byte, err error) {
+	encoder := new(logEncoder)
+
+	state, found := stateOfCache(lc.cache, key)
+	if !found {
+		encoder.WriteByte(logOpRemove)
+		encoder.putString(key)
+		return encoder.record(), nil
+	}
+
+	data, err := lc.codec.Encode(state.value)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder.WriteByte(logOpSet)
+	encoder.putString(key)
+	encoder.putVarint(state.expiration)
+	encoder.putVarint(int64(len(state.tags)))
+
+	for _, tag := range state.tags {
+		encoder.putString(tag)
+	}
+
+	encoder.putBytes(data)
+	return encoder.record(), nil
+}
+
+// append appends record to the buffer and returns the size appended after it, which is used to commit it.
+func (lc *logCache) append(record []byte) (appended int64) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if lc.file == nil {
+		return 0
+	}
+
+	if lc.rewrites != nil {
+		lc.rewrites.Write(record)
+	}
+
+	lc.buffer.Write(record)
+	lc.appended += int64(len(record))
+	return lc.appended
+}
+
+// commit waits until records appended before appended are written and synced by the fsync policy.
+// The first waiter writes all records buffered for others, so records of many mutations are written in one group.
+func (lc *logCache) commit(appended int64) {
+	if appended <= 0 {
+		return
+	}
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	for lc.file != nil && lc.written < appended {
+		if lc.writing {
+			lc.writtenCond.Wait()
+			continue
+		}
+
+		lc.writeBuffer()
+	}
+}
+
+// writeBuffer writes buffered records to the log and syncs it by the fsync policy.
+// It should be called with the lock held and writing unset, and it releases the lock while writing.
+func (lc *logCache) writeBuffer() {
+	file, appended, data := lc.file, lc.appended, lc.buffer.Bytes()
+	lc.buffer = new(bytes.Buffer)
+	lc.writing = true
+	lc.lock.Unlock()
+
+	n, err := file.Write(data)
+	if err == nil && lc.fsyncPolicy == FsyncAlways {
+		err = file.Sync()
+	}
+
+	lc.lock.Lock()
+	lc.writing = false
+	lc.written = appended
+	lc.size += int64(n)
+	lc.writtenCond.Broadcast()
+
+	if err == nil && lc.fsyncPolicy != FsyncAlways {
+		lc.dirty = true
+	}
+
+	lc.reportError(err)
+}
+
+// waitWriting waits until no one is writing the log.
+// It should be called with the lock held.
+func (lc *logCache) waitWriting() {
+	for lc.writing {
+		lc.writtenCond.Wait()
+	}
+}
+
+// logStates appends the states of keys to the log and returns the size appended for committing them.
+// It should be called with the locks of keys held.
+func (lc *logCache) logStates(keys ...string) (appended int64) {
+	for _, key := range keys {
+		record, err := lc.encodeState(key)
+		if err != nil {
+			lc.reportError(err)
+			continue
+		}
+
+		if n := lc.append(record); n > 0 {
+			appended = n
+		}
+	}
+
+	return appended
+}
+
+// logOp appends an operation with its argument to the log and returns the size appended for committing it.
+// It should be called with opLock held for writing.
+func (lc *logCache) logOp(op byte, arg string) (appended int64) {
+	encoder := new(logEncoder)
+	encoder.WriteByte(op)
+	encoder.putString(arg)
+	return lc.append(encoder.record())
+}
+
+// mutateKeys calls fn with the locks of keys held, and writes the states of keys if fn reports they're changed.
+func (lc *logCache) mutateKeys(keys []string, fn func() (changed bool)) {
+	lc.opLock.RLock()
+	unlock := lc.keyLocks.lock(keys...)
+
+	appended := int64(0)
+	if fn() {
+		appended = lc.logStates(keys...)
+	}
+
+	unlock()
+	lc.opLock.RUnlock()
+
+	lc.commit(appended)
+}
+
+// mutateAll calls fn with all other mutations blocked and writes op with arg.
+func (lc *logCache) mutateAll(op byte, arg string, fn func()) {
+	lc.opLock.Lock()
+	fn()
+	appended := lc.logOp(op, arg)
+	lc.opLock.Unlock()
+
+	lc.commit(appended)
+}
+
+// apply applies the payload of a record to cache.
+func (lc *logCache) apply(payload []byte) error {
+	decoder := logDecoder{Reader: bytes.NewReader(payload)}
+
+	op, err := decoder.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	arg, err := decoder.string()
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case logOpSet:
+		return lc.applySet(decoder, arg)
+	case logOpRemove:
+		lc.cache.Remove(arg)
+	case logOpRemovePrefix:
+		lc.cache.RemovePrefix(arg)
+	case logOpRemoveMatch:
+		lc.cache.RemoveMatch(arg)
+	case logOpInvalidateTag:
+		lc.cache.InvalidateTag(arg)
+	case logOpReset:
+		lc.cache.Reset()
+	default:
+		return ErrSnapshotCorrupted
+	}
+
+	return nil
+}
+
+func (lc *logCache) applySet(decoder logDecoder, key string) error {
+	expiration, err := decoder.varint()
+	if err != nil {
+		return err
+	}
+
+	count, err := decoder.varint()
+	if err != nil {
+		return err
+	}
+
+	var tags []string
+	for i := int64(0); i < count; i++ {
+		tag, err := decoder.string()
+		if err != nil {
+			return err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	data, err := decoder.bytes()
+	if err != nil {
+		return err
+	}
+
+	value, err := lc.codec.Decode(key, data)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Duration(NoTTL)
+	if expiration > 0 {
+		if ttl = time.Duration(expiration - lc.now()); ttl <= 0 {
+			lc.cache.Remove(key)
+			return nil
+		}
+	}
+
+	lc.cache.SetWithTags(key, value, ttl, tags...)
+	return nil
+}
+
+// replay applies all records of file to cache and returns the size of valid records.
+// A broken record at the end is ignored because it may be written partly when crashing.
+func (lc *logCache) replay(file *os.File) (size int64, err error) {
+	reader := bufio.NewReader(file)
+
+	for {
+		length, err := binary.ReadUvarint(reader)
+		if err != nil || length > maxSnapshotField {
+			return size, nil
+		}
+
+		record := make([]byte, length+4)
+		if _, err = io.ReadFull(reader, record); err != nil {
+			return size, nil
+		}
+
+		payload := record[:length]
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(record[length:]) {
+			return size, nil
+		}
+
+		if err = lc.apply(payload); err != nil {
+			return size, err
+		}
+
+		size += int64(len(binary.AppendUvarint(nil, length)) + len(record))
+	}
+}
+
+// open replays the log and opens it for appending.
+func (lc *logCache) open() error {
+	file, err := os.OpenFile(lc.logPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	size, err := lc.replay(file)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	lc.lock.Lock()
+	lc.file = file
+	lc.size = size
+	lc.lock.Unlock()
+
+	return nil
+}
+
+// startRewrite starts buffering records for rewriting the log, and it returns false if the log is being rewritten.
+func (lc *logCache) startRewrite() bool {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if lc.file == nil || lc.rewrites != nil {
+		return false
+	}
+
+	lc.rewrites = new(bytes.Buffer)
+	return true
+}
+
+// cancelRewrite stops buffering records for rewriting the log.
+func (lc *logCache) cancelRewrite() {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.rewrites = nil
+}
+
+// rewrite replaces the log with a new log of records written by writeStates and records buffered since startRewrite.
+// The states are written without holding the lock, so writes to cache aren't blocked.
+func (lc *logCache) rewrite(writeStates func(writer *bufio.Writer)) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(lc.logPath), filepath.Base(lc.logPath)+".*.tmp")
+	if err != nil {
+		lc.cancelRewrite()
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(tmp)
+	writeStates(writer)
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	// Records written to the old log are in rewrites, so the old log shouldn't be written when swapping.
+	lc.waitWriting()
+
+	rewrites := lc.rewrites
+	lc.rewrites = nil
+
+	// The log has been closed during rewriting, so the new log is dropped.
+	if lc.file == nil {
+		tmp.Close()
+		return os.Remove(tmp.Name())
+	}
+
+	writer.Write(rewrites.Bytes())
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), lc.logPath); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// Buffered records are in rewrites which are synced in the new log, so they're committed.
+	lc.buffer = new(bytes.Buffer)
+	lc.written = lc.appended
+	lc.writtenCond.Broadcast()
+
+	lc.file.Close()
+	lc.file = tmp
+	lc.size = size
+	lc.compactedSize = size
+	lc.dirty = false
+	return nil
+}
+
+// compact rewrites the log from the states of all keys in cache.
+// Records written during rewriting are buffered and appended to the new log, and replaying them is idempotent.
+func (lc *logCache) compact() (err error) {
+	if !lc.startRewrite() {
+		return nil
+	}
+
+	return lc.rewrite(func(writer *bufio.Writer) {
+		for _, key := range lc.cache.Keys() {
+			record, err := lc.encodeState(key)
+			if err != nil {
+				lc.reportError(err)
+				continue
+			}
+
+			writer.Write(record)
+		}
+	})
+}
+
+// checkpoint is called before saving a snapshot, and finish should be called after saving it.
+// The snapshot has the states of all records written before checkpoint, so finish truncates the log to
+// records written after checkpoint if the snapshot is saved, and replaying starts after the snapshot.
+func (lc *logCache) checkpoint() (finish func(saved bool)) {
+	if !lc.startRewrite() {
+		return func(saved bool) {}
+	}
+
+	return func(saved bool) {
+		if !saved {
+			lc.cancelRewrite()
+			return
+		}
+
+		lc.reportError(lc.rewrite(func(writer *bufio.Writer) {}))
+	}
+}
+
+// needCompact reports if the log has grown enough since the last compaction.
+// The log should be at least compactSize and twice of the size after the last compaction,
+// so a log of many live keys won't be rewritten again and again.
+// It should be called with the lock held.
+func (lc *logCache) needCompact() bool {
+	if lc.logCompactSize <= 0 || lc.file == nil {
+		return false
+	}
+
+	return lc.size >= lc.logCompactSize && lc.size >= 2*lc.compactedSize
+}
+
+// maintain syncs the log by the fsync policy and compacts it if it has grown too large.
+func (lc *logCache) maintain() {
+	lc.lock.Lock()
+
+	if lc.file == nil {
+		lc.lock.Unlock()
+		return
+	}
+
+	// The log is synced as a writing without the lock, so it isn't swapped or closed while syncing.
+	if lc.dirty && !lc.writing && lc.fsyncPolicy == FsyncEverySecond {
+		file := lc.file
+		lc.dirty = false
+		lc.writing = true
+		lc.lock.Unlock()
+
+		err := file.Sync()
+
+		lc.lock.Lock()
+		lc.writing = false
+		lc.writtenCond.Broadcast()
+		lc.reportError(err)
+	}
+
+	needCompact := lc.needCompact()
+	lc.lock.Unlock()
+
+	if needCompact {
+		lc.reportError(lc.compact())
+	}
+}
+
+// run opens the log and runs a task maintaining it.
+// It returns a cancel function which cancels the task and closes the log.
+// Cache runs without the log if opening fails and the error is reported, and it panics if there is no logError.
+func (lc *logCache) run() (cancel func()) {
+	if err := lc.open(); err != nil {
+		if lc.logError == nil {
+			panic("cachego: failed to open append log: " + err.Error())
+		}
+
+		lc.reportError(err)
+		return func() {}
+	}
+
+	fn := func(ctx context.Context) {
+		lc.maintain()
+	}
+
+	ctx, cancelTask := context.WithCancel(context.Background())
+	task.New(fn).Context(ctx).Duration(logTaskDuration).Ticker(lc.newTicker).Start()
+
+	return func() {
+		cancelTask()
+
+		lc.lock.Lock()
+		defer lc.lock.Unlock()
+
+		lc.waitWriting()
+		if lc.buffer.Len() > 0 {
+			lc.writeBuffer()
+		}
+
+		if lc.fsyncPolicy != FsyncNever {
+			lc.reportError(lc.file.Sync())
+		}
+
+		lc.reportError(lc.file.Close())
+		lc.file = nil
+		lc.writtenCond.Broadcast()
+	}
+}
+
+// Get gets the value of key from cache and returns value if found.
+// See Cache interface.
+func (lc *logCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	return lc.cache.Get(key, deserializeF)
+}
+
+// MGet gets the values of keys from cache and returns values with founds.
+// See Cache interface.
+func (lc *logCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	return lc.cache.MGet(keys, deserializeF)
+}
+
+// Set sets key and value to cache with ttl and returns evicted value if exists.
+// See Cache interface.
+func (lc *logCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	lc.mutateKeys([]string{key}, func() bool {
+		evictedValue = lc.cache.Set(key, value, ttl...)
+		return true
+	})
+
+	return evictedValue
+}
+
+// MSet sets keys and values to cache with ttls and returns evicted values.
+// See Cache interface.
+func (lc *logCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	lc.mutateKeys(keys, func() bool {
+		evictedValues = lc.cache.MSet(keys, values, ttls...)
+		return true
+	})
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (lc *logCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	lc.mutateKeys([]string{key}, func() bool {
+		evictedValue = lc.cache.SetWithTags(key, value, ttl, tags...)
+		return true
+	})
+
+	return evictedValue
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (lc *logCache) InvalidateTag(tag string) (removed int) {
+	lc.mutateAll(logOpInvalidateTag, tag, func() {
+		removed = lc.cache.InvalidateTag(tag)
+	})
+
+	return removed
+}
+
+// Remove removes key and returns the removed value of key.
+// See Cache interface.
+func (lc *logCache) Remove(key string) (removedValue interface{}) {
+	lc.mutateKeys([]string{key}, func() bool {
+		removedValue = lc.cache.Remove(key)
+		return true
+	})
+
+	return removedValue
+}
+
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (lc *logCache) RemovePrefix(prefix string) (removed int) {
+	lc.mutateAll(logOpRemovePrefix, prefix, func() {
+		removed = lc.cache.RemovePrefix(prefix)
+	})
+
+	return removed
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (lc *logCache) RemoveMatch(pattern string) (removed int) {
+	lc.mutateAll(logOpRemoveMatch, pattern, func() {
+		removed = lc.cache.RemoveMatch(pattern)
+	})
+
+	return removed
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (lc *logCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	lc.mutateKeys([]string{key}, func() bool {
+		actual, loaded = lc.cache.GetOrSet(key, value, ttl...)
+		return !loaded
+	})
+
+	return actual, loaded
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (lc *logCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	lc.mutateKeys([]string{key}, func() bool {
+		swapped = lc.cache.CompareAndSwap(key, oldValue, newValue)
+		return swapped
+	})
+
+	return swapped
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (lc *logCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	lc.mutateKeys([]string{key}, func() bool {
+		deleted = lc.cache.CompareAndDelete(key, oldValue)
+		return deleted
+	})
+
+	return deleted
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// The state of key is only written if it's kept or removed, so updating a missing key without keeping it writes nothing.
+// See Cache interface.
+func (lc *logCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	lc.mutateKeys([]string{key}, func() bool {
+		existed := false
+		newValue, kept = lc.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+			existed = exists
+			return fn(oldValue, exists)
+		})
+
+		return kept || existed
+	})
+
+	return newValue, kept
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (lc *logCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return lc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (lc *logCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return lc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (lc *logCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	lc.mutateKeys([]string{key}, func() bool {
+		value, err = lc.cache.IncrBy(key, delta, ttl...)
+		return err == nil
+	})
+
+	return value, err
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (lc *logCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	lc.mutateKeys([]string{key}, func() bool {
+		value, err = lc.cache.IncrByFloat(key, delta, ttl...)
+		return err == nil
+	})
+
+	return value, err
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (lc *logCache) Range(fn RangeFunc) {
+	lc.cache.Range(fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (lc *logCache) Keys() (keys []string) {
+	return lc.cache.Keys()
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (lc *logCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	return lc.cache.Scan(cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (lc *logCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(lc.config, lc, name, quota)
+}
+
+func (lc *logCache) watchNamespace(ns *namespace) {
+	watchNamespaceOf(lc.cache, ns)
+}
+
+// evictPrefix evicts a key for the quota of namespace.
+// Evictions aren't written to the log, and replaying applies the capacity of cache again.
+func (lc *logCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	return evictPrefixOf(lc.cache, prefix, skip)
+}
+
+func (lc *logCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	return ttlOfCache(lc.cache, key)
+}
+
+// Flush writes all pending writes to the backing store and returns the error if failed.
+// See Cache interface.
+func (lc *logCache) Flush() error {
+	return lc.cache.Flush()
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (lc *logCache) SaveSnapshot(w io.Writer) error {
+	return lc.cache.SaveSnapshot(w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// Entries loaded are written to the log.
+// See Cache interface.
+func (lc *logCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(lc, lc.codec, r)
+}
+
+// Size returns the count of keys in cache.
+// See Cache interface.
+func (lc *logCache) Size() (size int) {
+	return lc.cache.Size()
+}
+
+// GC cleans the expired keys in cache and returns the exact count cleaned.
+// Expired keys aren't written to the log because their expirations are written.
+// See Cache interface.
+func (lc *logCache) GC() (cleans int) {
+	return lc.cache.GC()
+}
+
+// Reset resets cache to initial status which is like a new cache.
+// See Cache interface.
+func (lc *logCache) Reset() {
+	lc.mutateAll(logOpReset, "", lc.cache.Reset)
+}
+
+// Close closes cache.
+// See Cache interface.
+func (lc *logCache) Close() error {
+	return lc.cache.Close()
+}
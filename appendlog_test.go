@@ -0,0 +1,398 @@
+package memcache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLog$
+func TestCacheAppendLog(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		fakeClock := clock.NewFake(time.Now())
+		path := filepath.Join(t.TempDir(), "cache.log")
+
+		var errs []error
+		onError := func(err error) {
+			errs = append(errs, err)
+		}
+
+		newLogged := func() Cache {
+			return NewCache(withPolicy(64), WithShardings(2), WithGC(0), WithNow(fakeClock.Now), WithAppendLog(path, FsyncAlways, 0), WithAppendLogError(onError))
+		}
+
+		cache := newLogged()
+		cache.Set("key", "value", NoTTL)
+		cache.Set("ttl", 1, 10*time.Second)
+		cache.Set("expired", 2, time.Second)
+		cache.MSet([]string{"user:1", "user:2", "tmp:1"}, []interface{}{1, 2, 3}, NoTTL)
+		cache.SetWithTags("tagged", "tagged", NoTTL, "tag")
+		cache.SetWithTags("kept", "kept", NoTTL, "other")
+		cache.Remove("key")
+		cache.RemovePrefix("tmp:")
+		cache.InvalidateTag("tag")
+		cache.Incr("counter")
+		cache.IncrBy("counter", 9)
+		cache.Close()
+
+		fakeClock.Advance(2 * time.Second)
+
+		replayed := newLogged()
+		if size := replayed.Size(); size != 5 {
+			t.Fatalf("%s: size %d != 5", name, size)
+		}
+
+		for key, want := range map[string]interface{}{"ttl": 1, "user:1": 1, "user:2": 2, "kept": "kept", "counter": int64(10)} {
+			if value, found := replayed.Get(key, nil); !found || value != want {
+				t.Fatalf("%s: value %+v of %s != %+v", name, value, key, want)
+			}
+		}
+
+		replayed.Range(func(key string, value interface{}, ttl time.Duration) bool {
+			if key == "ttl" && ttl != 8*time.Second {
+				t.Fatalf("%s: ttl %s != 8s", name, ttl)
+			}
+
+			return true
+		})
+
+		// Tags are restored by replaying.
+		if removed := replayed.InvalidateTag("other"); removed != 1 {
+			t.Fatalf("%s: removed %d != 1", name, removed)
+		}
+
+		replayed.Close()
+
+		if len(errs) != 0 {
+			t.Fatalf("%s: errs %+v is wrong", name, errs)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLogCorrupted$
+func TestCacheAppendLogCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithAppendLog(path, FsyncNever, 0))
+	cache.Set("key", "value", NoTTL)
+	cache.Set("key1", "value1", NoTTL)
+	cache.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the last record as if crashing when writing it.
+	if err = os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := NewCache(WithLRU(16), WithGC(0), WithAppendLog(path, FsyncNever, 0))
+	if size := replayed.Size(); size != 1 {
+		t.Fatalf("size %d != 1", size)
+	}
+
+	if value, found := replayed.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	// The broken record is truncated, so records written later can be replayed.
+	replayed.Set("key2", "value2", NoTTL)
+	replayed.Close()
+
+	replayed = NewCache(WithLRU(16), WithGC(0), WithAppendLog(path, FsyncNever, 0))
+	if size := replayed.Size(); size != 2 {
+		t.Fatalf("size %d != 2", size)
+	}
+
+	if value, found := replayed.Get("key2", nil); !found || value != "value2" {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	replayed.Close()
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLogCompact$
+func TestCacheAppendLogCompact(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	var errs []error
+	onError := func(err error) {
+		errs = append(errs, err)
+	}
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithNewTicker(fakeClock.NewTicker), WithAppendLog(path, FsyncEverySecond, 1024), WithAppendLogError(onError))
+	for i := 0; i < 100; i++ {
+		cache.Set("key", i, NoTTL)
+		cache.Set("key"+strconv.Itoa(i%3), i, NoTTL)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() < 1024 {
+		t.Fatalf("size %d < 1024", info.Size())
+	}
+
+	fakeClock.Advance(time.Second)
+
+	// The log is compacted by the task in background.
+	var compacted int64
+	for i := 0; i < 100; i++ {
+		if info, err = os.Stat(path); err == nil && info.Size() < 1024 {
+			compacted = info.Size()
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if compacted <= 0 {
+		t.Fatalf("log isn't compacted")
+	}
+
+	cache.Set("new", "new", NoTTL)
+	cache.Close()
+
+	replayed := NewCache(WithLRU(16), WithGC(0), WithAppendLog(path, FsyncNever, 0))
+	if size := replayed.Size(); size != 5 {
+		t.Fatalf("size %d != 5", size)
+	}
+
+	for key, want := range map[string]interface{}{"key": 99, "key0": 99, "key1": 97, "key2": 98, "new": "new"} {
+		if value, found := replayed.Get(key, nil); !found || value != want {
+			t.Fatalf("value %+v of %s != %+v", value, key, want)
+		}
+	}
+
+	replayed.Close()
+
+	matches, err := filepath.Glob(path + ".*.tmp")
+	if err != nil || len(matches) != 0 {
+		t.Fatalf("matches %+v, err %+v is wrong", matches, err)
+	}
+
+	if len(errs) != 0 {
+		t.Fatalf("errs %+v is wrong", errs)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLogCompactGrowth$
+func TestCacheAppendLogCompactGrowth(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	cache := NewCache(WithLRU(64), WithGC(0), WithNewTicker(fakeClock.NewTicker), WithAppendLog(path, FsyncNever, 64))
+	defer cache.Close()
+
+	for i := 0; i < 20; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, NoTTL)
+		cache.Set("key"+strconv.Itoa(i), i*10, NoTTL)
+	}
+
+	stat := func() os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return info
+	}
+
+	before := stat()
+	fakeClock.Advance(time.Second)
+
+	compacted := stat()
+	if os.SameFile(before, compacted) || compacted.Size() >= before.Size() {
+		t.Fatalf("log isn't compacted, size %d >= %d", compacted.Size(), before.Size())
+	}
+
+	// Live keys are larger than compact size, but the log shouldn't be compacted until it doubles.
+	fakeClock.Advance(time.Second)
+	if info := stat(); !os.SameFile(info, compacted) {
+		t.Fatal("log is compacted again without growing")
+	}
+
+	for i := 0; i < 40; i++ {
+		cache.Set("key"+strconv.Itoa(i%20), i, NoTTL)
+	}
+
+	fakeClock.Advance(time.Second)
+	if info := stat(); os.SameFile(info, compacted) {
+		t.Fatal("log isn't compacted after doubling")
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLogOpenError$
+func TestCacheAppendLogOpenError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "cache.log")
+
+	var errs []error
+	onError := func(err error) {
+		errs = append(errs, err)
+	}
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithAppendLog(path, FsyncNever, 0), WithAppendLogError(onError))
+	cache.Close()
+
+	if len(errs) != 1 {
+		t.Fatalf("errs %+v is wrong", errs)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("creating cache should panic without log error")
+		}
+	}()
+
+	NewCache(WithLRU(16), WithGC(0), WithAppendLog(path, FsyncNever, 0))
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLogSnapshot$
+func TestCacheAppendLogSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "cache.snapshot")
+	logPath := filepath.Join(dir, "cache.log")
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithAppendLog(logPath, FsyncAlways, 0))
+	cache.Set("key", "value", NoTTL)
+	cache.Set("removed", "removed", NoTTL)
+
+	if err := SaveSnapshotFile(cache, snapshotPath); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Remove("removed")
+	cache.Set("key1", "value1", NoTTL)
+	cache.Close()
+
+	// The log is replayed after the snapshot, so mutations after saving the snapshot are restored.
+	replayed := NewCache(WithLRU(16), WithGC(0), WithSnapshot(snapshotPath, 0), WithAppendLog(logPath, FsyncAlways, 0))
+	if size := replayed.Size(); size != 2 {
+		t.Fatalf("size %d != 2", size)
+	}
+
+	if _, found := replayed.Get("removed", nil); found {
+		t.Fatal("removed is found")
+	}
+
+	if value, found := replayed.Get("key1", nil); !found || value != "value1" {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	replayed.Close()
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheAppendLogTruncate$
+func TestCacheAppendLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "cache.snapshot")
+	logPath := filepath.Join(dir, "cache.log")
+
+	newLogged := func() Cache {
+		return NewCache(WithLRU(16), WithGC(0), WithSnapshot(snapshotPath, 0), WithAppendLog(logPath, FsyncAlways, 0))
+	}
+
+	cache := newLogged()
+	for i := 0; i < 10; i++ {
+		cache.Set("key", i, NoTTL)
+	}
+
+	// Updating a missing key without keeping it changes nothing, so nothing is written.
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Update("missing", func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		return nil, NoTTL, false
+	})
+
+	updated, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Size() != info.Size() {
+		t.Fatalf("size %d of log != %d", updated.Size(), info.Size())
+	}
+
+	cache.Close()
+
+	// The snapshot saved when closing has all states, so the log is truncated.
+	if info, err = os.Stat(logPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 0 {
+		t.Fatalf("size %d of log != 0", info.Size())
+	}
+
+	replayed := newLogged()
+	if value, found := replayed.Get("key", nil); !found || value != 9 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	replayed.Close()
+}
+
+// go test -v -cover -count=1 -run=^TestCacheAppendLogConcurrent$
+func TestCacheAppendLogConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	newLogged := func() Cache {
+		return NewCache(WithLRU(1024), WithShardings(4), WithGC(0), WithAppendLog(path, FsyncAlways, 0))
+	}
+
+	cache := newLogged()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				cache.Set("key"+strconv.Itoa(i)+"-"+strconv.Itoa(j%10), j, NoTTL)
+				cache.Incr("counter")
+
+				if j%25 == 0 {
+					cache.RemovePrefix("key" + strconv.Itoa(i) + "-1")
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	want := make(map[string]interface{})
+	cache.Range(func(key string, value interface{}, ttl time.Duration) bool {
+		want[key] = value
+		return true
+	})
+
+	cache.Close()
+
+	replayed := newLogged()
+	defer replayed.Close()
+
+	if size := replayed.Size(); size != len(want) {
+		t.Fatalf("size %d != %d", size, len(want))
+	}
+
+	for key, value := range want {
+		if got, found := replayed.Get(key, nil); !found || got != value {
+			t.Fatalf("value %+v of %s != %+v", got, key, value)
+		}
+	}
+}
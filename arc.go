@@ -0,0 +1,686 @@
+package memcache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"time"
+)
+
+type arcCache struct {
+	*config
+
+	// t1 and t2 store resident entries, t1 for recency and t2 for frequency.
+	t1 *list.List
+	t2 *list.List
+
+	// b1 and b2 store ghost keys evicted from t1 and t2.
+	b1 *list.List
+	b2 *list.List
+
+	t1Map map[string]*list.Element
+	t2Map map[string]*list.Element
+	b1Map map[string]*list.Element
+	b2Map map[string]*list.Element
+
+	// target is the adaptive target size of t1.
+	target int
+	index  *keyIndex
+	lock   sync.RWMutex
+}
+
+func newARCCache(conf *config) Cache {
+	if conf.maxEntries <= 0 {
+		panic("cachego: arc cache must specify max entries")
+	}
+
+	cache := &arcCache{
+		config: conf,
+	}
+
+	cache.reset()
+	return cache
+}
+
+func (ac *arcCache) unwrap(element *list.Element) *entry {
+	entry, ok := element.Value.(*entry)
+	if !ok {
+		panic("cachego: failed to unwrap arc element's value to entry")
+	}
+
+	return entry
+}
+
+func (ac *arcCache) unwrapGhost(element *list.Element) string {
+	key, ok := element.Value.(string)
+	if !ok {
+		panic("cachego: failed to unwrap arc ghost element's value to key")
+	}
+
+	return key
+}
+
+// removeElement removes element from entries and returns its entry.
+func (ac *arcCache) removeElement(entries *list.List, entryMap map[string]*list.Element, element *list.Element) *entry {
+	entry := ac.unwrap(element)
+
+	delete(entryMap, entry.key)
+	entries.Remove(element)
+	ac.index.remove(entry.key)
+
+	return entry
+}
+
+func (ac *arcCache) pushGhost(ghosts *list.List, ghostMap map[string]*list.Element, key string) {
+	ghostMap[key] = ghosts.PushFront(key)
+}
+
+func (ac *arcCache) removeGhost(ghosts *list.List, ghostMap map[string]*list.Element, element *list.Element) {
+	delete(ghostMap, ac.unwrapGhost(element))
+	ghosts.Remove(element)
+}
+
+// replace moves the lru entry of t1 or t2 to its ghost list and returns the evicted value.
+func (ac *arcCache) replace(inB2 bool) (evictedValue interface{}) {
+	t1Len := ac.t1.Len()
+
+	if t1Len > 0 && (t1Len > ac.target || (inB2 && t1Len == ac.target)) {
+		entry := ac.removeElement(ac.t1, ac.t1Map, ac.t1.Back())
+		ac.pushGhost(ac.b1, ac.b1Map, entry.key)
+
+		return *entry.value
+	}
+
+	if element := ac.t2.Back(); element != nil {
+		entry := ac.removeElement(ac.t2, ac.t2Map, element)
+		ac.pushGhost(ac.b2, ac.b2Map, entry.key)
+
+		return *entry.value
+	}
+
+	return nil
+}
+
+func (ac *arcCache) get(key string) (value interface{}, found bool) {
+	var entry *entry
+
+	if element, ok := ac.t1Map[key]; ok {
+		entry = ac.unwrap(element)
+		if entry.expired(0) {
+			return nil, false
+		}
+
+		delete(ac.t1Map, key)
+		ac.t1.Remove(element)
+		ac.t2Map[key] = ac.t2.PushFront(entry)
+		ac.index.touch(key, 1)
+	} else if element, ok := ac.t2Map[key]; ok {
+		entry = ac.unwrap(element)
+		if entry.expired(0) {
+			return nil, false
+		}
+
+		ac.t2.MoveToFront(element)
+		ac.index.touch(key, 1)
+	} else {
+		return nil, false
+	}
+
+	if entry.value == nil {
+		return nil, false
+	}
+
+	return *entry.value, true
+}
+
+func (ac *arcCache) set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	curTtl := ac.ttlOf(value, ttl)
+
+	if element, ok := ac.t1Map[key]; ok {
+		entry := ac.unwrap(element)
+		ac.index.untagExpired(entry)
+		entry.setup(key, &value, curTtl)
+
+		delete(ac.t1Map, key)
+		ac.t1.Remove(element)
+		ac.t2Map[key] = ac.t2.PushFront(entry)
+		ac.index.touch(key, 1)
+		return nil
+	}
+
+	if element, ok := ac.t2Map[key]; ok {
+		entry := ac.unwrap(element)
+		ac.index.untagExpired(entry)
+		entry.setup(key, &value, curTtl)
+
+		ac.t2.MoveToFront(element)
+		ac.index.touch(key, 1)
+		return nil
+	}
+
+	evictedValue = makeRoom(ac, ac.index, key, ac.size())
+
+	if element, ok := ac.b1Map[key]; ok {
+		delta := 1
+		if ac.b1.Len() < ac.b2.Len() {
+			delta = ac.b2.Len() / ac.b1.Len()
+		}
+
+		ac.target += delta
+		if ac.target > ac.maxEntries {
+			ac.target = ac.maxEntries
+		}
+
+		ac.removeGhost(ac.b1, ac.b1Map, element)
+
+		if ac.t1.Len()+ac.t2.Len() >= ac.maxEntries {
+			evictedValue = ac.replace(false)
+		}
+
+		ac.t2Map[key] = ac.t2.PushFront(newEntry(key, &value, curTtl, ac.now))
+		ac.index.add(key)
+		ac.index.touch(key, 1)
+		return evictedValue
+	}
+
+	if element, ok := ac.b2Map[key]; ok {
+		delta := 1
+		if ac.b2.Len() < ac.b1.Len() {
+			delta = ac.b1.Len() / ac.b2.Len()
+		}
+
+		ac.target -= delta
+		if ac.target < 0 {
+			ac.target = 0
+		}
+
+		ac.removeGhost(ac.b2, ac.b2Map, element)
+
+		if ac.t1.Len()+ac.t2.Len() >= ac.maxEntries {
+			evictedValue = ac.replace(true)
+		}
+
+		ac.t2Map[key] = ac.t2.PushFront(newEntry(key, &value, curTtl, ac.now))
+		ac.index.add(key)
+		ac.index.touch(key, 1)
+		return evictedValue
+	}
+
+	l1Len := ac.t1.Len() + ac.b1.Len()
+	total := l1Len + ac.t2.Len() + ac.b2.Len()
+
+	if l1Len >= ac.maxEntries {
+		if ac.t1.Len() < ac.maxEntries {
+			ac.removeGhost(ac.b1, ac.b1Map, ac.b1.Back())
+
+			if ac.t1.Len()+ac.t2.Len() >= ac.maxEntries {
+				evictedValue = ac.replace(false)
+			}
+		} else {
+			entry := ac.removeElement(ac.t1, ac.t1Map, ac.t1.Back())
+			evictedValue = *entry.value
+		}
+	} else if total >= ac.maxEntries {
+		if total >= 2*ac.maxEntries && ac.b2.Len() > 0 {
+			ac.removeGhost(ac.b2, ac.b2Map, ac.b2.Back())
+		}
+
+		if ac.t1.Len()+ac.t2.Len() >= ac.maxEntries {
+			evictedValue = ac.replace(false)
+		}
+	}
+
+	ac.t1Map[key] = ac.t1.PushFront(newEntry(key, &value, curTtl, ac.now))
+	ac.index.add(key)
+	ac.index.touch(key, 0)
+	return evictedValue
+}
+
+func (ac *arcCache) entryOf(key string) *entry {
+	// Getting moves the entry of key to t2 if found.
+	if _, found := ac.get(key); !found {
+		return nil
+	}
+
+	if element, ok := ac.t2Map[key]; ok {
+		return ac.unwrap(element)
+	}
+
+	return nil
+}
+
+// evictKey evicts key chosen by namespaces or tenants, which is the same as removing it.
+func (ac *arcCache) evictKey(key string) (evictedValue interface{}) {
+	return ac.remove(key)
+}
+
+func (ac *arcCache) remove(key string) (removedValue interface{}) {
+	if element, ok := ac.t1Map[key]; ok {
+		return *ac.removeElement(ac.t1, ac.t1Map, element).value
+	}
+
+	if element, ok := ac.t2Map[key]; ok {
+		return *ac.removeElement(ac.t2, ac.t2Map, element).value
+	}
+
+	return nil
+}
+
+func (ac *arcCache) peek(key string) *entry {
+	if element, ok := ac.t1Map[key]; ok {
+		return ac.unwrap(element)
+	}
+
+	if element, ok := ac.t2Map[key]; ok {
+		return ac.unwrap(element)
+	}
+
+	return nil
+}
+
+func (ac *arcCache) walk(fn func(e *entry) bool) {
+	for _, entries := range []*list.List{ac.t1, ac.t2} {
+		for element := entries.Front(); element != nil; element = element.Next() {
+			if !fn(ac.unwrap(element)) {
+				return
+			}
+		}
+	}
+}
+
+// walkCold walks entries from the back of t1 and t2 which are evicted in order, and t1 is segment 0.
+func (ac *arcCache) walkCold(fn func(e *entry, segment int) bool) {
+	for segment, entries := range []*list.List{ac.t1, ac.t2} {
+		for element := entries.Back(); element != nil; element = element.Prev() {
+			if !fn(ac.unwrap(element), segment) {
+				return
+			}
+		}
+	}
+}
+
+func (ac *arcCache) size() (size int) {
+	return len(ac.t1Map) + len(ac.t2Map)
+}
+
+func (ac *arcCache) gcList(entries *list.List, entryMap map[string]*list.Element, now int64, scans *int) (cleans int) {
+	for element := entries.Back(); element != nil; {
+		if ac.maxScans > 0 && *scans >= ac.maxScans {
+			break
+		}
+
+		*scans++
+		prev := element.Prev()
+
+		if entry := ac.unwrap(element); entry.expired(now) {
+			ac.removeElement(entries, entryMap, element)
+			cleans++
+		}
+
+		element = prev
+	}
+
+	return cleans
+}
+
+func (ac *arcCache) gc() (cleans int) {
+	now := ac.now()
+	scans := 0
+
+	cleans += ac.gcList(ac.t1, ac.t1Map, now, &scans)
+	cleans += ac.gcList(ac.t2, ac.t2Map, now, &scans)
+	return cleans
+}
+
+func (ac *arcCache) reset() {
+	ac.t1 = list.New()
+	ac.t2 = list.New()
+	ac.b1 = list.New()
+	ac.b2 = list.New()
+	ac.t1Map = make(map[string]*list.Element, mapInitialCap)
+	ac.t2Map = make(map[string]*list.Element, mapInitialCap)
+	ac.b1Map = make(map[string]*list.Element, mapInitialCap)
+	ac.b2Map = make(map[string]*list.Element, mapInitialCap)
+	ac.target = 0
+	ac.index = ac.index.renew(ac.config)
+}
+
+// Get gets the value of key from cache and returns value if found.
+// See Cache interface.
+func (ac *arcCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	ac.lock.Lock()
+	value, found = ac.get(key)
+	ac.lock.Unlock()
+
+	// Loading may be slow, so it's done without the lock.
+	if !found && ac.loadFunc != nil {
+		newVals, err := ac.loadFunc([]string{key}, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			ac.Set(key, newVals[0])
+		}
+	}
+
+	return value, found
+}
+
+// MGet gets the values of keys from cache and returns values with founds.
+// See Cache interface.
+func (ac *arcCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	values = make([]interface{}, len(keys))
+	founds = make([]bool, len(keys))
+	mio := &MInOuput{}
+
+	ac.lock.Lock()
+	for i, key := range keys {
+		value, found := ac.get(key)
+		founds[i] = found
+
+		if !found {
+			mio.Keys = append(mio.Keys, key)
+			mio.Indexes = append(mio.Indexes, i)
+		} else {
+			values[i] = value
+		}
+	}
+	ac.lock.Unlock()
+
+	if len(mio.Keys) > 0 && ac.loadFunc != nil {
+		newVals, err := ac.loadFunc(mio.Keys, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			ac.lock.Lock()
+			defer ac.lock.Unlock()
+
+			// The load function may return fewer values than keys, and keys without values are missed.
+			for i, index := range mio.Indexes {
+				if i < len(newVals) {
+					values[index] = newVals[i]
+					ac.set(mio.Keys[i], newVals[i])
+				}
+			}
+		}
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to cache with ttl and returns evicted value if exists.
+// See Cache interface.
+func (ac *arcCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return ac.set(key, value, ttl...)
+}
+
+// MSet sets keys and values to cache with ttls and returns evicted values.
+// See Cache interface.
+func (ac *arcCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	// Keys and values must have the same length, or nothing is set.
+	if len(keys) != len(values) {
+		return nil
+	}
+
+	for i := 0; i < len(keys); i++ {
+		if len(ttls) > i {
+			evictedValues = append(evictedValues, ac.set(keys[i], values[i], ttls[i]))
+		} else {
+			evictedValues = append(evictedValues, ac.set(keys[i], values[i]))
+		}
+	}
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (ac *arcCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return setWithTags(ac, ac.index, key, value, ttl, tags)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (ac *arcCache) InvalidateTag(tag string) (removed int) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return invalidateTag(ac, ac, ac.index, tag)
+}
+
+// Remove removes key and returns the removed value of key.
+// See Cache interface.
+func (ac *arcCache) Remove(key string) (removedValue interface{}) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return ac.remove(key)
+}
+
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (ac *arcCache) RemovePrefix(prefix string) (removed int) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return removeMatched(ac, ac, ac.index, prefix, func(key string) bool {
+		return true
+	})
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (ac *arcCache) RemoveMatch(pattern string) (removed int) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return removeMatched(ac, ac, ac.index, literalPrefix(pattern), func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (ac *arcCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return getOrSet(ac, key, value, ttl)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (ac *arcCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return compareAndSwap(ac, key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (ac *arcCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return compareAndDelete(ac, key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (ac *arcCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return update(ac, key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (ac *arcCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return ac.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (ac *arcCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return ac.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (ac *arcCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return incrBy(ac, key, delta, ttl)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (ac *arcCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return incrByFloat(ac, key, delta, ttl)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (ac *arcCache) Range(fn RangeFunc) {
+	ac.lock.RLock()
+	items := collect(ac, ac.now())
+	ac.lock.RUnlock()
+
+	rangeItems(items, fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (ac *arcCache) Keys() (keys []string) {
+	ac.lock.RLock()
+	defer ac.lock.RUnlock()
+
+	now := ac.now()
+	ac.walk(func(e *entry) bool {
+		if _, found := valueOf(e); found && !e.expired(now) {
+			keys = append(keys, e.key)
+		}
+
+		return true
+	})
+
+	return keys
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (ac *arcCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	ac.lock.RLock()
+	defer ac.lock.RUnlock()
+
+	return scan(ac, ac.index, ac.now(), cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (ac *arcCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(ac.config, ac, name, quota)
+}
+
+func (ac *arcCache) watchNamespace(ns *namespace) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	watchNamespace(ac, ac.index, ns)
+}
+
+func (ac *arcCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return evictPrefix(ac, ac.index, prefix, skip)
+}
+
+// stateOf returns the state of key without recording an access.
+func (ac *arcCache) stateOf(key string) (state keyState, found bool) {
+	ac.lock.RLock()
+	defer ac.lock.RUnlock()
+
+	element, ok := ac.t1Map[key]
+	if !ok {
+		element, ok = ac.t2Map[key]
+	}
+	if !ok {
+		return state, false
+	}
+
+	return stateOfEntry(ac.unwrap(element), ac.index)
+}
+
+// ttlOfKey returns the remaining ttl of key without recording an access.
+func (ac *arcCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	ac.lock.RLock()
+	defer ac.lock.RUnlock()
+
+	return ttlOfEntry(ac.peek(key), ac.now())
+}
+
+// Flush does nothing because cache has no store.
+// See Cache interface.
+func (ac *arcCache) Flush() error {
+	return nil
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (ac *arcCache) SaveSnapshot(w io.Writer) error {
+	return saveSnapshot(ac, ac.codec, w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (ac *arcCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(ac, ac.codec, r)
+}
+
+// Size returns the count of keys in cache.
+// See Cache interface.
+func (ac *arcCache) Size() (size int) {
+	ac.lock.RLock()
+	defer ac.lock.RUnlock()
+
+	return ac.size()
+}
+
+// GC cleans the expired keys in cache and returns the exact count cleaned.
+// See Cache interface.
+func (ac *arcCache) GC() (cleans int) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	return ac.gc()
+}
+
+// Reset resets cache to initial status which is like a new cache.
+// See Cache interface.
+func (ac *arcCache) Reset() {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	ac.reset()
+}
+
+// Close releases all entries in cache.
+// See Cache interface.
+func (ac *arcCache) Close() error {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	ac.reset()
+	return nil
+}
@@ -0,0 +1,163 @@
+package memcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestARCCache(maxEntries int, now func() int64) *arcCache {
+	conf := newDefaultConfig()
+	conf.maxEntries = maxEntries
+	conf.now = now
+
+	return newARCCache(conf).(*arcCache)
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestARCCacheEvict$
+func TestARCCacheEvict(t *testing.T) {
+	cache := newTestARCCache(4, now)
+
+	for i := 0; i < 4; i++ {
+		cache.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	// Hitting key 0 moves it to t2, so it survives a scan of new keys.
+	if _, found := cache.Get("0", nil); !found {
+		t.Fatal("key 0 not found")
+	}
+
+	for i := 4; i < 8; i++ {
+		cache.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	if size := cache.Size(); size != 4 {
+		t.Fatalf("size %d != 4", size)
+	}
+
+	if value, found := cache.Get("0", nil); !found || value != 0 {
+		t.Fatalf("value %v found %v is wrong", value, found)
+	}
+
+	if _, found := cache.Get("1", nil); found {
+		t.Fatal("key 1 should be evicted")
+	}
+
+	if cache.b1.Len() == 0 {
+		t.Fatal("evicted keys should be remembered in b1")
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestARCCacheAdapt$
+func TestARCCacheAdapt(t *testing.T) {
+	cache := newTestARCCache(4, now)
+
+	for i := 0; i < 4; i++ {
+		cache.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	cache.Get("3", nil)
+	cache.Set("4", 4, NoTTL)
+
+	if _, ok := cache.b1Map["0"]; !ok {
+		t.Fatal("key 0 should be a ghost in b1")
+	}
+
+	// Setting a ghost key of b1 grows the target size of t1.
+	cache.Set("0", 0, NoTTL)
+
+	if cache.target != 1 {
+		t.Fatalf("target %d != 1", cache.target)
+	}
+
+	if _, ok := cache.t2Map["0"]; !ok {
+		t.Fatal("key 0 should be moved to t2")
+	}
+
+	if size := cache.Size(); size != 4 {
+		t.Fatalf("size %d != 4", size)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestARCCacheTTL$
+func TestARCCacheTTL(t *testing.T) {
+	current := int64(0)
+	cache := newTestARCCache(4, func() int64 { return current })
+
+	cache.Set("key", "value", time.Second)
+	cache.Set("forever", "value", NoTTL)
+
+	if _, found := cache.Get("key", nil); !found {
+		t.Fatal("key not found")
+	}
+
+	current += 2 * time.Second.Nanoseconds()
+
+	if _, found := cache.Get("key", nil); found {
+		t.Fatal("key should be expired")
+	}
+
+	if cleans := cache.GC(); cleans != 1 {
+		t.Fatalf("cleans %d != 1", cleans)
+	}
+
+	if size := cache.Size(); size != 1 {
+		t.Fatalf("size %d != 1", size)
+	}
+
+	if removed := cache.Remove("forever"); removed != "value" {
+		t.Fatalf("removed %v != value", removed)
+	}
+
+	cache.Set("key", "value", NoTTL)
+	cache.Reset()
+
+	if size := cache.Size(); size != 0 {
+		t.Fatalf("size %d != 0", size)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestARCCacheWithShardings$
+func TestARCCacheWithShardings(t *testing.T) {
+	cache := NewCache(WithARC(16), WithShardings(4), WithGC(0), WithLoadFunc(testLoadfunc))
+
+	keys := []string{"1", "2", "3"}
+	cache.MSet(keys, []interface{}{1, 2, 3}, NoTTL, NoTTL, NoTTL)
+
+	values, founds := cache.MGet([]string{"1", "2", "3", "4"}, nil)
+	for i := 0; i < 3; i++ {
+		if !founds[i] || values[i] != i+1 {
+			t.Fatalf("values[%d] %v founds[%d] %v is wrong", i, values[i], i, founds[i])
+		}
+	}
+
+	if values[3] != "4value" {
+		t.Fatalf("values[3] %v != 4value", values[3])
+	}
+
+	if value, found := cache.Get("4", nil); !found || value != "4value" {
+		t.Fatalf("value %v found %v is wrong", value, found)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestARCCacheLoadFewer$
+func TestARCCacheLoadFewer(t *testing.T) {
+	loadFunc := func(keys []string, deserializeF DeserializeFunc) ([]interface{}, error) {
+		return []interface{}{keys[0] + "value"}, nil
+	}
+
+	cache := NewCache(WithARC(16), WithGC(0), WithLoadFunc(loadFunc))
+
+	values, _ := cache.MGet([]string{"1", "2"}, nil)
+	if values[0] != "1value" || values[1] != nil {
+		t.Fatalf("values %+v is wrong", values)
+	}
+
+	if value, found := cache.Get("1", nil); !found || value != "1value" {
+		t.Fatalf("value %v found %v is wrong", value, found)
+	}
+
+	if value, found := cache.Get("2", nil); found {
+		t.Fatalf("value %v is found", value)
+	}
+}
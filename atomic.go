@@ -0,0 +1,83 @@
+package memcache
+
+import "time"
+
+// UpdateFunc updates the value of key atomically.
+// oldValue is the current value of key and exists reports if key exists in cache.
+// Returns the new value with its ttl, and keep reports if the key should be kept or removed.
+// Returning KeepTTL keeps the remaining ttl of key.
+type UpdateFunc func(oldValue interface{}, exists bool) (newValue interface{}, ttl time.Duration, keep bool)
+
+// atomicCache is a cache whose operations can be combined under one lock.
+// All methods should be called with the write lock held.
+type atomicCache interface {
+	// entryOf returns the unexpired entry of key or nil if not found.
+	// It records an access of key just like getting.
+	entryOf(key string) *entry
+	set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{})
+	remove(key string) (removedValue interface{})
+}
+
+func valueOf(e *entry) (value interface{}, found bool) {
+	if e == nil || e.value == nil || *e.value == nil {
+		return nil, false
+	}
+
+	return *e.value, true
+}
+
+func getOrSet(ac atomicCache, key string, value interface{}, ttl []time.Duration) (actual interface{}, loaded bool) {
+	if actual, loaded = valueOf(ac.entryOf(key)); loaded {
+		return actual, true
+	}
+
+	ac.set(key, value, ttl...)
+	return value, false
+}
+
+func compareAndSwap(ac atomicCache, key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	e := ac.entryOf(key)
+	if value, found := valueOf(e); !found || value != oldValue {
+		return false
+	}
+
+	// Only the value is swapped, and the ttl of key is kept.
+	e.value = &newValue
+	return true
+}
+
+func compareAndDelete(ac atomicCache, key string, oldValue interface{}) (deleted bool) {
+	if value, found := valueOf(ac.entryOf(key)); !found || value != oldValue {
+		return false
+	}
+
+	ac.remove(key)
+	return true
+}
+
+func update(ac atomicCache, key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	e := ac.entryOf(key)
+	oldValue, exists := valueOf(e)
+
+	newValue, ttl, keep := fn(oldValue, exists)
+	if !keep {
+		if exists {
+			ac.remove(key)
+		}
+
+		return nil, false
+	}
+
+	if ttl != KeepTTL {
+		ac.set(key, newValue, ttl)
+		return newValue, true
+	}
+
+	if exists {
+		ac.set(key, newValue, e.ttlOf(e.now()))
+	} else {
+		ac.set(key, newValue)
+	}
+
+	return newValue, true
+}
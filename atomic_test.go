@@ -0,0 +1,167 @@
+package memcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheGetOrSet$
+func TestCacheGetOrSet(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithShardings(4), WithGC(0))
+
+		actual, loaded := cache.GetOrSet("key", "value1", NoTTL)
+		if loaded || actual != "value1" {
+			t.Fatalf("%s: actual %v loaded %v is wrong", name, actual, loaded)
+		}
+
+		actual, loaded = cache.GetOrSet("key", "value2", NoTTL)
+		if !loaded || actual != "value1" {
+			t.Fatalf("%s: actual %v loaded %v is wrong", name, actual, loaded)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheCompareAndSwap$
+func TestCacheCompareAndSwap(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithShardings(4), WithGC(0), WithNow(fakeClock.Now))
+
+		if cache.CompareAndSwap("key", nil, "value") {
+			t.Fatalf("%s: swapping a missing key should fail", name)
+		}
+
+		cache.Set("key", "value1", time.Second)
+
+		if cache.CompareAndSwap("key", "value2", "value3") {
+			t.Fatalf("%s: swapping a different value should fail", name)
+		}
+
+		if !cache.CompareAndSwap("key", "value1", "value2") {
+			t.Fatalf("%s: swapping the same value should succeed", name)
+		}
+
+		if value, _ := cache.Get("key", nil); value != "value2" {
+			t.Fatalf("%s: value %v != value2", name, value)
+		}
+
+		// Swapping keeps the ttl of key.
+		fakeClock.Advance(2 * time.Second)
+		if _, found := cache.Get("key", nil); found {
+			t.Fatalf("%s: key should be expired", name)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheCompareAndDelete$
+func TestCacheCompareAndDelete(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithShardings(4), WithGC(0))
+		cache.Set("key", "value1", NoTTL)
+
+		if cache.CompareAndDelete("key", "value2") {
+			t.Fatalf("%s: deleting a different value should fail", name)
+		}
+
+		if !cache.CompareAndDelete("key", "value1") {
+			t.Fatalf("%s: deleting the same value should succeed", name)
+		}
+
+		if size := cache.Size(); size != 0 {
+			t.Fatalf("%s: size %d != 0", name, size)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -run=^TestCacheUpdate$
+func TestCacheUpdate(t *testing.T) {
+	increase := func(oldValue interface{}, exists bool) (newValue interface{}, ttl time.Duration, keep bool) {
+		if !exists {
+			return 1, NoTTL, true
+		}
+
+		return oldValue.(int) + 1, NoTTL, true
+	}
+
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithShardings(4), WithGC(0))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 100; j++ {
+					cache.Update("counter", increase)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if value, _ := cache.Get("counter", nil); value != 1000 {
+			t.Fatalf("%s: value %v != 1000", name, value)
+		}
+
+		newValue, kept := cache.Update("counter", func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+			return nil, NoTTL, false
+		})
+
+		if newValue != nil || kept {
+			t.Fatalf("%s: newValue %v kept %v is wrong", name, newValue, kept)
+		}
+
+		if _, found := cache.Get("counter", nil); found {
+			t.Fatalf("%s: counter should be removed", name)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheUpdateKeepTTL$
+func TestCacheUpdateKeepTTL(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	keep := func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		return "value2", KeepTTL, true
+	}
+
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithShardings(4), WithGC(0), WithNow(fakeClock.Now))
+		cache.Set("key", "value1", 2*time.Second)
+		cache.Set("forever", "value1", NoTTL)
+
+		fakeClock.Advance(time.Second)
+		cache.Update("key", keep)
+		cache.Update("forever", keep)
+
+		if value, _ := cache.Get("key", nil); value != "value2" {
+			t.Fatalf("%s: value %v != value2", name, value)
+		}
+
+		fakeClock.Advance(1500 * time.Millisecond)
+		if _, found := cache.Get("key", nil); found {
+			t.Fatalf("%s: key should be expired", name)
+		}
+
+		if value, _ := cache.Get("forever", nil); value != "value2" {
+			t.Fatalf("%s: value %v != value2", name, value)
+		}
+
+		cache.Close()
+	}
+}
@@ -0,0 +1,91 @@
+package memcache
+
+import (
+	"container/list"
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+const (
+	// readStripeSize is the count of accesses a stripe can buffer before a batch is returned.
+	readStripeSize = 16
+)
+
+type readStripe struct {
+	lock     sync.Mutex
+	elements [readStripeSize]*list.Element
+	count    int
+}
+
+// readBuffer is a striped lossy buffer recording accesses of lru elements.
+// Accesses are recorded with a read lock of cache and applied in batches with its write lock,
+// so hits don't need to serialize on the write lock for moving elements.
+// An access is dropped if its stripe is busy, which only makes lru a bit less exact.
+type readBuffer struct {
+	stripes []readStripe
+	shift   uint
+}
+
+func newReadBuffer() *readBuffer {
+	stripes := 1
+	for stripes < runtime.GOMAXPROCS(0) {
+		stripes <<= 1
+	}
+
+	return &readBuffer{
+		stripes: make([]readStripe, stripes),
+		shift:   uint(64 - bits.TrailingZeros(uint(stripes))),
+	}
+}
+
+func (rb *readBuffer) stripeOf(hash int) *readStripe {
+	if len(rb.stripes) <= 1 {
+		return &rb.stripes[0]
+	}
+
+	// Use the high bits of a fibonacci hash, because the low bits are the same in one sharding.
+	index := (uint64(hash) * 0x9E3779B97F4A7C15) >> rb.shift
+	return &rb.stripes[index]
+}
+
+// record records an access of element and returns a batch if the stripe is full.
+// The returned batch should be applied with the write lock of cache.
+func (rb *readBuffer) record(hash int, element *list.Element) (batch []*list.Element) {
+	stripe := rb.stripeOf(hash)
+	if !stripe.lock.TryLock() {
+		return nil
+	}
+
+	defer stripe.lock.Unlock()
+
+	stripe.elements[stripe.count] = element
+	stripe.count++
+
+	if stripe.count < readStripeSize {
+		return nil
+	}
+
+	batch = make([]*list.Element, readStripeSize)
+	copy(batch, stripe.elements[:])
+
+	stripe.elements = [readStripeSize]*list.Element{}
+	stripe.count = 0
+	return batch
+}
+
+// drain calls fn with all buffered elements and clears the buffer.
+func (rb *readBuffer) drain(fn func(element *list.Element)) {
+	for i := range rb.stripes {
+		stripe := &rb.stripes[i]
+		stripe.lock.Lock()
+
+		for j := 0; j < stripe.count; j++ {
+			fn(stripe.elements[j])
+			stripe.elements[j] = nil
+		}
+
+		stripe.count = 0
+		stripe.lock.Unlock()
+	}
+}
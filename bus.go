@@ -0,0 +1,78 @@
+package memcache
+
+import (
+	"sync"
+)
+
+// Invalidation is a message telling subscribers to remove some keys from their near caches.
+// Keys, Prefix and Match are all applied, and All removes all keys.
+type Invalidation struct {
+	// Source is the id of cache publishing it, so the cache can skip its own invalidations.
+	Source string
+
+	Keys   []string
+	Prefix string
+	Match  string
+	All    bool
+}
+
+// InvalidationBus delivers invalidations to all subscribers, which may be in other processes.
+// See TieredCache and MemoryBus.
+type InvalidationBus interface {
+	// Publish publishes invalidation to all subscribers.
+	Publish(invalidation Invalidation) error
+
+	// Subscribe subscribes invalidations with fn and returns a function to unsubscribe.
+	// fn should return quickly because it may be called in the publishing goroutine.
+	Subscribe(fn func(invalidation Invalidation)) (unsubscribe func())
+}
+
+// MemoryBus is an invalidation bus in memory, which delivers invalidations to subscribers in the same process.
+// It's useful in tests or for caches sharing an l2 cache in one process.
+type MemoryBus struct {
+	subscribers map[uint64]func(invalidation Invalidation)
+	nextID      uint64
+	lock        sync.RWMutex
+}
+
+// NewMemoryBus returns an invalidation bus in memory.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		subscribers: make(map[uint64]func(invalidation Invalidation)),
+	}
+}
+
+// Publish delivers invalidation to all subscribers synchronously.
+// See InvalidationBus.
+func (mb *MemoryBus) Publish(invalidation Invalidation) error {
+	mb.lock.RLock()
+	subscribers := make([]func(invalidation Invalidation), 0, len(mb.subscribers))
+	for _, fn := range mb.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	mb.lock.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(invalidation)
+	}
+
+	return nil
+}
+
+// Subscribe subscribes invalidations with fn and returns a function to unsubscribe.
+// See InvalidationBus.
+func (mb *MemoryBus) Subscribe(fn func(invalidation Invalidation)) (unsubscribe func()) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	id := mb.nextID
+	mb.nextID++
+	mb.subscribers[id] = fn
+
+	return func() {
+		mb.lock.Lock()
+		defer mb.lock.Unlock()
+
+		delete(mb.subscribers, id)
+	}
+}
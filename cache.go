@@ -3,20 +3,30 @@ package memcache
 import (
 	"context"
 	"fmt"
+	"io"
+	"math"
 	"time"
 
+	"github.com/xd-luqiang/memcache/pkg/clock"
 	"github.com/xd-luqiang/memcache/pkg/task"
 )
 
 const (
 	// NoTTL means a key is never expired.
 	NoTTL = 0
+
+	// KeepTTL can be returned by UpdateFunc to keep the remaining ttl of key.
+	// A key not existing before updating is set with the default ttl just like Set without ttl.
+	KeepTTL = time.Duration(math.MinInt64)
 )
 
 var (
 	newCaches = map[CacheType]func(conf *config) Cache{
 		// standard: newStandardCache,
-		lru: newLRUCache,
+		lru:    newLRUCache,
+		arc:    newARCCache,
+		s3fifo: newS3FIFOCache,
+		sieve:  newSieveCache,
 		// lfu:      newLFUCache,
 	}
 )
@@ -37,10 +47,99 @@ type Cache interface {
 	Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{})
 	MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{})
 
+	// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+	// The tags of key are replaced by tags, and Set won't change the tags of key unless key has expired.
+	// Use InvalidateTag to remove all keys having a tag.
+	SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{})
+
+	// InvalidateTag removes all keys having tag and returns the count of unexpired keys removed.
+	// Tags of keys are cleaned when keys are removed, evicted or expired.
+	InvalidateTag(tag string) (removed int)
+
 	// Remove removes key and returns the removed value of key.
 	// A nil value will be returned if key doesn't exist in cache.
 	Remove(key string) (removedValue interface{})
 
+	// RemovePrefix removes all keys starting with prefix and returns the count of unexpired keys removed.
+	// It scans all keys unless the prefix index is enabled, see WithPrefixIndex.
+	RemovePrefix(prefix string) (removed int)
+
+	// RemoveMatch removes all keys matching the glob pattern and returns the count of unexpired keys removed.
+	// Only keys starting with the literal prefix of pattern will be checked if the prefix index is enabled.
+	// See Scan for the syntax of pattern.
+	RemoveMatch(pattern string) (removed int)
+
+	// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+	// loaded reports if the value is got from cache.
+	GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool)
+
+	// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+	// The ttl of key won't be changed.
+	// Notice that oldValue must be comparable, or it panics just like comparing two interfaces.
+	CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool)
+
+	// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+	// Notice that oldValue must be comparable, or it panics just like comparing two interfaces.
+	CompareAndDelete(key string, oldValue interface{}) (deleted bool)
+
+	// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+	// fn is called with the lock of cache held, so don't use cache in fn.
+	// fn can return KeepTTL to keep the remaining ttl of key.
+	Update(key string, fn UpdateFunc) (newValue interface{}, kept bool)
+
+	// Incr increases the value of key by 1 and returns the new value.
+	// See IncrBy.
+	Incr(key string, ttl ...time.Duration) (value int64, err error)
+
+	// Decr decreases the value of key by 1 and returns the new value.
+	// See IncrBy.
+	Decr(key string, ttl ...time.Duration) (value int64, err error)
+
+	// IncrBy increases the value of key by delta atomically and returns the new value.
+	// A missing key will be set to delta, and ErrNotNumeric will be returned if the value isn't an int64.
+	// ErrOverflow will be returned and the value is kept if the new value overflows int64.
+	// The ttl of key is kept unless ttl is specified, and the new value is stored as int64.
+	IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error)
+
+	// IncrByFloat increases the value of key by delta atomically and returns the new value.
+	// It's the same as IncrBy except that the new value is stored as float64.
+	IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error)
+
+	// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+	// fn is called with a snapshot of entries and without any locks held, so it's ok to use cache in fn.
+	Range(fn RangeFunc)
+
+	// Keys returns all unexpired keys in cache.
+	Keys() (keys []string)
+
+	// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+	// Scanning starts with cursor 0 and finishes when the next cursor returned is 0.
+	// All keys existing during the whole scanning will be returned exactly once, and no locks are held between calls.
+	// Count is about how many keys a call visits like redis, so a call may return fewer keys or none before finishing.
+	// A call walks all entries unless cache has a scan index, see WithScanIndex.
+	// An empty match matches all keys, and a non-positive count uses a default count.
+	Scan(cursor uint64, match string, count int) (keys []string, next uint64)
+
+	// Namespace returns a view of cache whose keys are prefixed with name and a separator ":".
+	// All namespaces share the capacity of cache, and Size, Reset and stats of a namespace only count its keys.
+	// See Reporter.Namespaces for stats of namespaces.
+	// The optional quota limits the count of keys in namespace, and the coldest keys of namespace are
+	// evicted when setting keys through namespace exceeds the quota.
+	// Views of the same name share one namespace, and a non-empty quota replaces the quota of namespace.
+	Namespace(name string, quota ...int) Cache
+
+	// Flush writes all pending writes to the backing store and returns the error if failed.
+	// It does nothing if cache has no store in write-behind mode, see WithWriteBehind.
+	Flush() error
+
+	// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+	// Values are encoded by the codec of cache, see WithCodec.
+	SaveSnapshot(w io.Writer) error
+
+	// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+	// The snapshot is versioned and checksummed, and nothing is set if it's corrupted.
+	LoadSnapshot(r io.Reader) error
+
 	// Size returns the count of keys in cache.
 	// The result may be different in different implements.
 	Size() (size int)
@@ -52,6 +151,10 @@ type Cache interface {
 	// Reset resets cache to initial status which is like a new cache.
 	Reset()
 
+	// Close closes cache and stops all background goroutines of cache like gc task.
+	// A closed cache does nothing and returns zero values, and closing it again returns ErrClosed.
+	Close() error
+
 	// Load loads a key with ttl to cache and returns an error if failed.
 	// We recommend you use this method to load missed keys to cache,
 	// because it may use singleflight to reduce the times calling load function.
@@ -68,21 +171,75 @@ func newCache(withReport bool, opts ...Option) (cache Cache, reporter *Reporter)
 		return nil, nil
 	}
 
+	if conf.overflowPath != "" {
+		if conf.cacheType != lru {
+			panic("cachego: overflow only supports lru cache")
+		}
+
+		overflow, err := openOverflowStore(conf)
+		if err != nil {
+			if conf.overflowError == nil {
+				panic("cachego: failed to open overflow: " + err.Error())
+			}
+
+			conf.overflowError(err)
+		}
+
+		conf.overflow = overflow
+	}
+
 	if conf.shardings > 0 {
 		cache = newShardingCache(conf, newCache)
 	} else {
 		cache = newCache(conf)
 	}
 
+	var logged *logCache
+	if conf.logPath != "" {
+		logged = newLogCache(conf, cache)
+		cache = logged
+	}
+
+	var stored *storeCache
+	if conf.store != nil {
+		stored = newStoreCache(conf, cache)
+		cache = stored
+	}
+
 	if withReport {
 		cache, reporter = report(conf, cache)
 	}
 
+	closable := newClosableCache(conf, cache)
 	if conf.gcDuration > 0 {
-		RunGCTask(cache, conf.gcDuration)
+		closable.onClose(runGCTask(cache, conf.gcDuration, conf.newTicker))
+	}
+
+	if stored != nil && conf.writeBehind {
+		closable.onClose(stored.runFlushTask())
+	}
+
+	// Saving a snapshot truncates the log, because the snapshot has the states of older records.
+	if conf.snapshotPath != "" {
+		var checkpoint func() (finish func(saved bool))
+		if logged != nil {
+			checkpoint = logged.checkpoint
+		}
+
+		closable.onClose(runSnapshotTask(conf, cache, checkpoint))
+	}
+
+	// The log is opened after loading the snapshot, so it only replays mutations after the snapshot.
+	if logged != nil {
+		closable.onClose(logged.run())
+	}
+
+	// Cancels are called in order, so overflow is closed after all tasks which may use cache are stopped.
+	if conf.overflow != nil {
+		closable.onClose(conf.overflow.close)
 	}
 
-	return cache, reporter
+	return closable, reporter
 }
 
 // NewCache creates a cache with options.
@@ -108,9 +265,14 @@ func NewCacheWithReport(opts ...Option) (cache Cache, reporter *Reporter) {
 // RunGCTask runs a gc task in a new goroutine and returns a cancel function to cancel the task.
 // However, you don't need to call it manually for most time, instead, use options is a better choice.
 // Making it a public function is for more customizations in some situations.
-// For example, using options to run gc task is un-cancelable, so you can use it to run gc task by your own
+// For example, you can use it to run gc task with a different duration by your own
 // and get a cancel function to cancel the gc task.
+// Notice that the gc task run by options will be canceled when closing cache, see Cache.Close.
 func RunGCTask(cache Cache, duration time.Duration) (cancel func()) {
+	return runGCTask(cache, duration, clock.NewTicker)
+}
+
+func runGCTask(cache Cache, duration time.Duration, newTicker func(duration time.Duration) clock.Ticker) (cancel func()) {
 	fn := func(ctx context.Context) {
 		cache.GC()
 	}
@@ -118,6 +280,6 @@ func RunGCTask(cache Cache, duration time.Duration) (cancel func()) {
 	ctx := context.Background()
 	ctx, cancel = context.WithCancel(ctx)
 
-	go task.New(fn).Context(ctx).Duration(duration).Run()
+	task.New(fn).Context(ctx).Duration(duration).Ticker(newTicker).Start()
 	return cancel
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
 )
 
 func testDeserializeFunc(key string, data []byte) interface{} {
@@ -23,8 +25,9 @@ func testLoadfunc(keys []string, deserializeF DeserializeFunc) ([]interface{}, e
 }
 
 func TestNewCache(t *testing.T) {
-	cache, reporter := NewCacheWithReport(WithCacheName("test"), WithShardings(4), WithLRU(4), WithGC(0), WithExpire(5*time.Second), WithProtect(time.Second), withLoadFunc(testLoadfunc))
-	cancell := RunGCTask(cache, 500*time.Millisecond)
+	fakeClock := clock.NewFake(time.Now())
+	cache, reporter := NewCacheWithReport(WithCacheName("test"), WithShardings(4), WithLRU(4), WithGC(500*time.Millisecond), WithExpire(5*time.Second), WithProtect(time.Second), WithLoadFunc(testLoadfunc),
+		WithNow(fakeClock.Now), WithNewTicker(fakeClock.NewTicker))
 	keys := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
 	vals := []interface{}{1, 2, 3, nil, 5, nil, 7, 8}
 	cache.MSet(keys, vals)
@@ -33,23 +36,90 @@ func TestNewCache(t *testing.T) {
 	values, founds := cache.MGet(qkeys, testDeserializeFunc)
 	t.Logf("cache.Get %v", values)
 	t.Logf("cache.Get %v", founds)
-	// t.Logf("cache.Size() %v", cache.Size())
 
-	time.Sleep(1*time.Second + 100*time.Millisecond)
+	fakeClock.Advance(1*time.Second + 100*time.Millisecond)
 	values, founds = cache.MGet(qkeys, testDeserializeFunc)
 	t.Logf("cache.Get %v", values)
 	t.Logf("cache.Get %v", founds)
-	// t.Logf("cache.Size() %v", cache.Size())
 
-	// time.Sleep(4 * time.Second)
-	// t.Logf("cache.Size() %v", cache.Size())
+	t.Logf("cache.MissedRate() %v", reporter.MissedRate())
+}
 
-	cancell()
-	// t.Logf("cache.Size() %v", cache.Size())
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheTTLLifecycle$
+func TestCacheTTLLifecycle(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	cache, reporter := NewCacheWithReport(WithLRU(16), WithShardings(2), WithGC(time.Minute), WithNow(fakeClock.Now), WithNewTicker(fakeClock.NewTicker))
+	defer cache.Close()
 
-	// // t.Logf("cache.CacheName() %v", reporter.CacheName())
-	// // t.Logf("cache.CacheType() %v", reporter.CacheType())
-	// // t.Logf("cache.CacheShardings() %v", reporter.CacheShardings())
-	// t.Logf("cache.Size() %v", cache.Size())
-	t.Logf("cache.MissedRate() %v", reporter.MissedRate())
+	cache.Set("short", "value", time.Second)
+	cache.Set("long", "value", time.Hour)
+	cache.Set("forever", "value", NoTTL)
+
+	fakeClock.Advance(time.Second - time.Nanosecond)
+	if _, found := cache.Get("short", nil); !found {
+		t.Fatal("short should be found before its ttl")
+	}
+
+	fakeClock.Advance(2 * time.Nanosecond)
+	if _, found := cache.Get("short", nil); found {
+		t.Fatal("short should be expired after its ttl")
+	}
+
+	// Expired keys are still in cache until gc runs.
+	if size := cache.Size(); size != 3 {
+		t.Fatalf("size %d != 3", size)
+	}
+
+	fakeClock.Advance(time.Minute)
+	if size := cache.Size(); size != 2 {
+		t.Fatalf("size %d != 2", size)
+	}
+
+	fakeClock.Advance(time.Hour)
+	if size := cache.Size(); size != 1 {
+		t.Fatalf("size %d != 1", size)
+	}
+
+	if gcs := reporter.CountGC(); gcs != 61 {
+		t.Fatalf("gcs %d != 61", gcs)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNewCacheWithFastClock$
+func TestNewCacheWithFastClock(t *testing.T) {
+	precision := 10 * time.Millisecond
+
+	conf := newDefaultConfig()
+	WithFastClock(precision)(conf)
+	defer conf.clock.Stop()
+
+	if conf.clock.Duration() != precision {
+		t.Fatalf("conf.clock.Duration() %s != %s", conf.clock.Duration(), precision)
+	}
+
+	// A fast clock caches time and updates it every precision, so it's faked by truncating time to precision.
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	now := func() int64 {
+		now := fakeClock.Now()
+		return now - now%int64(precision)
+	}
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithNow(now))
+	defer cache.Close()
+
+	// Setting key in the middle of a precision makes the cached time lag behind.
+	fakeClock.Advance(precision / 2)
+
+	ttl := 500 * time.Millisecond
+	cache.Set("key", "value", ttl)
+
+	fakeClock.Advance(ttl - precision)
+	if _, found := cache.Get("key", nil); !found {
+		t.Fatal("key should be found at ttl - precision")
+	}
+
+	fakeClock.Advance(2 * precision)
+	if _, found := cache.Get("key", nil); found {
+		t.Fatal("key should be expired by ttl + precision")
+	}
 }
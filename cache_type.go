@@ -12,6 +12,21 @@ const (
 	// lfu cache is a cache using lfu to evict entries.
 	// More details see https://en.wikipedia.org/wiki/Cache_replacement_policies#Least-frequently_used_(LFU).
 	lfu CacheType = "lfu"
+
+	// arc cache is a cache using arc to evict entries.
+	// It balances recency and frequency adaptively, so it doesn't need any tuning.
+	// More details see https://en.wikipedia.org/wiki/Adaptive_replacement_cache.
+	arc CacheType = "arc"
+
+	// s3fifo cache is a cache using three fifo queues to evict entries.
+	// Hits don't reorder entries, so getting only needs a read lock.
+	// More details see https://s3fifo.com.
+	s3fifo CacheType = "s3fifo"
+
+	// sieve cache is a cache using a fifo queue and a moving hand to evict entries.
+	// Hits don't reorder entries, so getting only needs a read lock.
+	// More details see https://cachemon.github.io/SIEVE-website.
+	sieve CacheType = "sieve"
 )
 
 // CacheType is the type of cache.
@@ -36,3 +51,18 @@ func (ct CacheType) IsLRU() bool {
 func (ct CacheType) IsLFU() bool {
 	return ct == lfu
 }
+
+// IsARC returns if cache type is arc.
+func (ct CacheType) IsARC() bool {
+	return ct == arc
+}
+
+// IsS3FIFO returns if cache type is s3fifo.
+func (ct CacheType) IsS3FIFO() bool {
+	return ct == s3fifo
+}
+
+// IsSieve returns if cache type is sieve.
+func (ct CacheType) IsSieve() bool {
+	return ct == sieve
+}
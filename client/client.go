@@ -0,0 +1,775 @@
+// Package client provides a cache served by a remote server over memcached protocol.
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+var (
+	// ErrUnsupported is reported when using an operation which can't be done over memcached protocol.
+	ErrUnsupported = errors.New("cachego: operation is unsupported by client")
+
+	// ErrConflict is returned when key is changed by others in all retries of updating it with cas.
+	ErrConflict = errors.New("cachego: key is changed by others too often")
+
+	errMismatch = errors.New("cachego: keys and values must have the same length")
+)
+
+const (
+	// maxCASRetries is the max times of updating a key with cas.
+	maxCASRetries = 32
+)
+
+// item is the value of key got from server.
+type item struct {
+	value interface{}
+	found bool
+	cas   uint64
+	ttl   time.Duration
+}
+
+// Client is a cache served by a remote server over memcached meta protocol, see the server package.
+// It implements memcache.Cache, so code can switch between local and remote caches without changes.
+//
+// Values are stored with flags telling their types, so bytes, strings, int64 and float64 are got in the same types,
+// and other values are encoded by the codec, see WithCodec. Values stored by other clients are got as bytes.
+// Ttls are rounded up to seconds, which is the precision of memcached protocol.
+// Keys set without ttls expire after 60s like memcache.NewCache, see WithExpire.
+//
+// Methods which can't return errors report them to the error function and return zero values, see WithError.
+// Enumerating keys, tags and snapshots can't be done over memcached protocol, so Keys, Scan, Range, RemovePrefix,
+// RemoveMatch, InvalidateTag, SaveSnapshot, LoadSnapshot and the tags of SetWithTags report ErrUnsupported.
+type Client struct {
+	*config
+
+	pool *pool
+
+	// prefix is the prefix of keys in namespace, and it's empty if client isn't a namespace.
+	prefix string
+}
+
+// New returns a client of the server listening on the address of network with options.
+// Network can be "tcp" or "unix", see net.Dial.
+// Connections are dialed when using, so New won't fail even if server isn't reachable.
+func New(network string, address string, opts ...Option) *Client {
+	conf := newDefaultConfig()
+	applyOptions(conf, opts)
+
+	dialConn := func() (*conn, error) {
+		return dial(network, address, conf.dialTimeout)
+	}
+
+	return &Client{
+		config: conf,
+		pool:   newPool(dialConn, conf.maxIdleConns),
+	}
+}
+
+// report reports err to the error function if err isn't nil.
+func (c *Client) report(err error) {
+	if err != nil && c.onError != nil {
+		c.onError(err)
+	}
+}
+
+// isBroken reports if err means the connection is closed by server, which happens to idle connections
+// if server restarts or closes idle connections.
+func isBroken(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// do calls fn with a connection of pool and puts the connection back after calling.
+// An idempotent fn is retried once with a new connection if an idle connection is broken, so clients reconnect automatically.
+// Other requests aren't retried because server may have done them before the connection is broken.
+func (c *Client) do(idempotent bool, fn func(cn *conn) error) error {
+	for retried := false; ; retried = true {
+		cn, reused, err := c.pool.get()
+		if err != nil {
+			return err
+		}
+
+		cn.setTimeout(c.timeout)
+
+		err = fn(cn)
+		c.pool.put(cn, err)
+
+		if err == nil || !idempotent || !reused || retried || !isBroken(err) {
+			return err
+		}
+	}
+}
+
+// getItems gets the items of keys, and all gets are pipelined in one round trip.
+func (c *Client) getItems(keys []string) (items []item, err error) {
+	var decodeErr error
+
+	err = c.do(true, func(cn *conn) error {
+		items = make([]item, len(keys))
+		decodeErr = nil
+
+		for _, key := range keys {
+			if err := cn.writeGet(c.prefix + key); err != nil {
+				return err
+			}
+		}
+
+		if err := cn.flush(); err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			resp, err := cn.readResponse()
+			if err != nil {
+				return err
+			}
+
+			if resp.code == codeMissed {
+				continue
+			}
+
+			if resp.code != codeValue {
+				return errBadResponse
+			}
+
+			// A value which can't be decoded is treated as missing, and the rest responses are still read.
+			value, err := c.decode(key, resp.value, resp.flags)
+			if err != nil {
+				decodeErr = err
+				continue
+			}
+
+			items[i] = item{value: value, found: true, cas: resp.cas, ttl: resp.ttl}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return items, decodeErr
+}
+
+// setItems sets the values of keys with their ttls, and all sets are pipelined in one round trip.
+// Keys, values and ttls must have the same length.
+func (c *Client) setItems(keys []string, values []interface{}, ttls []time.Duration) error {
+	if len(values) != len(keys) || len(ttls) != len(keys) {
+		return errMismatch
+	}
+
+	data := make([][]byte, len(keys))
+	flags := make([]uint32, len(keys))
+
+	for i, value := range values {
+		var err error
+		if data[i], flags[i], err = c.encode(value); err != nil {
+			return err
+		}
+	}
+
+	// Setting the same values again is harmless, so sets are idempotent.
+	return c.do(true, func(cn *conn) error {
+		for i, key := range keys {
+			if err := cn.writeSet(c.prefix+key, data[i], flags[i], ttls[i], modeSet, 0); err != nil {
+				return err
+			}
+		}
+
+		if err := cn.flush(); err != nil {
+			return err
+		}
+
+		for range keys {
+			resp, err := cn.readResponse()
+			if err != nil {
+				return err
+			}
+
+			if resp.code != codeHeader {
+				return errBadResponse
+			}
+		}
+
+		return nil
+	})
+}
+
+// request writes a request by write and returns its response, and the request isn't retried.
+func (c *Client) request(write func(cn *conn) error) (resp response, err error) {
+	err = c.do(false, func(cn *conn) error {
+		if err := write(cn); err != nil {
+			return err
+		}
+
+		if err := cn.flush(); err != nil {
+			return err
+		}
+
+		resp, err = cn.readResponse()
+		return err
+	})
+
+	return resp, err
+}
+
+// store stores value to key with ttl by mode, and zero cas means no comparing.
+func (c *Client) store(key string, value interface{}, ttl time.Duration, mode byte, cas uint64) (code string, err error) {
+	data, flags, err := c.encode(value)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.request(func(cn *conn) error {
+		return cn.writeSet(c.prefix+key, data, flags, ttl, mode, cas)
+	})
+
+	return resp.code, err
+}
+
+// casUpdate updates the item of key by fn with its cas, and it's retried if key is changed by others before updating.
+// fn returns the new item of key and reports if key should be changed, and a new item not found removes key.
+// ErrConflict is returned if key is still changed by others after maxCASRetries times.
+func (c *Client) casUpdate(key string, fn func(old item) (newItem item, change bool, err error)) error {
+	for i := 0; i < maxCASRetries; i++ {
+		items, err := c.getItems([]string{key})
+		if err != nil {
+			return err
+		}
+
+		old := items[0]
+
+		newItem, change, err := fn(old)
+		if err != nil || !change {
+			return err
+		}
+
+		var code string
+		switch {
+		case !newItem.found && !old.found:
+			return nil
+		case !newItem.found:
+			var resp response
+			resp, err = c.request(func(cn *conn) error {
+				return cn.writeDelete(c.prefix+key, old.cas)
+			})
+
+			code = resp.code
+		case !old.found:
+			code, err = c.store(key, newItem.value, newItem.ttl, modeAdd, 0)
+		default:
+			code, err = c.store(key, newItem.value, newItem.ttl, modeSet, old.cas)
+		}
+
+		if err != nil || code == codeHeader {
+			return err
+		}
+	}
+
+	return ErrConflict
+}
+
+// valueEqual reports if value equals other, and bytes are compared by their contents.
+// It panics if values aren't comparable just like comparing two interfaces.
+func valueEqual(value interface{}, other interface{}) bool {
+	if data, ok := value.([]byte); ok {
+		otherData, ok := other.([]byte)
+		return ok && bytes.Equal(data, otherData)
+	}
+
+	return value == other
+}
+
+// ttlOf returns the first ttl or the expire time if ttl is empty.
+func (c *Client) ttlOf(ttl []time.Duration) time.Duration {
+	if len(ttl) > 0 {
+		return ttl[0]
+	}
+
+	return c.expireTime
+}
+
+// Get gets the value of key from server and returns value if found.
+// deserializeF is unused because client has no load function.
+// See memcache.Cache.
+func (c *Client) Get(key string, deserializeF memcache.DeserializeFunc) (value interface{}, found bool) {
+	items, err := c.getItems([]string{key})
+	if err != nil {
+		c.report(err)
+		return nil, false
+	}
+
+	return items[0].value, items[0].found
+}
+
+// MGet gets the values of keys from server in one round trip.
+// See memcache.Cache.
+func (c *Client) MGet(keys []string, deserializeF memcache.DeserializeFunc) (values []interface{}, founds []bool) {
+	values = make([]interface{}, len(keys))
+	founds = make([]bool, len(keys))
+
+	items, err := c.getItems(keys)
+	if err != nil {
+		c.report(err)
+		return values, founds
+	}
+
+	for i, item := range items {
+		values[i], founds[i] = item.value, item.found
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to server with ttl, and the evicted value is always nil because server doesn't tell it.
+// See memcache.Cache.
+func (c *Client) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	c.report(c.setItems([]string{key}, []interface{}{value}, []time.Duration{c.ttlOf(ttl)}))
+	return nil
+}
+
+// MSet sets keys and values to server with their ttls in one round trip.
+// Keys without ttls expire after the expire time, and nothing is set if keys and values have different lengths.
+// See memcache.Cache.
+func (c *Client) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	if len(keys) != len(values) {
+		c.report(errMismatch)
+		return nil
+	}
+
+	keyTTLs := make([]time.Duration, len(keys))
+	for i := range keys {
+		if i < len(ttls) {
+			keyTTLs[i] = ttls[i]
+		} else {
+			keyTTLs[i] = c.expireTime
+		}
+	}
+
+	c.report(c.setItems(keys, values, keyTTLs))
+	return make([]interface{}, len(keys))
+}
+
+// SetWithTags sets key and value to server with ttl, and tags are unsupported.
+// See memcache.Cache.
+func (c *Client) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	if len(tags) > 0 {
+		c.report(ErrUnsupported)
+	}
+
+	return c.Set(key, value, ttl)
+}
+
+// InvalidateTag is unsupported.
+// See memcache.Cache.
+func (c *Client) InvalidateTag(tag string) (removed int) {
+	c.report(ErrUnsupported)
+	return 0
+}
+
+// Remove removes key and returns the removed value of key.
+// The value is got right before removing in the same round trip, so it may be stale if key is set by others at the time.
+// See memcache.Cache.
+func (c *Client) Remove(key string) (removedValue interface{}) {
+	var got response
+
+	err := c.do(false, func(cn *conn) error {
+		if err := cn.writeGet(c.prefix + key); err != nil {
+			return err
+		}
+
+		if err := cn.writeDelete(c.prefix+key, 0); err != nil {
+			return err
+		}
+
+		if err := cn.flush(); err != nil {
+			return err
+		}
+
+		var err error
+		if got, err = cn.readResponse(); err != nil {
+			return err
+		}
+
+		resp, err := cn.readResponse()
+		if err != nil {
+			return err
+		}
+
+		if resp.code != codeHeader && resp.code != codeNotFound {
+			return errBadResponse
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		c.report(err)
+		return nil
+	}
+
+	if got.code != codeValue {
+		return nil
+	}
+
+	removedValue, err = c.decode(key, got.value, got.flags)
+	if err != nil {
+		c.report(err)
+		return nil
+	}
+
+	return removedValue
+}
+
+// RemovePrefix is unsupported.
+// See memcache.Cache.
+func (c *Client) RemovePrefix(prefix string) (removed int) {
+	c.report(ErrUnsupported)
+	return 0
+}
+
+// RemoveMatch is unsupported.
+// See memcache.Cache.
+func (c *Client) RemoveMatch(pattern string) (removed int) {
+	c.report(ErrUnsupported)
+	return 0
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to server with ttl and returns it.
+// See memcache.Cache.
+func (c *Client) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	err := c.casUpdate(key, func(old item) (item, bool, error) {
+		if old.found {
+			actual, loaded = old.value, true
+			return old, false, nil
+		}
+
+		actual, loaded = value, false
+		return item{value: value, found: true, ttl: c.ttlOf(ttl)}, true, nil
+	})
+
+	if err != nil {
+		c.report(err)
+		return nil, false
+	}
+
+	return actual, loaded
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See memcache.Cache.
+func (c *Client) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	err := c.casUpdate(key, func(old item) (item, bool, error) {
+		swapped = old.found && valueEqual(old.value, oldValue)
+		return item{value: newValue, found: true, ttl: old.ttl}, swapped, nil
+	})
+
+	if err != nil {
+		c.report(err)
+		return false
+	}
+
+	return swapped
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See memcache.Cache.
+func (c *Client) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	err := c.casUpdate(key, func(old item) (item, bool, error) {
+		deleted = old.found && valueEqual(old.value, oldValue)
+		return item{}, deleted, nil
+	})
+
+	if err != nil {
+		c.report(err)
+		return false
+	}
+
+	return deleted
+}
+
+// Update updates the value of key by fn atomically with cas and returns the new value and if key is kept.
+// fn may be called more than once if key is changed by others before updating.
+// See memcache.Cache.
+func (c *Client) Update(key string, fn memcache.UpdateFunc) (newValue interface{}, kept bool) {
+	err := c.casUpdate(key, func(old item) (item, bool, error) {
+		value, ttl, keep := fn(old.value, old.found)
+
+		newValue, kept = nil, false
+		if !keep {
+			return item{}, old.found, nil
+		}
+
+		// The remaining ttl of key is kept by writing it back, which is rounded to seconds.
+		if ttl == memcache.KeepTTL {
+			ttl = c.ttlOf(nil)
+			if old.found {
+				ttl = old.ttl
+			}
+		}
+
+		newValue, kept = value, true
+		return item{value: value, found: true, ttl: ttl}, true, nil
+	})
+
+	if err != nil {
+		c.report(err)
+		return nil, false
+	}
+
+	return newValue, kept
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See memcache.Cache.
+func (c *Client) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return c.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See memcache.Cache.
+func (c *Client) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return c.IncrBy(key, -1, ttl...)
+}
+
+// incr increases the value of key by delta on server and returns the new value.
+// ok reports false if the value isn't an unsigned number, which can't be increased by server.
+func (c *Client) incr(key string, delta uint64, ttl []time.Duration) (value int64, ok bool, err error) {
+	for i := 0; i < maxCASRetries; i++ {
+		resp, err := c.request(func(cn *conn) error {
+			return cn.writeIncr(c.prefix+key, delta, ttl)
+		})
+
+		if err != nil {
+			return 0, true, err
+		}
+
+		switch resp.code {
+		case codeValue:
+			n, err := strconv.ParseUint(string(resp.value), 10, 64)
+			if err != nil {
+				return 0, true, errBadResponse
+			}
+
+			if n <= math.MaxInt64 {
+				return int64(n), true, nil
+			}
+
+			// The new value overflows int64, so the increase is reverted.
+			_, err = c.request(func(cn *conn) error {
+				return cn.writeDecr(c.prefix+key, delta)
+			})
+
+			if err != nil {
+				return 0, true, err
+			}
+
+			return 0, true, memcache.ErrOverflow
+		case codeNonNumeric:
+			return 0, false, nil
+		case codeNotFound:
+			// Missing keys are added as int64, and it's retried if key is added by others.
+			code, err := c.store(key, int64(delta), c.ttlOf(ttl), modeAdd, 0)
+			if err != nil || code == codeHeader {
+				return int64(delta), true, err
+			}
+		default:
+			return 0, true, errBadResponse
+		}
+	}
+
+	return 0, true, ErrConflict
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// Non-negative deltas are increased by server in one round trip, and others are updated with cas because
+// server only stores unsigned numbers and stops decreasing at zero.
+// See memcache.Cache.
+func (c *Client) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	if delta >= 0 {
+		value, ok, err := c.incr(key, uint64(delta), ttl)
+		if ok {
+			return value, err
+		}
+	}
+
+	err = c.casUpdate(key, func(old item) (item, bool, error) {
+		if !old.found {
+			value = delta
+			return item{value: value, found: true, ttl: c.ttlOf(ttl)}, true, nil
+		}
+
+		n, err := toInt64(old.value)
+		if err != nil {
+			return item{}, false, err
+		}
+
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return item{}, false, memcache.ErrOverflow
+		}
+
+		value = n + delta
+		if len(ttl) > 0 {
+			old.ttl = ttl[0]
+		}
+
+		return item{value: value, found: true, ttl: old.ttl}, true, nil
+	})
+
+	return value, err
+}
+
+// IncrByFloat increases the value of key by delta atomically with cas and returns the new value.
+// See memcache.Cache.
+func (c *Client) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	err = c.casUpdate(key, func(old item) (item, bool, error) {
+		if !old.found {
+			value = delta
+			return item{value: value, found: true, ttl: c.ttlOf(ttl)}, true, nil
+		}
+
+		n, err := toFloat64(old.value)
+		if err != nil {
+			return item{}, false, err
+		}
+
+		value = n + delta
+		if len(ttl) > 0 {
+			old.ttl = ttl[0]
+		}
+
+		return item{value: value, found: true, ttl: old.ttl}, true, nil
+	})
+
+	return value, err
+}
+
+// Range is unsupported.
+// See memcache.Cache.
+func (c *Client) Range(fn memcache.RangeFunc) {
+	c.report(ErrUnsupported)
+}
+
+// Keys is unsupported.
+// See memcache.Cache.
+func (c *Client) Keys() (keys []string) {
+	c.report(ErrUnsupported)
+	return nil
+}
+
+// Scan is unsupported.
+// See memcache.Cache.
+func (c *Client) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	c.report(ErrUnsupported)
+	return nil, 0
+}
+
+// Namespace returns a view of client whose keys are prefixed with name and a separator ":".
+// Namespaces share the connections of client, and quota, Size and Reset are unsupported in namespaces.
+// See memcache.Cache.
+func (c *Client) Namespace(name string, quota ...int) memcache.Cache {
+	if len(quota) > 0 {
+		c.report(ErrUnsupported)
+	}
+
+	return &Client{
+		config: c.config,
+		pool:   c.pool,
+		prefix: c.prefix + name + ":",
+	}
+}
+
+// Flush does nothing because client has no pending writes.
+// See memcache.Cache.
+func (c *Client) Flush() error {
+	return nil
+}
+
+// SaveSnapshot is unsupported.
+// See memcache.Cache.
+func (c *Client) SaveSnapshot(w io.Writer) error {
+	return ErrUnsupported
+}
+
+// LoadSnapshot is unsupported.
+// See memcache.Cache.
+func (c *Client) LoadSnapshot(r io.Reader) error {
+	return ErrUnsupported
+}
+
+// Size returns the count of keys in server.
+// See memcache.Cache.
+func (c *Client) Size() (size int) {
+	if c.prefix != "" {
+		c.report(ErrUnsupported)
+		return 0
+	}
+
+	var stats map[string]string
+	err := c.do(true, func(cn *conn) (err error) {
+		cn.writeLine("stats")
+		if err = cn.flush(); err != nil {
+			return err
+		}
+
+		stats, err = cn.readStats()
+		return err
+	})
+
+	if err == nil {
+		size, err = strconv.Atoi(stats["curr_items"])
+	}
+
+	c.report(err)
+	return size
+}
+
+// GC does nothing because server cleans expired keys by itself.
+// See memcache.Cache.
+func (c *Client) GC() (cleans int) {
+	return 0
+}
+
+// Reset removes all keys in server.
+// See memcache.Cache.
+func (c *Client) Reset() {
+	if c.prefix != "" {
+		c.report(ErrUnsupported)
+		return
+	}
+
+	err := c.do(true, func(cn *conn) error {
+		cn.writeLine("flush_all")
+		if err := cn.flush(); err != nil {
+			return err
+		}
+
+		line, err := cn.readLine()
+		if err == nil && line != "OK" {
+			err = errBadResponse
+		}
+
+		return err
+	})
+
+	c.report(err)
+}
+
+// Close closes all connections of client, and a namespace does nothing because it doesn't own the connections.
+// See memcache.Cache.
+func (c *Client) Close() error {
+	if c.prefix != "" {
+		return nil
+	}
+
+	return c.pool.close()
+}
@@ -0,0 +1,516 @@
+package client
+
+import (
+	"encoding/gob"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+	"github.com/xd-luqiang/memcache/pkg/clock"
+	"github.com/xd-luqiang/memcache/server"
+)
+
+type testValue struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(testValue{})
+}
+
+func newTestServer(t *testing.T, cache memcache.Cache, opts ...server.Option) (address string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New(cache, opts...)
+	go srv.Serve(listener)
+
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	return listener.Addr().String()
+}
+
+// newTestClient returns a client of a new server and the errors reported by client.
+func newTestClient(t *testing.T, opts ...Option) (client *Client, errs func() []error) {
+	cache := memcache.NewCache(memcache.WithLRU(64), memcache.WithGC(0))
+	t.Cleanup(func() {
+		cache.Close()
+	})
+
+	var reported []error
+	var lock sync.Mutex
+
+	onError := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		reported = append(reported, err)
+	}
+
+	client = New("tcp", newTestServer(t, cache), append([]Option{WithError(onError)}, opts...)...)
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	errs = func() []error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		errs := reported
+		reported = nil
+		return errs
+	}
+
+	return client, errs
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClient$
+func TestClient(t *testing.T) {
+	client, errs := newTestClient(t)
+
+	var cache memcache.Cache = client
+	if value, found := cache.Get("key", nil); found {
+		t.Fatalf("get key returns %+v", value)
+	}
+
+	values := map[string]interface{}{
+		"bytes":      []byte("bytes"),
+		"string":     "string",
+		"int64":      int64(-64),
+		"float64":    3.14,
+		"int":        1,
+		"struct":     testValue{Name: "gob", Count: 3},
+		"with space": "space",
+	}
+
+	for key, value := range values {
+		cache.Set(key, value)
+	}
+
+	for key, want := range values {
+		value, found := cache.Get(key, nil)
+		if !found {
+			t.Fatalf("key %s not found", key)
+		}
+
+		if b, ok := want.([]byte); ok {
+			if string(value.([]byte)) != string(b) {
+				t.Fatalf("key %s: value %+v != %+v", key, value, want)
+			}
+
+			continue
+		}
+
+		if value != want {
+			t.Fatalf("key %s: value %+v (%T) != %+v (%T)", key, value, value, want, want)
+		}
+	}
+
+	if size := cache.Size(); size != len(values) {
+		t.Fatalf("size %d != %d", size, len(values))
+	}
+
+	cache.MSet([]string{"a", "b"}, []interface{}{"1", "2"})
+
+	got, founds := cache.MGet([]string{"a", "missing", "b"}, nil)
+	if got[0] != "1" || founds[1] || got[2] != "2" || !founds[0] || !founds[2] {
+		t.Fatalf("mget returns %+v %+v", got, founds)
+	}
+
+	if removed := cache.Remove("a"); removed != "1" {
+		t.Fatalf("removed %+v != 1", removed)
+	}
+
+	if removed := cache.Remove("a"); removed != nil {
+		t.Fatalf("removed %+v != nil", removed)
+	}
+
+	if actual, loaded := cache.GetOrSet("b", "3"); !loaded || actual != "2" {
+		t.Fatalf("get or set returns %+v %+v", actual, loaded)
+	}
+
+	if actual, loaded := cache.GetOrSet("c", "3"); loaded || actual != "3" {
+		t.Fatalf("get or set returns %+v %+v", actual, loaded)
+	}
+
+	if cache.CompareAndSwap("c", "x", "4") || !cache.CompareAndSwap("c", "3", "4") {
+		t.Fatal("compare and swap is wrong")
+	}
+
+	if cache.CompareAndDelete("c", "3") || !cache.CompareAndDelete("c", "4") {
+		t.Fatal("compare and delete is wrong")
+	}
+
+	// Bytes are compared by their contents.
+	if cache.CompareAndSwap("bytes", []byte("x"), []byte("new")) || !cache.CompareAndSwap("bytes", []byte("bytes"), []byte("new")) {
+		t.Fatal("compare and swap bytes is wrong")
+	}
+
+	if cache.CompareAndDelete("bytes", "new") || !cache.CompareAndDelete("bytes", []byte("new")) {
+		t.Fatal("compare and delete bytes is wrong")
+	}
+
+	newValue, kept := cache.Update("c", func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		return "5", memcache.NoTTL, !exists
+	})
+
+	if newValue != "5" || !kept {
+		t.Fatalf("update returns %+v %+v", newValue, kept)
+	}
+
+	if _, kept = cache.Update("c", func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		return nil, 0, false
+	}); kept {
+		t.Fatal("key is kept")
+	}
+
+	if _, found := cache.Get("c", nil); found {
+		t.Fatal("key c is found")
+	}
+
+	if errs := errs(); len(errs) > 0 {
+		t.Fatalf("errors %+v", errs)
+	}
+
+	cache.Reset()
+	if size := cache.Size(); size != 0 {
+		t.Fatalf("size %d != 0", size)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientCounter$
+func TestClientCounter(t *testing.T) {
+	client, errs := newTestClient(t)
+
+	if value, err := client.Incr("counter"); err != nil || value != 1 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if value, err := client.IncrBy("counter", 10); err != nil || value != 11 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if value, err := client.Decr("counter"); err != nil || value != 10 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if value, _ := client.Get("counter", nil); value != int64(10) {
+		t.Fatalf("value %+v != 10", value)
+	}
+
+	if value, err := client.IncrByFloat("counter", 0.5); err != nil || value != 10.5 {
+		t.Fatalf("value %f, err %+v", value, err)
+	}
+
+	client.Set("text", "text")
+	if _, err := client.Incr("text"); !errors.Is(err, memcache.ErrNotNumeric) {
+		t.Fatalf("err %+v != memcache.ErrNotNumeric", err)
+	}
+
+	// Server only stores unsigned numbers, so negative values are still increased and decreased correctly.
+	if value, err := client.IncrBy("negative", -5); err != nil || value != -5 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if value, err := client.IncrBy("negative", 2); err != nil || value != -3 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if value, err := client.IncrBy("negative", 10); err != nil || value != 7 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if value, err := client.IncrBy("negative", -10); err != nil || value != -3 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	client.Set("max", int64(math.MaxInt64))
+	if _, err := client.Incr("max"); !errors.Is(err, memcache.ErrOverflow) {
+		t.Fatalf("err %+v != memcache.ErrOverflow", err)
+	}
+
+	if value, _ := client.Get("max", nil); value != int64(math.MaxInt64) {
+		t.Fatalf("value %+v != %d", value, int64(math.MaxInt64))
+	}
+
+	client.Set("min", int64(math.MinInt64))
+	if _, err := client.Decr("min"); !errors.Is(err, memcache.ErrOverflow) {
+		t.Fatalf("err %+v != memcache.ErrOverflow", err)
+	}
+
+	if value, _ := client.Get("min", nil); value != int64(math.MinInt64) {
+		t.Fatalf("value %+v != %d", value, int64(math.MinInt64))
+	}
+
+	// Concurrent increases are atomic with cas.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 16; j++ {
+				if _, err := client.Incr("concurrent"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if value, _ := client.Get("concurrent", nil); value != int64(128) {
+		t.Fatalf("value %+v != 128", value)
+	}
+
+	if errs := errs(); len(errs) > 0 {
+		t.Fatalf("errors %+v", errs)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientTTL$
+func TestClientTTL(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	client := New("tcp", newTestServer(t, cache, server.WithNow(fakeClock.Now)), WithExpire(4*time.Second))
+	defer client.Close()
+
+	client.Set("key", "value", 1500*time.Millisecond)
+	client.Set("never", "value", memcache.NoTTL)
+	client.Set("default", "value")
+	client.MSet([]string{"mkey", "mnever", "mdefault"}, []interface{}{"value", "value", "value"}, 1500*time.Millisecond, memcache.NoTTL)
+	client.IncrBy("counter", 1, 3*time.Second)
+
+	fakeClock.Advance(time.Second)
+
+	// The ttl of key is rounded up to 2 seconds, and increasing keeps the ttl.
+	client.Incr("counter")
+	if _, found := client.Get("key", nil); !found {
+		t.Fatal("key not found")
+	}
+
+	fakeClock.Advance(time.Second + time.Millisecond)
+	if _, found := client.Get("key", nil); found {
+		t.Fatal("key found")
+	}
+
+	if _, found := client.Get("mkey", nil); found {
+		t.Fatal("mkey found")
+	}
+
+	if value, _ := client.Get("counter", nil); value != int64(2) {
+		t.Fatalf("value %+v != 2", value)
+	}
+
+	fakeClock.Advance(time.Second)
+	if _, found := client.Get("counter", nil); found {
+		t.Fatal("counter found")
+	}
+
+	if _, found := client.Get("default", nil); !found {
+		t.Fatal("default not found")
+	}
+
+	// Keys set without ttls expire after the expire time.
+	fakeClock.Advance(time.Second)
+	for _, key := range []string{"default", "mdefault"} {
+		if _, found := client.Get(key, nil); found {
+			t.Fatalf("%s found", key)
+		}
+	}
+
+	for _, key := range []string{"never", "mnever"} {
+		if _, found := client.Get(key, nil); !found {
+			t.Fatalf("%s not found", key)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientMSetMismatch$
+func TestClientMSetMismatch(t *testing.T) {
+	client, errs := newTestClient(t)
+
+	for _, values := range [][]interface{}{{"1"}, {"1", "2", "3"}} {
+		client.MSet([]string{"k1", "k2"}, values)
+
+		if reported := errs(); len(reported) != 1 || reported[0] != errMismatch {
+			t.Fatalf("reported %+v is wrong", reported)
+		}
+
+		if _, found := client.Get("k1", nil); found {
+			t.Fatal("k1 found")
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientNamespace$
+func TestClientNamespace(t *testing.T) {
+	client, errs := newTestClient(t)
+
+	ns := client.Namespace("ns")
+	ns.Set("key", "value")
+
+	if value, _ := client.Get("ns:key", nil); value != "value" {
+		t.Fatalf("value %+v != value", value)
+	}
+
+	if value, _ := ns.Namespace("sub").GetOrSet("key", "sub"); value != "sub" {
+		t.Fatalf("value %+v != sub", value)
+	}
+
+	if value, _ := client.Get("ns:sub:key", nil); value != "sub" {
+		t.Fatalf("value %+v != sub", value)
+	}
+
+	if err := ns.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ns.Size()
+	if errs := errs(); len(errs) != 1 || errs[0] != ErrUnsupported {
+		t.Fatalf("errors %+v", errs)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientUnsupported$
+func TestClientUnsupported(t *testing.T) {
+	client, errs := newTestClient(t)
+
+	client.Keys()
+	client.Scan(0, "", 0)
+	client.Range(func(key string, value interface{}, ttl time.Duration) bool { return true })
+	client.RemovePrefix("prefix")
+	client.RemoveMatch("*")
+	client.InvalidateTag("tag")
+	client.SetWithTags("key", "value", memcache.NoTTL, "tag")
+
+	if errs := errs(); len(errs) != 7 {
+		t.Fatalf("len(errs) %d != 7", len(errs))
+	}
+
+	if value, _ := client.Get("key", nil); value != "value" {
+		t.Fatalf("value %+v != value", value)
+	}
+
+	if err := client.SaveSnapshot(nil); err != ErrUnsupported {
+		t.Fatalf("err %+v != ErrUnsupported", err)
+	}
+
+	// Keys must be valid in memcached protocol.
+	client.Set("", "value")
+	client.Set(string(make([]byte, maxKeyLength+1)), "value")
+
+	if errs := errs(); len(errs) != 2 || errs[0] != errBadKey {
+		t.Fatalf("errors %+v", errs)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientReconnect$
+func TestClientReconnect(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	var errs []error
+	client := New("tcp", newTestServer(t, cache, server.WithIdleTimeout(20*time.Millisecond)), WithError(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	client.Set("key", "value")
+	if len(client.pool.idle) != 1 {
+		t.Fatalf("len(client.pool.idle) %d != 1", len(client.pool.idle))
+	}
+
+	// The idle connection is closed by server, so client should reconnect.
+	time.Sleep(100 * time.Millisecond)
+
+	if value, found := client.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v, found %+v", value, found)
+	}
+
+	if len(errs) > 0 {
+		t.Fatalf("errors %+v", errs)
+	}
+
+	// Increasing isn't idempotent, so it isn't retried after the idle connection is closed by server.
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := client.Incr("counter"); err == nil {
+		t.Fatal("increasing is retried")
+	}
+
+	if value, err := client.Incr("counter"); err != nil || value != 1 {
+		t.Fatalf("value %d, err %+v", value, err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Close(); err != memcache.ErrClosed {
+		t.Fatalf("err %+v != memcache.ErrClosed", err)
+	}
+
+	client.Get("key", nil)
+	if len(errs) != 1 || errs[0] != memcache.ErrClosed {
+		t.Fatalf("errors %+v", errs)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClientTimeout$
+func TestClientTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// The server accepts connections but never responds.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	var errs []error
+	client := New("tcp", listener.Addr().String(), WithTimeout(20*time.Millisecond), WithError(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	defer client.Close()
+
+	begin := time.Now()
+	if _, found := client.Get("key", nil); found {
+		t.Fatal("key found")
+	}
+
+	if cost := time.Since(begin); cost > time.Second {
+		t.Fatalf("cost %s is too long", cost)
+	}
+
+	var netErr net.Error
+	if len(errs) != 1 || !errors.As(errs[0], &netErr) || !netErr.Timeout() {
+		t.Fatalf("errors %+v", errs)
+	}
+
+	if len(client.pool.idle) != 0 {
+		t.Fatalf("len(client.pool.idle) %d != 0", len(client.pool.idle))
+	}
+}
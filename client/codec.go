@@ -0,0 +1,139 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+// Flags of items telling the types of values.
+// Values stored by other clients usually have zero flags, so they are got as bytes.
+const (
+	flagBytes uint32 = iota
+	flagString
+	flagInt64
+	flagFloat64
+	flagCodec
+)
+
+// gobCodec encodes values with encoding/gob, which is the same as the default codec of cache.
+type gobCodec struct{}
+
+// Encode encodes value to bytes.
+func (gobCodec) Encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&value); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decode decodes data of key to value.
+func (gobCodec) Decode(key string, data []byte) (value interface{}, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// encode encodes value to data with the flags of its type.
+// Numbers are encoded in decimal, so they can be increased by other clients.
+func (c *Client) encode(value interface{}) (data []byte, flags uint32, err error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, flagBytes, nil
+	case string:
+		return []byte(v), flagString, nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), flagInt64, nil
+	case float64:
+		return strconv.AppendFloat(nil, v, 'g', -1, 64), flagFloat64, nil
+	default:
+		data, err = c.codec.Encode(value)
+		return data, flagCodec, err
+	}
+}
+
+// decode decodes data of key to value by flags, and data with unknown flags is returned as bytes.
+func (c *Client) decode(key string, data []byte, flags uint32) (value interface{}, err error) {
+	switch flags {
+	case flagString:
+		return string(data), nil
+	case flagInt64:
+		return strconv.ParseInt(string(data), 10, 64)
+	case flagFloat64:
+		return strconv.ParseFloat(string(data), 64)
+	case flagCodec:
+		return c.codec.Decode(key, data)
+	default:
+		return data, nil
+	}
+}
+
+// toInt64 converts value to int64 like cache does, see memcache.Cache.IncrBy.
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		return parseInt64(v)
+	case []byte:
+		return parseInt64(string(v))
+	default:
+		return 0, memcache.ErrNotNumeric
+	}
+}
+
+// toFloat64 converts value to float64 like cache does, see memcache.Cache.IncrByFloat.
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return parseFloat64(v)
+	case []byte:
+		return parseFloat64(string(v))
+	default:
+		n, err := toInt64(value)
+		return float64(n), err
+	}
+}
+
+func parseInt64(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, memcache.ErrNotNumeric
+	}
+
+	return n, nil
+}
+
+func parseFloat64(s string) (float64, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, memcache.ErrNotNumeric
+	}
+
+	return n, nil
+}
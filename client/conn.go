@@ -0,0 +1,305 @@
+package client
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	// maxKeyLength is the max length of keys, which is the same as memcached.
+	maxKeyLength = 250
+
+	// maxRelativeExptime is the max exptime which is relative to now, and a larger one is a unix timestamp.
+	maxRelativeExptime = 60 * 60 * 24 * 30
+)
+
+var (
+	errBadKey      = errors.New("cachego: key is empty or longer than 250 bytes")
+	errBadResponse = errors.New("cachego: bad response from server")
+)
+
+// Codes of meta responses.
+const (
+	codeValue    = "VA"
+	codeHeader   = "HD"
+	codeMissed   = "EN"
+	codeNotFound = "NF"
+	codeNotStore = "NS"
+	codeExists   = "EX"
+
+	// codeNonNumeric is the code of the error line responded when increasing a non-numeric value.
+	codeNonNumeric = "CLIENT_ERROR cannot increment or decrement non-numeric value"
+)
+
+// Modes of ms command.
+const (
+	modeSet byte = 'S'
+	modeAdd byte = 'E'
+)
+
+// response is a response of meta commands.
+type response struct {
+	code  string
+	value []byte
+	flags uint32
+	cas   uint64
+	ttl   time.Duration
+}
+
+// conn is a connection to server speaking memcached meta protocol.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func dial(network string, address string, dialTimeout time.Duration) (*conn, error) {
+	netConn, err := net.DialTimeout(network, address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		conn:   netConn,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+	}
+
+	return cn, nil
+}
+
+func (cn *conn) close() error {
+	return cn.conn.Close()
+}
+
+// setTimeout sets the deadline of writing and reading to timeout later, and zero timeout means never.
+func (cn *conn) setTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		cn.conn.SetDeadline(time.Now().Add(timeout))
+	} else {
+		cn.conn.SetDeadline(time.Time{})
+	}
+}
+
+// encodeKey returns key in base64 if it has spaces or control characters, and encoded reports if it's base64.
+func encodeKey(key string) (encodedKey string, encoded bool, err error) {
+	if len(key) <= 0 || len(key) > maxKeyLength {
+		return "", false, errBadKey
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return base64.StdEncoding.EncodeToString([]byte(key)), true, nil
+		}
+	}
+
+	return key, false, nil
+}
+
+// exptimeOf returns the exptime in seconds of ttl which is rounded up to seconds.
+// A ttl longer than 30 days is sent as a unix timestamp, or server treats it as one.
+func exptimeOf(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	exptime := int64((ttl + time.Second - 1) / time.Second)
+	if exptime > maxRelativeExptime {
+		return time.Now().Unix() + exptime
+	}
+
+	return exptime
+}
+
+// writeMeta writes a meta command of key with tokens.
+func (cn *conn) writeMeta(command string, key string, tokens ...string) error {
+	encodedKey, encoded, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	cn.writer.WriteString(command)
+	cn.writer.WriteByte(' ')
+	cn.writer.WriteString(encodedKey)
+
+	for _, token := range tokens {
+		cn.writer.WriteByte(' ')
+		cn.writer.WriteString(token)
+	}
+
+	if encoded {
+		cn.writer.WriteString(" b")
+	}
+
+	cn.writer.WriteString("\r\n")
+	return nil
+}
+
+// writeGet writes a get of key returning its value, flags, cas and ttl.
+func (cn *conn) writeGet(key string) error {
+	return cn.writeMeta("mg", key, "v", "f", "c", "t")
+}
+
+// writeSet writes a set of key with mode, and zero cas means no comparing.
+func (cn *conn) writeSet(key string, data []byte, flags uint32, ttl time.Duration, mode byte, cas uint64) error {
+	tokens := []string{
+		strconv.Itoa(len(data)),
+		"F" + strconv.FormatUint(uint64(flags), 10),
+		"T" + strconv.FormatInt(exptimeOf(ttl), 10),
+		"M" + string(mode),
+	}
+
+	if cas != 0 {
+		tokens = append(tokens, "C"+strconv.FormatUint(cas, 10))
+	}
+
+	if err := cn.writeMeta("ms", key, tokens...); err != nil {
+		return err
+	}
+
+	cn.writer.Write(data)
+	cn.writer.WriteString("\r\n")
+	return nil
+}
+
+// writeIncr writes an increase of key by delta returning the new value, and ttl updates the ttl of key if it's not empty.
+func (cn *conn) writeIncr(key string, delta uint64, ttl []time.Duration) error {
+	tokens := []string{"v", "MI", "D" + strconv.FormatUint(delta, 10)}
+	if len(ttl) > 0 {
+		tokens = append(tokens, "T"+strconv.FormatInt(exptimeOf(ttl[0]), 10))
+	}
+
+	return cn.writeMeta("ma", key, tokens...)
+}
+
+// writeDecr writes a decrease of key by delta, which stops at zero.
+func (cn *conn) writeDecr(key string, delta uint64) error {
+	return cn.writeMeta("ma", key, "MD", "D"+strconv.FormatUint(delta, 10))
+}
+
+// writeDelete writes a delete of key, and zero cas means no comparing.
+func (cn *conn) writeDelete(key string, cas uint64) error {
+	if cas == 0 {
+		return cn.writeMeta("md", key)
+	}
+
+	return cn.writeMeta("md", key, "C"+strconv.FormatUint(cas, 10))
+}
+
+func (cn *conn) writeLine(line string) {
+	cn.writer.WriteString(line)
+	cn.writer.WriteString("\r\n")
+}
+
+func (cn *conn) flush() error {
+	return cn.writer.Flush()
+}
+
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readResponse reads a response of meta commands, and an error line from server is returned as an error.
+func (cn *conn) readResponse() (resp response, err error) {
+	line, err := cn.readLine()
+	if err != nil {
+		return resp, err
+	}
+
+	// Increasing a non-numeric value is responded with an error line, but the connection is still fine.
+	if line == codeNonNumeric {
+		resp.code = codeNonNumeric
+		return resp, nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) <= 0 {
+		return resp, errBadResponse
+	}
+
+	resp.code, fields = fields[0], fields[1:]
+	resp.ttl = memcache.NoTTL
+
+	switch resp.code {
+	case codeValue:
+		if len(fields) <= 0 {
+			return resp, errBadResponse
+		}
+
+		size, err := strconv.Atoi(fields[0])
+		if err != nil || size < 0 {
+			return resp, errBadResponse
+		}
+
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(cn.reader, data); err != nil {
+			return resp, err
+		}
+
+		resp.value, fields = data[:size], fields[1:]
+	case codeHeader, codeMissed, codeNotFound, codeNotStore, codeExists:
+	default:
+		return resp, fmt.Errorf("cachego: server responds %q", line)
+	}
+
+	for _, field := range fields {
+		var err error
+
+		switch field[0] {
+		case 'f':
+			var flags uint64
+			flags, err = strconv.ParseUint(field[1:], 10, 32)
+			resp.flags = uint32(flags)
+		case 'c':
+			resp.cas, err = strconv.ParseUint(field[1:], 10, 64)
+		case 't':
+			var ttl int64
+			if ttl, err = strconv.ParseInt(field[1:], 10, 64); ttl > 0 {
+				resp.ttl = time.Duration(ttl) * time.Second
+			}
+		}
+
+		if err != nil {
+			return resp, errBadResponse
+		}
+	}
+
+	return resp, nil
+}
+
+// readStats reads the stats of server until END.
+func (cn *conn) readStats() (stats map[string]string, err error) {
+	stats = make(map[string]string)
+
+	for {
+		line, err := cn.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if line == "END" {
+			return stats, nil
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return nil, fmt.Errorf("cachego: server responds %q", line)
+		}
+
+		stats[fields[1]] = fields[2]
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	defaultDialTimeout  = time.Second
+	defaultTimeout      = time.Second
+	defaultMaxIdleConns = 8
+	defaultExpireTime   = 60 * time.Second
+)
+
+type config struct {
+	dialTimeout  time.Duration
+	timeout      time.Duration
+	maxIdleConns int
+	expireTime   time.Duration
+	codec        memcache.Codec
+	onError      func(err error)
+}
+
+func newDefaultConfig() *config {
+	return &config{
+		dialTimeout:  defaultDialTimeout,
+		timeout:      defaultTimeout,
+		maxIdleConns: defaultMaxIdleConns,
+		expireTime:   defaultExpireTime,
+		codec:        gobCodec{},
+		onError:      nil,
+	}
+}
+
+// Option applies to config and sets some values to config.
+type Option func(conf *config)
+
+func (o Option) applyTo(conf *config) {
+	o(conf)
+}
+
+func applyOptions(conf *config, opts []Option) {
+	for _, opt := range opts {
+		opt.applyTo(conf)
+	}
+}
+
+// WithDialTimeout returns an option setting the timeout of dialing server.
+func WithDialTimeout(dialTimeout time.Duration) Option {
+	return func(conf *config) {
+		conf.dialTimeout = dialTimeout
+	}
+}
+
+// WithTimeout returns an option setting the timeout of each request including writing and reading.
+// Zero timeout means never.
+func WithTimeout(timeout time.Duration) Option {
+	return func(conf *config) {
+		conf.timeout = timeout
+	}
+}
+
+// WithMaxIdleConns returns an option setting the max count of idle connections kept in pool.
+// Connections more than it are closed after using.
+func WithMaxIdleConns(maxIdleConns int) Option {
+	return func(conf *config) {
+		conf.maxIdleConns = maxIdleConns
+	}
+}
+
+// WithExpire returns an option setting the ttl of keys set without ttls, which is 60s like memcache.NewCache.
+// Unlike memcache.NewCache, the ttl isn't fluctuated because ttls are rounded up to seconds.
+func WithExpire(expireTime time.Duration) Option {
+	return func(conf *config) {
+		conf.expireTime = expireTime
+	}
+}
+
+// WithCodec returns an option setting the codec of values which aren't bytes, strings, int64 or float64.
+// By default, values are encoded with encoding/gob, so values of custom types should be registered with gob.Register.
+func WithCodec(codec memcache.Codec) Option {
+	return func(conf *config) {
+		conf.codec = codec
+	}
+}
+
+// WithError returns an option setting a function called with the error when a method of cache fails.
+// Most methods of cache can't return errors, so a failed one returns zero values and reports its error here.
+func WithError(onError func(err error)) Option {
+	return func(conf *config) {
+		conf.onError = onError
+	}
+}
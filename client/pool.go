@@ -0,0 +1,81 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+// pool keeps idle connections to server for reusing.
+type pool struct {
+	dial    func() (*conn, error)
+	maxIdle int
+
+	idle   []*conn
+	closed bool
+	lock   sync.Mutex
+}
+
+func newPool(dial func() (*conn, error), maxIdle int) *pool {
+	return &pool{
+		dial:    dial,
+		maxIdle: maxIdle,
+	}
+}
+
+// get returns an idle connection or dials a new one, and reused reports if it's an idle one.
+func (p *pool) get() (cn *conn, reused bool, err error) {
+	p.lock.Lock()
+
+	if p.closed {
+		p.lock.Unlock()
+		return nil, false, memcache.ErrClosed
+	}
+
+	if n := len(p.idle); n > 0 {
+		cn = p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+
+		p.lock.Unlock()
+		return cn, true, nil
+	}
+
+	p.lock.Unlock()
+
+	cn, err = p.dial()
+	return cn, false, err
+}
+
+// put puts cn back to pool if it isn't broken by err, otherwise cn is closed.
+// Any error breaks the connection, because the responses left in it are unknown.
+func (p *pool) put(cn *conn, err error) {
+	p.lock.Lock()
+
+	if err == nil && !p.closed && len(p.idle) < p.maxIdle {
+		p.idle = append(p.idle, cn)
+		p.lock.Unlock()
+		return
+	}
+
+	p.lock.Unlock()
+	cn.close()
+}
+
+// close closes all idle connections, and connections in use are closed after using.
+func (p *pool) close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return memcache.ErrClosed
+	}
+
+	for _, cn := range p.idle {
+		cn.close()
+	}
+
+	p.idle = nil
+	p.closed = true
+	return nil
+}
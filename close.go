@@ -0,0 +1,339 @@
+package memcache
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// closableCache stops background goroutines of cache when closing.
+// All methods of a closed cache do nothing and return zero values or ErrClosed.
+type closableCache struct {
+	*config
+	cache Cache
+
+	closed  int32
+	cancels []func()
+	lock    sync.Mutex
+}
+
+func newClosableCache(conf *config, cache Cache) *closableCache {
+	return &closableCache{
+		config: conf,
+		cache:  cache,
+	}
+}
+
+func (cc *closableCache) isClosed() bool {
+	return atomic.LoadInt32(&cc.closed) > 0
+}
+
+// onClose adds a cancel function which will be called when closing cache.
+func (cc *closableCache) onClose(cancel func()) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	cc.cancels = append(cc.cancels, cancel)
+}
+
+// Get gets the value of key from cache and returns value if found.
+// See Cache interface.
+func (cc *closableCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	if cc.isClosed() {
+		return nil, false
+	}
+
+	return cc.cache.Get(key, deserializeF)
+}
+
+// MGet gets the values of keys from cache and returns values with founds.
+// See Cache interface.
+func (cc *closableCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	if cc.isClosed() {
+		return make([]interface{}, len(keys)), make([]bool, len(keys))
+	}
+
+	return cc.cache.MGet(keys, deserializeF)
+}
+
+// Set sets key and value to cache with ttl and returns evicted value if exists.
+// See Cache interface.
+func (cc *closableCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	if cc.isClosed() {
+		return nil
+	}
+
+	return cc.cache.Set(key, value, ttl...)
+}
+
+// MSet sets keys and values to cache with ttls and returns evicted values.
+// See Cache interface.
+func (cc *closableCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	if cc.isClosed() {
+		return nil
+	}
+
+	return cc.cache.MSet(keys, values, ttls...)
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (cc *closableCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	if cc.isClosed() {
+		return nil
+	}
+
+	return cc.cache.SetWithTags(key, value, ttl, tags...)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (cc *closableCache) InvalidateTag(tag string) (removed int) {
+	if cc.isClosed() {
+		return 0
+	}
+
+	return cc.cache.InvalidateTag(tag)
+}
+
+// Remove removes key and returns the removed value of key.
+// See Cache interface.
+func (cc *closableCache) Remove(key string) (removedValue interface{}) {
+	if cc.isClosed() {
+		return nil
+	}
+
+	return cc.cache.Remove(key)
+}
+
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (cc *closableCache) RemovePrefix(prefix string) (removed int) {
+	if cc.isClosed() {
+		return 0
+	}
+
+	return cc.cache.RemovePrefix(prefix)
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (cc *closableCache) RemoveMatch(pattern string) (removed int) {
+	if cc.isClosed() {
+		return 0
+	}
+
+	return cc.cache.RemoveMatch(pattern)
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (cc *closableCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	if cc.isClosed() {
+		return nil, false
+	}
+
+	return cc.cache.GetOrSet(key, value, ttl...)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (cc *closableCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	if cc.isClosed() {
+		return false
+	}
+
+	return cc.cache.CompareAndSwap(key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (cc *closableCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	if cc.isClosed() {
+		return false
+	}
+
+	return cc.cache.CompareAndDelete(key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (cc *closableCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	if cc.isClosed() {
+		return nil, false
+	}
+
+	return cc.cache.Update(key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (cc *closableCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return cc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (cc *closableCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return cc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (cc *closableCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	if cc.isClosed() {
+		return 0, ErrClosed
+	}
+
+	return cc.cache.IncrBy(key, delta, ttl...)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (cc *closableCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	if cc.isClosed() {
+		return 0, ErrClosed
+	}
+
+	return cc.cache.IncrByFloat(key, delta, ttl...)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (cc *closableCache) Range(fn RangeFunc) {
+	if cc.isClosed() {
+		return
+	}
+
+	cc.cache.Range(fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (cc *closableCache) Keys() (keys []string) {
+	if cc.isClosed() {
+		return nil
+	}
+
+	return cc.cache.Keys()
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (cc *closableCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	if cc.isClosed() {
+		return nil, 0
+	}
+
+	return cc.cache.Scan(cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (cc *closableCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(cc.config, cc, name, quota)
+}
+
+func (cc *closableCache) watchNamespace(ns *namespace) {
+	watchNamespaceOf(cc.cache, ns)
+}
+
+func (cc *closableCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	if cc.isClosed() {
+		return false
+	}
+
+	return evictPrefixOf(cc.cache, prefix, skip)
+}
+
+func (cc *closableCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	if cc.isClosed() {
+		return 0, false
+	}
+
+	return ttlOfCache(cc.cache, key)
+}
+
+// Flush writes all pending writes to the backing store and returns the error if failed.
+// See Cache interface.
+func (cc *closableCache) Flush() error {
+	if cc.isClosed() {
+		return ErrClosed
+	}
+
+	return cc.cache.Flush()
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (cc *closableCache) SaveSnapshot(w io.Writer) error {
+	if cc.isClosed() {
+		return ErrClosed
+	}
+
+	return cc.cache.SaveSnapshot(w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (cc *closableCache) LoadSnapshot(r io.Reader) error {
+	if cc.isClosed() {
+		return ErrClosed
+	}
+
+	return cc.cache.LoadSnapshot(r)
+}
+
+// Size returns the count of keys in cache.
+// See Cache interface.
+func (cc *closableCache) Size() (size int) {
+	if cc.isClosed() {
+		return 0
+	}
+
+	return cc.cache.Size()
+}
+
+// GC cleans the expired keys in cache and returns the exact count cleaned.
+// See Cache interface.
+func (cc *closableCache) GC() (cleans int) {
+	if cc.isClosed() {
+		return 0
+	}
+
+	return cc.cache.GC()
+}
+
+// Reset resets cache to initial status which is like a new cache.
+// See Cache interface.
+func (cc *closableCache) Reset() {
+	if cc.isClosed() {
+		return
+	}
+
+	cc.cache.Reset()
+}
+
+// Close stops all background goroutines of cache and releases all entries.
+// See Cache interface.
+func (cc *closableCache) Close() error {
+	if !atomic.CompareAndSwapInt32(&cc.closed, 0, 1) {
+		return ErrClosed
+	}
+
+	cc.lock.Lock()
+	cancels := cc.cancels
+	cc.cancels = nil
+	cc.lock.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+
+	if cc.clock != nil {
+		cc.clock.Stop()
+	}
+
+	return cc.cache.Close()
+}
@@ -0,0 +1,64 @@
+package memcache
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheClose$
+func TestCacheClose(t *testing.T) {
+	cache := NewCache(WithLRU(16), WithShardings(2))
+	cache.Set("key", "value", NoTTL)
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Close(); err != ErrClosed {
+		t.Fatalf("err %+v != ErrClosed", err)
+	}
+
+	if _, found := cache.Get("key", nil); found {
+		t.Fatal("closed cache shouldn't find anything")
+	}
+
+	cache.Set("key", "value", NoTTL)
+
+	if size := cache.Size(); size != 0 {
+		t.Fatalf("size %d != 0", size)
+	}
+
+	values, founds := cache.MGet([]string{"key", "key"}, nil)
+	if len(values) != 2 || len(founds) != 2 || founds[0] || founds[1] {
+		t.Fatalf("values %v founds %v is wrong", values, founds)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheCloseGoroutineLeak$
+func TestCacheCloseGoroutineLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	caches := make([]Cache, 0, 10)
+	for i := 0; i < 10; i++ {
+		caches = append(caches, NewCache(WithLRU(16), WithGC(time.Millisecond), WithFastClock(time.Millisecond)))
+	}
+
+	if after := runtime.NumGoroutine(); after < before+20 {
+		t.Fatalf("after %d < before %d + 20", after, before)
+	}
+
+	for _, cache := range caches {
+		cache.Close()
+	}
+
+	// Goroutines exit asynchronously, so we wait for them a while.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("goroutines leaked: after %d > before %d", after, before)
+	}
+}
@@ -0,0 +1,117 @@
+// Command memcached serves a cache over memcached protocol on tcp or a unix socket.
+// The cache can also be served over redis protocol on another tcp address.
+//
+//	memcached -network tcp -address :11211 -policy sieve -max-entries 100000 -resp-address :6379
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+	"github.com/xd-luqiang/memcache/server"
+)
+
+var (
+	network     = flag.String("network", "tcp", "network of listener, tcp or unix")
+	address     = flag.String("address", ":11211", "address of listener, or the path of unix socket")
+	policy      = flag.String("policy", "lru", "eviction policy of cache: lru, arc, s3fifo or sieve")
+	maxEntries  = flag.Int("max-entries", 100000, "max entries of cache")
+	shardings   = flag.Int("shardings", 0, "sharding count of cache, and zero means no sharding")
+	gcDuration  = flag.Duration("gc", 10*time.Minute, "duration of cleaning expired keys, and zero means never")
+	snapshot    = flag.String("snapshot", "", "path of snapshot which is loaded on start and saved on exit")
+	snapshotDur = flag.Duration("snapshot-duration", 0, "duration of saving snapshots, and zero means only saving on exit")
+	maxItemSize = flag.Int("max-item-size", 1024*1024, "max size in bytes of item values")
+	idleTimeout = flag.Duration("idle-timeout", 0, "timeout of idle connections, and zero means never")
+	respAddress = flag.String("resp-address", "", "tcp address of redis protocol listener, and empty means disabled")
+)
+
+func cacheOptions() ([]memcache.Option, error) {
+	opts := []memcache.Option{
+		memcache.WithShardings(*shardings),
+		memcache.WithGC(*gcDuration),
+	}
+
+	policies := map[string]func(maxEntries int) memcache.Option{
+		"lru":    memcache.WithLRU,
+		"arc":    memcache.WithARC,
+		"s3fifo": memcache.WithS3FIFO,
+		"sieve":  memcache.WithSieve,
+	}
+
+	withPolicy, ok := policies[*policy]
+	if !ok {
+		return nil, fmt.Errorf("policy %s doesn't exist", *policy)
+	}
+
+	opts = append(opts, withPolicy(*maxEntries))
+
+	if *snapshot != "" {
+		onError := func(err error) {
+			log.Printf("snapshot: %v", err)
+		}
+
+		opts = append(opts, memcache.WithSnapshot(*snapshot, *snapshotDur), memcache.WithSnapshotError(onError))
+	}
+
+	return opts, nil
+}
+
+func main() {
+	flag.Parse()
+
+	opts, err := cacheOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A socket file left by the last run should be removed before listening.
+	if *network == "unix" {
+		if err = os.Remove(*address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatal(err)
+		}
+	}
+
+	cache := memcache.NewCache(opts...)
+	if cache == nil {
+		log.Fatal("failed to create cache")
+	}
+
+	srv := server.New(cache, server.WithMaxItemSize(*maxItemSize), server.WithIdleTimeout(*idleTimeout))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		srv.Close()
+	}()
+
+	if *respAddress != "" {
+		go func() {
+			log.Printf("redis protocol is serving on tcp %s", *respAddress)
+
+			if err := srv.ListenAndServeRESP("tcp", *respAddress); !errors.Is(err, server.ErrServerClosed) {
+				log.Print(err)
+			}
+		}()
+	}
+
+	log.Printf("memcached is serving on %s %s", *network, *address)
+
+	err = srv.ListenAndServe(*network, *address)
+	if !errors.Is(err, server.ErrServerClosed) {
+		log.Print(err)
+	}
+
+	// Closing cache saves the last snapshot.
+	if err = cache.Close(); err != nil {
+		log.Print(err)
+	}
+}
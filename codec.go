@@ -0,0 +1,35 @@
+package memcache
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Codec encodes values to bytes and decodes them back, which is used by snapshots.
+type Codec interface {
+	// Encode encodes value to bytes.
+	Encode(value interface{}) ([]byte, error)
+
+	// Decode decodes data of key to value.
+	Decode(key string, data []byte) (value interface{}, err error)
+}
+
+// gobCodec encodes values with encoding/gob.
+// Values of custom types should be registered with gob.Register before using.
+type gobCodec struct{}
+
+// Encode encodes value to bytes.
+func (gobCodec) Encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&value); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decode decodes data of key to value.
+func (gobCodec) Decode(key string, data []byte) (value interface{}, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
@@ -0,0 +1,97 @@
+package memcache
+
+import (
+	"container/list"
+)
+
+const (
+	// coldSegments is the max count of segments in caches, like t1 and t2 of arc.
+	coldSegments = 2
+)
+
+// coldElement is a key in cold list with the segment of cache it's in and the time it's moved to the front.
+type coldElement struct {
+	key     string
+	segment int
+	stamp   uint64
+}
+
+// colder reports if ce is evicted before other by cache.
+// Segments are evicted in order, and keys in a segment are evicted from the one moved to the front earliest.
+func (ce *coldElement) colder(other *coldElement) bool {
+	if ce.segment != other.segment {
+		return ce.segment < other.segment
+	}
+
+	return ce.stamp < other.stamp
+}
+
+// coldList keeps some keys of cache like keys of a namespace in the order they're evicted by cache,
+// so the coldest one of them can be found without walking all keys of cache.
+// Caches move keys to the front of their segments by keyIndex.touch, and keys in a segment keep the same order in list.
+type coldList struct {
+	segments [coldSegments]*list.List
+	elements map[string]*list.Element
+}
+
+func newColdList() *coldList {
+	cl := &coldList{
+		elements: make(map[string]*list.Element),
+	}
+
+	for i := range cl.segments {
+		cl.segments[i] = list.New()
+	}
+
+	return cl
+}
+
+func (cl *coldList) unwrap(element *list.Element) *coldElement {
+	ce, ok := element.Value.(*coldElement)
+	if !ok {
+		panic("cachego: failed to unwrap cold element")
+	}
+
+	return ce
+}
+
+// touch moves key to the front of segment with stamp.
+func (cl *coldList) touch(key string, segment int, stamp uint64) {
+	element, ok := cl.elements[key]
+	if !ok {
+		cl.elements[key] = cl.segments[segment].PushFront(&coldElement{key: key, segment: segment, stamp: stamp})
+		return
+	}
+
+	ce := cl.unwrap(element)
+	ce.stamp = stamp
+
+	if ce.segment == segment {
+		cl.segments[segment].MoveToFront(element)
+		return
+	}
+
+	cl.segments[ce.segment].Remove(element)
+	ce.segment = segment
+	cl.elements[key] = cl.segments[segment].PushFront(ce)
+}
+
+func (cl *coldList) remove(key string) {
+	if element, ok := cl.elements[key]; ok {
+		delete(cl.elements, key)
+		cl.segments[cl.unwrap(element).segment].Remove(element)
+	}
+}
+
+// coldest returns the coldest key except skip, or nil if there is no such key.
+func (cl *coldList) coldest(skip string) *coldElement {
+	for _, segment := range cl.segments {
+		for element := segment.Back(); element != nil; element = element.Prev() {
+			if ce := cl.unwrap(element); ce.key != skip {
+				return ce
+			}
+		}
+	}
+
+	return nil
+}
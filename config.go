@@ -1,6 +1,10 @@
 package memcache
 
-import "time"
+import (
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
 
 type (
 	DeserializeFunc func(string, []byte) interface{}
@@ -19,9 +23,27 @@ type config struct {
 	maxScans   int
 	maxEntries int
 
+	// prefixIndex enables the prefix index of keys for removing keys by prefix and pattern.
+	prefixIndex bool
+
+	// scanIndex enables the scan index of keys for scanning keys page by page.
+	scanIndex bool
+
+	// namespaces stores all namespaces of cache which share the capacity of cache.
+	namespaces *namespaceRegistry
+
+	// tenants stores shares and stats of tenants, and it's nil if cache has no tenants.
+	tenants *tenantRegistry
+
 	now  func() int64
 	hash func(key string) int
 
+	// clock is the fast clock owned by cache which should be stopped with cache.
+	clock *clock.Clock
+
+	// newTicker creates tickers for background tasks like gc.
+	newTicker func(duration time.Duration) clock.Ticker
+
 	recordMissed bool
 	recordHit    bool
 	recordGC     bool
@@ -33,6 +55,33 @@ type config struct {
 	reportLoad   func(reporter *Reporter, key string, value interface{}, ttl time.Duration, err error)
 
 	loadFunc LoadFunc
+
+	// store is the backing store of cache, see Store.
+	store         Store
+	writeBehind   bool
+	flushDuration time.Duration
+	flushBatch    int
+	flushRetries  int
+	storeError    func(keys []string, err error)
+
+	// codec encodes values in snapshots.
+	codec Codec
+
+	snapshotPath     string
+	snapshotDuration time.Duration
+	snapshotError    func(err error)
+
+	// logPath is the path of the append-only log, and empty means no log.
+	logPath        string
+	fsyncPolicy    FsyncPolicy
+	logCompactSize int64
+	logError       func(err error)
+
+	// overflow stores entries evicted from lru cache on disk, and it's nil if cache has no overflow.
+	overflow      *overflowStore
+	overflowPath  string
+	overflowSize  int64
+	overflowError func(err error)
 }
 
 func newDefaultConfig() *config {
@@ -48,10 +97,27 @@ func newDefaultConfig() *config {
 		maxEntries:   100000,
 		now:          now,
 		hash:         hash,
+		newTicker:    clock.NewTicker,
 		recordMissed: true,
 		recordHit:    true,
 		recordGC:     true,
 		recordLoad:   true,
 		loadFunc:     nil,
+		namespaces:   newNamespaceRegistry(),
+		codec:        gobCodec{},
 	}
 }
+
+// ttlOf returns the ttl of value which will be set to cache.
+// A fluctuated expire time is used if ttl isn't specified, and nil value always uses protect time.
+func (c *config) ttlOf(value interface{}, ttl []time.Duration) time.Duration {
+	if value == nil {
+		return c.protectTime
+	}
+
+	if len(ttl) > 0 {
+		return ttl[0]
+	}
+
+	return fluctuate(c.expireTime)
+}
@@ -0,0 +1,134 @@
+package memcache
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// toInt64 converts value to int64, and unsigned values greater than math.MaxInt64 aren't numeric.
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return uint64ToInt64(uint64(v))
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return uint64ToInt64(v)
+	case string:
+		return parseInt64(v)
+	case []byte:
+		return parseInt64(string(v))
+	default:
+		return 0, ErrNotNumeric
+	}
+}
+
+func uint64ToInt64(v uint64) (int64, error) {
+	if v > math.MaxInt64 {
+		return 0, ErrNotNumeric
+	}
+
+	return int64(v), nil
+}
+
+func parseInt64(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrNotNumeric
+	}
+
+	return n, nil
+}
+
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return parseFloat64(v)
+	case []byte:
+		return parseFloat64(string(v))
+	default:
+		n, err := toInt64(value)
+		return float64(n), err
+	}
+}
+
+func parseFloat64(s string) (float64, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, ErrNotNumeric
+	}
+
+	return n, nil
+}
+
+// setNumber sets n to the entry of key.
+// The ttl of entry is kept if ttl isn't specified.
+func setNumber(ac atomicCache, e *entry, key string, n interface{}, ttl []time.Duration) {
+	if e == nil || len(ttl) > 0 {
+		ac.set(key, n, ttl...)
+		return
+	}
+
+	e.value = &n
+}
+
+func incrBy(ac atomicCache, key string, delta int64, ttl []time.Duration) (int64, error) {
+	e := ac.entryOf(key)
+
+	value, found := valueOf(e)
+	if !found {
+		ac.set(key, delta, ttl...)
+		return delta, nil
+	}
+
+	n, err := toInt64(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+
+	n += delta
+	setNumber(ac, e, key, n, ttl)
+	return n, nil
+}
+
+func incrByFloat(ac atomicCache, key string, delta float64, ttl []time.Duration) (float64, error) {
+	e := ac.entryOf(key)
+
+	value, found := valueOf(e)
+	if !found {
+		ac.set(key, delta, ttl...)
+		return delta, nil
+	}
+
+	n, err := toFloat64(value)
+	if err != nil {
+		return 0, err
+	}
+
+	n += delta
+	setNumber(ac, e, key, n, ttl)
+	return n, nil
+}
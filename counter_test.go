@@ -0,0 +1,128 @@
+package memcache
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -run=^TestCacheIncrBy$
+func TestCacheIncrBy(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithShardings(4), WithGC(0))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 100; j++ {
+					cache.Incr("counter", NoTTL)
+					cache.IncrBy("counter", 2)
+					cache.Decr("counter")
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if value, _ := cache.Get("counter", nil); value != int64(2000) {
+			t.Fatalf("%s: value %v != 2000", name, value)
+		}
+
+		cache.Set("string", "10", NoTTL)
+		if value, err := cache.IncrBy("string", 5); err != nil || value != 15 {
+			t.Fatalf("%s: value %d err %+v is wrong", name, value, err)
+		}
+
+		cache.Set("words", "hello", NoTTL)
+		if _, err := cache.Incr("words"); err != ErrNotNumeric {
+			t.Fatalf("%s: err %+v != ErrNotNumeric", name, err)
+		}
+
+		cache.Set("huge", uint64(math.MaxUint64), NoTTL)
+		if _, err := cache.Incr("huge"); err != ErrNotNumeric {
+			t.Fatalf("%s: err %+v != ErrNotNumeric", name, err)
+		}
+
+		cache.Set("max", int64(math.MaxInt64), NoTTL)
+		if _, err := cache.Incr("max"); err != ErrOverflow {
+			t.Fatalf("%s: err %+v != ErrOverflow", name, err)
+		}
+
+		if value, _ := cache.Get("max", nil); value != int64(math.MaxInt64) {
+			t.Fatalf("%s: value %v != MaxInt64", name, value)
+		}
+
+		cache.Set("min", int64(math.MinInt64), NoTTL)
+		if _, err := cache.Decr("min"); err != ErrOverflow {
+			t.Fatalf("%s: err %+v != ErrOverflow", name, err)
+		}
+
+		cache.Close()
+		if _, err := cache.Incr("counter"); err != ErrClosed {
+			t.Fatalf("%s: err %+v != ErrClosed", name, err)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheIncrByTTL$
+func TestCacheIncrByTTL(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	cache := NewCache(WithLRU(16), WithGC(0), WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	cache.IncrBy("counter", 1, time.Second)
+
+	// The ttl is kept if not specified.
+	fakeClock.Advance(500 * time.Millisecond)
+	cache.IncrBy("counter", 1)
+
+	fakeClock.Advance(600 * time.Millisecond)
+	if _, found := cache.Get("counter", nil); found {
+		t.Fatal("counter should be expired")
+	}
+
+	// An expired key is increased from zero.
+	if value, _ := cache.IncrBy("counter", 1, time.Second); value != 1 {
+		t.Fatalf("value %d != 1", value)
+	}
+
+	// The ttl is reset if specified.
+	fakeClock.Advance(500 * time.Millisecond)
+	cache.IncrBy("counter", 1, time.Second)
+
+	fakeClock.Advance(600 * time.Millisecond)
+	if value, found := cache.Get("counter", nil); !found || value != int64(2) {
+		t.Fatalf("value %v found %v is wrong", value, found)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheIncrByFloat$
+func TestCacheIncrByFloat(t *testing.T) {
+	cache := NewCache(WithS3FIFO(16), WithGC(0))
+	defer cache.Close()
+
+	if value, err := cache.IncrByFloat("counter", 1.5, NoTTL); err != nil || value != 1.5 {
+		t.Fatalf("value %f err %+v is wrong", value, err)
+	}
+
+	if value, err := cache.IncrByFloat("counter", 0.25); err != nil || value != 1.75 {
+		t.Fatalf("value %f err %+v is wrong", value, err)
+	}
+
+	cache.Set("integer", 3, NoTTL)
+	if value, err := cache.IncrByFloat("integer", 0.5); err != nil || value != 3.5 {
+		t.Fatalf("value %f err %+v is wrong", value, err)
+	}
+
+	// A float can't be increased as an integer.
+	if _, err := cache.Incr("counter"); err != ErrNotNumeric {
+		t.Fatalf("err %+v != ErrNotNumeric", err)
+	}
+}
@@ -1,12 +1,19 @@
 package memcache
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type entry struct {
 	key        string
 	value      *interface{}
 	expiration int64 // Time in nanosecond, valid util 2262 year (enough, uh?)
 	now        func() int64
+
+	// visits is the access count of entry used by fifo-based caches.
+	// It's updated atomically so hits only need a read lock.
+	visits int32
 }
 
 func newEntry(key string, value *interface{}, ttl time.Duration, now func() int64) *entry {
@@ -35,3 +42,24 @@ func (e *entry) expired(now int64) bool {
 
 	return e.expiration > 0 && e.expiration < e.now()
 }
+
+// visit increases the visits of entry atomically and stops at limit.
+func (e *entry) visit(limit int32) {
+	for {
+		visits := atomic.LoadInt32(&e.visits)
+		if visits >= limit || atomic.CompareAndSwapInt32(&e.visits, visits, visits+1) {
+			return
+		}
+	}
+}
+
+// unvisit decreases the visits of entry and returns the visits before decreasing.
+// It should be called with the write lock held.
+func (e *entry) unvisit() int32 {
+	visits := atomic.LoadInt32(&e.visits)
+	if visits > 0 {
+		atomic.StoreInt32(&e.visits, visits-1)
+	}
+
+	return visits
+}
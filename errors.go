@@ -0,0 +1,20 @@
+package memcache
+
+import "errors"
+
+var (
+	// ErrClosed is returned when using a closed cache.
+	ErrClosed = errors.New("cachego: cache is closed")
+
+	// ErrNotNumeric is returned when increasing a value which isn't a number.
+	ErrNotNumeric = errors.New("cachego: value is not numeric")
+
+	// ErrOverflow is returned when increasing or decreasing a number overflows int64.
+	ErrOverflow = errors.New("cachego: increment or decrement would overflow")
+
+	// ErrSnapshotCorrupted is returned when loading a snapshot which isn't valid.
+	ErrSnapshotCorrupted = errors.New("cachego: snapshot is corrupted")
+
+	// ErrSnapshotVersion is returned when loading a snapshot of an unsupported version.
+	ErrSnapshotVersion = errors.New("cachego: snapshot version is unsupported")
+)
@@ -0,0 +1,127 @@
+package memcache
+
+import "strings"
+
+// matchGlob reports if s matches the glob pattern.
+// It supports the same syntax as redis:
+//
+//	?      matches any single character
+//	*      matches any sequence of characters
+//	[abc]  matches one character in brackets, and [^abc] or [!abc] matches one not in brackets
+//	[a-z]  matches one character in range
+//	\x     matches character x literally
+//
+// An empty pattern matches everything.
+func matchGlob(pattern string, s string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	px, sx := 0, 0
+
+	// starPx and starSx record the last star for backtracking.
+	starPx, starSx := -1, -1
+
+	for sx < len(s) {
+		if px < len(pattern) {
+			switch pattern[px] {
+			case '*':
+				starPx, starSx = px, sx
+				px++
+				continue
+			case '?':
+				px++
+				sx++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(pattern, px, s[sx]); ok && matched {
+					px = next
+					sx++
+					continue
+				}
+			case '\\':
+				if px+1 < len(pattern) && pattern[px+1] == s[sx] {
+					px += 2
+					sx++
+					continue
+				}
+			default:
+				if pattern[px] == s[sx] {
+					px++
+					sx++
+					continue
+				}
+			}
+		}
+
+		if starPx < 0 {
+			return false
+		}
+
+		// Let the last star match one more character and try again.
+		starSx++
+		px, sx = starPx+1, starSx
+	}
+
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+
+	return px == len(pattern)
+}
+
+// matchClass matches c with the class starting at pattern[px] which is '['.
+// Returns if c matches and the index after class, and ok is false if class isn't closed.
+func matchClass(pattern string, px int, c byte) (matched bool, next int, ok bool) {
+	px++
+
+	negated := false
+	if px < len(pattern) && (pattern[px] == '^' || pattern[px] == '!') {
+		negated = true
+		px++
+	}
+
+	for first := true; px < len(pattern); first = false {
+		if pattern[px] == ']' && !first {
+			return matched != negated, px + 1, true
+		}
+
+		lo := pattern[px]
+		if lo == '\\' && px+1 < len(pattern) {
+			px++
+			lo = pattern[px]
+		}
+
+		hi := lo
+		if px+2 < len(pattern) && pattern[px+1] == '-' && pattern[px+2] != ']' {
+			hi = pattern[px+2]
+			px += 2
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+
+		px++
+	}
+
+	return false, px, false
+}
+
+// escapeGlob escapes all special characters in s so the pattern returned only matches s itself.
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, "*?[\\") {
+		return s
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("*?[\\", s[i]) >= 0 {
+			builder.WriteByte('\\')
+		}
+
+		builder.WriteByte(s[i])
+	}
+
+	return builder.String()
+}
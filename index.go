@@ -0,0 +1,300 @@
+package memcache
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/radix"
+)
+
+// keyIndex indexes keys in cache so some operations don't need to scan all entries.
+// Caches should call add when a key is added and remove when a key is removed for any reason,
+// including removing, evicting and cleaning expired entries.
+// It should be used with the lock of cache held.
+type keyIndex struct {
+	prefixes *radix.Tree
+
+	// tagKeys maps tags to their keys and keyTags maps keys to their tags.
+	// They're created lazily because most caches don't use tags.
+	tagKeys map[string]map[string]struct{}
+	keyTags map[string][]string
+
+	// namespaces are watched so their sizes are counted when keys are added or removed.
+	namespaces []*namespaceWatch
+
+	// tenants counts keys of tenants if cache has tenants.
+	tenants *tenantIndex
+
+	// scans stores keys prefixed with their scan positions, so a page of scanning doesn't walk all keys.
+	// It's nil if cache has no scan index, see WithScanIndex.
+	scans *radix.Tree
+
+	// stamp increases when a key is touched, which orders keys in a segment of cold lists.
+	stamp uint64
+}
+
+// namespaceWatch counts keys of a namespace in one cache and keeps them in a cold list for evicting.
+type namespaceWatch struct {
+	ns    *namespace
+	count int64
+	cold  *coldList
+}
+
+func newNamespaceWatch(ns *namespace) *namespaceWatch {
+	return &namespaceWatch{
+		ns:   ns,
+		cold: newColdList(),
+	}
+}
+
+func newKeyIndex(conf *config) *keyIndex {
+	index := new(keyIndex)
+	if conf.prefixIndex {
+		index.prefixes = radix.New()
+	}
+
+	if conf.scanIndex {
+		index.scans = radix.New()
+	}
+
+	if conf.tenants != nil {
+		index.tenants = newTenantIndex(conf)
+	}
+
+	return index
+}
+
+// renew returns a new index for a reset cache and keeps watching namespaces.
+// Keys in this index are no longer counted in namespaces and tenants.
+func (ki *keyIndex) renew(conf *config) *keyIndex {
+	index := newKeyIndex(conf)
+	if ki == nil {
+		return index
+	}
+
+	for _, watch := range ki.namespaces {
+		atomic.AddInt64(&watch.ns.size, -watch.count)
+		index.namespaces = append(index.namespaces, newNamespaceWatch(watch.ns))
+	}
+
+	if ki.tenants != nil {
+		ki.tenants.release()
+	}
+
+	return index
+}
+
+func (ki *keyIndex) count(key string, delta int64) {
+	for _, watch := range ki.namespaces {
+		if strings.HasPrefix(key, watch.ns.prefix) {
+			watch.count += delta
+			atomic.AddInt64(&watch.ns.size, delta)
+		}
+	}
+
+	if ki.tenants != nil {
+		ki.tenants.count(key, int(delta))
+	}
+}
+
+// watchOf returns the watch of namespace with prefix, or nil if it's not watched.
+func (ki *keyIndex) watchOf(prefix string) *namespaceWatch {
+	for _, watch := range ki.namespaces {
+		if watch.ns.prefix == prefix {
+			return watch
+		}
+	}
+
+	return nil
+}
+
+// touch records that key is added or moved to the front of segment in cache, so cold lists keep the order of evicting.
+// Caches with one list of entries always use segment 0.
+func (ki *keyIndex) touch(key string, segment int) {
+	if len(ki.namespaces) <= 0 && ki.tenants == nil {
+		return
+	}
+
+	ki.stamp++
+	for _, watch := range ki.namespaces {
+		if strings.HasPrefix(key, watch.ns.prefix) {
+			watch.cold.touch(key, segment, ki.stamp)
+		}
+	}
+
+	if ki.tenants != nil {
+		ki.tenants.touch(key, segment, ki.stamp)
+	}
+}
+
+func (ki *keyIndex) add(key string) {
+	if ki.prefixes != nil {
+		ki.prefixes.Insert(key)
+	}
+
+	if ki.scans != nil {
+		ki.scans.Insert(scanKey(key))
+	}
+
+	ki.count(key, 1)
+}
+
+func (ki *keyIndex) remove(key string) {
+	if ki.prefixes != nil {
+		ki.prefixes.Delete(key)
+	}
+
+	if ki.scans != nil {
+		ki.scans.Delete(scanKey(key))
+	}
+
+	for _, watch := range ki.namespaces {
+		if strings.HasPrefix(key, watch.ns.prefix) {
+			watch.cold.remove(key)
+		}
+	}
+
+	if ki.tenants != nil {
+		ki.tenants.remove(key)
+	}
+
+	ki.untag(key)
+	ki.count(key, -1)
+}
+
+// tag replaces the tags of key with tags.
+func (ki *keyIndex) tag(key string, tags []string) {
+	ki.untag(key)
+
+	if len(tags) <= 0 {
+		return
+	}
+
+	if ki.tagKeys == nil {
+		ki.tagKeys = make(map[string]map[string]struct{}, mapInitialCap)
+		ki.keyTags = make(map[string][]string, mapInitialCap)
+	}
+
+	for _, tag := range tags {
+		keys, ok := ki.tagKeys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			ki.tagKeys[tag] = keys
+		}
+
+		keys[key] = struct{}{}
+	}
+
+	ki.keyTags[key] = append([]string(nil), tags...)
+}
+
+func (ki *keyIndex) untag(key string) {
+	tags, ok := ki.keyTags[key]
+	if !ok {
+		return
+	}
+
+	for _, tag := range tags {
+		keys := ki.tagKeys[tag]
+		delete(keys, key)
+
+		if len(keys) <= 0 {
+			delete(ki.tagKeys, tag)
+		}
+	}
+
+	delete(ki.keyTags, key)
+}
+
+// untagExpired removes the tags of an expired entry which is going to be replaced,
+// so the tags won't apply to the new value of key.
+func (ki *keyIndex) untagExpired(e *entry) {
+	if e.expired(0) {
+		ki.untag(e.key)
+	}
+}
+
+// keysWithTag returns all keys having tag.
+func (ki *keyIndex) keysWithTag(tag string) (keys []string) {
+	for key := range ki.tagKeys[tag] {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// keysWithPrefix returns all keys starting with prefix, and ok is false if there is no prefix index.
+func (ki *keyIndex) keysWithPrefix(prefix string) (keys []string, ok bool) {
+	if ki.prefixes == nil {
+		return nil, false
+	}
+
+	ki.prefixes.WalkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	return keys, true
+}
+
+// literalPrefix returns the prefix of glob pattern before any special characters.
+func literalPrefix(pattern string) string {
+	if index := strings.IndexAny(pattern, "*?[\\"); index >= 0 {
+		return pattern[:index]
+	}
+
+	return pattern
+}
+
+// removeLive removes key and returns 1 if key is unexpired, so expired keys aren't counted as removed.
+// It should be called with the lock held.
+func removeLive(wc walkableCache, ac atomicCache, key string) int {
+	e := wc.peek(key)
+	ac.remove(key)
+
+	if _, found := valueOf(e); found && !e.expired(0) {
+		return 1
+	}
+
+	return 0
+}
+
+// removeMatched removes all unexpired keys matching fn and returns the count removed.
+// prefix is used to find keys by index if possible, and all keys matched must start with it.
+// It should be called with the lock held.
+func removeMatched(wc walkableCache, ac atomicCache, index *keyIndex, prefix string, fn func(key string) bool) (removed int) {
+	keys, ok := index.keysWithPrefix(prefix)
+	if !ok {
+		wc.walk(func(e *entry) bool {
+			keys = append(keys, e.key)
+			return true
+		})
+	}
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && fn(key) {
+			removed += removeLive(wc, ac, key)
+		}
+	}
+
+	return removed
+}
+
+// setWithTags sets key with value and ttl and replaces the tags of key with tags.
+// It should be called with the lock held.
+func setWithTags(ac atomicCache, index *keyIndex, key string, value interface{}, ttl time.Duration, tags []string) (evictedValue interface{}) {
+	evictedValue = ac.set(key, value, ttl)
+	index.tag(key, tags)
+	return evictedValue
+}
+
+// invalidateTag removes all keys having tag and returns the count of unexpired keys removed.
+// It should be called with the lock held.
+func invalidateTag(wc walkableCache, ac atomicCache, index *keyIndex, tag string) (removed int) {
+	for _, key := range index.keysWithTag(tag) {
+		removed += removeLive(wc, ac, key)
+	}
+
+	return removed
+}
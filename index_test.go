@@ -0,0 +1,211 @@
+package memcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheRemovePrefix$
+func TestCacheRemovePrefix(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		for _, withIndex := range []bool{false, true} {
+			opts := []Option{withPolicy(1024), WithShardings(4), WithGC(0)}
+			if withIndex {
+				opts = append(opts, WithPrefixIndex())
+			}
+
+			cache := NewCache(opts...)
+			for i := 0; i < 10; i++ {
+				cache.Set("tenant:123:"+strconv.Itoa(i), i, NoTTL)
+				cache.Set("tenant:1234:"+strconv.Itoa(i), i, NoTTL)
+				cache.Set("tenant:456:"+strconv.Itoa(i), i, NoTTL)
+			}
+
+			if removed := cache.RemovePrefix("tenant:123:"); removed != 10 {
+				t.Fatalf("%s %v: removed %d != 10", name, withIndex, removed)
+			}
+
+			if removed := cache.RemoveMatch("tenant:*:[0-4]"); removed != 10 {
+				t.Fatalf("%s %v: removed %d != 10", name, withIndex, removed)
+			}
+
+			if removed := cache.RemoveMatch("tenant:456:?"); removed != 5 {
+				t.Fatalf("%s %v: removed %d != 5", name, withIndex, removed)
+			}
+
+			if size := cache.Size(); size != 5 {
+				t.Fatalf("%s %v: size %d != 5", name, withIndex, size)
+			}
+
+			cache.Close()
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestKeyIndexConsistency$
+func TestKeyIndexConsistency(t *testing.T) {
+	for name, cacheType := range map[string]CacheType{"lru": lru, "arc": arc, "s3fifo": s3fifo, "sieve": sieve} {
+		fakeClock := clock.NewFake(time.Now())
+
+		conf := newDefaultConfig()
+		conf.cacheType = cacheType
+		conf.maxEntries = 16
+		conf.prefixIndex = true
+		conf.now = fakeClock.Now
+
+		cache := newCaches[cacheType](conf)
+		for i := 0; i < 100; i++ {
+			key := strconv.Itoa(i % 40)
+
+			cache.Set(key, i, time.Duration(i%5+1)*time.Second)
+			cache.Get(strconv.Itoa(i%7), nil)
+
+			if i%9 == 0 {
+				cache.Remove(strconv.Itoa(i % 11))
+			}
+
+			if i%13 == 0 {
+				fakeClock.Advance(time.Second)
+				cache.GC()
+			}
+		}
+
+		var index *keyIndex
+		switch c := cache.(type) {
+		case *lruCache:
+			index = c.index
+		case *arcCache:
+			index = c.index
+		case *s3fifoCache:
+			index = c.index
+		case *sieveCache:
+			index = c.index
+		}
+
+		if indexed := index.prefixes.Size(); indexed != cache.Size() {
+			t.Fatalf("%s: indexed %d != size %d", name, indexed, cache.Size())
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheInvalidateTag$
+func TestCacheInvalidateTag(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(1024), WithShardings(4), WithGC(0))
+
+		for i := 0; i < 10; i++ {
+			key := "page:" + strconv.Itoa(i)
+			cache.SetWithTags(key, i, NoTTL, "product:42", "page:"+strconv.Itoa(i%2))
+		}
+
+		cache.SetWithTags("product:42", 42, NoTTL, "product:42")
+		cache.Set("product:43", 43, NoTTL)
+
+		if removed := cache.InvalidateTag("page:0"); removed != 5 {
+			t.Fatalf("%s: removed %d != 5", name, removed)
+		}
+
+		// Replacing tags of a key should drop its old tags.
+		cache.SetWithTags("page:1", 1, NoTTL, "product:43")
+
+		if removed := cache.InvalidateTag("product:42"); removed != 5 {
+			t.Fatalf("%s: removed %d != 5", name, removed)
+		}
+
+		if removed := cache.InvalidateTag("product:42"); removed != 0 {
+			t.Fatalf("%s: removed %d != 0", name, removed)
+		}
+
+		if size := cache.Size(); size != 2 {
+			t.Fatalf("%s: size %d != 2", name, size)
+		}
+
+		if _, found := cache.Get("page:1", nil); !found {
+			t.Fatalf("%s: page:1 should be found", name)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestKeyIndexTagCleanup$
+func TestKeyIndexTagCleanup(t *testing.T) {
+	for name, cacheType := range map[string]CacheType{"lru": lru, "arc": arc, "s3fifo": s3fifo, "sieve": sieve} {
+		fakeClock := clock.NewFake(time.Now())
+
+		conf := newDefaultConfig()
+		conf.cacheType = cacheType
+		conf.maxEntries = 16
+		conf.now = fakeClock.Now
+
+		cache := newCaches[cacheType](conf)
+		for i := 0; i < 100; i++ {
+			key := strconv.Itoa(i % 40)
+
+			cache.SetWithTags(key, i, time.Duration(i%5+1)*time.Second, "all", "mod:"+strconv.Itoa(i%3))
+			cache.Get(strconv.Itoa(i%7), nil)
+
+			if i%9 == 0 {
+				cache.Remove(strconv.Itoa(i % 11))
+			}
+
+			if i%13 == 0 {
+				fakeClock.Advance(time.Second)
+				cache.GC()
+			}
+		}
+
+		var index *keyIndex
+		switch c := cache.(type) {
+		case *lruCache:
+			index = c.index
+		case *arcCache:
+			index = c.index
+		case *s3fifoCache:
+			index = c.index
+		case *sieveCache:
+			index = c.index
+		}
+
+		if tagged := len(index.keyTags); tagged != cache.Size() {
+			t.Fatalf("%s: tagged %d != size %d", name, tagged, cache.Size())
+		}
+
+		if tagged := len(index.tagKeys["all"]); tagged != cache.Size() {
+			t.Fatalf("%s: tagged %d != size %d", name, tagged, cache.Size())
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheInvalidateTagExpired$
+func TestCacheInvalidateTagExpired(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		fakeClock := clock.NewFake(time.Now())
+		cache := NewCache(withPolicy(16), WithGC(0), WithNow(fakeClock.Now))
+
+		cache.SetWithTags("expired", "old", time.Second, "tag")
+		cache.SetWithTags("replaced", "old", time.Second, "tag")
+		cache.SetWithTags("prefix:expired", "old", time.Second)
+		fakeClock.Advance(2 * time.Second)
+
+		// The new value of an expired key doesn't have the tags of the old one.
+		cache.Set("replaced", "new", NoTTL)
+
+		if removed := cache.InvalidateTag("tag"); removed != 0 {
+			t.Fatalf("%s: removed %d != 0", name, removed)
+		}
+
+		if value, found := cache.Get("replaced", nil); !found || value != "new" {
+			t.Fatalf("%s: value %+v is wrong or not found", name, value)
+		}
+
+		if removed := cache.RemovePrefix("prefix:"); removed != 0 {
+			t.Fatalf("%s: removed %d != 0", name, removed)
+		}
+
+		cache.Close()
+	}
+}
@@ -0,0 +1,56 @@
+package memcache
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// keyLockCount is the count of striped locks of keys, which is a power of 2.
+	keyLockCount = 256
+)
+
+// keyLocks are striped locks of keys, which serialize writes of the same key without one lock for all keys.
+type keyLocks struct {
+	locks []sync.Mutex
+	hash  func(key string) int
+}
+
+func newKeyLocks(hash func(key string) int) *keyLocks {
+	return &keyLocks{
+		locks: make([]sync.Mutex, keyLockCount),
+		hash:  hash,
+	}
+}
+
+// lock locks the striped locks of keys and returns a function unlocking them.
+// Locks are locked in order, so locking keys of batches never deadlocks.
+func (kl *keyLocks) lock(keys ...string) (unlock func()) {
+	mask := len(kl.locks) - 1
+	if len(keys) == 1 {
+		l := &kl.locks[kl.hash(keys[0])&mask]
+		l.Lock()
+		return l.Unlock
+	}
+
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]struct{}, len(keys))
+	for _, key := range keys {
+		index := kl.hash(key) & mask
+		if _, ok := seen[index]; !ok {
+			seen[index] = struct{}{}
+			indexes = append(indexes, index)
+		}
+	}
+
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		kl.locks[index].Lock()
+	}
+
+	return func() {
+		for i := len(indexes) - 1; i >= 0; i-- {
+			kl.locks[indexes[i]].Unlock()
+		}
+	}
+}
@@ -3,6 +3,7 @@ package memcache
 import (
 	"container/list"
 	"fmt"
+	"io"
 	"math/rand"
 	"sync"
 	"time"
@@ -15,6 +16,13 @@ type lruCache struct {
 	elementList *list.List
 	lock        sync.RWMutex
 
+	// buffer records hits with the read lock and promotes them in batches with the write lock.
+	buffer *readBuffer
+	index  *keyIndex
+
+	// spills are keys spilled to overflow with the lock held, which are written to overflow after releasing the lock.
+	spills []string
+
 	// loader *loader
 }
 
@@ -27,6 +35,8 @@ func newLRUCache(conf *config) Cache {
 		config:      conf,
 		elementMap:  make(map[string]*list.Element, mapInitialCap),
 		elementList: list.New(),
+		buffer:      newReadBuffer(),
+		index:       newKeyIndex(conf),
 		// loader:      newLoader(conf.singleflight),
 	}
 
@@ -42,30 +52,117 @@ func (lc *lruCache) unwrap(element *list.Element) *entry {
 	return entry
 }
 
+// moveToFront moves element to front and touches its key in index.
+// Elements removed from list are ignored, because they may be buffered before removing.
+func (lc *lruCache) moveToFront(element *list.Element) {
+	entry := lc.unwrap(element)
+	if lc.elementMap[entry.key] != element {
+		return
+	}
+
+	lc.elementList.MoveToFront(element)
+	lc.index.touch(entry.key, 0)
+}
+
+// promote moves all elements in batch to front.
+// Elements removed from list are ignored by list itself.
+func (lc *lruCache) promote(batch []*list.Element) {
+	for _, element := range batch {
+		lc.moveToFront(element)
+	}
+}
+
 func (lc *lruCache) evict() (evictedValue interface{}) {
+	// Apply buffered hits first so we won't evict an element which has been hit recently.
+	lc.buffer.drain(lc.moveToFront)
+
 	if element := lc.elementList.Back(); element != nil {
-		return lc.removeElement(element)
+		return lc.evictElement(element)
 	}
 
 	return nil
 }
 
-func (lc *lruCache) get(key string) (value interface{}, found bool) {
+// evictKey evicts key chosen by namespaces or tenants, so it's spilled to overflow like keys evicted by policy.
+func (lc *lruCache) evictKey(key string) (evictedValue interface{}) {
+	if element, ok := lc.elementMap[key]; ok {
+		return lc.evictElement(element)
+	}
+
+	return nil
+}
+
+func (lc *lruCache) evictElement(element *list.Element) (evictedValue interface{}) {
+	lc.spill(lc.unwrap(element))
+	return lc.removeElement(element)
+}
+
+// spill stages the entry being evicted in overflow if it's unexpired, and it's written to overflow by unlock.
+func (lc *lruCache) spill(e *entry) {
+	if lc.overflow == nil {
+		return
+	}
+
+	if state, found := stateOfEntry(e, lc.index); found {
+		lc.overflow.stage(e.key, state)
+		lc.spills = append(lc.spills, e.key)
+	}
+}
+
+// unlock releases the write lock and writes entries spilled with the lock held to overflow.
+// Encoding and writing entries may be slow, so they're done without the lock.
+func (lc *lruCache) unlock() {
+	spills := lc.spills
+	lc.spills = nil
+	lc.lock.Unlock()
+
+	for _, key := range spills {
+		lc.overflow.write(key)
+	}
+}
+
+// restore moves key from overflow back to cache and returns its entry, or nil if key isn't in overflow.
+// It should be called with the write lock held.
+func (lc *lruCache) restore(key string) *entry {
+	if lc.overflow == nil {
+		return nil
+	}
+
+	state, found := lc.overflow.take(key)
+	if !found {
+		return nil
+	}
+
+	ttl := time.Duration(NoTTL)
+	if state.expiration > 0 {
+		if ttl = time.Duration(state.expiration - lc.now()); ttl <= 0 {
+			return nil
+		}
+	}
+
+	setWithTags(lc, lc.index, key, state.value, ttl, state.tags)
+	return lc.unwrap(lc.elementMap[key])
+}
+
+// get gets the value of key and records the hit to buffer instead of moving element to front.
+// It only needs the read lock, and the returned batch should be promoted with the write lock.
+func (lc *lruCache) get(key string) (value interface{}, found bool, batch []*list.Element) {
 	element, ok := lc.elementMap[key]
 	if !ok {
-		return nil, false
+		return nil, false, nil
 	}
 
 	entry := lc.unwrap(element)
 	if entry.expired(0) {
-		return nil, false
+		return nil, false, nil
 	}
-	lc.elementList.MoveToFront(element)
+
+	batch = lc.buffer.record(lc.hash(key), element)
 	if entry.value == nil {
-		return nil, false
-	} else {
-		return *entry.value, true
+		return nil, false, batch
 	}
+
+	return *entry.value, true, batch
 }
 
 func fluctuate(a time.Duration) time.Duration {
@@ -80,39 +177,64 @@ func fluctuate(a time.Duration) time.Duration {
 }
 
 func (lc *lruCache) set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
-	curTtl := fluctuate(lc.expireTime)
-	if len(ttl) > 0 {
-		curTtl = ttl[0]
-	}
-	if value == nil {
-		curTtl = lc.protectTime
-	}
+	curTtl := lc.ttlOf(value, ttl)
 	element, ok := lc.elementMap[key]
 	if ok {
 		entry := lc.unwrap(element)
+		lc.index.untagExpired(entry)
 		entry.setup(key, &value, curTtl)
 
-		lc.elementList.MoveToFront(element)
+		lc.moveToFront(element)
 		return nil
 	}
 
+	if lc.index.tenants != nil {
+		// Apply buffered hits first so tenants evict their coldest keys.
+		lc.buffer.drain(lc.moveToFront)
+		evictedValue = makeRoom(lc, lc.index, key, lc.size())
+	}
+
 	if lc.maxEntries > 0 && lc.elementList.Len() >= lc.maxEntries {
 		evictedValue = lc.evict()
 	}
 
+	// The old value of key in overflow is stale now.
+	if lc.overflow != nil {
+		lc.overflow.remove(key)
+	}
+
 	element = lc.elementList.PushFront(newEntry(key, &value, curTtl, lc.now))
 	lc.elementMap[key] = element
+	lc.index.add(key)
+	lc.index.touch(key, 0)
 
 	return evictedValue
 }
 
+// entryOf returns the entry of key, and key in overflow is restored to cache.
+func (lc *lruCache) entryOf(key string) *entry {
+	element, ok := lc.elementMap[key]
+	if !ok {
+		return lc.restore(key)
+	}
+
+	entry := lc.unwrap(element)
+	if entry.expired(0) {
+		return nil
+	}
+
+	lc.moveToFront(element)
+	return entry
+}
+
 func (lc *lruCache) removeElement(element *list.Element) (removedValue interface{}) {
 	entry := lc.unwrap(element)
 
 	delete(lc.elementMap, entry.key)
 	lc.elementList.Remove(element)
+	lc.index.remove(entry.key)
 
-	return entry.value
+	return *entry.value
 }
 
 func (lc *lruCache) remove(key string) (removedValue interface{}) {
@@ -120,9 +242,40 @@ func (lc *lruCache) remove(key string) (removedValue interface{}) {
 		return lc.removeElement(element)
 	}
 
+	if lc.overflow != nil {
+		if state, found := lc.overflow.take(key); found {
+			return state.value
+		}
+	}
+
+	return nil
+}
+
+func (lc *lruCache) peek(key string) *entry {
+	if element, ok := lc.elementMap[key]; ok {
+		return lc.unwrap(element)
+	}
+
 	return nil
 }
 
+func (lc *lruCache) walk(fn func(e *entry) bool) {
+	for element := lc.elementList.Front(); element != nil; element = element.Next() {
+		if !fn(lc.unwrap(element)) {
+			return
+		}
+	}
+}
+
+// walkCold walks entries from the back which is evicted first.
+func (lc *lruCache) walkCold(fn func(e *entry, segment int) bool) {
+	for element := lc.elementList.Back(); element != nil; element = element.Prev() {
+		if !fn(lc.unwrap(element), 0) {
+			return
+		}
+	}
+}
+
 func (lc *lruCache) size() (size int) {
 	return len(lc.elementMap)
 }
@@ -144,44 +297,70 @@ func (lc *lruCache) gc() (cleans int) {
 		}
 	}
 
+	// Shards share one overflow, so sharding cache cleans it once instead of each shard.
+	if lc.overflow != nil && lc.shardings <= 0 {
+		cleans += lc.overflow.gc(now)
+	}
+
 	return cleans
 }
 
 func (lc *lruCache) reset() {
 	lc.elementMap = make(map[string]*list.Element, mapInitialCap)
 	lc.elementList = list.New()
+	lc.buffer = newReadBuffer()
+	lc.index = lc.index.renew(lc.config)
+
+	if lc.overflow != nil && lc.shardings <= 0 {
+		lc.overflow.reset()
+	}
 
 	// lc.loader.Reset()
 }
 
 // Get gets the value of key from cache and returns value if found.
+// A hit only takes the read lock, and it will be promoted in batches later.
 // See Cache interface.
 func (lc *lruCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
-	lc.lock.Lock()
-	defer lc.lock.Unlock()
+	lc.lock.RLock()
+	value, found, batch := lc.get(key)
+	lc.lock.RUnlock()
 
-	value, found = lc.get(key)
-	if !found {
-		if lc.loadFunc != nil {
-			newVals, err := lc.loadFunc([]string{key}, deserializeF)
-			if err == nil && len(newVals) > 0 {
-				lc.set(key, newVals[0])
-				return value, found
-			}
+	// Promoting is lossy, so we give up if someone else is holding the lock.
+	if len(batch) > 0 && lc.lock.TryLock() {
+		lc.promote(batch)
+		lc.unlock()
+	}
+
+	if !found && lc.overflow != nil {
+		lc.lock.Lock()
+		value, found = valueOf(lc.entryOf(key))
+		lc.unlock()
+	}
+
+	if !found && lc.loadFunc != nil {
+		newVals, err := lc.loadFunc([]string{key}, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			lc.Set(key, newVals[0])
 		}
 	}
+
 	return value, found
 }
 
 func (lc *lruCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
-	lc.lock.Lock()
-	defer lc.lock.Unlock()
 	values = make([]interface{}, len(keys))
 	founds = make([]bool, len(keys))
 	mio := &MInOuput{}
+
+	var batches []*list.Element
+
+	lc.lock.RLock()
 	for i, key := range keys {
-		value, found := lc.get(key)
+		value, found, batch := lc.get(key)
 		founds[i] = found
+		batches = append(batches, batch...)
+
 		if !found {
 			mio.Keys = append(mio.Keys, key)
 			mio.Indexes = append(mio.Indexes, i)
@@ -189,15 +368,47 @@ func (lc *lruCache) MGet(keys []string, deserializeF DeserializeFunc) (values []
 			values[i] = value
 		}
 	}
-	if len(mio.Keys) > 0 && lc.loadFunc != nil {
-		newVals, err := lc.loadFunc(mio.Keys, deserializeF)
-		if err == nil && len(newVals) > 0 {
-			for i, index := range mio.Indexes {
-				values[index] = newVals[i]
-				lc.set(mio.Keys[i], newVals[i])
+	lc.lock.RUnlock()
+
+	if len(mio.Keys) > 0 && lc.overflow != nil {
+		missed := &MInOuput{}
+
+		lc.lock.Lock()
+		for i, key := range mio.Keys {
+			index := mio.Indexes[i]
+			if values[index], founds[index] = valueOf(lc.entryOf(key)); !founds[index] {
+				missed.Keys = append(missed.Keys, key)
+				missed.Indexes = append(missed.Indexes, index)
 			}
 		}
+		lc.unlock()
+
+		mio = missed
+	}
+
+	var newVals []interface{}
+	if len(mio.Keys) > 0 && lc.loadFunc != nil {
+		loadedVals, err := lc.loadFunc(mio.Keys, deserializeF)
+		if err == nil && len(loadedVals) > 0 {
+			newVals = loadedVals
+		}
 	}
+
+	if len(batches) <= 0 && len(newVals) <= 0 {
+		return values, founds
+	}
+
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	lc.promote(batches)
+	for i, index := range mio.Indexes {
+		if i < len(newVals) {
+			values[index] = newVals[i]
+			lc.set(mio.Keys[i], newVals[i])
+		}
+	}
+
 	return values, founds
 }
 
@@ -205,14 +416,14 @@ func (lc *lruCache) MGet(keys []string, deserializeF DeserializeFunc) (values []
 // See Cache interface.
 func (lc *lruCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
 	lc.lock.Lock()
-	defer lc.lock.Unlock()
+	defer lc.unlock()
 
 	return lc.set(key, value, ttl...)
 }
 
 func (lc *lruCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
 	lc.lock.Lock()
-	defer lc.lock.Unlock()
+	defer lc.unlock()
 	if len(keys) != len(values) {
 		fmt.Printf("cachego: keys and values must have the same length, key: %v, value: %v\n", keys, values)
 		return nil
@@ -227,15 +438,237 @@ func (lc *lruCache) MSet(keys []string, values []interface{}, ttls ...time.Durat
 	return evictedValues
 }
 
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (lc *lruCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return setWithTags(lc, lc.index, key, value, ttl, tags)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (lc *lruCache) InvalidateTag(tag string) (removed int) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	removed = invalidateTag(lc, lc, lc.index, tag)
+	if lc.overflow != nil {
+		removed += lc.overflow.invalidateTag(tag)
+	}
+
+	return removed
+}
+
 // Remove removes key and returns the removed value of key.
 // See Cache interface.
 func (lc *lruCache) Remove(key string) (removedValue interface{}) {
 	lc.lock.Lock()
-	defer lc.lock.Unlock()
+	defer lc.unlock()
 
 	return lc.remove(key)
 }
 
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (lc *lruCache) RemovePrefix(prefix string) (removed int) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	matched := func(key string) bool {
+		return true
+	}
+
+	removed = removeMatched(lc, lc, lc.index, prefix, matched)
+	if lc.overflow != nil {
+		removed += lc.overflow.removeMatched(prefix, matched)
+	}
+
+	return removed
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (lc *lruCache) RemoveMatch(pattern string) (removed int) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	matched := func(key string) bool {
+		return matchGlob(pattern, key)
+	}
+
+	removed = removeMatched(lc, lc, lc.index, literalPrefix(pattern), matched)
+	if lc.overflow != nil {
+		removed += lc.overflow.removeMatched(literalPrefix(pattern), matched)
+	}
+
+	return removed
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (lc *lruCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return getOrSet(lc, key, value, ttl)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (lc *lruCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return compareAndSwap(lc, key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (lc *lruCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return compareAndDelete(lc, key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (lc *lruCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return update(lc, key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (lc *lruCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return lc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (lc *lruCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return lc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (lc *lruCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return incrBy(lc, key, delta, ttl)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (lc *lruCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	return incrByFloat(lc, key, delta, ttl)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (lc *lruCache) Range(fn RangeFunc) {
+	lc.lock.RLock()
+	items := collect(lc, lc.now())
+	lc.lock.RUnlock()
+
+	rangeItems(items, fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (lc *lruCache) Keys() (keys []string) {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	now := lc.now()
+	lc.walk(func(e *entry) bool {
+		if _, found := valueOf(e); found && !e.expired(now) {
+			keys = append(keys, e.key)
+		}
+
+		return true
+	})
+
+	return keys
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (lc *lruCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	return scan(lc, lc.index, lc.now(), cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (lc *lruCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(lc.config, lc, name, quota)
+}
+
+func (lc *lruCache) watchNamespace(ns *namespace) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	watchNamespace(lc, lc.index, ns)
+}
+
+func (lc *lruCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	lc.buffer.drain(lc.moveToFront)
+	return evictPrefix(lc, lc.index, prefix, skip)
+}
+
+// stateOf returns the state of key without recording an access.
+func (lc *lruCache) stateOf(key string) (state keyState, found bool) {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	element, ok := lc.elementMap[key]
+	if !ok {
+		return state, false
+	}
+
+	return stateOfEntry(lc.unwrap(element), lc.index)
+}
+
+// ttlOfKey returns the remaining ttl of key without recording an access.
+func (lc *lruCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	return ttlOfEntry(lc.peek(key), lc.now())
+}
+
+// Flush does nothing because cache has no store.
+// See Cache interface.
+func (lc *lruCache) Flush() error {
+	return nil
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (lc *lruCache) SaveSnapshot(w io.Writer) error {
+	return saveSnapshot(lc, lc.codec, w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (lc *lruCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(lc, lc.codec, r)
+}
+
 // Size returns the count of keys in cache.
 // See Cache interface.
 func (lc *lruCache) Size() (size int) {
@@ -249,7 +682,7 @@ func (lc *lruCache) Size() (size int) {
 // See Cache interface.
 func (lc *lruCache) GC() (cleans int) {
 	lc.lock.Lock()
-	defer lc.lock.Unlock()
+	defer lc.unlock()
 
 	return lc.gc()
 }
@@ -258,11 +691,21 @@ func (lc *lruCache) GC() (cleans int) {
 // See Cache interface.
 func (lc *lruCache) Reset() {
 	lc.lock.Lock()
-	defer lc.lock.Unlock()
+	defer lc.unlock()
 
 	lc.reset()
 }
 
+// Close releases all entries in cache.
+// See Cache interface.
+func (lc *lruCache) Close() error {
+	lc.lock.Lock()
+	defer lc.unlock()
+
+	lc.reset()
+	return nil
+}
+
 // Load loads a value by load function and sets it to cache.
 // Returns an error if load failed.
 // func (lc *lruCache) Load(key string, ttl time.Duration, load func() (value interface{}, err error)) (value interface{}, err error) {
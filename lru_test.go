@@ -0,0 +1,149 @@
+package memcache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func newTestLRUCache(maxEntries int) *lruCache {
+	conf := newDefaultConfig()
+	conf.maxEntries = maxEntries
+
+	return newLRUCache(conf).(*lruCache)
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestLRUCachePromote$
+func TestLRUCachePromote(t *testing.T) {
+	cache := newTestLRUCache(4)
+
+	for i := 0; i < 4; i++ {
+		cache.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	// The hit of key 0 is buffered and should be applied before evicting.
+	if _, found := cache.Get("0", nil); !found {
+		t.Fatal("key 0 not found")
+	}
+
+	cache.Set("4", 4, NoTTL)
+
+	if _, found := cache.Get("0", nil); !found {
+		t.Fatal("key 0 should be promoted and survive")
+	}
+
+	if _, found := cache.Get("1", nil); found {
+		t.Fatal("key 1 should be evicted")
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestLRUCachePromoteBatch$
+func TestLRUCachePromoteBatch(t *testing.T) {
+	cache := newTestLRUCache(4)
+	cache.buffer = &readBuffer{stripes: make([]readStripe, 1)}
+
+	for i := 0; i < 4; i++ {
+		cache.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	for i := 0; i < readStripeSize; i++ {
+		cache.Get("0", nil)
+	}
+
+	// A full stripe is promoted at once without waiting for eviction.
+	if front := cache.unwrap(cache.elementList.Front()); front.key != "0" {
+		t.Fatalf("front.key %s != 0", front.key)
+	}
+
+	if count := cache.buffer.stripes[0].count; count != 0 {
+		t.Fatalf("count %d != 0", count)
+	}
+}
+
+// go test -v -cover -count=1 -run=^TestLRUCacheConcurrentPromote$
+func TestLRUCacheConcurrentPromote(t *testing.T) {
+	cache := newTestLRUCache(64)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(offset int) {
+			defer wg.Done()
+
+			for j := 0; j < 10000; j++ {
+				key := strconv.Itoa((offset + j) % 128)
+				if _, found := cache.Get(key, nil); !found {
+					cache.Set(key, j, NoTTL)
+				}
+
+				if j%1000 == 0 {
+					cache.Remove(key)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if size := cache.Size(); size > 64 || size != cache.elementList.Len() {
+		t.Fatalf("size %d is wrong with list len %d", size, cache.elementList.Len())
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestLRUCacheRemovedValue$
+func TestLRUCacheRemovedValue(t *testing.T) {
+	cache := newTestLRUCache(2)
+	cache.Set("key1", "value1", NoTTL)
+	cache.Set("key2", "value2", NoTTL)
+
+	// Entries store pointers of values, and callers should get the values instead of the pointers.
+	if evictedValue := cache.Set("key3", "value3", NoTTL); evictedValue != "value1" {
+		t.Fatalf("evictedValue %+v != value1", evictedValue)
+	}
+
+	if removedValue := cache.Remove("key2"); removedValue != "value2" {
+		t.Fatalf("removedValue %+v != value2", removedValue)
+	}
+
+	if removedValue := cache.Remove("key2"); removedValue != nil {
+		t.Fatalf("removedValue %+v != nil", removedValue)
+	}
+}
+
+// go test -v -run=^$ -bench=^BenchmarkLRUCacheGet$ -benchtime=1s
+func BenchmarkLRUCacheGet(b *testing.B) {
+	cache := newTestLRUCache(1024)
+	for i := 0; i < 1024; i++ {
+		cache.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		cache.Get(strconv.Itoa(i&1023), nil)
+	}
+}
+
+// go test -v -run=^$ -bench=^BenchmarkLRUCacheGetParallel$ -benchtime=1s -cpu=1,2,4,8
+func BenchmarkLRUCacheGetParallel(b *testing.B) {
+	cache := newTestLRUCache(1024)
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		cache.Set(keys[i], i, NoTTL)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Get(keys[i&1023], nil)
+			i++
+		}
+	})
+}
@@ -0,0 +1,513 @@
+package memcache
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// namespaceSeparator separates the name of namespace and the key in namespace.
+	namespaceSeparator = ":"
+)
+
+// namespace stores the status of keys starting with its prefix.
+type namespace struct {
+	name   string
+	prefix string
+
+	// watched is false if the underlying cache can't count keys for namespace.
+	// Size is counted by ranging cache in this case.
+	watched bool
+
+	size         int64
+	quota        int64
+	hitCount     uint64
+	missedCount  uint64
+	evictedCount uint64
+}
+
+// namespaceRegistry stores all namespaces of a cache, so views with the same name share one namespace.
+type namespaceRegistry struct {
+	namespaces map[string]*namespace
+	lock       sync.Mutex
+}
+
+func newNamespaceRegistry() *namespaceRegistry {
+	return &namespaceRegistry{
+		namespaces: make(map[string]*namespace),
+	}
+}
+
+// namespaceOf returns the namespace of name and creates it if not exists.
+// A new namespace is watched by cache so its size is counted when keys are added or removed.
+func (nr *namespaceRegistry) namespaceOf(cache Cache, name string, quota []int) *namespace {
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+
+	ns, ok := nr.namespaces[name]
+	if !ok {
+		ns = &namespace{
+			name:   name,
+			prefix: name + namespaceSeparator,
+		}
+
+		ns.watched = watchNamespaceOf(cache, ns)
+		nr.namespaces[name] = ns
+	}
+
+	if len(quota) > 0 {
+		atomic.StoreInt64(&ns.quota, int64(quota[0]))
+	}
+
+	return ns
+}
+
+func (nr *namespaceRegistry) all() (namespaces []*namespace) {
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+
+	for _, ns := range nr.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].name < namespaces[j].name
+	})
+
+	return namespaces
+}
+
+// namespaceWatcher is a cache which can count keys of namespaces when keys are added or removed.
+type namespaceWatcher interface {
+	watchNamespace(ns *namespace)
+}
+
+// prefixEvictor is a cache which can evict the coldest key starting with prefix.
+type prefixEvictor interface {
+	evictPrefix(prefix string, skip string) (evicted bool)
+}
+
+// keyEvictor is a cache which can evict a key chosen by namespaces or tenants like evicting by its policy.
+// evictKey should be called with the lock held.
+type keyEvictor interface {
+	evictKey(key string) (evictedValue interface{})
+}
+
+// coldWalkableCache is a cache whose entries can be walked from the coldest one which will be evicted first.
+// Entries are walked with the segment they're in, see keyIndex.touch.
+// walkCold should be called with the lock held.
+type coldWalkableCache interface {
+	walkCold(fn func(e *entry, segment int) bool)
+}
+
+func watchNamespaceOf(cache Cache, ns *namespace) bool {
+	watcher, ok := cache.(namespaceWatcher)
+	if ok {
+		watcher.watchNamespace(ns)
+	}
+
+	return ok
+}
+
+func evictPrefixOf(cache Cache, prefix string, skip string) bool {
+	evictor, ok := cache.(prefixEvictor)
+	return ok && evictor.evictPrefix(prefix, skip)
+}
+
+// watchNamespace counts existing keys of ns and lets index count keys of ns later.
+// Existing keys are walked from the coldest one, so the cold list of ns has the same order as cache.
+// It should be called with the lock held.
+func watchNamespace(cwc coldWalkableCache, index *keyIndex, ns *namespace) {
+	watch := newNamespaceWatch(ns)
+
+	cwc.walkCold(func(e *entry, segment int) bool {
+		if strings.HasPrefix(e.key, ns.prefix) {
+			index.stamp++
+			watch.cold.touch(e.key, segment, index.stamp)
+			watch.count++
+		}
+
+		return true
+	})
+
+	atomic.AddInt64(&ns.size, watch.count)
+	index.namespaces = append(index.namespaces, watch)
+}
+
+// evictPrefix removes the coldest key of the namespace with prefix except skip and reports if removed.
+// The coldest key is found by the cold list of namespace, so it doesn't walk all keys of cache.
+// It should be called with the lock held.
+func evictPrefix(ke keyEvictor, index *keyIndex, prefix string, skip string) (evicted bool) {
+	watch := index.watchOf(prefix)
+	if watch == nil {
+		return false
+	}
+
+	victim := watch.cold.coldest(skip)
+	if victim == nil {
+		return false
+	}
+
+	ke.evictKey(victim.key)
+	return true
+}
+
+// NamespaceStats is the stats of a namespace.
+type NamespaceStats struct {
+	Name         string
+	Size         int
+	Quota        int
+	HitCount     uint64
+	MissedCount  uint64
+	EvictedCount uint64
+}
+
+func (ns *namespace) stats() NamespaceStats {
+	return NamespaceStats{
+		Name:         ns.name,
+		Size:         int(atomic.LoadInt64(&ns.size)),
+		Quota:        int(atomic.LoadInt64(&ns.quota)),
+		HitCount:     atomic.LoadUint64(&ns.hitCount),
+		MissedCount:  atomic.LoadUint64(&ns.missedCount),
+		EvictedCount: atomic.LoadUint64(&ns.evictedCount),
+	}
+}
+
+// HitRate returns the hit rate of namespace.
+func (ns NamespaceStats) HitRate() float64 {
+	total := ns.HitCount + ns.MissedCount
+	if total <= 0 {
+		return 0.0
+	}
+
+	return float64(ns.HitCount) / float64(total)
+}
+
+// namespaceCache is a view of cache whose keys are prefixed with the prefix of namespace.
+type namespaceCache struct {
+	*config
+
+	// cache is the underlying cache storing the full keys.
+	cache Cache
+	ns    *namespace
+}
+
+func newNamespaceCache(conf *config, cache Cache, name string, quota []int) Cache {
+	if name == "" {
+		panic("cachego: namespace name can't be empty")
+	}
+
+	return &namespaceCache{
+		config: conf,
+		cache:  cache,
+		ns:     conf.namespaces.namespaceOf(cache, name, quota),
+	}
+}
+
+func (nc *namespaceCache) keyOf(key string) string {
+	return nc.ns.prefix + key
+}
+
+func (nc *namespaceCache) keysOf(keys []string) []string {
+	fullKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fullKeys = append(fullKeys, nc.keyOf(key))
+	}
+
+	return fullKeys
+}
+
+func (nc *namespaceCache) record(found bool) {
+	if found && nc.recordHit {
+		atomic.AddUint64(&nc.ns.hitCount, 1)
+	}
+
+	if !found && nc.recordMissed {
+		atomic.AddUint64(&nc.ns.missedCount, 1)
+	}
+}
+
+func (nc *namespaceCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	return ttlOfCache(nc.cache, nc.keyOf(key))
+}
+
+// limit evicts the coldest keys of namespace except key until its size doesn't exceed the quota.
+func (nc *namespaceCache) limit(key string) {
+	quota := atomic.LoadInt64(&nc.ns.quota)
+	if quota <= 0 || !nc.ns.watched {
+		return
+	}
+
+	for atomic.LoadInt64(&nc.ns.size) > quota {
+		if !evictPrefixOf(nc.cache, nc.ns.prefix, key) {
+			return
+		}
+
+		atomic.AddUint64(&nc.ns.evictedCount, 1)
+	}
+}
+
+// Get gets the value of key from cache and returns value if found.
+// See Cache interface.
+func (nc *namespaceCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	value, found = nc.cache.Get(nc.keyOf(key), deserializeF)
+	nc.record(found)
+
+	return value, found
+}
+
+// MGet gets the values of keys from cache and returns values with founds.
+// See Cache interface.
+func (nc *namespaceCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	values, founds = nc.cache.MGet(nc.keysOf(keys), deserializeF)
+	for _, found := range founds {
+		nc.record(found)
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to cache with ttl and returns evicted value if exists.
+// See Cache interface.
+func (nc *namespaceCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	key = nc.keyOf(key)
+
+	evictedValue = nc.cache.Set(key, value, ttl...)
+	nc.limit(key)
+
+	return evictedValue
+}
+
+// MSet sets keys and values to cache with ttls and returns evicted values.
+// See Cache interface.
+func (nc *namespaceCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	keys = nc.keysOf(keys)
+
+	evictedValues = nc.cache.MSet(keys, values, ttls...)
+	if len(keys) > 0 {
+		nc.limit(keys[len(keys)-1])
+	}
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// Tags are also prefixed, so they won't be invalidated by other namespaces.
+// See Cache interface.
+func (nc *namespaceCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	key = nc.keyOf(key)
+
+	evictedValue = nc.cache.SetWithTags(key, value, ttl, nc.keysOf(tags)...)
+	nc.limit(key)
+
+	return evictedValue
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (nc *namespaceCache) InvalidateTag(tag string) (removed int) {
+	return nc.cache.InvalidateTag(nc.keyOf(tag))
+}
+
+// Remove removes key and returns the removed value of key.
+// See Cache interface.
+func (nc *namespaceCache) Remove(key string) (removedValue interface{}) {
+	return nc.cache.Remove(nc.keyOf(key))
+}
+
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (nc *namespaceCache) RemovePrefix(prefix string) (removed int) {
+	return nc.cache.RemovePrefix(nc.keyOf(prefix))
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (nc *namespaceCache) RemoveMatch(pattern string) (removed int) {
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	return nc.cache.RemoveMatch(escapeGlob(nc.ns.prefix) + pattern)
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (nc *namespaceCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	key = nc.keyOf(key)
+
+	actual, loaded = nc.cache.GetOrSet(key, value, ttl...)
+	if !loaded {
+		nc.limit(key)
+	}
+
+	return actual, loaded
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (nc *namespaceCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	return nc.cache.CompareAndSwap(nc.keyOf(key), oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (nc *namespaceCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	return nc.cache.CompareAndDelete(nc.keyOf(key), oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (nc *namespaceCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	key = nc.keyOf(key)
+
+	newValue, kept = nc.cache.Update(key, fn)
+	if kept {
+		nc.limit(key)
+	}
+
+	return newValue, kept
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (nc *namespaceCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return nc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (nc *namespaceCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return nc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (nc *namespaceCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	key = nc.keyOf(key)
+
+	value, err = nc.cache.IncrBy(key, delta, ttl...)
+	if err == nil {
+		nc.limit(key)
+	}
+
+	return value, err
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (nc *namespaceCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	key = nc.keyOf(key)
+
+	value, err = nc.cache.IncrByFloat(key, delta, ttl...)
+	if err == nil {
+		nc.limit(key)
+	}
+
+	return value, err
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (nc *namespaceCache) Range(fn RangeFunc) {
+	nc.cache.Range(func(key string, value interface{}, ttl time.Duration) bool {
+		if !strings.HasPrefix(key, nc.ns.prefix) {
+			return true
+		}
+
+		return fn(strings.TrimPrefix(key, nc.ns.prefix), value, ttl)
+	})
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (nc *namespaceCache) Keys() (keys []string) {
+	nc.Range(func(key string, value interface{}, ttl time.Duration) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (nc *namespaceCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	if match == "" {
+		match = "*"
+	}
+
+	keys, next = nc.cache.Scan(cursor, escapeGlob(nc.ns.prefix)+match, count)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, nc.ns.prefix)
+	}
+
+	return keys, next
+}
+
+// Flush writes all pending writes of the underlying cache to the backing store.
+// See Cache interface.
+func (nc *namespaceCache) Flush() error {
+	return nc.cache.Flush()
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (nc *namespaceCache) SaveSnapshot(w io.Writer) error {
+	return saveSnapshot(nc, nc.codec, w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (nc *namespaceCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(nc, nc.codec, r)
+}
+
+// Size returns the count of keys in namespace.
+// See Cache interface.
+func (nc *namespaceCache) Size() (size int) {
+	if nc.ns.watched {
+		return int(atomic.LoadInt64(&nc.ns.size))
+	}
+
+	nc.cache.Range(func(key string, value interface{}, ttl time.Duration) bool {
+		if strings.HasPrefix(key, nc.ns.prefix) {
+			size++
+		}
+
+		return true
+	})
+
+	return size
+}
+
+// GC cleans the expired keys in the underlying cache and returns the exact count cleaned.
+// Namespaces share entries of the underlying cache, so keys in other namespaces are also cleaned.
+// See Cache interface.
+func (nc *namespaceCache) GC() (cleans int) {
+	return nc.cache.GC()
+}
+
+// Reset removes all keys in namespace.
+// See Cache interface.
+func (nc *namespaceCache) Reset() {
+	nc.cache.RemovePrefix(nc.ns.prefix)
+}
+
+// Close does nothing because namespace doesn't own the underlying cache.
+// Close the underlying cache instead if you don't need it anymore.
+// See Cache interface.
+func (nc *namespaceCache) Close() error {
+	return nil
+}
+
+// Namespace returns a view of namespace name in this namespace.
+// See Cache interface.
+func (nc *namespaceCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(nc.config, nc.cache, nc.ns.prefix+name, quota)
+}
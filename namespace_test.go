@@ -0,0 +1,257 @@
+package memcache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNamespace$
+func TestNamespace(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(1024), WithShardings(4), WithGC(0))
+		cache.Set("users:0", 0, NoTTL)
+
+		users := cache.Namespace("users")
+		orders := cache.Namespace("orders")
+
+		for i := 0; i < 10; i++ {
+			users.Set(strconv.Itoa(i), i, NoTTL)
+			orders.Set(strconv.Itoa(i), i*10, NoTTL)
+		}
+
+		if value, found := users.Get("3", nil); !found || value != 3 {
+			t.Fatalf("%s: value %+v, found %+v is wrong", name, value, found)
+		}
+
+		if value, found := cache.Get("orders:3", nil); !found || value != 30 {
+			t.Fatalf("%s: value %+v, found %+v is wrong", name, value, found)
+		}
+
+		if size := users.Size(); size != 10 {
+			t.Fatalf("%s: size %d != 10", name, size)
+		}
+
+		if keys := orders.Keys(); len(keys) != 10 || keys[0] != "0" {
+			t.Fatalf("%s: keys %+v are wrong", name, keys)
+		}
+
+		if removed := users.RemoveMatch("[0-4]"); removed != 5 {
+			t.Fatalf("%s: removed %d != 5", name, removed)
+		}
+
+		if size := users.Size(); size != 5 {
+			t.Fatalf("%s: size %d != 5", name, size)
+		}
+
+		// A nested namespace is a part of its parent.
+		admins := users.Namespace("admins")
+		admins.Set("1", 1, NoTTL)
+
+		if _, found := cache.Get("users:admins:1", nil); !found {
+			t.Fatalf("%s: users:admins:1 should be found", name)
+		}
+
+		if size := users.Size(); size != 6 {
+			t.Fatalf("%s: size %d != 6", name, size)
+		}
+
+		users.Reset()
+
+		if size := users.Size(); size != 0 {
+			t.Fatalf("%s: size %d != 0", name, size)
+		}
+
+		if size := admins.Size(); size != 0 {
+			t.Fatalf("%s: size %d != 0", name, size)
+		}
+
+		if size := orders.Size(); size != 10 {
+			t.Fatalf("%s: size %d != 10", name, size)
+		}
+
+		cache.Reset()
+
+		if size := orders.Size(); size != 0 {
+			t.Fatalf("%s: size %d != 0", name, size)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNamespaceQuota$
+func TestNamespaceQuota(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache, reporter := NewCacheWithReport(withPolicy(1024), WithShardings(4), WithGC(0))
+		sessions := cache.Namespace("sessions", 5)
+
+		for i := 0; i < 20; i++ {
+			sessions.Set(strconv.Itoa(i), i, NoTTL)
+		}
+
+		if size := sessions.Size(); size != 5 {
+			t.Fatalf("%s: size %d != 5", name, size)
+		}
+
+		if _, found := sessions.Get("19", nil); !found {
+			t.Fatalf("%s: the last key should be found", name)
+		}
+
+		sessions.Get("0", nil)
+
+		stats := reporter.Namespaces()
+		if len(stats) != 1 {
+			t.Fatalf("%s: len(stats) %d != 1", name, len(stats))
+		}
+
+		want := NamespaceStats{Name: "sessions", Size: 5, Quota: 5, HitCount: 1, MissedCount: 1, EvictedCount: 15}
+		if stats[0] != want {
+			t.Fatalf("%s: stats %+v != %+v", name, stats[0], want)
+		}
+
+		if hitRate := stats[0].HitRate(); hitRate != 0.5 {
+			t.Fatalf("%s: hit rate %f != 0.5", name, hitRate)
+		}
+
+		// Quota of namespace is replaced by a view with a new quota.
+		cache.Namespace("sessions", 0)
+		for i := 0; i < 20; i++ {
+			sessions.Set(strconv.Itoa(i), i, NoTTL)
+		}
+
+		if size := sessions.Size(); size != 20 {
+			t.Fatalf("%s: size %d != 20", name, size)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNamespaceSizeConsistency$
+func TestNamespaceSizeConsistency(t *testing.T) {
+	for name, cacheType := range map[string]CacheType{"lru": lru, "arc": arc, "s3fifo": s3fifo, "sieve": sieve} {
+		fakeClock := clock.NewFake(time.Now())
+
+		conf := newDefaultConfig()
+		conf.cacheType = cacheType
+		conf.maxEntries = 16
+		conf.now = fakeClock.Now
+
+		cache := newCaches[cacheType](conf)
+		cache.Set("a:before", 0, NoTTL)
+
+		a := cache.Namespace("a")
+		b := cache.Namespace("b", 4)
+
+		for i := 0; i < 100; i++ {
+			a.Set(strconv.Itoa(i%30), i, time.Duration(i%5+1)*time.Second)
+			b.Set(strconv.Itoa(i%7), i, NoTTL)
+			a.Get(strconv.Itoa(i%7), nil)
+
+			if i%9 == 0 {
+				a.Remove(strconv.Itoa(i % 11))
+			}
+
+			if i%13 == 0 {
+				fakeClock.Advance(time.Second)
+				cache.GC()
+			}
+		}
+
+		// Size of namespace counts expired keys which aren't cleaned like Size of cache.
+		count := func(prefix string) (size int) {
+			cache.(walkableCache).walk(func(e *entry) bool {
+				if strings.HasPrefix(e.key, prefix) {
+					size++
+				}
+
+				return true
+			})
+
+			return size
+		}
+
+		if size, want := a.Size(), count("a:"); size != want {
+			t.Fatalf("%s: size %d != %d", name, size, want)
+		}
+
+		if size := b.Size(); size != 4 {
+			t.Fatalf("%s: size %d != 4", name, size)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNamespaceColdList$
+func TestNamespaceColdList(t *testing.T) {
+	for name, cacheType := range map[string]CacheType{"lru": lru, "arc": arc, "s3fifo": s3fifo, "sieve": sieve} {
+		conf := newDefaultConfig()
+		conf.cacheType = cacheType
+		conf.maxEntries = 16
+
+		cache := newCaches[cacheType](conf)
+		for i := 0; i < 5; i++ {
+			cache.Set("a:before:"+strconv.Itoa(i), i, NoTTL)
+		}
+
+		a := cache.Namespace("a")
+		b := cache.Namespace("b", 4)
+
+		var index *keyIndex
+		switch c := cache.(type) {
+		case *lruCache:
+			index = c.index
+		case *arcCache:
+			index = c.index
+		case *s3fifoCache:
+			index = c.index
+		case *sieveCache:
+			index = c.index
+		}
+
+		// The cold list of namespace should have the same order as walking cache from the coldest key.
+		check := func(i int) {
+			var want []string
+			cache.(coldWalkableCache).walkCold(func(e *entry, segment int) bool {
+				if strings.HasPrefix(e.key, "a:") {
+					want = append(want, e.key)
+				}
+
+				return true
+			})
+
+			var got []string
+			for _, segment := range index.watchOf("a:").cold.segments {
+				for element := segment.Back(); element != nil; element = element.Prev() {
+					got = append(got, element.Value.(*coldElement).key)
+				}
+			}
+
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("%s: %d: cold list %v != %v", name, i, got, want)
+			}
+		}
+
+		check(-1)
+
+		for i := 0; i < 200; i++ {
+			a.Set(strconv.Itoa(i%23), i, NoTTL)
+			b.Set(strconv.Itoa(i%7), i, NoTTL)
+			a.Get(strconv.Itoa(i%5), nil)
+			a.Get(strconv.Itoa(i%3), nil)
+
+			if i%9 == 0 {
+				a.Remove(strconv.Itoa(i % 11))
+			}
+
+			check(i)
+		}
+
+		if size := b.Size(); size != 4 {
+			t.Fatalf("%s: size %d != 4", name, size)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package memcache
 
 import (
 	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
 )
 
 // Option applies to config and sets some values to config.
@@ -42,6 +44,33 @@ func WithLFU(maxEntries int) Option {
 	}
 }
 
+// WithARC returns an option setting the type of cache to arc.
+// Notice that arc cache must have max entries limit, so you have to specify a maxEntries.
+func WithARC(maxEntries int) Option {
+	return func(conf *config) {
+		conf.cacheType = arc
+		conf.maxEntries = maxEntries
+	}
+}
+
+// WithS3FIFO returns an option setting the type of cache to s3fifo.
+// Notice that s3fifo cache must have max entries limit, so you have to specify a maxEntries.
+func WithS3FIFO(maxEntries int) Option {
+	return func(conf *config) {
+		conf.cacheType = s3fifo
+		conf.maxEntries = maxEntries
+	}
+}
+
+// WithSieve returns an option setting the type of cache to sieve.
+// Notice that sieve cache must have max entries limit, so you have to specify a maxEntries.
+func WithSieve(maxEntries int) Option {
+	return func(conf *config) {
+		conf.cacheType = sieve
+		conf.maxEntries = maxEntries
+	}
+}
+
 // WithShardings returns an option setting the sharding count of cache.
 // Negative value means no sharding.
 func WithShardings(shardings int) Option {
@@ -94,6 +123,40 @@ func WithMaxEntries(maxEntries int) Option {
 	}
 }
 
+// WithPrefixIndex returns an option enabling the prefix index of keys.
+// It makes RemovePrefix and RemoveMatch find keys without scanning all entries,
+// but costs more memory and makes setting and removing keys a bit slower.
+func WithPrefixIndex() Option {
+	return func(conf *config) {
+		conf.prefixIndex = true
+	}
+}
+
+// WithScanIndex returns an option enabling the scan index of keys.
+// It makes a page of Scan only visit the keys it returns instead of walking all entries,
+// but costs more memory and makes setting and removing keys a bit slower.
+func WithScanIndex() Option {
+	return func(conf *config) {
+		conf.scanIndex = true
+	}
+}
+
+// WithTenants returns an option making cache evict keys fairly by tenants.
+// tenantOf returns the tenant of a key, and shares specify the min and max shares of tenants in max entries.
+// Shares only count entries because entries in cache have no cost, so a tenant with large values isn't limited more.
+// A share with empty tenant is the default share of tenants not specified.
+// Stats of tenants can be got by Reporter.Tenants.
+// See TenantShare.
+func WithTenants(tenantOf TenantFunc, shares ...TenantShare) Option {
+	return func(conf *config) {
+		if tenantOf == nil {
+			panic("cachego: tenant function can't be nil")
+		}
+
+		conf.tenants = newTenantRegistry(tenantOf, shares)
+	}
+}
+
 // WithNow returns an option setting the now function of cache.
 // A now function should return a nanosecond unix time.
 func WithNow(now func() int64) Option {
@@ -104,6 +167,36 @@ func WithNow(now func() int64) Option {
 	}
 }
 
+// WithFastClock returns an option setting the now function of cache to a fast clock.
+// A fast clock caches time and updates it in fixed duration, which is faster than time.Now and reduces gc objects.
+// By default, it uses a shared clock updated every 100ms, and you can specify a duration to use a clock of cache's own.
+// Notice that the precision of ttl will be about the duration, so a key may live a bit longer than its ttl.
+// See pkg/clock.Clock.
+func WithFastClock(duration ...time.Duration) Option {
+	return func(conf *config) {
+		if len(duration) > 0 && duration[0] > 0 {
+			conf.clock = clock.NewWithDuration(duration[0])
+			conf.now = conf.clock.Now
+			return
+		}
+
+		conf.now = clock.New().Now
+	}
+}
+
+// WithNewTicker returns an option setting the function creating tickers of cache's background tasks.
+// It's useful in tests with clock.FakeClock, so gc can be driven by FakeClock.Advance:
+//
+//	fakeClock := clock.NewFake(time.Now())
+//	cache := NewCache(WithNow(fakeClock.Now), WithNewTicker(fakeClock.NewTicker))
+func WithNewTicker(newTicker func(duration time.Duration) clock.Ticker) Option {
+	return func(conf *config) {
+		if newTicker != nil {
+			conf.newTicker = newTicker
+		}
+	}
+}
+
 // WithHash returns an option setting the hash function of cache.
 // A hash function should return the hash code of key.
 func WithHash(hash func(key string) int) Option {
@@ -175,3 +268,118 @@ func WithLoadFunc(loadFunc LoadFunc) Option {
 		conf.loadFunc = loadFunc
 	}
 }
+
+// WithWriteThrough returns an option setting store to cache in write-through mode.
+// Keys missed are loaded from store, and writes are written to store before updating cache.
+// Use WithStoreError to get errors of store.
+// See Store.
+func WithWriteThrough(store Store) Option {
+	return func(conf *config) {
+		conf.store = store
+		conf.writeBehind = false
+	}
+}
+
+// WithWriteBehind returns an option setting store to cache in write-behind mode.
+// Keys missed are loaded from store, and writes are queued and flushed to store every flushDuration in batches.
+// Writes of the same key are coalesced, and a batch is retried at most retries times before being dropped.
+// Pending writes are flushed when closing cache, and you can use Cache.Flush to flush them manually.
+// Use WithStoreError to get errors of store.
+// See Store.
+func WithWriteBehind(store Store, flushDuration time.Duration, batchSize int, retries int) Option {
+	return func(conf *config) {
+		if flushDuration <= 0 {
+			panic("cachego: flush duration must be > 0")
+		}
+
+		if batchSize <= 0 {
+			panic("cachego: batch size must be > 0")
+		}
+
+		conf.store = store
+		conf.writeBehind = true
+		conf.flushDuration = flushDuration
+		conf.flushBatch = batchSize
+		conf.flushRetries = retries
+	}
+}
+
+// WithStoreError returns an option setting a function called with keys and error when store fails.
+func WithStoreError(storeError func(keys []string, err error)) Option {
+	return func(conf *config) {
+		conf.storeError = storeError
+	}
+}
+
+// WithCodec returns an option setting the codec of values in snapshots.
+// By default, values are encoded with encoding/gob, so values of custom types should be registered with gob.Register.
+func WithCodec(codec Codec) Option {
+	return func(conf *config) {
+		conf.codec = codec
+	}
+}
+
+// WithSnapshot returns an option loading the snapshot of path when creating cache,
+// saving a snapshot to path every snapshotDuration and saving the last one when closing cache.
+// Zero snapshotDuration means only saving when closing.
+// Use WithSnapshotError to get errors of snapshots.
+func WithSnapshot(path string, snapshotDuration time.Duration) Option {
+	return func(conf *config) {
+		conf.snapshotPath = path
+		conf.snapshotDuration = snapshotDuration
+	}
+}
+
+// WithSnapshotError returns an option setting a function called with the error when loading or saving snapshots fails.
+func WithSnapshotError(snapshotError func(err error)) Option {
+	return func(conf *config) {
+		conf.snapshotError = snapshotError
+	}
+}
+
+// WithAppendLog returns an option writing all mutations of cache to an append-only log of path.
+// The log is replayed after loading the snapshot when creating cache, and fsync is the policy of syncing it to disk.
+// Keys are written with their expirations, so expired keys aren't restored.
+// The log is rewritten from the keys of cache in background once it reaches compactSize bytes and twice of its size
+// after the last rewrite, and zero compactSize means never.
+// Use WithAppendLogError to get errors of the log, or creating cache panics if the log can't be opened.
+func WithAppendLog(path string, fsync FsyncPolicy, compactSize int64) Option {
+	return func(conf *config) {
+		conf.logPath = path
+		conf.fsyncPolicy = fsync
+		conf.logCompactSize = compactSize
+	}
+}
+
+// WithAppendLogError returns an option setting a function called with the error when writing or replaying the log fails.
+// Cache runs without the log if opening the log fails and logError is set.
+func WithAppendLogError(logError func(err error)) Option {
+	return func(conf *config) {
+		conf.logError = logError
+	}
+}
+
+// WithOverflow returns an option spilling entries evicted from lru cache to a file of path with at most maxSize bytes.
+// Keys missed in memory are looked up in the file before loading, and they're moved back to memory if found.
+// The oldest entries in the file are dropped when exceeding maxSize, and non-positive maxSize uses 64MB.
+// Only entries evicted for the max entries of cache are spilled, and entries evicted by tenants or namespace quotas aren't.
+// Notice that Size, Keys, Range, Scan and snapshots only cover entries in memory, and the file is removed when closing cache.
+// Creating cache panics if cache isn't lru, or the file can't be opened and WithOverflowError isn't used.
+// Use WithOverflowError to get errors of the file, and cache runs without overflow if opening the file fails.
+func WithOverflow(path string, maxSize int64) Option {
+	return func(conf *config) {
+		if maxSize <= 0 {
+			maxSize = defaultOverflowSize
+		}
+
+		conf.overflowPath = path
+		conf.overflowSize = maxSize
+	}
+}
+
+// WithOverflowError returns an option setting a function called with the error when encoding, writing or reading overflow fails.
+func WithOverflowError(overflowError func(err error)) Option {
+	return func(conf *config) {
+		conf.overflowError = overflowError
+	}
+}
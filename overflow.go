@@ -0,0 +1,563 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultOverflowSize is the default max size in bytes of overflow.
+	defaultOverflowSize = 64 * 1024 * 1024
+)
+
+// overflowRecord is the location of an entry in the file of overflow.
+type overflowRecord struct {
+	key        string
+	offset     int64
+	length     int64
+	expiration int64
+	tags       []string
+}
+
+func (r *overflowRecord) expired(now int64) bool {
+	return r.expiration > 0 && r.expiration < now
+}
+
+// overflowStore stores entries evicted from memory in a log-structured file, and finds them by an index in memory.
+// Records are only appended to the file, and the file is rewritten with live records when dead records
+// take more than half of the max size. The oldest entries are dropped when live records exceed the max size.
+// The file is truncated when opening, so entries in overflow don't survive restarting.
+// Overflow is shared by all shards, so rewriting copies records without the lock and only swaps the file with it.
+type overflowStore struct {
+	*config
+
+	file *os.File
+
+	// size is the size of file, and live is the size of records in index.
+	size int64
+	live int64
+
+	// records stores all elements of order by keys, and order stores records from the oldest one.
+	records map[string]*list.Element
+	order   *list.List
+
+	// pending stores states staged by cache which aren't written to the file yet.
+	// They're found and removed just like records, so writing them later won't bring back stale values.
+	pending map[string]*keyState
+	lock    sync.Mutex
+
+	// compacting reports if the file is being rewritten, and generation changes when the file is truncated or closed.
+	compacting bool
+	generation uint64
+}
+
+// openOverflowStore truncates the file of overflow and opens it.
+func openOverflowStore(conf *config) (*overflowStore, error) {
+	file, err := os.OpenFile(conf.overflowPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ofs := &overflowStore{
+		config:  conf,
+		file:    file,
+		records: make(map[string]*list.Element, mapInitialCap),
+		order:   list.New(),
+		pending: make(map[string]*keyState),
+	}
+
+	return ofs, nil
+}
+
+func (ofs *overflowStore) reportError(err error) {
+	if err != nil && ofs.overflowError != nil {
+		ofs.overflowError(err)
+	}
+}
+
+func (ofs *overflowStore) unwrap(element *list.Element) *overflowRecord {
+	record, ok := element.Value.(*overflowRecord)
+	if !ok {
+		panic("cachego: failed to unwrap overflow element's value to record")
+	}
+
+	return record
+}
+
+// removeElement removes the record of element from index, and its bytes become dead.
+// It should be called with the lock held.
+func (ofs *overflowStore) removeElement(element *list.Element) *overflowRecord {
+	record := ofs.unwrap(element)
+
+	delete(ofs.records, record.key)
+	ofs.order.Remove(element)
+	ofs.live -= record.length
+
+	return record
+}
+
+// stage stages the state of key which is written to the file by write later.
+// It's cheap enough to be called with the lock of cache held.
+func (ofs *overflowStore) stage(key string, state keyState) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	if ofs.file == nil {
+		return
+	}
+
+	if element, ok := ofs.records[key]; ok {
+		ofs.removeElement(element)
+	}
+
+	ofs.pending[key] = &state
+}
+
+// write encodes the staged state of key and appends it to the file.
+// States taken or removed after staging aren't written, and states which are too large for overflow are dropped.
+func (ofs *overflowStore) write(key string) {
+	ofs.lock.Lock()
+	state, ok := ofs.pending[key]
+	ofs.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	data, err := ofs.codec.Encode(state.value)
+	if err != nil {
+		ofs.reportError(err)
+		ofs.unstage(key, state)
+		return
+	}
+
+	encoder := new(logEncoder)
+	encoder.putString(key)
+	encoder.putBytes(data)
+	raw := encoder.record()
+
+	ofs.lock.Lock()
+	compact := ofs.append(key, state, raw)
+	ofs.lock.Unlock()
+
+	if compact {
+		ofs.reportError(ofs.compact())
+	}
+}
+
+// append appends raw of the staged state of key to the file, and reports if the file should be rewritten.
+// It should be called with the lock held.
+func (ofs *overflowStore) append(key string, state *keyState, raw []byte) (compact bool) {
+	// The state may be taken, removed or staged again while encoding.
+	if ofs.pending[key] != state {
+		return false
+	}
+
+	delete(ofs.pending, key)
+
+	length := int64(len(raw))
+	if length > ofs.overflowSize {
+		return false
+	}
+
+	for ofs.live+length > ofs.overflowSize && ofs.order.Len() > 0 {
+		ofs.removeElement(ofs.order.Front())
+	}
+
+	if _, err := ofs.file.WriteAt(raw, ofs.size); err != nil {
+		ofs.reportError(err)
+		return false
+	}
+
+	record := &overflowRecord{
+		key:        key,
+		offset:     ofs.size,
+		length:     length,
+		expiration: state.expiration,
+		tags:       state.tags,
+	}
+
+	ofs.records[key] = ofs.order.PushBack(record)
+	ofs.size += length
+	ofs.live += length
+
+	if ofs.compacting || ofs.size-ofs.live <= ofs.overflowSize/2 {
+		return false
+	}
+
+	ofs.compacting = true
+	return true
+}
+
+// unstage removes the staged state of key if it's still state.
+func (ofs *overflowStore) unstage(key string, state *keyState) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	if ofs.pending[key] == state {
+		delete(ofs.pending, key)
+	}
+}
+
+// read reads the value of record from the file.
+// It should be called with the lock held.
+func (ofs *overflowStore) read(record *overflowRecord) (value interface{}, err error) {
+	buffer := make([]byte, record.length)
+	if _, err = ofs.file.ReadAt(buffer, record.offset); err != nil {
+		return nil, err
+	}
+
+	length, n := binary.Uvarint(buffer)
+	if n <= 0 || int64(n)+int64(length)+4 != record.length {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	payload := buffer[n : n+int(length)]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(buffer[n+int(length):]) {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	decoder := logDecoder{Reader: bytes.NewReader(payload)}
+
+	key, err := decoder.string()
+	if err != nil {
+		return nil, err
+	}
+
+	if key != record.key {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	data, err := decoder.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return ofs.codec.Decode(key, data)
+}
+
+// take removes key from overflow and returns its state if it's unexpired.
+func (ofs *overflowStore) take(key string) (state keyState, found bool) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	if staged, ok := ofs.pending[key]; ok {
+		delete(ofs.pending, key)
+
+		if staged.expiration > 0 && staged.expiration < ofs.now() {
+			return state, false
+		}
+
+		return *staged, true
+	}
+
+	element, ok := ofs.records[key]
+	if !ok {
+		return state, false
+	}
+
+	record := ofs.removeElement(element)
+	if record.expired(ofs.now()) {
+		return state, false
+	}
+
+	value, err := ofs.read(record)
+	if err != nil {
+		ofs.reportError(err)
+		return state, false
+	}
+
+	state = keyState{value: value, expiration: record.expiration, tags: record.tags}
+	return state, true
+}
+
+// remove removes key from overflow without reading it.
+func (ofs *overflowStore) remove(key string) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	delete(ofs.pending, key)
+
+	if element, ok := ofs.records[key]; ok {
+		ofs.removeElement(element)
+	}
+}
+
+// removeIf removes all records and staged states which fn returns true and returns the count removed.
+// It should be called with the lock held.
+func (ofs *overflowStore) removeIf(fn func(record *overflowRecord) bool) (removed int) {
+	for key, state := range ofs.pending {
+		if fn(&overflowRecord{key: key, expiration: state.expiration, tags: state.tags}) {
+			delete(ofs.pending, key)
+			removed++
+		}
+	}
+
+	for element := ofs.order.Front(); element != nil; {
+		next := element.Next()
+
+		if fn(ofs.unwrap(element)) {
+			ofs.removeElement(element)
+			removed++
+		}
+
+		element = next
+	}
+
+	return removed
+}
+
+// removeLiveIf removes all records which fn returns true and returns the count of unexpired records removed.
+// It should be called with the lock held.
+func (ofs *overflowStore) removeLiveIf(fn func(record *overflowRecord) bool) (removed int) {
+	now := ofs.now()
+
+	ofs.removeIf(func(record *overflowRecord) bool {
+		if !fn(record) {
+			return false
+		}
+
+		if !record.expired(now) {
+			removed++
+		}
+
+		return true
+	})
+
+	return removed
+}
+
+// removeMatched removes all keys starting with prefix which fn returns true and returns the count of unexpired keys removed.
+func (ofs *overflowStore) removeMatched(prefix string, fn func(key string) bool) (removed int) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	return ofs.removeLiveIf(func(record *overflowRecord) bool {
+		return strings.HasPrefix(record.key, prefix) && fn(record.key)
+	})
+}
+
+// invalidateTag removes all keys having tag and returns the count of unexpired keys removed.
+func (ofs *overflowStore) invalidateTag(tag string) (removed int) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	return ofs.removeLiveIf(func(record *overflowRecord) bool {
+		for _, t := range record.tags {
+			if t == tag {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// gc removes expired keys and returns the count removed.
+// It scans at most maxScans keys just like caches, and sharding cache calls it once for all shards.
+func (ofs *overflowStore) gc(now int64) (cleans int) {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	scans := 0
+	for key, state := range ofs.pending {
+		if ofs.maxScans > 0 && scans >= ofs.maxScans {
+			return cleans
+		}
+
+		scans++
+
+		if state.expiration > 0 && state.expiration < now {
+			delete(ofs.pending, key)
+			cleans++
+		}
+	}
+
+	for _, element := range ofs.records {
+		if ofs.maxScans > 0 && scans >= ofs.maxScans {
+			return cleans
+		}
+
+		scans++
+
+		if ofs.unwrap(element).expired(now) {
+			ofs.removeElement(element)
+			cleans++
+		}
+	}
+
+	return cleans
+}
+
+// compactRecord is a record copied by compact, and newOffset is its offset in the new file.
+type compactRecord struct {
+	element   *list.Element
+	offset    int64
+	length    int64
+	newOffset int64
+}
+
+// compact rewrites the file with live records, and it should be called without the lock after setting compacting.
+// Records are copied without the lock, and records appended meanwhile are copied with the lock before swapping files.
+// Records removed meanwhile are copied as dead records, which are dropped by the next rewriting.
+func (ofs *overflowStore) compact() (err error) {
+	ofs.lock.Lock()
+	file, generation, size := ofs.file, ofs.generation, ofs.size
+
+	records := make([]compactRecord, 0, ofs.order.Len())
+	for element := ofs.order.Front(); element != nil; element = element.Next() {
+		record := ofs.unwrap(element)
+		records = append(records, compactRecord{element: element, offset: record.offset, length: record.length})
+	}
+
+	ofs.lock.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(ofs.overflowPath), filepath.Base(ofs.overflowPath)+".*.tmp")
+	if err != nil {
+		ofs.finishCompact()
+		return err
+	}
+
+	swapped := false
+	defer func() {
+		if !swapped {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(tmp)
+	copied := int64(0)
+
+	// Bytes before size are never rewritten until files are swapped, so they're read without the lock.
+	for i := range records {
+		buffer := make([]byte, records[i].length)
+		if _, err = file.ReadAt(buffer, records[i].offset); err != nil {
+			return ofs.abortCompact(generation, err)
+		}
+
+		if _, err = writer.Write(buffer); err != nil {
+			return ofs.abortCompact(generation, err)
+		}
+
+		records[i].newOffset = copied
+		copied += records[i].length
+	}
+
+	if err = writer.Flush(); err != nil {
+		return ofs.abortCompact(generation, err)
+	}
+
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	ofs.compacting = false
+
+	// The file is truncated or closed while copying, so records copied are useless.
+	if ofs.generation != generation {
+		return nil
+	}
+
+	// Records appended while copying are after size, and they're copied with the lock held.
+	tail := make([]byte, ofs.size-size)
+	if _, err = file.ReadAt(tail, size); err != nil {
+		return err
+	}
+
+	if _, err = tmp.WriteAt(tail, copied); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), ofs.overflowPath); err != nil {
+		return err
+	}
+
+	offsets := make(map[*list.Element]int64, len(records))
+	for _, r := range records {
+		offsets[r.element] = r.newOffset
+	}
+
+	for element := ofs.order.Front(); element != nil; element = element.Next() {
+		record := ofs.unwrap(element)
+
+		if offset, ok := offsets[element]; ok {
+			record.offset = offset
+		} else {
+			record.offset = copied + record.offset - size
+		}
+	}
+
+	swapped = true
+	file.Close()
+
+	ofs.file = tmp
+	ofs.size = copied + int64(len(tail))
+	return nil
+}
+
+// finishCompact clears compacting after compact fails, so the file can be rewritten again later.
+func (ofs *overflowStore) finishCompact() {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	ofs.compacting = false
+}
+
+// abortCompact finishes compact failed with err, and err is dropped if the file is truncated or closed meanwhile.
+func (ofs *overflowStore) abortCompact(generation uint64, err error) error {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	ofs.compacting = false
+	if ofs.generation != generation {
+		return nil
+	}
+
+	return err
+}
+
+// reset removes all keys and truncates the file.
+func (ofs *overflowStore) reset() {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	if ofs.file == nil {
+		return
+	}
+
+	ofs.records = make(map[string]*list.Element, mapInitialCap)
+	ofs.order = list.New()
+	ofs.pending = make(map[string]*keyState)
+	ofs.size = 0
+	ofs.live = 0
+	ofs.generation++
+	ofs.reportError(ofs.file.Truncate(0))
+}
+
+// close closes and removes the file, and overflow does nothing after closing.
+func (ofs *overflowStore) close() {
+	ofs.lock.Lock()
+	defer ofs.lock.Unlock()
+
+	if ofs.file == nil {
+		return
+	}
+
+	ofs.reportError(ofs.file.Close())
+	ofs.reportError(os.Remove(ofs.overflowPath))
+
+	ofs.file = nil
+	ofs.records = make(map[string]*list.Element)
+	ofs.order = list.New()
+	ofs.pending = make(map[string]*keyState)
+	ofs.size = 0
+	ofs.live = 0
+	ofs.generation++
+}
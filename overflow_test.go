@@ -0,0 +1,376 @@
+package memcache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestOverflow$
+func TestOverflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overflow")
+
+	var errs []error
+	overflowError := func(err error) {
+		errs = append(errs, err)
+	}
+
+	loads := 0
+	loadFunc := func(keys []string, deserializeF DeserializeFunc) ([]interface{}, error) {
+		loads++
+		return nil, nil
+	}
+
+	cache := NewCache(WithLRU(2), WithGC(0), WithOverflow(path, 1024*1024), WithOverflowError(overflowError), WithLoadFunc(loadFunc))
+
+	for i := 0; i < 5; i++ {
+		cache.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+
+	if size := cache.Size(); size != 2 {
+		t.Fatalf("size %d != 2", size)
+	}
+
+	for i := 0; i < 5; i++ {
+		key := "key" + strconv.Itoa(i)
+		if value, found := cache.Get(key, nil); !found || value != "value"+strconv.Itoa(i) {
+			t.Fatalf("key %s: value %+v is wrong or not found", key, value)
+		}
+	}
+
+	if loads != 0 {
+		t.Fatalf("loads %d != 0", loads)
+	}
+
+	values, founds := cache.MGet([]string{"key0", "key1", "key2", "missed"}, nil)
+	for i := 0; i < 3; i++ {
+		if !founds[i] || values[i] != "value"+strconv.Itoa(i) {
+			t.Fatalf("values[%d] %+v is wrong or not found", i, values[i])
+		}
+	}
+
+	if founds[3] || loads != 1 {
+		t.Fatalf("founds[3] %+v is wrong or loads %d != 1", founds[3], loads)
+	}
+
+	// Setting key3 which is in overflow drops its old value there.
+	cache.Set("key3", "new")
+	if value, found := cache.Get("key3", nil); !found || value != "new" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	if value := cache.Remove("key0"); value != "value0" {
+		t.Fatalf("value %+v != value0", value)
+	}
+
+	if value, found := cache.Get("key0", nil); found {
+		t.Fatalf("value %+v is found", value)
+	}
+
+	cache.Set("counter", 10)
+	cache.SetWithTags("tagged", "value", NoTTL, "tag")
+	cache.Set("other", "value")
+	cache.Set("another", "value")
+
+	if n, err := cache.IncrBy("counter", 5); err != nil || n != 15 {
+		t.Fatalf("n %d != 15 or err %+v != nil", n, err)
+	}
+
+	cache.Set("other", "value")
+	cache.Set("another", "value")
+
+	if removed := cache.InvalidateTag("tag"); removed != 1 {
+		t.Fatalf("removed %d != 1", removed)
+	}
+
+	if removed := cache.RemovePrefix("key"); removed != 4 {
+		t.Fatalf("removed %d != 4", removed)
+	}
+
+	if removed := cache.RemoveMatch("*other"); removed != 2 {
+		t.Fatalf("removed %d != 2", removed)
+	}
+
+	if value, found := cache.Get("counter", nil); !found || value != int64(15) {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	cache.Set("func", func() {})
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+
+	if len(errs) != 1 {
+		t.Fatalf("errs %+v is wrong", errs)
+	}
+
+	cache.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("err %+v isn't not exist", err)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestOverflowTTL$
+func TestOverflowTTL(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	path := filepath.Join(t.TempDir(), "overflow")
+
+	cache := NewCache(WithLRU(1), WithGC(0), WithNow(fakeClock.Now), WithOverflow(path, 1024*1024))
+	defer cache.Close()
+
+	cache.Set("short", "value", time.Second)
+	cache.Set("disk", "value", 30*time.Second)
+	cache.Set("forever", "value", NoTTL)
+	cache.Set("memory", "value", time.Minute)
+
+	fakeClock.Advance(2 * time.Second)
+	if value, found := cache.Get("short", nil); found {
+		t.Fatalf("value %+v is found", value)
+	}
+
+	// Both memory and disk in overflow are expired.
+	fakeClock.Advance(time.Minute)
+	if cleans := cache.GC(); cleans != 2 {
+		t.Fatalf("cleans %d != 2", cleans)
+	}
+
+	if value, found := cache.Get("disk", nil); found {
+		t.Fatalf("value %+v is found", value)
+	}
+
+	if value, found := cache.Get("forever", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestOverflowMaxSize$
+func TestOverflowMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overflow")
+
+	cache := NewCache(WithLRU(4), WithShardings(2), WithGC(0), WithOverflow(path, 1024))
+	defer cache.Close()
+
+	for i := 0; i < 1000; i++ {
+		cache.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() > 2048 {
+			t.Fatalf("size %d of file > 2048", info.Size())
+		}
+	}
+
+	found := 0
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+
+		value, ok := cache.Get(key, nil)
+		if ok && value != "value"+strconv.Itoa(i) {
+			t.Fatalf("key %s: value %+v is wrong", key, value)
+		}
+
+		if ok {
+			found++
+		}
+	}
+
+	if found <= 8 || found >= 100 {
+		t.Fatalf("found %d is wrong", found)
+	}
+
+	if value, found := cache.Get("key999", nil); !found || value != "value999" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	cache.Reset()
+	if value, found := cache.Get("key990", nil); found {
+		t.Fatalf("value %+v is found", value)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestOverflowStage$
+func TestOverflowStage(t *testing.T) {
+	conf := newDefaultConfig()
+	conf.overflowPath = filepath.Join(t.TempDir(), "overflow")
+	conf.overflowSize = 1024 * 1024
+
+	ofs, err := openOverflowStore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ofs.close()
+
+	// Staged states are found before being written.
+	ofs.stage("key", keyState{value: "value"})
+	if state, found := ofs.take("key"); !found || state.value != "value" {
+		t.Fatalf("state %+v is wrong or not found", state)
+	}
+
+	ofs.write("key")
+	if state, found := ofs.take("key"); found {
+		t.Fatalf("state %+v is found", state)
+	}
+
+	// Staged states removed before being written aren't written.
+	ofs.stage("key", keyState{value: "value"})
+	ofs.stage("tagged", keyState{value: "value", tags: []string{"tag"}})
+	ofs.remove("key")
+
+	if removed := ofs.invalidateTag("tag"); removed != 1 {
+		t.Fatalf("removed %d != 1", removed)
+	}
+
+	ofs.write("key")
+	ofs.write("tagged")
+
+	if ofs.size != 0 || len(ofs.records) != 0 || len(ofs.pending) != 0 {
+		t.Fatalf("size %d, records %+v or pending %+v is wrong", ofs.size, ofs.records, ofs.pending)
+	}
+
+	ofs.stage("key", keyState{value: "value"})
+	ofs.write("key")
+
+	if state, found := ofs.take("key"); !found || state.value != "value" {
+		t.Fatalf("state %+v is wrong or not found", state)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestOverflowInvalid$
+func TestOverflowInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "overflow")
+
+	newCacheRecovered := func(opts ...Option) (r interface{}) {
+		defer func() {
+			r = recover()
+		}()
+
+		NewCache(opts...).Close()
+		return nil
+	}
+
+	if r := newCacheRecovered(WithARC(2), WithGC(0), WithOverflow(path, 0)); r == nil {
+		t.Fatal("overflow of arc cache doesn't panic")
+	}
+
+	if r := newCacheRecovered(WithLRU(2), WithGC(0), WithOverflow(path, 0)); r == nil {
+		t.Fatal("opening overflow fails without panic")
+	}
+
+	var errs []error
+	overflowError := func(err error) {
+		errs = append(errs, err)
+	}
+
+	cache := NewCache(WithLRU(1), WithGC(0), WithOverflow(path, 0), WithOverflowError(overflowError))
+	defer cache.Close()
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+
+	if value, found := cache.Get("b", nil); !found || value != 2 {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("errs %+v is wrong", errs)
+	}
+}
+
+// go test -v -cover -count=1 -run=^TestOverflowCompact$
+func TestOverflowCompact(t *testing.T) {
+	conf := newDefaultConfig()
+	conf.overflowPath = filepath.Join(t.TempDir(), "overflow")
+	conf.overflowSize = 4096
+
+	ofs, err := openOverflowStore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ofs.close()
+
+	var errs []error
+	var errsLock sync.Mutex
+	conf.overflowError = func(err error) {
+		errsLock.Lock()
+		defer errsLock.Unlock()
+
+		errs = append(errs, err)
+	}
+
+	// Records are rewritten many times while others are appending and taking records.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 500; j++ {
+				key := strconv.Itoa(i) + "-" + strconv.Itoa(j%10)
+				ofs.stage(key, keyState{value: key + "-" + strconv.Itoa(j)})
+				ofs.write(key)
+
+				if j%7 == 0 {
+					ofs.take(key)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(errs) != 0 {
+		t.Fatalf("errs %+v is wrong", errs)
+	}
+
+	for i := 0; i < 4; i++ {
+		for j := 490; j < 500; j++ {
+			key := strconv.Itoa(i) + "-" + strconv.Itoa(j%10)
+
+			if state, found := ofs.take(key); found && state.value != key+"-"+strconv.Itoa(j) {
+				t.Fatalf("key %s: state %+v is wrong", key, state)
+			}
+		}
+	}
+
+	if ofs.size-ofs.live > ofs.overflowSize {
+		t.Fatalf("size %d and live %d are wrong", ofs.size, ofs.live)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestOverflowGC$
+func TestOverflowGC(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	path := filepath.Join(t.TempDir(), "overflow")
+
+	cache := NewCache(WithLRU(1), WithShardings(4), WithMaxScans(2), WithGC(0), WithNow(fakeClock.Now), WithOverflow(path, 1024*1024))
+	defer cache.Close()
+
+	for i := 0; i < 20; i++ {
+		cache.Set("key"+strconv.Itoa(i), "value", time.Second)
+	}
+
+	// Overflow is shared by shards, so it's only scanned once by at most maxScans.
+	fakeClock.Advance(2 * time.Second)
+	if cleans := cache.GC(); cleans > 4+2 {
+		t.Fatalf("cleans %d > 6", cleans)
+	}
+
+	total := 0
+	for i := 0; i < 20; i++ {
+		total += cache.GC()
+	}
+
+	if total == 0 {
+		t.Fatal("total cleans == 0")
+	}
+}
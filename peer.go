@@ -0,0 +1,347 @@
+package memcache
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/singleflight"
+)
+
+const (
+	// defaultPeerReplicas is the default count of virtual nodes of each peer.
+	defaultPeerReplicas = 50
+)
+
+// ringHash returns the position of key on ring.
+// Hash codes of similar keys like peers with virtual node numbers are close, so they're mixed by the finalizer of murmur3.
+func ringHash(key string) int {
+	h := uint64(hash(key))
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return int(h)
+}
+
+// HashRing is a consistent hash ring of peers, and each peer has some virtual nodes on ring.
+// Only about 1/n of keys change their owners when a peer is added to or removed from n peers.
+type HashRing struct {
+	replicas int
+	hashes   []int
+	peers    map[int]string
+	lock     sync.RWMutex
+}
+
+// NewHashRing returns a hash ring with replicas virtual nodes of each peer.
+// More virtual nodes make keys distributed more evenly, but picking is a bit slower.
+func NewHashRing(replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = defaultPeerReplicas
+	}
+
+	return &HashRing{
+		replicas: replicas,
+		peers:    make(map[int]string),
+	}
+}
+
+// Set sets the peers of ring, and peers not in them are removed from ring.
+func (hr *HashRing) Set(peers ...string) {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+
+	hashes := make([]int, 0, len(sorted)*hr.replicas)
+	nodes := make(map[int]string, len(sorted)*hr.replicas)
+
+	for _, peer := range sorted {
+		for i := 0; i < hr.replicas; i++ {
+			h := ringHash(strconv.Itoa(i) + peer)
+			if _, ok := nodes[h]; ok {
+				continue
+			}
+
+			hashes = append(hashes, h)
+			nodes[h] = peer
+		}
+	}
+
+	sort.Ints(hashes)
+
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+
+	hr.hashes = hashes
+	hr.peers = nodes
+}
+
+// Pick returns the peer owning key, and an empty peer will be returned if ring has no peers.
+func (hr *HashRing) Pick(key string) (peer string) {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+
+	if len(hr.hashes) <= 0 {
+		return ""
+	}
+
+	h := ringHash(key)
+	i := sort.Search(len(hr.hashes), func(i int) bool {
+		return hr.hashes[i] >= h
+	})
+
+	if i >= len(hr.hashes) {
+		i = 0
+	}
+
+	return hr.peers[hr.hashes[i]]
+}
+
+// PeerTransport fetches values of keys from their owners.
+// See HTTPTransport.
+type PeerTransport interface {
+	// Fetch fetches the encoded value of key in group from peer.
+	// The peer should serve it by PeerGroup.Fetch of the group named group.
+	// A *PeerLoadError should be returned if peer fails to load key, so key won't be loaded again by the fetcher.
+	Fetch(peer string, group string, key string) (data []byte, err error)
+}
+
+// PeerLoadError is the error of loading key in its owner peer, which is returned by PeerGroup.Get as it is.
+type PeerLoadError struct {
+	Peer    string
+	Key     string
+	Message string
+}
+
+// Error returns the message of error.
+func (ple *PeerLoadError) Error() string {
+	return "cachego: peer " + ple.Peer + " fails to load " + ple.Key + ": " + ple.Message
+}
+
+// PeerLoadFunc loads the value of key with its ttl, which is only called by the owner of key.
+type PeerLoadFunc func(key string) (value interface{}, ttl time.Duration, err error)
+
+type peerConfig struct {
+	replicas  int
+	hotCache  Cache
+	hotTTL    time.Duration
+	codec     Codec
+	peerError func(peer string, key string, err error)
+}
+
+func newDefaultPeerConfig() *peerConfig {
+	return &peerConfig{
+		replicas:  defaultPeerReplicas,
+		hotCache:  nil,
+		hotTTL:    time.Minute,
+		codec:     gobCodec{},
+		peerError: nil,
+	}
+}
+
+// PeerOption applies to peer config and sets some values to it.
+type PeerOption func(conf *peerConfig)
+
+func (po PeerOption) applyTo(conf *peerConfig) {
+	po(conf)
+}
+
+func applyPeerOptions(conf *peerConfig, opts []PeerOption) {
+	for _, opt := range opts {
+		opt.applyTo(conf)
+	}
+}
+
+// WithPeerReplicas returns an option setting the count of virtual nodes of each peer.
+// All peers should use the same replicas, or they may not agree on the owners of keys.
+func WithPeerReplicas(replicas int) PeerOption {
+	return func(conf *peerConfig) {
+		if replicas > 0 {
+			conf.replicas = replicas
+		}
+	}
+}
+
+// WithPeerHotCache returns an option setting the hot cache of keys owned by other peers.
+// Values fetched from owners are set to hot cache with ttl, so hot keys won't be fetched every time.
+// Notice that values in hot cache may be stale for ttl after they change in owners.
+func WithPeerHotCache(hotCache Cache, ttl time.Duration) PeerOption {
+	return func(conf *peerConfig) {
+		conf.hotCache = hotCache
+		conf.hotTTL = ttl
+	}
+}
+
+// WithPeerCodec returns an option setting the codec of values fetched between peers.
+// All peers should use the same codec, and the default one uses encoding/gob.
+func WithPeerCodec(codec Codec) PeerOption {
+	return func(conf *peerConfig) {
+		if codec != nil {
+			conf.codec = codec
+		}
+	}
+}
+
+// WithPeerError returns an option setting the function reporting errors of fetching from peers.
+// Keys are loaded locally after failing to fetch from their owners, but errors of owners loading keys are
+// returned without loading locally or reporting, see PeerLoadError.
+func WithPeerError(peerError func(peer string, key string, err error)) PeerOption {
+	return func(conf *peerConfig) {
+		conf.peerError = peerError
+	}
+}
+
+// PeerGroup is a group of keys loaded by one of peers, so a key is only loaded once among all peers.
+// Peers are picked by consistent hashing, and a key missed in a peer not owning it is fetched from its owner,
+// which loads the key in singleflight mode and keeps it in its cache.
+//
+// All peers should create groups with the same name and set the same peers, and each peer serves fetches of
+// other peers by its transport, see HTTPTransport.
+type PeerGroup struct {
+	*peerConfig
+
+	name      string
+	self      string
+	cache     Cache
+	load      PeerLoadFunc
+	transport PeerTransport
+	ring      *HashRing
+
+	// loads and fetches are separated, so two peers fetching from each other won't wait for each other.
+	loads   *singleflight.Group
+	fetches *singleflight.Group
+}
+
+// NewPeerGroup returns a group named name of peer self, which is also the address of self in peers.
+// Keys owned by self are loaded by load and set to cache, and others are fetched from their owners by transport.
+// Use SetPeers to set all peers including self, or self owns all keys.
+func NewPeerGroup(name string, self string, cache Cache, load PeerLoadFunc, transport PeerTransport, opts ...PeerOption) *PeerGroup {
+	conf := newDefaultPeerConfig()
+	applyPeerOptions(conf, opts)
+
+	return &PeerGroup{
+		peerConfig: conf,
+		name:       name,
+		self:       self,
+		cache:      cache,
+		load:       load,
+		transport:  transport,
+		ring:       NewHashRing(conf.replicas),
+		loads:      singleflight.NewGroup(mapInitialCap),
+		fetches:    singleflight.NewGroup(mapInitialCap),
+	}
+}
+
+// Name returns the name of group.
+func (pg *PeerGroup) Name() string {
+	return pg.name
+}
+
+// SetPeers sets all peers of group including self.
+func (pg *PeerGroup) SetPeers(peers ...string) {
+	pg.ring.Set(peers...)
+}
+
+// Owner returns the peer owning key.
+func (pg *PeerGroup) Owner(key string) (peer string) {
+	if peer = pg.ring.Pick(key); peer == "" {
+		return pg.self
+	}
+
+	return peer
+}
+
+func (pg *PeerGroup) reportError(peer string, key string, err error) {
+	if pg.peerError != nil {
+		pg.peerError(peer, key, err)
+	}
+}
+
+// Get gets the value of key from cache, hot cache, its owner or loader in order.
+// Key is loaded locally if its owner can't be reached, and the error of its owner loading it is returned as it is.
+func (pg *PeerGroup) Get(key string) (value interface{}, err error) {
+	if value, found := pg.cache.Get(key, nil); found {
+		return value, nil
+	}
+
+	if pg.hotCache != nil {
+		if value, found := pg.hotCache.Get(key, nil); found {
+			return value, nil
+		}
+	}
+
+	peer := pg.Owner(key)
+	if peer == pg.self {
+		return pg.loadLocally(key)
+	}
+
+	value, err = pg.fetches.Call(key, func() (interface{}, error) {
+		return pg.fetch(peer, key)
+	})
+
+	if err == nil {
+		return value, nil
+	}
+
+	var loadErr *PeerLoadError
+	if errors.As(err, &loadErr) {
+		return nil, err
+	}
+
+	pg.reportError(peer, key, err)
+	return pg.loadLocally(key)
+}
+
+// Fetch returns the encoded value of key which is fetched by other peers, see PeerTransport.
+// Key is always loaded locally, so peers having different views of owners won't fetch from each other forever.
+func (pg *PeerGroup) Fetch(key string) (data []byte, err error) {
+	value, err := pg.loadLocally(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.codec.Encode(value)
+}
+
+// fetch fetches key from peer and sets it to hot cache.
+func (pg *PeerGroup) fetch(peer string, key string) (value interface{}, err error) {
+	data, err := pg.transport.Fetch(peer, pg.name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err = pg.codec.Decode(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if pg.hotCache != nil {
+		pg.hotCache.Set(key, value, pg.hotTTL)
+	}
+
+	return value, nil
+}
+
+// loadLocally gets key from cache or loads it in singleflight mode.
+func (pg *PeerGroup) loadLocally(key string) (value interface{}, err error) {
+	if value, found := pg.cache.Get(key, nil); found {
+		return value, nil
+	}
+
+	return pg.loads.Call(key, func() (interface{}, error) {
+		// Check cache again because key may be loaded after the last check.
+		if value, found := pg.cache.Get(key, nil); found {
+			return value, nil
+		}
+
+		value, ttl, err := pg.load(key)
+		if err != nil {
+			return nil, err
+		}
+
+		pg.cache.Set(key, value, ttl)
+		return value, nil
+	})
+}
@@ -0,0 +1,142 @@
+package memcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPeerBasePath is the default base path of http transport.
+	DefaultPeerBasePath = "/_memcache/"
+
+	// defaultPeerTimeout is the timeout of fetching from peers if client isn't specified.
+	defaultPeerTimeout = 5 * time.Second
+)
+
+// HTTPTransport is a peer transport over http, and peers are their base urls like "http://10.0.0.1:8080".
+// It's also an http handler serving fetches of registered groups from other peers,
+// so it should be mounted at its base path of each peer.
+type HTTPTransport struct {
+	basePath string
+	client   *http.Client
+	groups   map[string]*PeerGroup
+	lock     sync.RWMutex
+}
+
+// NewHTTPTransport returns an http transport fetching with client under basePath.
+// DefaultPeerBasePath is used if basePath is empty, and a client with a 5s timeout is used if client is nil,
+// so an unreachable peer won't block getting keys forever.
+func NewHTTPTransport(basePath string, client *http.Client) *HTTPTransport {
+	if basePath == "" {
+		basePath = DefaultPeerBasePath
+	}
+
+	if !strings.HasSuffix(basePath, "/") {
+		basePath += "/"
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: defaultPeerTimeout}
+	}
+
+	return &HTTPTransport{
+		basePath: basePath,
+		client:   client,
+		groups:   make(map[string]*PeerGroup),
+	}
+}
+
+// Register registers groups, so they can be fetched by other peers.
+func (ht *HTTPTransport) Register(groups ...*PeerGroup) {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+
+	for _, group := range groups {
+		ht.groups[group.Name()] = group
+	}
+}
+
+// Fetch fetches the encoded value of key in group from peer.
+// See PeerTransport.
+func (ht *HTTPTransport) Fetch(peer string, group string, key string) (data []byte, err error) {
+	target := strings.TrimSuffix(peer, "/") + ht.basePath + url.PathEscape(group) + "/" + url.PathEscape(key)
+
+	resp, err := ht.client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The owner fails to load key only if it responds an internal error, and others mean it can't serve the fetch.
+	if resp.StatusCode == http.StatusInternalServerError {
+		return nil, &PeerLoadError{Peer: peer, Key: key, Message: strings.TrimSpace(string(data))}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cachego: peer %s responds %d: %s", peer, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+// ServeHTTP serves fetches of registered groups from other peers.
+func (ht *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "cachego: method "+r.Method+" is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, ht.basePath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	escapedGroup, escapedKey, ok := strings.Cut(strings.TrimPrefix(path, ht.basePath), "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	groupName, err := url.PathUnescape(escapedGroup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := url.PathUnescape(escapedKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ht.lock.RLock()
+	group, ok := ht.groups[groupName]
+	ht.lock.RUnlock()
+
+	if !ok {
+		http.Error(w, "cachego: group "+groupName+" not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := group.Fetch(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
@@ -0,0 +1,294 @@
+package memcache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestHashRing$
+func TestHashRing(t *testing.T) {
+	ring := NewHashRing(50)
+	if peer := ring.Pick("key"); peer != "" {
+		t.Fatalf("peer %s != ''", peer)
+	}
+
+	peers := []string{"peer1", "peer2", "peer3"}
+	ring.Set(peers...)
+
+	another := NewHashRing(50)
+	another.Set("peer3", "peer1", "peer2")
+
+	owners := make(map[string]string, 3000)
+	counts := make(map[string]int, len(peers))
+
+	for i := 0; i < 3000; i++ {
+		key := "key" + strconv.Itoa(i)
+		owners[key] = ring.Pick(key)
+		counts[owners[key]]++
+
+		if peer := another.Pick(key); peer != owners[key] {
+			t.Fatalf("key %s: peer %s != %s", key, peer, owners[key])
+		}
+	}
+
+	for _, peer := range peers {
+		if counts[peer] < 500 {
+			t.Fatalf("peer %s only owns %d keys of 3000", peer, counts[peer])
+		}
+	}
+
+	ring.Set("peer1", "peer2")
+	for key, owner := range owners {
+		peer := ring.Pick(key)
+		if owner != "peer3" && peer != owner {
+			t.Fatalf("key %s: peer %s != %s", key, peer, owner)
+		}
+
+		if peer == "peer3" {
+			t.Fatalf("key %s is still owned by peer3", key)
+		}
+	}
+}
+
+type testPeer struct {
+	group   *PeerGroup
+	server  *httptest.Server
+	loads   map[string]int
+	fetches int64
+	lock    sync.Mutex
+}
+
+func (tp *testPeer) loadsOf(key string) int {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	return tp.loads[key]
+}
+
+// newTestPeers returns n peers serving a group on loopback.
+func newTestPeers(t *testing.T, n int, opts ...PeerOption) []*testPeer {
+	peers := make([]*testPeer, 0, n)
+	addresses := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		peer := &testPeer{loads: make(map[string]int)}
+		transport := NewHTTPTransport("", nil)
+
+		peer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&peer.fetches, 1)
+			transport.ServeHTTP(w, r)
+		}))
+
+		t.Cleanup(peer.server.Close)
+
+		load := func(key string) (value interface{}, ttl time.Duration, err error) {
+			time.Sleep(10 * time.Millisecond)
+
+			peer.lock.Lock()
+			peer.loads[key]++
+			peer.lock.Unlock()
+
+			if key == "error" {
+				return nil, 0, fmt.Errorf("load %s failed", key)
+			}
+
+			return "value of " + key, NoTTL, nil
+		}
+
+		cache := NewCache(WithLRU(64), WithGC(0))
+		t.Cleanup(func() {
+			cache.Close()
+		})
+
+		peer.group = NewPeerGroup("test", peer.server.URL, cache, load, transport, opts...)
+		transport.Register(peer.group)
+
+		peers = append(peers, peer)
+		addresses = append(addresses, peer.server.URL)
+	}
+
+	for _, peer := range peers {
+		peer.group.SetPeers(addresses...)
+	}
+
+	return peers
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPeerGroup$
+func TestPeerGroup(t *testing.T) {
+	peers := newTestPeers(t, 3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+
+		for _, peer := range peers {
+			for j := 0; j < 3; j++ {
+				wg.Add(1)
+
+				go func(group *PeerGroup) {
+					defer wg.Done()
+
+					value, err := group.Get(key)
+					if err != nil {
+						t.Errorf("key %s: err %+v", key, err)
+						return
+					}
+
+					if value != "value of "+key {
+						t.Errorf("key %s: value %+v is wrong", key, value)
+					}
+				}(peer.group)
+			}
+		}
+	}
+
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		owner := peers[0].group.Owner(key)
+
+		for _, peer := range peers {
+			if peer.group.Owner(key) != owner {
+				t.Fatalf("key %s: owner %s != %s", key, peer.group.Owner(key), owner)
+			}
+
+			loads := peer.loadsOf(key)
+			if peer.server.URL == owner && loads != 1 {
+				t.Fatalf("key %s: owner loads %d != 1", key, loads)
+			}
+
+			if peer.server.URL != owner && loads != 0 {
+				t.Fatalf("key %s: peer %s loads %d != 0", key, peer.server.URL, loads)
+			}
+		}
+	}
+
+	if _, err := peers[0].group.Get("error"); err == nil {
+		t.Fatal("err == nil")
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPeerGroupHotCache$
+func TestPeerGroupHotCache(t *testing.T) {
+	hotCache := NewCache(WithLRU(16), WithGC(0))
+	defer hotCache.Close()
+
+	peers := newTestPeers(t, 2)
+	peers[0].group.hotCache = hotCache
+
+	var key string
+	var owner *testPeer
+
+	for i := 0; ; i++ {
+		key = "key" + strconv.Itoa(i)
+		if peers[0].group.Owner(key) == peers[1].server.URL {
+			owner = peers[1]
+			break
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if value, err := peers[0].group.Get(key); err != nil || value != "value of "+key {
+			t.Fatalf("value %+v is wrong or err %+v != nil", value, err)
+		}
+	}
+
+	if fetches := atomic.LoadInt64(&owner.fetches); fetches != 1 {
+		t.Fatalf("fetches %d != 1", fetches)
+	}
+
+	if value, found := hotCache.Get(key, nil); !found || value != "value of "+key {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPeerGroupFallback$
+func TestPeerGroupFallback(t *testing.T) {
+	var reported []string
+	peerError := func(peer string, key string, err error) {
+		reported = append(reported, key)
+	}
+
+	peers := newTestPeers(t, 2, WithPeerError(peerError))
+	peers[1].server.Close()
+
+	var key string
+	for i := 0; ; i++ {
+		key = "key" + strconv.Itoa(i)
+		if peers[0].group.Owner(key) == peers[1].server.URL {
+			break
+		}
+	}
+
+	if value, err := peers[0].group.Get(key); err != nil || value != "value of "+key {
+		t.Fatalf("value %+v is wrong or err %+v != nil", value, err)
+	}
+
+	if len(reported) != 1 || reported[0] != key {
+		t.Fatalf("reported %+v is wrong", reported)
+	}
+
+	if loads := peers[0].loadsOf(key); loads != 1 {
+		t.Fatalf("loads %d != 1", loads)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPeerGroupLoadError$
+func TestPeerGroupLoadError(t *testing.T) {
+	var reported []string
+	peerError := func(peer string, key string, err error) {
+		reported = append(reported, key)
+	}
+
+	peers := newTestPeers(t, 2, WithPeerError(peerError))
+
+	fetcher, owner := peers[0], peers[1]
+	if fetcher.group.Owner("error") != owner.server.URL {
+		fetcher, owner = owner, fetcher
+	}
+
+	_, err := fetcher.group.Get("error")
+
+	var loadErr *PeerLoadError
+	if !errors.As(err, &loadErr) || loadErr.Peer != owner.server.URL || loadErr.Key != "error" {
+		t.Fatalf("err %+v isn't a load error of owner", err)
+	}
+
+	if loads := owner.loadsOf("error"); loads != 1 {
+		t.Fatalf("owner loads %d != 1", loads)
+	}
+
+	if loads := fetcher.loadsOf("error"); loads != 0 {
+		t.Fatalf("fetcher loads %d != 0", loads)
+	}
+
+	if len(reported) != 0 {
+		t.Fatalf("reported %+v isn't empty", reported)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNewHTTPTransport$
+func TestNewHTTPTransport(t *testing.T) {
+	transport := NewHTTPTransport("", nil)
+	if transport.client == http.DefaultClient || transport.client.Timeout != defaultPeerTimeout {
+		t.Fatalf("client %+v has no default timeout", transport.client)
+	}
+
+	if transport.basePath != DefaultPeerBasePath {
+		t.Fatalf("base path %s != %s", transport.basePath, DefaultPeerBasePath)
+	}
+
+	client := &http.Client{}
+	if transport = NewHTTPTransport("/peers", client); transport.client != client || transport.basePath != "/peers/" {
+		t.Fatalf("client %+v or base path %s is wrong", transport.client, transport.basePath)
+	}
+}
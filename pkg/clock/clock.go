@@ -63,32 +63,61 @@ var (
 // The another reason choosing to use it is .
 // So, better performance should not be the first reason to use it.
 // The first reason to use it is reducing gc objects, but we hope you never use it :)
+//
+// Notice that the time of clock is updated in fixed duration, so the precision of time is about the duration.
+// For example, a key with 1s ttl may live about 1.1s if you use a clock with 100ms duration in cache.
 type Clock struct {
-	now int64
+	now      int64
+	duration time.Duration
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
 // New creates a new clock which caches time and updates it in fixed duration.
+// The clock returned is shared and updated every 100ms, so don't stop it.
 func New() *Clock {
 	clockOnce.Do(func() {
-		clock = &Clock{
-			now: time.Now().UnixNano(),
-		}
-
-		go clock.start()
+		clock = NewWithDuration(duration)
 	})
 
 	return clock
 }
 
+// NewWithDuration creates a new clock which caches time and updates it every duration.
+// A smaller duration means a higher precision and a higher cost.
+// Remember to stop the clock if you don't need it anymore, or its goroutine will run forever.
+func NewWithDuration(duration time.Duration) *Clock {
+	if duration <= 0 {
+		panic("clock: duration must be > 0")
+	}
+
+	c := &Clock{
+		now:      time.Now().UnixNano(),
+		duration: duration,
+		stopCh:   make(chan struct{}),
+	}
+
+	go c.start()
+	return c
+}
+
 func (c *Clock) start() {
-	for {
-		for i := 0; i < 9; i++ {
-			time.Sleep(duration)
-			atomic.AddInt64(&c.now, int64(duration))
-		}
+	ticker := time.NewTicker(c.duration)
+	defer ticker.Stop()
 
-		time.Sleep(duration)
-		atomic.StoreInt64(&c.now, time.Now().UnixNano())
+	// We add duration to now for most ticks and correct it with time.Now every 10 ticks.
+	for ticks := 1; ; ticks++ {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			if ticks%10 == 0 {
+				atomic.StoreInt64(&c.now, time.Now().UnixNano())
+			} else {
+				atomic.AddInt64(&c.now, int64(c.duration))
+			}
+		}
 	}
 }
 
@@ -96,3 +125,16 @@ func (c *Clock) start() {
 func (c *Clock) Now() int64 {
 	return atomic.LoadInt64(&c.now)
 }
+
+// Duration returns the duration of updating time which is also the precision of clock.
+func (c *Clock) Duration() time.Duration {
+	return c.duration
+}
+
+// Stop stops updating time of clock, and Now will always return the last time updated.
+// It's safe to call Stop more than once.
+func (c *Clock) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+}
@@ -74,3 +74,44 @@ func TestClock(t *testing.T) {
 		time.Sleep(time.Duration(rand.Int63n(int64(duration))))
 	}
 }
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestNewWithDuration$
+func TestNewWithDuration(t *testing.T) {
+	testClock := NewWithDuration(100 * time.Millisecond)
+	defer testClock.Stop()
+
+	if testClock == New() {
+		t.Fatal("testClock shouldn't be the shared clock")
+	}
+
+	if testClock.Duration() != 100*time.Millisecond {
+		t.Fatalf("testClock.Duration() %s != 100ms", testClock.Duration())
+	}
+
+	for i := 0; i < 10; i++ {
+		now := testClock.Now()
+
+		expect := time.Now().UnixNano()
+		if math.Abs(float64(expect-now)) > float64(testClock.Duration())*1.5 {
+			t.Fatalf("now %d is wrong with expect %d", now, expect)
+		}
+
+		time.Sleep(time.Duration(rand.Int63n(int64(testClock.Duration()))))
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestClockStop$
+func TestClockStop(t *testing.T) {
+	testClock := NewWithDuration(time.Millisecond)
+	testClock.Stop()
+	testClock.Stop()
+
+	// Wait for the goroutine exiting in case it's updating time.
+	time.Sleep(10 * time.Millisecond)
+	now := testClock.Now()
+
+	time.Sleep(10 * time.Millisecond)
+	if testClock.Now() != now {
+		t.Fatalf("testClock.Now() %d != now %d", testClock.Now(), now)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 FishGoddess. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock controlled manually which is useful in tests.
+// Its time only changes when calling Advance or Set, and tickers created by it tick only when time passes by.
+// Use FakeClock.Now with options like WithNow, and use FakeClock.NewTicker to drive tasks.
+type FakeClock struct {
+	now     int64
+	tickers []*fakeTicker
+	lock    sync.Mutex
+}
+
+// NewFake creates a fake clock starting at t.
+func NewFake(t time.Time) *FakeClock {
+	return &FakeClock{
+		now: t.UnixNano(),
+	}
+}
+
+// Now returns the current time of fake clock in nanoseconds.
+func (fc *FakeClock) Now() int64 {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	return fc.now
+}
+
+// Advance moves the time forward by d and fires all tickers due.
+// It returns after all ticks fired have been handled, so the results of tasks can be checked right away.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.lock.Lock()
+	now := fc.now + int64(d)
+	fc.lock.Unlock()
+
+	fc.Set(time.Unix(0, now))
+}
+
+// Set sets the time of fake clock to t and fires all tickers due if t is later than current time.
+// It returns after all ticks fired have been handled.
+func (fc *FakeClock) Set(t time.Time) {
+	fc.lock.Lock()
+
+	now := t.UnixNano()
+	fc.now = now
+
+	tickers := make([]*fakeTicker, 0, len(fc.tickers))
+	for _, ticker := range fc.tickers {
+		if !ticker.stopped() {
+			tickers = append(tickers, ticker)
+		}
+	}
+
+	fc.tickers = tickers
+	fc.lock.Unlock()
+
+	// Fire ticks without lock, because tasks may call Now when handling ticks.
+	for _, ticker := range tickers {
+		ticker.fire(now)
+	}
+}
+
+// NewTicker returns a ticker which ticks every duration of fake clock.
+func (fc *FakeClock) NewTicker(duration time.Duration) Ticker {
+	if duration <= 0 {
+		panic("clock: duration must be > 0")
+	}
+
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	ticker := &fakeTicker{
+		duration: int64(duration),
+		next:     fc.now + int64(duration),
+		ch:       make(chan time.Time),
+		done:     make(chan struct{}),
+		stopCh:   make(chan struct{}),
+	}
+
+	fc.tickers = append(fc.tickers, ticker)
+	return ticker
+}
+
+type fakeTicker struct {
+	duration int64
+	next     int64
+
+	ch       chan time.Time
+	done     chan struct{}
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	// lock makes sure only one goroutine fires this ticker at the same time.
+	lock sync.Mutex
+}
+
+func (ft *fakeTicker) stopped() bool {
+	select {
+	case <-ft.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// fire delivers all ticks due at now and waits for them being handled.
+func (ft *fakeTicker) fire(now int64) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	for ft.next <= now {
+		tick := time.Unix(0, ft.next)
+		ft.next += ft.duration
+
+		select {
+		case ft.ch <- tick:
+		case <-ft.stopCh:
+			return
+		}
+
+		select {
+		case <-ft.done:
+		case <-ft.stopCh:
+			return
+		}
+	}
+}
+
+func (ft *fakeTicker) C() <-chan time.Time {
+	return ft.ch
+}
+
+func (ft *fakeTicker) Done() {
+	select {
+	case ft.done <- struct{}{}:
+	case <-ft.stopCh:
+	}
+}
+
+func (ft *fakeTicker) Stop() {
+	ft.stopOnce.Do(func() {
+		close(ft.stopCh)
+	})
+}
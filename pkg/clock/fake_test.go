@@ -0,0 +1,80 @@
+// Copyright 2023 FishGoddess. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestFakeClock$
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	fakeClock := NewFake(start)
+
+	if now := fakeClock.Now(); now != start.UnixNano() {
+		t.Fatalf("now %d != start %d", now, start.UnixNano())
+	}
+
+	fakeClock.Advance(time.Second)
+	if now := fakeClock.Now(); now != start.Add(time.Second).UnixNano() {
+		t.Fatalf("now %d is wrong", now)
+	}
+
+	fakeClock.Set(start)
+	if now := fakeClock.Now(); now != start.UnixNano() {
+		t.Fatalf("now %d != start %d", now, start.UnixNano())
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestFakeClockTicker$
+func TestFakeClockTicker(t *testing.T) {
+	fakeClock := NewFake(time.Unix(1000, 0))
+	ticker := fakeClock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var ticks int64
+	go func() {
+		for range ticker.C() {
+			// Now should be usable when handling ticks.
+			fakeClock.Now()
+			atomic.AddInt64(&ticks, 1)
+			ticker.Done()
+		}
+	}()
+
+	fakeClock.Advance(500 * time.Millisecond)
+	if n := atomic.LoadInt64(&ticks); n != 0 {
+		t.Fatalf("ticks %d != 0", n)
+	}
+
+	fakeClock.Advance(500 * time.Millisecond)
+	if n := atomic.LoadInt64(&ticks); n != 1 {
+		t.Fatalf("ticks %d != 1", n)
+	}
+
+	fakeClock.Advance(3 * time.Second)
+	if n := atomic.LoadInt64(&ticks); n != 4 {
+		t.Fatalf("ticks %d != 4", n)
+	}
+
+	ticker.Stop()
+	fakeClock.Advance(time.Second)
+
+	if n := atomic.LoadInt64(&ticks); n != 4 {
+		t.Fatalf("ticks %d != 4", n)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 FishGoddess. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"time"
+)
+
+// Ticker delivers ticks at fixed duration like time.Ticker.
+// Tasks should receive ticks from C and call Done after handling each tick.
+type Ticker interface {
+	// C returns the channel delivering ticks.
+	C() <-chan time.Time
+
+	// Done reports the last tick received from C has been handled.
+	// A fake clock uses it to wait for tasks, and a real ticker just ignores it.
+	Done()
+
+	// Stop stops the ticker, and no more ticks will be delivered.
+	Stop()
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+// NewTicker returns a ticker backed by time.Ticker.
+func NewTicker(duration time.Duration) Ticker {
+	return &realTicker{
+		ticker: time.NewTicker(duration),
+	}
+}
+
+func (rt *realTicker) C() <-chan time.Time {
+	return rt.ticker.C
+}
+
+func (rt *realTicker) Done() {}
+
+func (rt *realTicker) Stop() {
+	rt.ticker.Stop()
+}
@@ -0,0 +1,259 @@
+// Copyright 2023 FishGoddess. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package radix
+
+import (
+	"sort"
+	"strings"
+)
+
+type node struct {
+	// prefix is the edge from parent to this node.
+	prefix   string
+	children []*node
+	leaf     bool
+}
+
+func commonPrefix(a string, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+// childOf returns the index of child whose prefix starts with c, or the index to insert if not found.
+func (n *node) childOf(c byte) (index int, found bool) {
+	index = sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= c
+	})
+
+	return index, index < len(n.children) && n.children[index].prefix[0] == c
+}
+
+func (n *node) insertChild(index int, child *node) {
+	n.children = append(n.children, nil)
+	copy(n.children[index+1:], n.children[index:])
+	n.children[index] = child
+}
+
+func (n *node) removeChild(index int) {
+	copy(n.children[index:], n.children[index+1:])
+	n.children[len(n.children)-1] = nil
+	n.children = n.children[:len(n.children)-1]
+}
+
+// Tree is a radix tree storing a set of keys which can be walked by prefix.
+// It's not safe for concurrent use, so use it with a lock.
+type Tree struct {
+	root *node
+	size int
+}
+
+// New returns a new empty tree.
+func New() *Tree {
+	return &Tree{
+		root: new(node),
+	}
+}
+
+// Size returns the count of keys in tree.
+func (t *Tree) Size() int {
+	return t.size
+}
+
+// Insert inserts key to tree and reports if key is new.
+func (t *Tree) Insert(key string) bool {
+	n := t.root
+
+	for {
+		if len(key) == 0 {
+			if n.leaf {
+				return false
+			}
+
+			n.leaf = true
+			t.size++
+			return true
+		}
+
+		index, found := n.childOf(key[0])
+		if !found {
+			n.insertChild(index, &node{prefix: key, leaf: true})
+			t.size++
+			return true
+		}
+
+		child := n.children[index]
+		common := commonPrefix(key, child.prefix)
+
+		if common == len(child.prefix) {
+			n = child
+			key = key[common:]
+			continue
+		}
+
+		// Split child at the common prefix.
+		split := &node{prefix: child.prefix[:common]}
+		child.prefix = child.prefix[common:]
+		split.children = []*node{child}
+		n.children[index] = split
+
+		n = split
+		key = key[common:]
+	}
+}
+
+// Contains reports if key is in tree.
+func (t *Tree) Contains(key string) bool {
+	n := t.root
+
+	for len(key) > 0 {
+		index, found := n.childOf(key[0])
+		if !found || !strings.HasPrefix(key, n.children[index].prefix) {
+			return false
+		}
+
+		n = n.children[index]
+		key = key[len(n.prefix):]
+	}
+
+	return n.leaf
+}
+
+// Delete deletes key from tree and reports if key existed.
+func (t *Tree) Delete(key string) bool {
+	// parents records the path so we can merge nodes after deleting.
+	var parents []*node
+	var indexes []int
+
+	n := t.root
+	for len(key) > 0 {
+		index, found := n.childOf(key[0])
+		if !found || !strings.HasPrefix(key, n.children[index].prefix) {
+			return false
+		}
+
+		parents = append(parents, n)
+		indexes = append(indexes, index)
+
+		n = n.children[index]
+		key = key[len(n.prefix):]
+	}
+
+	if !n.leaf {
+		return false
+	}
+
+	n.leaf = false
+	t.size--
+
+	// Remove empty nodes and merge nodes having only one child from bottom to top.
+	for i := len(parents) - 1; i >= 0; i-- {
+		parent, index := parents[i], indexes[i]
+
+		if !n.leaf && len(n.children) == 0 {
+			parent.removeChild(index)
+		} else if !n.leaf && len(n.children) == 1 {
+			child := n.children[0]
+			child.prefix = n.prefix + child.prefix
+			parent.children[index] = child
+		}
+
+		n = parent
+	}
+
+	return true
+}
+
+// WalkPrefix calls fn with all keys starting with prefix in byte order until fn returns false.
+// Don't modify tree in fn.
+func (t *Tree) WalkPrefix(prefix string, fn func(key string) bool) {
+	n := t.root
+	path := ""
+
+	for len(prefix) > 0 {
+		index, found := n.childOf(prefix[0])
+		if !found {
+			return
+		}
+
+		child := n.children[index]
+		if strings.HasPrefix(prefix, child.prefix) {
+			n = child
+			path += child.prefix
+			prefix = prefix[len(child.prefix):]
+			continue
+		}
+
+		// The rest of prefix ends in the middle of child's edge.
+		if !strings.HasPrefix(child.prefix, prefix) {
+			return
+		}
+
+		n = child
+		path += child.prefix
+		prefix = ""
+	}
+
+	walk(n, path, fn)
+}
+
+// WalkFrom calls fn with all keys not less than start in byte order until fn returns false.
+// Don't modify tree in fn.
+func (t *Tree) WalkFrom(start string, fn func(key string) bool) {
+	walkFrom(t.root, "", start, fn)
+}
+
+// walkFrom walks keys not less than start in the subtree of n, and path is a prefix of start.
+func walkFrom(n *node, path string, start string, fn func(key string) bool) bool {
+	rest := start[len(path):]
+	if len(rest) == 0 {
+		return walk(n, path, fn)
+	}
+
+	// The key of n itself is path which is less than start, so only children are walked.
+	for _, child := range n.children {
+		if strings.HasPrefix(rest, child.prefix) {
+			if !walkFrom(child, path+child.prefix, start, fn) {
+				return false
+			}
+
+			continue
+		}
+
+		// All keys of child are greater than start, or all of them are less than start.
+		if child.prefix > rest && !walk(child, path+child.prefix, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func walk(n *node, path string, fn func(key string) bool) bool {
+	if n.leaf && !fn(path) {
+		return false
+	}
+
+	for _, child := range n.children {
+		if !walk(child, path+child.prefix, fn) {
+			return false
+		}
+	}
+
+	return true
+}
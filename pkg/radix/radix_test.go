@@ -0,0 +1,148 @@
+// Copyright 2023 FishGoddess. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package radix
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func walkPrefix(tree *Tree, prefix string) []string {
+	var keys []string
+	tree.WalkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	return keys
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTree$
+func TestTree(t *testing.T) {
+	tree := New()
+
+	keys := []string{"tenant:1:a", "tenant:1:b", "tenant:12:a", "tenant:2:a", "tenant", "te", "other", ""}
+	for _, key := range keys {
+		if !tree.Insert(key) {
+			t.Fatalf("insert %q should be new", key)
+		}
+	}
+
+	if tree.Insert("tenant:1:a") {
+		t.Fatal("insert tenant:1:a again shouldn't be new")
+	}
+
+	if tree.Size() != len(keys) {
+		t.Fatalf("tree.Size() %d != %d", tree.Size(), len(keys))
+	}
+
+	for _, key := range keys {
+		if !tree.Contains(key) {
+			t.Fatalf("tree should contain %q", key)
+		}
+	}
+
+	if tree.Contains("tenant:") || tree.Contains("t") {
+		t.Fatal("tree shouldn't contain prefixes not inserted")
+	}
+
+	got := strings.Join(walkPrefix(tree, "tenant:1"), ",")
+	if expect := "tenant:12:a,tenant:1:a,tenant:1:b"; got != expect {
+		t.Fatalf("got %s != expect %s", got, expect)
+	}
+
+	got = strings.Join(walkPrefix(tree, "tena"), ",")
+	if expect := "tenant,tenant:12:a,tenant:1:a,tenant:1:b,tenant:2:a"; got != expect {
+		t.Fatalf("got %s != expect %s", got, expect)
+	}
+
+	if got := walkPrefix(tree, "tenant:3"); len(got) != 0 {
+		t.Fatalf("got %v should be empty", got)
+	}
+
+	if !tree.Delete("tenant") || tree.Delete("tenant") || tree.Delete("tenant:") {
+		t.Fatal("delete result is wrong")
+	}
+
+	got = strings.Join(walkPrefix(tree, "te"), ",")
+	if expect := "te,tenant:12:a,tenant:1:a,tenant:1:b,tenant:2:a"; got != expect {
+		t.Fatalf("got %s != expect %s", got, expect)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTreeRandom$
+func TestTreeRandom(t *testing.T) {
+	tree := New()
+	keys := map[string]bool{}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		key := strconv.FormatInt(random.Int63n(5000), 36)
+
+		if random.Intn(3) == 0 {
+			if deleted := tree.Delete(key); deleted != keys[key] {
+				t.Fatalf("delete %s: deleted %v != %v", key, deleted, keys[key])
+			}
+
+			delete(keys, key)
+			continue
+		}
+
+		if inserted := tree.Insert(key); inserted == keys[key] {
+			t.Fatalf("insert %s: inserted %v is wrong", key, inserted)
+		}
+
+		keys[key] = true
+	}
+
+	expect := make([]string, 0, len(keys))
+	for key := range keys {
+		expect = append(expect, key)
+	}
+
+	sort.Strings(expect)
+
+	got := walkPrefix(tree, "")
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Fatalf("got %d keys != expect %d keys", len(got), len(expect))
+	}
+
+	for i := 0; i < 100; i++ {
+		start := strconv.FormatInt(random.Int63n(5000), 36)
+		from := sort.SearchStrings(expect, start)
+
+		got = got[:0]
+		tree.WalkFrom(start, func(key string) bool {
+			got = append(got, key)
+			return len(got) < 10
+		})
+
+		end := from + 10
+		if end > len(expect) {
+			end = len(expect)
+		}
+
+		if strings.Join(got, ",") != strings.Join(expect[from:end], ",") {
+			t.Fatalf("walk from %s: got %v != expect %v", start, got, expect[from:end])
+		}
+	}
+
+	if tree.Size() != len(keys) {
+		t.Fatalf("tree.Size() %d != %d", tree.Size(), len(keys))
+	}
+}
@@ -42,12 +42,13 @@ func testGroupCall(t *testing.T, group *Group, concurrency int) {
 			})
 
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 
 			r := atomic.LoadInt64(&rightResult)
 			if result != r {
-				t.Fatalf("result %d != rightResult %d", result, r)
+				t.Errorf("result %d != rightResult %d", result, r)
 			}
 		}(int64(i))
 	}
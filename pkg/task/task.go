@@ -17,12 +17,15 @@ package task
 import (
 	"context"
 	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
 )
 
 // Task runs a function at fixed duration.
 type Task struct {
-	ctx      context.Context
-	duration time.Duration
+	ctx       context.Context
+	duration  time.Duration
+	newTicker func(duration time.Duration) clock.Ticker
 
 	before func(ctx context.Context)
 	fn     func(ctx context.Context)
@@ -34,9 +37,10 @@ type Task struct {
 // By default, its duration is 1min, and you can change it by Duration().
 func New(fn func(ctx context.Context)) *Task {
 	return &Task{
-		ctx:      context.Background(),
-		duration: time.Minute,
-		fn:       fn,
+		ctx:       context.Background(),
+		duration:  time.Minute,
+		newTicker: clock.NewTicker,
+		fn:        fn,
 	}
 }
 
@@ -52,6 +56,16 @@ func (t *Task) Duration(duration time.Duration) *Task {
 	return t
 }
 
+// Ticker sets newTicker to task which creates the ticker driving task loops.
+// By default, it's clock.NewTicker, and you can use clock.FakeClock.NewTicker to drive task in tests.
+func (t *Task) Ticker(newTicker func(duration time.Duration) clock.Ticker) *Task {
+	if newTicker != nil {
+		t.newTicker = newTicker
+	}
+
+	return t
+}
+
 // Before sets fn to task which will be called before task starting.
 func (t *Task) Before(fn func(ctx context.Context)) *Task {
 	t.before = fn
@@ -71,6 +85,22 @@ func (t *Task) Run() {
 		return
 	}
 
+	t.run(t.newTicker(t.duration))
+}
+
+// Start runs task in a new goroutine.
+// Different from go Run(), the ticker is created before returning, so no ticks of a fake clock will be missed.
+func (t *Task) Start() {
+	if t.fn == nil {
+		return
+	}
+
+	go t.run(t.newTicker(t.duration))
+}
+
+func (t *Task) run(ticker clock.Ticker) {
+	defer ticker.Stop()
+
 	if t.before != nil {
 		t.before(t.ctx)
 	}
@@ -79,15 +109,13 @@ func (t *Task) Run() {
 		defer t.after(t.ctx)
 	}
 
-	ticker := time.NewTicker(t.duration)
-	defer ticker.Stop()
-
 	for {
 		select {
 		case <-t.ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			t.fn(t.ctx)
+			ticker.Done()
 		}
 	}
 }
@@ -20,6 +20,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
 )
 
 type testEntry struct {
@@ -99,3 +101,28 @@ func TestTickerTaskRun(t *testing.T) {
 		t.Fatalf("result %s != expect %s", result.String(), expect.String())
 	}
 }
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTaskWithFakeClock$
+func TestTaskWithFakeClock(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1000, 0))
+
+	var loop int64
+	mainFn := func(ctx context.Context) {
+		atomic.AddInt64(&loop, 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	New(mainFn).Context(ctx).Duration(time.Minute).Ticker(fakeClock.NewTicker).Start()
+
+	fakeClock.Advance(time.Minute)
+	if n := atomic.LoadInt64(&loop); n != 1 {
+		t.Fatalf("loop %d != 1", n)
+	}
+
+	fakeClock.Advance(10 * time.Minute)
+	if n := atomic.LoadInt64(&loop); n != 11 {
+		t.Fatalf("loop %d != 11", n)
+	}
+}
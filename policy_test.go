@@ -0,0 +1,132 @@
+package memcache
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var testPolicies = map[string]func(maxEntries int) Option{
+	"lru":    WithLRU,
+	"arc":    WithARC,
+	"s3fifo": WithS3FIFO,
+	"sieve":  WithSieve,
+}
+
+// testTrace returns a zipf-distributed trace of keys which is similar to web traces.
+func testTrace(length int, keys uint64) []string {
+	random := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(random, 1.1, 1, keys-1)
+
+	trace := make([]string, 0, length)
+	for i := 0; i < length; i++ {
+		trace = append(trace, strconv.FormatUint(zipf.Uint64(), 10))
+	}
+
+	return trace
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPolicyHitRate$
+func TestPolicyHitRate(t *testing.T) {
+	maxEntries := 1000
+	trace := testTrace(100000, 100000)
+	hitRates := make(map[string]float64, len(testPolicies))
+
+	for name, withPolicy := range testPolicies {
+		cache, reporter := NewCacheWithReport(withPolicy(maxEntries), WithGC(0))
+
+		for _, key := range trace {
+			if _, found := cache.Get(key, nil); !found {
+				cache.Set(key, key, NoTTL)
+			}
+		}
+
+		if size := cache.Size(); size > maxEntries {
+			t.Fatalf("%s: size %d > maxEntries %d", name, size, maxEntries)
+		}
+
+		hitRates[name] = reporter.HitRate()
+		t.Logf("%s: hit rate %.4f", name, hitRates[name])
+	}
+
+	// The trace is skewed with many one-hit wonders, so scan-resistant policies should beat lru.
+	for _, name := range []string{"arc", "s3fifo", "sieve"} {
+		if hitRates[name] <= hitRates["lru"] {
+			t.Fatalf("%s: hit rate %.4f <= lru hit rate %.4f", name, hitRates[name], hitRates["lru"])
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPolicyOneHitWonders$
+func TestPolicyOneHitWonders(t *testing.T) {
+	for _, name := range []string{"s3fifo", "sieve"} {
+		cache := NewCache(testPolicies[name](10), WithGC(0))
+
+		for i := 0; i < 5; i++ {
+			cache.Set("hot"+strconv.Itoa(i), i, NoTTL)
+			cache.Get("hot"+strconv.Itoa(i), nil)
+		}
+
+		// A scan of one-hit wonders shouldn't flush visited entries out.
+		for i := 0; i < 100; i++ {
+			cache.Set("scan"+strconv.Itoa(i), i, NoTTL)
+		}
+
+		for i := 0; i < 5; i++ {
+			if _, found := cache.Get("hot"+strconv.Itoa(i), nil); !found {
+				t.Fatalf("%s: hot%d should survive the scan", name, i)
+			}
+		}
+	}
+}
+
+// go test -v -cover -count=1 -run=^TestPolicyConcurrentGet$
+func TestPolicyConcurrentGet(t *testing.T) {
+	trace := testTrace(10000, 1000)
+
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(100), WithGC(0))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func(offset int) {
+				defer wg.Done()
+
+				for j := offset; j < len(trace); j += 8 {
+					if _, found := cache.Get(trace[j], nil); !found {
+						cache.Set(trace[j], j, NoTTL)
+					}
+				}
+			}(i)
+		}
+
+		wg.Wait()
+
+		if size := cache.Size(); size > 100 {
+			t.Fatalf("%s: size %d > 100", name, size)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestPolicyLoadFewer$
+func TestPolicyLoadFewer(t *testing.T) {
+	loadFunc := func(keys []string, deserializeF DeserializeFunc) ([]interface{}, error) {
+		return []interface{}{keys[0] + "value"}, nil
+	}
+
+	for name, withPolicy := range testPolicies {
+		cache := NewCache(withPolicy(16), WithGC(0), WithLoadFunc(loadFunc))
+
+		values, _ := cache.MGet([]string{"1", "2"}, nil)
+		if values[0] != "1value" || values[1] != nil {
+			t.Fatalf("%s: values %+v is wrong", name, values)
+		}
+
+		if value, found := cache.Get("1", nil); !found || value != "1value" {
+			t.Fatalf("%s: value %v found %v is wrong", name, value, found)
+		}
+	}
+}
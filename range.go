@@ -0,0 +1,194 @@
+package memcache
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// defaultScanCount is the count of keys visited by scan if count isn't specified.
+	defaultScanCount = 10
+)
+
+// RangeFunc is called with each key, value and remaining ttl when ranging cache.
+// A zero ttl means the key is never expired, and returning false stops ranging.
+type RangeFunc func(key string, value interface{}, ttl time.Duration) bool
+
+// walkableCache is a cache whose entries can be walked.
+// walk and peek should be called with the lock held.
+type walkableCache interface {
+	walk(fn func(e *entry) bool)
+
+	// peek returns the entry of key or nil if not found, and it doesn't record an access of key.
+	peek(key string) *entry
+}
+
+// ttlCache is a cache which can return the remaining ttl of key without recording an access.
+type ttlCache interface {
+	ttlOfKey(key string) (ttl time.Duration, found bool)
+}
+
+// ttlOfCache returns the remaining ttl of key in cache, and NoTTL is returned if cache can't tell it like a remote one.
+func ttlOfCache(cache Cache, key string) (ttl time.Duration, found bool) {
+	if tc, ok := cache.(ttlCache); ok {
+		return tc.ttlOfKey(key)
+	}
+
+	return NoTTL, true
+}
+
+// ttlOfEntry returns the remaining ttl of e at now if it's unexpired.
+func ttlOfEntry(e *entry, now int64) (ttl time.Duration, found bool) {
+	if _, found = valueOf(e); !found || e.expired(now) {
+		return 0, false
+	}
+
+	return e.ttlOf(now), true
+}
+
+type rangeItem struct {
+	key   string
+	value interface{}
+	ttl   time.Duration
+}
+
+// ttlOf returns the remaining ttl of entry at now.
+// The ttl of an expiring entry is at least 1ns, so it won't be confused with NoTTL.
+func (e *entry) ttlOf(now int64) time.Duration {
+	if e.expiration <= 0 {
+		return NoTTL
+	}
+
+	if ttl := time.Duration(e.expiration - now); ttl > 0 {
+		return ttl
+	}
+
+	return time.Nanosecond
+}
+
+// collect returns the snapshot of all unexpired entries in cache.
+// It should be called with the lock held, and fn can be called with the snapshot after unlocking.
+func collect(wc walkableCache, now int64) (items []rangeItem) {
+	wc.walk(func(e *entry) bool {
+		if value, found := valueOf(e); found && !e.expired(now) {
+			items = append(items, rangeItem{key: e.key, value: value, ttl: e.ttlOf(now)})
+		}
+
+		return true
+	})
+
+	return items
+}
+
+func rangeItems(items []rangeItem, fn RangeFunc) bool {
+	for _, item := range items {
+		if !fn(item.key, item.value, item.ttl) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scanHash returns the position of key in scanning which is a 32-bit fnv-1a hash.
+func scanHash(key string) uint32 {
+	hash := uint32(2166136261)
+
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+
+	return hash
+}
+
+// scanKey returns key prefixed with its position in big endian, so keys are sorted by positions in index.
+func scanKey(key string) string {
+	hash := scanHash(key)
+	return string([]byte{byte(hash >> 24), byte(hash >> 16), byte(hash >> 8), byte(hash)}) + key
+}
+
+// scanPosition returns the position of a key returned by scanKey.
+func scanPosition(scanKey string) uint32 {
+	return uint32(scanKey[0])<<24 | uint32(scanKey[1])<<16 | uint32(scanKey[2])<<8 | uint32(scanKey[3])
+}
+
+// scanPage returns the scan keys of at least count keys whose positions are not less than start in order,
+// and finished reports if there are no keys after them.
+// Keys with the same position are returned together, or some of them will be skipped.
+// A page is walked by the scan index if cache has one, otherwise all keys are walked to find the page.
+func scanPage(wc walkableCache, index *keyIndex, start uint32, count int) (page []string, finished bool) {
+	if index.scans != nil {
+		finished = true
+
+		position := string([]byte{byte(start >> 24), byte(start >> 16), byte(start >> 8), byte(start)})
+		index.scans.WalkFrom(position, func(scanned string) bool {
+			if len(page) >= count && scanPosition(scanned) != scanPosition(page[len(page)-1]) {
+				finished = false
+				return false
+			}
+
+			page = append(page, scanned)
+			return true
+		})
+
+		return page, finished
+	}
+
+	wc.walk(func(e *entry) bool {
+		if scanHash(e.key) >= start {
+			page = append(page, scanKey(e.key))
+		}
+
+		return true
+	})
+
+	sort.Strings(page)
+
+	end := count
+	for end < len(page) && scanPosition(page[end]) == scanPosition(page[end-1]) {
+		end++
+	}
+
+	if end >= len(page) {
+		return page, true
+	}
+
+	return page[:end], false
+}
+
+// scan visits about count keys whose positions are not less than cursor in order and returns the keys matching match.
+// The positions of keys are stable, so all keys existing during the whole scanning will be returned exactly once.
+// Count bounds the keys visited instead of the keys returned, so a page may return fewer keys or none.
+// The next cursor is 0 if all keys have been scanned.
+// It should be called with the lock held, and the read lock is enough.
+func scan(wc walkableCache, index *keyIndex, now int64, cursor uint64, match string, count int) (keys []string, next uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	if cursor > math.MaxUint32 {
+		return nil, 0
+	}
+
+	page, finished := scanPage(wc, index, uint32(cursor), count)
+
+	last := uint32(0)
+	for _, scanned := range page {
+		last = scanPosition(scanned)
+
+		key := scanned[4:]
+		if e := wc.peek(key); e != nil && !e.expired(now) && matchGlob(match, key) {
+			if _, found := valueOf(e); found {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if finished || last == math.MaxUint32 {
+		return keys, 0
+	}
+
+	return keys, uint64(last) + 1
+}
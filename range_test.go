@@ -0,0 +1,218 @@
+package memcache
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestMatchGlob$
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{pattern: "", s: "anything", matched: true},
+		{pattern: "*", s: "", matched: true},
+		{pattern: "tenant:123:*", s: "tenant:123:user:1", matched: true},
+		{pattern: "tenant:123:*", s: "tenant:1234:user", matched: false},
+		{pattern: "h?llo", s: "hello", matched: true},
+		{pattern: "h?llo", s: "hllo", matched: false},
+		{pattern: "h*llo", s: "heeello", matched: true},
+		{pattern: "h[ae]llo", s: "hallo", matched: true},
+		{pattern: "h[ae]llo", s: "hillo", matched: false},
+		{pattern: "h[^e]llo", s: "hallo", matched: true},
+		{pattern: "h[^e]llo", s: "hello", matched: false},
+		{pattern: "h[a-c]llo", s: "hbllo", matched: true},
+		{pattern: "h\\*llo", s: "h*llo", matched: true},
+		{pattern: "h\\*llo", s: "hello", matched: false},
+		{pattern: "*a*b*c", s: "xxaxxbxxc", matched: true},
+		{pattern: "*a*b*c", s: "xxaxxcxxb", matched: false},
+	}
+
+	for _, testCase := range testCases {
+		if matched := matchGlob(testCase.pattern, testCase.s); matched != testCase.matched {
+			t.Fatalf("pattern %q s %q: matched %v != %v", testCase.pattern, testCase.s, matched, testCase.matched)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheRange$
+func TestCacheRange(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		fakeClock := clock.NewFake(time.Now())
+		cache := NewCache(withPolicy(64), WithShardings(4), WithGC(0), WithNow(fakeClock.Now))
+
+		for i := 0; i < 10; i++ {
+			cache.Set(strconv.Itoa(i), i, time.Duration(i+1)*time.Second)
+		}
+
+		cache.Set("forever", "value", NoTTL)
+		fakeClock.Advance(5*time.Second + time.Nanosecond)
+
+		ranged := map[string]time.Duration{}
+		cache.Range(func(key string, value interface{}, ttl time.Duration) bool {
+			// Using cache in fn shouldn't deadlock.
+			cache.Get(key, nil)
+			ranged[key] = ttl
+			return true
+		})
+
+		if len(ranged) != 6 {
+			t.Fatalf("%s: len(ranged) %d != 6", name, len(ranged))
+		}
+
+		if ttl := ranged["9"]; ttl != 5*time.Second-time.Nanosecond {
+			t.Fatalf("%s: ttl %s is wrong", name, ttl)
+		}
+
+		if ttl := ranged["forever"]; ttl != NoTTL {
+			t.Fatalf("%s: ttl %s != NoTTL", name, ttl)
+		}
+
+		ranges := 0
+		cache.Range(func(key string, value interface{}, ttl time.Duration) bool {
+			ranges++
+			return ranges < 3
+		})
+
+		if ranges != 3 {
+			t.Fatalf("%s: ranges %d != 3", name, ranges)
+		}
+
+		keys := cache.Keys()
+		sort.Strings(keys)
+
+		if len(keys) != 6 || keys[0] != "5" || keys[5] != "forever" {
+			t.Fatalf("%s: keys %v is wrong", name, keys)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheScan$
+func TestCacheScan(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		for _, scanIndex := range []bool{false, true} {
+			opts := []Option{withPolicy(1024), WithShardings(4), WithGC(0)}
+			if scanIndex {
+				opts = append(opts, WithScanIndex())
+			}
+
+			testCacheScan(t, name+"/"+strconv.FormatBool(scanIndex), NewCache(opts...))
+		}
+	}
+}
+
+func testCacheScan(t *testing.T, name string, cache Cache) {
+	for i := 0; i < 100; i++ {
+		cache.Set("user:"+strconv.Itoa(i), i, NoTTL)
+		cache.Set("order:"+strconv.Itoa(i), i, NoTTL)
+	}
+
+	scanned := map[string]int{}
+	cursor := uint64(0)
+	calls := 0
+
+	for {
+		keys, next := cache.Scan(cursor, "user:*", 7)
+		if len(keys) > 7 {
+			t.Fatalf("%s: len(keys) %d > 7", name, len(keys))
+		}
+
+		for _, key := range keys {
+			scanned[key]++
+		}
+
+		// Keys set or removed during scanning shouldn't break scanning.
+		cache.Set("user:new:"+strconv.Itoa(calls), calls, NoTTL)
+		cache.Remove("order:" + strconv.Itoa(calls))
+		calls++
+
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if n := scanned["user:"+strconv.Itoa(i)]; n != 1 {
+			t.Fatalf("%s: user:%d is scanned %d times", name, i, n)
+		}
+	}
+
+	for key, n := range scanned {
+		if n != 1 {
+			t.Fatalf("%s: %s is scanned %d times", name, key, n)
+		}
+	}
+
+	// Count bounds the keys visited, so scanning 200 keys needs more calls than scanning 100 matched keys.
+	if calls < 200/7 {
+		t.Fatalf("%s: calls %d < %d", name, calls, 200/7)
+	}
+
+	cache.Reset()
+	cache.Set("user:reset", 1, NoTTL)
+
+	var keys []string
+	for cursor = 0; ; {
+		scannedKeys, next := cache.Scan(cursor, "*", 10)
+		keys = append(keys, scannedKeys...)
+
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+
+	if len(keys) != 1 || keys[0] != "user:reset" {
+		t.Fatalf("%s: keys %+v is wrong", name, keys)
+	}
+
+	cache.Close()
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheScanVisited$
+func TestCacheScanVisited(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		for _, scanIndex := range []bool{false, true} {
+			opts := []Option{withPolicy(1024), WithGC(0)}
+			if scanIndex {
+				opts = append(opts, WithScanIndex())
+			}
+
+			cache := NewCache(opts...)
+			for i := 0; i < 100; i++ {
+				cache.Set("order:"+strconv.Itoa(i), i, NoTTL)
+			}
+
+			cache.Set("user:1", 1, NoTTL)
+
+			// Only 10 keys are visited, so the page may have no matched keys but scanning isn't finished.
+			keys, next := cache.Scan(0, "user:*", 10)
+			if len(keys) > 1 || next == 0 {
+				t.Fatalf("%s/%t: keys %+v or next %d is wrong", name, scanIndex, keys, next)
+			}
+
+			found := len(keys)
+			for calls := 1; next != 0; calls++ {
+				if calls > 100/10+1 {
+					t.Fatalf("%s/%t: calls %d > %d", name, scanIndex, calls, 100/10+1)
+				}
+
+				keys, next = cache.Scan(next, "user:*", 10)
+				found += len(keys)
+			}
+
+			if found != 1 {
+				t.Fatalf("%s/%t: found %d != 1", name, scanIndex, found)
+			}
+
+			cache.Close()
+		}
+	}
+}
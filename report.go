@@ -1,6 +1,7 @@
 package memcache
 
 import (
+	"io"
 	"sync/atomic"
 	"time"
 )
@@ -58,11 +59,41 @@ func (r *Reporter) CacheGC() time.Duration {
 	return r.conf.gcDuration
 }
 
+// CacheMaxEntries returns the max entries of cache.
+// You can use WithMaxEntries to set cache's max entries.
+// Negative value means no limit.
+func (r *Reporter) CacheMaxEntries() int {
+	return r.conf.maxEntries
+}
+
 // CacheSize returns the size of cache.
 func (r *Reporter) CacheSize() int {
 	return r.cache.Size()
 }
 
+// Namespaces returns the stats of all namespaces sorted by name.
+// See Cache.Namespace.
+func (r *Reporter) Namespaces() []NamespaceStats {
+	namespaces := r.conf.namespaces.all()
+
+	stats := make([]NamespaceStats, 0, len(namespaces))
+	for _, ns := range namespaces {
+		stats = append(stats, ns.stats())
+	}
+
+	return stats
+}
+
+// Tenants returns the stats of all tenants sorted by tenant.
+// It returns nil if cache has no tenants, see WithTenants.
+func (r *Reporter) Tenants() []TenantStats {
+	if r.conf.tenants == nil {
+		return nil
+	}
+
+	return r.conf.tenants.stats()
+}
+
 // CountMissed returns the missed count.
 func (r *Reporter) CountMissed() uint64 {
 	return atomic.LoadUint64(&r.missedCount)
@@ -136,6 +167,10 @@ func report(conf *config, cache Cache) (Cache, *Reporter) {
 func (rc *reportableCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
 	value, found = rc.cache.Get(key, deserializeF)
 
+	if rc.tenants != nil {
+		rc.tenants.record(key, found, rc.recordHit, rc.recordMissed)
+	}
+
 	if found {
 		if rc.recordHit {
 			rc.increaseHitCount()
@@ -160,6 +195,10 @@ func (rc *reportableCache) Get(key string, deserializeF DeserializeFunc) (value
 func (rc *reportableCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
 	values, founds = rc.cache.MGet(keys, deserializeF)
 	for i, found := range founds {
+		if rc.tenants != nil {
+			rc.tenants.record(keys[i], found, rc.recordHit, rc.recordMissed)
+		}
+
 		if found {
 			if rc.recordHit {
 				rc.increaseHitCount()
@@ -193,12 +232,138 @@ func (rc *reportableCache) MSet(keys []string, values []interface{}, ttls ...tim
 	return evictedValues
 }
 
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (rc *reportableCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	return rc.cache.SetWithTags(key, value, ttl, tags...)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (rc *reportableCache) InvalidateTag(tag string) (removed int) {
+	return rc.cache.InvalidateTag(tag)
+}
+
 // Remove removes key and returns the removed value of key.
 // See Cache interface.
 func (rc *reportableCache) Remove(key string) (removedValue interface{}) {
 	return rc.cache.Remove(key)
 }
 
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (rc *reportableCache) RemovePrefix(prefix string) (removed int) {
+	return rc.cache.RemovePrefix(prefix)
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (rc *reportableCache) RemoveMatch(pattern string) (removed int) {
+	return rc.cache.RemoveMatch(pattern)
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (rc *reportableCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	return rc.cache.GetOrSet(key, value, ttl...)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (rc *reportableCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	return rc.cache.CompareAndSwap(key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (rc *reportableCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	return rc.cache.CompareAndDelete(key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (rc *reportableCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	return rc.cache.Update(key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (rc *reportableCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return rc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (rc *reportableCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return rc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (rc *reportableCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	return rc.cache.IncrBy(key, delta, ttl...)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (rc *reportableCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	return rc.cache.IncrByFloat(key, delta, ttl...)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (rc *reportableCache) Range(fn RangeFunc) {
+	rc.cache.Range(fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (rc *reportableCache) Keys() (keys []string) {
+	return rc.cache.Keys()
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (rc *reportableCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	return rc.cache.Scan(cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (rc *reportableCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(rc.config, rc, name, quota)
+}
+
+func (rc *reportableCache) watchNamespace(ns *namespace) {
+	watchNamespaceOf(rc.cache, ns)
+}
+
+func (rc *reportableCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	return evictPrefixOf(rc.cache, prefix, skip)
+}
+
+func (rc *reportableCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	return ttlOfCache(rc.cache, key)
+}
+
+// Flush writes all pending writes to the backing store and returns the error if failed.
+// See Cache interface.
+func (rc *reportableCache) Flush() error {
+	return rc.cache.Flush()
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (rc *reportableCache) SaveSnapshot(w io.Writer) error {
+	return rc.cache.SaveSnapshot(w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (rc *reportableCache) LoadSnapshot(r io.Reader) error {
+	return rc.cache.LoadSnapshot(r)
+}
+
 // Size returns the count of keys in cache.
 // See Cache interface.
 func (rc *reportableCache) Size() (size int) {
@@ -232,6 +397,12 @@ func (rc *reportableCache) Reset() {
 	rc.cache.Reset()
 }
 
+// Close closes cache.
+// See Cache interface.
+func (rc *reportableCache) Close() error {
+	return rc.cache.Close()
+}
+
 // Load loads a key with ttl to cache and returns an error if failed.
 // See Cache interface.
 // func (rc *reportableCache) Load(key string, ttl time.Duration, load func() (value interface{}, err error)) (value interface{}, err error) {
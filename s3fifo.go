@@ -0,0 +1,644 @@
+package memcache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// s3fifoMaxVisits is the max visits of entry recorded by s3-fifo cache.
+	s3fifoMaxVisits = 3
+)
+
+type s3fifoCache struct {
+	*config
+
+	// small is a probationary fifo queue which filters one-hit wonders out.
+	small    *list.List
+	smallMap map[string]*list.Element
+	smallCap int
+
+	// main is a fifo queue with reinsertion which stores entries visited in small.
+	main    *list.List
+	mainMap map[string]*list.Element
+
+	// ghost is a fifo queue storing keys evicted from small.
+	ghost    *list.List
+	ghostMap map[string]*list.Element
+	ghostCap int
+
+	index *keyIndex
+	lock  sync.RWMutex
+}
+
+func newS3FIFOCache(conf *config) Cache {
+	if conf.maxEntries <= 0 {
+		panic("cachego: s3-fifo cache must specify max entries")
+	}
+
+	smallCap := conf.maxEntries / 10
+	if smallCap <= 0 {
+		smallCap = 1
+	}
+
+	ghostCap := conf.maxEntries - smallCap
+	if ghostCap <= 0 {
+		ghostCap = 1
+	}
+
+	cache := &s3fifoCache{
+		config:   conf,
+		smallCap: smallCap,
+		ghostCap: ghostCap,
+	}
+
+	cache.reset()
+	return cache
+}
+
+func (sc *s3fifoCache) unwrap(element *list.Element) *entry {
+	entry, ok := element.Value.(*entry)
+	if !ok {
+		panic("cachego: failed to unwrap s3-fifo element's value to entry")
+	}
+
+	return entry
+}
+
+func (sc *s3fifoCache) pushGhost(key string) {
+	if sc.ghost.Len() >= sc.ghostCap {
+		element := sc.ghost.Back()
+		delete(sc.ghostMap, element.Value.(string))
+		sc.ghost.Remove(element)
+	}
+
+	sc.ghostMap[key] = sc.ghost.PushFront(key)
+}
+
+// evictSmall moves visited entries in small to main and evicts the first unvisited one.
+// Returns false if no entry is evicted.
+func (sc *s3fifoCache) evictSmall() (evictedValue interface{}, evicted bool) {
+	for element := sc.small.Back(); element != nil; element = sc.small.Back() {
+		entry := sc.unwrap(element)
+
+		delete(sc.smallMap, entry.key)
+		sc.small.Remove(element)
+
+		if entry.unvisit() > 0 {
+			atomic.StoreInt32(&entry.visits, 0)
+			sc.mainMap[entry.key] = sc.main.PushFront(entry)
+			sc.index.touch(entry.key, 1)
+			continue
+		}
+
+		sc.pushGhost(entry.key)
+		sc.index.remove(entry.key)
+		return *entry.value, true
+	}
+
+	return nil, false
+}
+
+// evictMain reinserts visited entries in main and evicts the first unvisited one.
+func (sc *s3fifoCache) evictMain() (evictedValue interface{}, evicted bool) {
+	for element := sc.main.Back(); element != nil; element = sc.main.Back() {
+		entry := sc.unwrap(element)
+
+		if entry.unvisit() > 0 {
+			sc.main.MoveToFront(element)
+			sc.index.touch(entry.key, 1)
+			continue
+		}
+
+		delete(sc.mainMap, entry.key)
+		sc.main.Remove(element)
+		sc.index.remove(entry.key)
+		return *entry.value, true
+	}
+
+	return nil, false
+}
+
+func (sc *s3fifoCache) evict() (evictedValue interface{}) {
+	if sc.small.Len() >= sc.smallCap || sc.main.Len() <= 0 {
+		if evictedValue, evicted := sc.evictSmall(); evicted {
+			return evictedValue
+		}
+	}
+
+	evictedValue, _ = sc.evictMain()
+	return evictedValue
+}
+
+func (sc *s3fifoCache) elementOf(key string) (*list.Element, bool) {
+	if element, ok := sc.smallMap[key]; ok {
+		return element, true
+	}
+
+	element, ok := sc.mainMap[key]
+	return element, ok
+}
+
+func (sc *s3fifoCache) get(key string) (value interface{}, found bool) {
+	element, ok := sc.elementOf(key)
+	if !ok {
+		return nil, false
+	}
+
+	entry := sc.unwrap(element)
+	if entry.expired(0) {
+		return nil, false
+	}
+
+	entry.visit(s3fifoMaxVisits)
+	if entry.value == nil {
+		return nil, false
+	}
+
+	return *entry.value, true
+}
+
+func (sc *s3fifoCache) set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	curTtl := sc.ttlOf(value, ttl)
+
+	if element, ok := sc.elementOf(key); ok {
+		entry := sc.unwrap(element)
+		sc.index.untagExpired(entry)
+		entry.setup(key, &value, curTtl)
+		entry.visit(s3fifoMaxVisits)
+		return nil
+	}
+
+	evictedValue = makeRoom(sc, sc.index, key, sc.size())
+
+	if sc.maxEntries > 0 && sc.size() >= sc.maxEntries {
+		evictedValue = sc.evict()
+	}
+
+	entry := newEntry(key, &value, curTtl, sc.now)
+	sc.index.add(key)
+
+	if element, ok := sc.ghostMap[key]; ok {
+		delete(sc.ghostMap, key)
+		sc.ghost.Remove(element)
+		sc.mainMap[key] = sc.main.PushFront(entry)
+		sc.index.touch(key, 1)
+		return evictedValue
+	}
+
+	sc.smallMap[key] = sc.small.PushFront(entry)
+	sc.index.touch(key, 0)
+	return evictedValue
+}
+
+func (sc *s3fifoCache) entryOf(key string) *entry {
+	element, ok := sc.elementOf(key)
+	if !ok {
+		return nil
+	}
+
+	entry := sc.unwrap(element)
+	if entry.expired(0) {
+		return nil
+	}
+
+	entry.visit(s3fifoMaxVisits)
+	return entry
+}
+
+// evictKey evicts key chosen by namespaces or tenants, which is the same as removing it.
+func (sc *s3fifoCache) evictKey(key string) (evictedValue interface{}) {
+	return sc.remove(key)
+}
+
+func (sc *s3fifoCache) remove(key string) (removedValue interface{}) {
+	if element, ok := sc.smallMap[key]; ok {
+		delete(sc.smallMap, key)
+		sc.small.Remove(element)
+		sc.index.remove(key)
+		return *sc.unwrap(element).value
+	}
+
+	if element, ok := sc.mainMap[key]; ok {
+		delete(sc.mainMap, key)
+		sc.main.Remove(element)
+		sc.index.remove(key)
+		return *sc.unwrap(element).value
+	}
+
+	return nil
+}
+
+func (sc *s3fifoCache) peek(key string) *entry {
+	if element, ok := sc.elementOf(key); ok {
+		return sc.unwrap(element)
+	}
+
+	return nil
+}
+
+func (sc *s3fifoCache) walk(fn func(e *entry) bool) {
+	for _, entries := range []*list.List{sc.small, sc.main} {
+		for element := entries.Front(); element != nil; element = element.Next() {
+			if !fn(sc.unwrap(element)) {
+				return
+			}
+		}
+	}
+}
+
+// walkCold walks entries from the back of small and main which are evicted in order, and small is segment 0.
+func (sc *s3fifoCache) walkCold(fn func(e *entry, segment int) bool) {
+	for segment, entries := range []*list.List{sc.small, sc.main} {
+		for element := entries.Back(); element != nil; element = element.Prev() {
+			if !fn(sc.unwrap(element), segment) {
+				return
+			}
+		}
+	}
+}
+
+func (sc *s3fifoCache) size() (size int) {
+	return len(sc.smallMap) + len(sc.mainMap)
+}
+
+func (sc *s3fifoCache) gcList(entries *list.List, entryMap map[string]*list.Element, now int64, scans *int) (cleans int) {
+	for element := entries.Back(); element != nil; {
+		if sc.maxScans > 0 && *scans >= sc.maxScans {
+			break
+		}
+
+		*scans++
+		prev := element.Prev()
+
+		if entry := sc.unwrap(element); entry.expired(now) {
+			delete(entryMap, entry.key)
+			entries.Remove(element)
+			sc.index.remove(entry.key)
+			cleans++
+		}
+
+		element = prev
+	}
+
+	return cleans
+}
+
+func (sc *s3fifoCache) gc() (cleans int) {
+	now := sc.now()
+	scans := 0
+
+	cleans += sc.gcList(sc.small, sc.smallMap, now, &scans)
+	cleans += sc.gcList(sc.main, sc.mainMap, now, &scans)
+	return cleans
+}
+
+func (sc *s3fifoCache) reset() {
+	sc.small = list.New()
+	sc.main = list.New()
+	sc.ghost = list.New()
+	sc.smallMap = make(map[string]*list.Element, mapInitialCap)
+	sc.mainMap = make(map[string]*list.Element, mapInitialCap)
+	sc.ghostMap = make(map[string]*list.Element, mapInitialCap)
+	sc.index = sc.index.renew(sc.config)
+}
+
+// Get gets the value of key from cache and returns value if found.
+// A hit only takes the read lock because s3-fifo doesn't reorder entries.
+// See Cache interface.
+func (sc *s3fifoCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	sc.lock.RLock()
+	value, found = sc.get(key)
+	sc.lock.RUnlock()
+
+	if !found && sc.loadFunc != nil {
+		newVals, err := sc.loadFunc([]string{key}, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			sc.Set(key, newVals[0])
+		}
+	}
+
+	return value, found
+}
+
+// MGet gets the values of keys from cache and returns values with founds.
+// See Cache interface.
+func (sc *s3fifoCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	values = make([]interface{}, len(keys))
+	founds = make([]bool, len(keys))
+	mio := &MInOuput{}
+
+	sc.lock.RLock()
+	for i, key := range keys {
+		value, found := sc.get(key)
+		founds[i] = found
+
+		if !found {
+			mio.Keys = append(mio.Keys, key)
+			mio.Indexes = append(mio.Indexes, i)
+		} else {
+			values[i] = value
+		}
+	}
+	sc.lock.RUnlock()
+
+	if len(mio.Keys) > 0 && sc.loadFunc != nil {
+		newVals, err := sc.loadFunc(mio.Keys, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			sc.lock.Lock()
+			defer sc.lock.Unlock()
+
+			// The load function may return fewer values than keys, and keys without values are missed.
+			for i, index := range mio.Indexes {
+				if i < len(newVals) {
+					values[index] = newVals[i]
+					sc.set(mio.Keys[i], newVals[i])
+				}
+			}
+		}
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to cache with ttl and returns evicted value if exists.
+// See Cache interface.
+func (sc *s3fifoCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.set(key, value, ttl...)
+}
+
+// MSet sets keys and values to cache with ttls and returns evicted values.
+// See Cache interface.
+func (sc *s3fifoCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	// Keys and values must have the same length, or nothing is set.
+	if len(keys) != len(values) {
+		return nil
+	}
+
+	for i := 0; i < len(keys); i++ {
+		if len(ttls) > i {
+			evictedValues = append(evictedValues, sc.set(keys[i], values[i], ttls[i]))
+		} else {
+			evictedValues = append(evictedValues, sc.set(keys[i], values[i]))
+		}
+	}
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (sc *s3fifoCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return setWithTags(sc, sc.index, key, value, ttl, tags)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (sc *s3fifoCache) InvalidateTag(tag string) (removed int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return invalidateTag(sc, sc, sc.index, tag)
+}
+
+// Remove removes key and returns the removed value of key.
+// See Cache interface.
+func (sc *s3fifoCache) Remove(key string) (removedValue interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.remove(key)
+}
+
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (sc *s3fifoCache) RemovePrefix(prefix string) (removed int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return removeMatched(sc, sc, sc.index, prefix, func(key string) bool {
+		return true
+	})
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (sc *s3fifoCache) RemoveMatch(pattern string) (removed int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return removeMatched(sc, sc, sc.index, literalPrefix(pattern), func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (sc *s3fifoCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return getOrSet(sc, key, value, ttl)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (sc *s3fifoCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return compareAndSwap(sc, key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (sc *s3fifoCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return compareAndDelete(sc, key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (sc *s3fifoCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return update(sc, key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *s3fifoCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *s3fifoCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (sc *s3fifoCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return incrBy(sc, key, delta, ttl)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (sc *s3fifoCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return incrByFloat(sc, key, delta, ttl)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (sc *s3fifoCache) Range(fn RangeFunc) {
+	sc.lock.RLock()
+	items := collect(sc, sc.now())
+	sc.lock.RUnlock()
+
+	rangeItems(items, fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (sc *s3fifoCache) Keys() (keys []string) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	now := sc.now()
+	sc.walk(func(e *entry) bool {
+		if _, found := valueOf(e); found && !e.expired(now) {
+			keys = append(keys, e.key)
+		}
+
+		return true
+	})
+
+	return keys
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (sc *s3fifoCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	return scan(sc, sc.index, sc.now(), cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (sc *s3fifoCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(sc.config, sc, name, quota)
+}
+
+func (sc *s3fifoCache) watchNamespace(ns *namespace) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	watchNamespace(sc, sc.index, ns)
+}
+
+func (sc *s3fifoCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return evictPrefix(sc, sc.index, prefix, skip)
+}
+
+// stateOf returns the state of key without recording an access.
+func (sc *s3fifoCache) stateOf(key string) (state keyState, found bool) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	element, ok := sc.elementOf(key)
+	if !ok {
+		return state, false
+	}
+
+	return stateOfEntry(sc.unwrap(element), sc.index)
+}
+
+// ttlOfKey returns the remaining ttl of key without recording an access.
+func (sc *s3fifoCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	return ttlOfEntry(sc.peek(key), sc.now())
+}
+
+// Flush does nothing because cache has no store.
+// See Cache interface.
+func (sc *s3fifoCache) Flush() error {
+	return nil
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (sc *s3fifoCache) SaveSnapshot(w io.Writer) error {
+	return saveSnapshot(sc, sc.codec, w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (sc *s3fifoCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(sc, sc.codec, r)
+}
+
+// Size returns the count of keys in cache.
+// See Cache interface.
+func (sc *s3fifoCache) Size() (size int) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	return sc.size()
+}
+
+// GC cleans the expired keys in cache and returns the exact count cleaned.
+// See Cache interface.
+func (sc *s3fifoCache) GC() (cleans int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.gc()
+}
+
+// Reset resets cache to initial status which is like a new cache.
+// See Cache interface.
+func (sc *s3fifoCache) Reset() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.reset()
+}
+
+// Close releases all entries in cache.
+// See Cache interface.
+func (sc *s3fifoCache) Close() error {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.reset()
+	return nil
+}
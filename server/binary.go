@@ -0,0 +1,533 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	binaryRequestMagic  = 0x80
+	binaryResponseMagic = 0x81
+
+	// binaryHeaderSize is the size of headers of requests and responses.
+	binaryHeaderSize = 24
+
+	// binaryNoVivify is the expiration of incr and decr which means not creating missing keys.
+	binaryNoVivify = 0xFFFFFFFF
+)
+
+// Opcodes of memcached binary protocol.
+const (
+	opGet        = 0x00
+	opSet        = 0x01
+	opAdd        = 0x02
+	opReplace    = 0x03
+	opDelete     = 0x04
+	opIncrement  = 0x05
+	opDecrement  = 0x06
+	opQuit       = 0x07
+	opFlush      = 0x08
+	opGetQ       = 0x09
+	opNoop       = 0x0A
+	opVersion    = 0x0B
+	opGetK       = 0x0C
+	opGetKQ      = 0x0D
+	opAppend     = 0x0E
+	opPrepend    = 0x0F
+	opStat       = 0x10
+	opSetQ       = 0x11
+	opAddQ       = 0x12
+	opReplaceQ   = 0x13
+	opDeleteQ    = 0x14
+	opIncrementQ = 0x15
+	opDecrementQ = 0x16
+	opQuitQ      = 0x17
+	opFlushQ     = 0x18
+	opAppendQ    = 0x19
+	opPrependQ   = 0x1A
+	opTouch      = 0x1C
+	opGAT        = 0x1D
+	opGATQ       = 0x1E
+	opGATK       = 0x23
+	opGATKQ      = 0x24
+)
+
+// Response statuses of memcached binary protocol.
+const (
+	binaryStatusOK             = 0x0000
+	binaryStatusKeyNotFound    = 0x0001
+	binaryStatusKeyExists      = 0x0002
+	binaryStatusTooLarge       = 0x0003
+	binaryStatusInvalid        = 0x0004
+	binaryStatusNotStored      = 0x0005
+	binaryStatusNonNumeric     = 0x0006
+	binaryStatusUnknownCommand = 0x0081
+)
+
+var (
+	errBadMagic = errors.New("bad magic of request")
+)
+
+var (
+	binaryStatusMessages = map[uint16]string{
+		binaryStatusKeyNotFound:    "Not found",
+		binaryStatusKeyExists:      "Data exists for key.",
+		binaryStatusTooLarge:       "Too large.",
+		binaryStatusInvalid:        "Invalid arguments",
+		binaryStatusNotStored:      "Not stored.",
+		binaryStatusNonNumeric:     "Non-numeric server-side value for incr or decr",
+		binaryStatusUnknownCommand: "Unknown command",
+	}
+
+	// binaryQuietOpcodes maps quiet opcodes to their normal ones.
+	binaryQuietOpcodes = map[byte]byte{
+		opGetQ:       opGet,
+		opGetKQ:      opGetK,
+		opSetQ:       opSet,
+		opAddQ:       opAdd,
+		opReplaceQ:   opReplace,
+		opDeleteQ:    opDelete,
+		opIncrementQ: opIncrement,
+		opDecrementQ: opDecrement,
+		opQuitQ:      opQuit,
+		opFlushQ:     opFlush,
+		opAppendQ:    opAppend,
+		opPrependQ:   opPrepend,
+		opGATQ:       opGAT,
+		opGATKQ:      opGATK,
+	}
+
+	// binaryStatuses maps statuses of commands to binary ones.
+	binaryStatuses = map[status]uint16{
+		statusStored:     binaryStatusOK,
+		statusNotStored:  binaryStatusNotStored,
+		statusExists:     binaryStatusKeyExists,
+		statusNotFound:   binaryStatusKeyNotFound,
+		statusDeleted:    binaryStatusOK,
+		statusTouched:    binaryStatusOK,
+		statusNonNumeric: binaryStatusNonNumeric,
+	}
+
+	binaryStoreModes = map[byte]storeMode{
+		opSet:     modeSet,
+		opAdd:     modeAdd,
+		opReplace: modeReplace,
+		opAppend:  modeAppend,
+		opPrepend: modePrepend,
+	}
+)
+
+// binaryHeader is the header of requests and responses.
+// The status of responses takes the place of vbucket of requests.
+type binaryHeader struct {
+	magic        byte
+	opcode       byte
+	keyLength    uint16
+	extrasLength byte
+	dataType     byte
+	status       uint16
+	bodyLength   uint32
+	opaque       uint32
+	cas          uint64
+}
+
+func (bh *binaryHeader) decode(b []byte) {
+	bh.magic = b[0]
+	bh.opcode = b[1]
+	bh.keyLength = binary.BigEndian.Uint16(b[2:])
+	bh.extrasLength = b[4]
+	bh.dataType = b[5]
+	bh.status = binary.BigEndian.Uint16(b[6:])
+	bh.bodyLength = binary.BigEndian.Uint32(b[8:])
+	bh.opaque = binary.BigEndian.Uint32(b[12:])
+	bh.cas = binary.BigEndian.Uint64(b[16:])
+}
+
+func (bh *binaryHeader) encode(b []byte) {
+	b[0] = bh.magic
+	b[1] = bh.opcode
+	binary.BigEndian.PutUint16(b[2:], bh.keyLength)
+	b[4] = bh.extrasLength
+	b[5] = bh.dataType
+	binary.BigEndian.PutUint16(b[6:], bh.status)
+	binary.BigEndian.PutUint32(b[8:], bh.bodyLength)
+	binary.BigEndian.PutUint32(b[12:], bh.opaque)
+	binary.BigEndian.PutUint64(b[16:], bh.cas)
+}
+
+// binaryRequest is a request of memcached binary protocol.
+type binaryRequest struct {
+	binaryHeader
+
+	// quiet means the request was sent with a quiet opcode, and opcode has been mapped to the normal one.
+	// Responses are written with sentOpcode.
+	quiet      bool
+	sentOpcode byte
+
+	// errStatus is the status of a request which can't be handled, like a too large one.
+	errStatus uint16
+
+	extras []byte
+	key    string
+	value  []byte
+}
+
+// binaryResponse is a response of memcached binary protocol.
+type binaryResponse struct {
+	status uint16
+	cas    uint64
+	extras []byte
+	key    string
+	value  []byte
+}
+
+// binaryConn serves a connection over memcached binary protocol.
+type binaryConn struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// serve reads requests and writes their responses until the connection is closed or quits.
+// Responses are flushed when no more requests are buffered, so quiet requests are written in batch.
+func (bc *binaryConn) serve() {
+	for {
+		if bc.server.idleTimeout > 0 {
+			bc.conn.SetReadDeadline(time.Now().Add(bc.server.idleTimeout))
+		}
+
+		req, err := bc.readRequest()
+		if err != nil {
+			return
+		}
+
+		if quit := bc.handle(req); quit {
+			bc.writer.Flush()
+			return
+		}
+
+		if bc.reader.Buffered() > 0 {
+			continue
+		}
+
+		if err = bc.writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readRequest reads a request, and the body of a request whose value is too large is discarded.
+func (bc *binaryConn) readRequest() (req *binaryRequest, err error) {
+	var header [binaryHeaderSize]byte
+	if _, err = io.ReadFull(bc.reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	req = new(binaryRequest)
+	req.decode(header[:])
+
+	if req.magic != binaryRequestMagic {
+		return nil, errBadMagic
+	}
+
+	req.sentOpcode = req.opcode
+	if opcode, ok := binaryQuietOpcodes[req.opcode]; ok {
+		req.opcode = opcode
+		req.quiet = true
+	}
+
+	bodyLength := int(req.bodyLength)
+	if bodyLength > bc.server.maxItemSize+maxKeyLength+int(req.extrasLength) {
+		_, err = io.CopyN(io.Discard, bc.reader, int64(bodyLength))
+		req.errStatus = binaryStatusTooLarge
+		return req, err
+	}
+
+	body := make([]byte, bodyLength)
+	if _, err = io.ReadFull(bc.reader, body); err != nil {
+		return nil, err
+	}
+
+	if int(req.extrasLength)+int(req.keyLength) > bodyLength {
+		req.errStatus = binaryStatusInvalid
+		return req, nil
+	}
+
+	req.extras = body[:req.extrasLength]
+	req.key = string(body[req.extrasLength : int(req.extrasLength)+int(req.keyLength)])
+	req.value = body[int(req.extrasLength)+int(req.keyLength):]
+	return req, nil
+}
+
+func (bc *binaryConn) write(req *binaryRequest, resp *binaryResponse) {
+	header := binaryHeader{
+		magic:        binaryResponseMagic,
+		opcode:       req.sentOpcode,
+		keyLength:    uint16(len(resp.key)),
+		extrasLength: byte(len(resp.extras)),
+		status:       resp.status,
+		bodyLength:   uint32(len(resp.extras) + len(resp.key) + len(resp.value)),
+		opaque:       req.opaque,
+		cas:          resp.cas,
+	}
+
+	var b [binaryHeaderSize]byte
+	header.encode(b[:])
+
+	bc.writer.Write(b[:])
+	bc.writer.Write(resp.extras)
+	bc.writer.WriteString(resp.key)
+	bc.writer.Write(resp.value)
+}
+
+func (bc *binaryConn) writeStatus(req *binaryRequest, status uint16) {
+	bc.write(req, &binaryResponse{status: status, value: []byte(binaryStatusMessages[status])})
+}
+
+// validate reports if the lengths of extras, key and value of req are valid.
+func (bc *binaryConn) validate(req *binaryRequest, extrasLength int, hasKey bool, hasValue bool) bool {
+	if len(req.extras) != extrasLength || (len(req.value) > 0 && !hasValue) {
+		return false
+	}
+
+	if hasKey {
+		return len(req.key) > 0 && len(req.key) <= maxKeyLength
+	}
+
+	return len(req.key) == 0
+}
+
+// handle handles req and reports if the connection should quit.
+func (bc *binaryConn) handle(req *binaryRequest) (quit bool) {
+	if req.errStatus != binaryStatusOK {
+		bc.writeStatus(req, req.errStatus)
+		return false
+	}
+
+	if _, ok := binaryStoreModes[req.opcode]; ok {
+		bc.handleStore(req)
+		return false
+	}
+
+	switch req.opcode {
+	case opGet, opGetK:
+		bc.handleGet(req)
+	case opGAT, opGATK, opTouch:
+		bc.handleTouch(req)
+	case opDelete:
+		bc.handleDelete(req)
+	case opIncrement, opDecrement:
+		bc.handleIncr(req)
+	case opFlush:
+		bc.handleFlush(req)
+	case opStat:
+		bc.handleStat(req)
+	case opNoop:
+		bc.write(req, &binaryResponse{})
+	case opVersion:
+		bc.write(req, &binaryResponse{value: []byte(Version)})
+	case opQuit:
+		if !req.quiet {
+			bc.write(req, &binaryResponse{})
+		}
+
+		return true
+	default:
+		bc.writeStatus(req, binaryStatusUnknownCommand)
+	}
+
+	return false
+}
+
+// writeItem writes item with its flags as extras, and key is only written by GetK and GATK.
+func (bc *binaryConn) writeItem(req *binaryRequest, item *Item) {
+	resp := &binaryResponse{cas: item.CAS, extras: make([]byte, 4), value: item.Value}
+	binary.BigEndian.PutUint32(resp.extras, item.Flags)
+
+	if req.opcode == opGetK || req.opcode == opGATK {
+		resp.key = req.key
+	}
+
+	bc.write(req, resp)
+}
+
+// writeMissed writes a response of missed key, and it's not written by quiet requests.
+func (bc *binaryConn) writeMissed(req *binaryRequest) {
+	if req.quiet {
+		return
+	}
+
+	resp := &binaryResponse{status: binaryStatusKeyNotFound, value: []byte(binaryStatusMessages[binaryStatusKeyNotFound])}
+	if req.opcode == opGetK || req.opcode == opGATK {
+		resp.key = req.key
+	}
+
+	bc.write(req, resp)
+}
+
+// handleGet handles Get, GetQ, GetK and GetKQ.
+func (bc *binaryConn) handleGet(req *binaryRequest) {
+	if !bc.validate(req, 0, true, false) {
+		bc.writeStatus(req, binaryStatusInvalid)
+		return
+	}
+
+	item := bc.server.get([]string{req.key})[0]
+	if item == nil {
+		bc.writeMissed(req)
+		return
+	}
+
+	bc.writeItem(req, item)
+}
+
+// handleTouch handles Touch, GAT, GATQ, GATK and GATKQ whose extras is the expiration.
+func (bc *binaryConn) handleTouch(req *binaryRequest) {
+	if !bc.validate(req, 4, true, false) {
+		bc.writeStatus(req, binaryStatusInvalid)
+		return
+	}
+
+	exptime := int64(binary.BigEndian.Uint32(req.extras))
+
+	item, st := bc.server.touch(req.key, exptime)
+	if st != statusTouched {
+		bc.writeMissed(req)
+		return
+	}
+
+	if req.opcode == opTouch {
+		bc.write(req, &binaryResponse{cas: item.CAS})
+		return
+	}
+
+	bc.writeItem(req, item)
+}
+
+// handleStore handles Set, Add, Replace, Append, Prepend and their quiet ones.
+// The extras of Set, Add and Replace are flags and expiration, and a non-zero cas is compared.
+func (bc *binaryConn) handleStore(req *binaryRequest) {
+	mode := binaryStoreModes[req.opcode]
+
+	extrasLength := 8
+	if mode == modeAppend || mode == modePrepend {
+		extrasLength = 0
+	}
+
+	if !bc.validate(req, extrasLength, true, true) {
+		bc.writeStatus(req, binaryStatusInvalid)
+		return
+	}
+
+	item := &Item{Value: req.value}
+
+	var exptime int64
+	if extrasLength > 0 {
+		item.Flags = binary.BigEndian.Uint32(req.extras)
+		exptime = int64(binary.BigEndian.Uint32(req.extras[4:]))
+	}
+
+	stored, st := bc.server.metaStore(req.key, item, exptime, metaStoreOptions{mode: mode, cas: req.cas})
+
+	switch {
+	case st == statusStored:
+		if !req.quiet {
+			bc.write(req, &binaryResponse{cas: stored.CAS})
+		}
+	case st == statusNotStored && mode == modeAdd:
+		bc.writeStatus(req, binaryStatusKeyExists)
+	case st == statusNotStored && mode == modeReplace:
+		bc.writeStatus(req, binaryStatusKeyNotFound)
+	default:
+		bc.writeStatus(req, binaryStatuses[st])
+	}
+}
+
+// handleDelete handles Delete and DeleteQ, and a non-zero cas is compared.
+func (bc *binaryConn) handleDelete(req *binaryRequest) {
+	if !bc.validate(req, 0, true, false) {
+		bc.writeStatus(req, binaryStatusInvalid)
+		return
+	}
+
+	st := bc.server.metaDelete(req.key, metaDeleteOptions{cas: req.cas})
+	if st != statusDeleted {
+		bc.writeStatus(req, binaryStatuses[st])
+		return
+	}
+
+	if !req.quiet {
+		bc.write(req, &binaryResponse{})
+	}
+}
+
+// handleIncr handles Increment, Decrement and their quiet ones.
+// The extras are delta, initial value and expiration, and a missing key is created with the initial value
+// unless the expiration is 0xFFFFFFFF.
+func (bc *binaryConn) handleIncr(req *binaryRequest) {
+	if !bc.validate(req, 20, true, false) {
+		bc.writeStatus(req, binaryStatusInvalid)
+		return
+	}
+
+	expiration := binary.BigEndian.Uint32(req.extras[16:])
+	opts := metaArithmeticOptions{
+		decr:          req.opcode == opDecrement,
+		delta:         binary.BigEndian.Uint64(req.extras),
+		cas:           req.cas,
+		vivify:        expiration != binaryNoVivify,
+		vivifyExptime: int64(expiration),
+		initial:       binary.BigEndian.Uint64(req.extras[8:]),
+	}
+
+	item, value, st := bc.server.metaArithmetic(req.key, opts)
+	if st != statusStored {
+		bc.writeStatus(req, binaryStatuses[st])
+		return
+	}
+
+	if !req.quiet {
+		resp := &binaryResponse{cas: item.CAS, value: make([]byte, 8)}
+		binary.BigEndian.PutUint64(resp.value, value)
+		bc.write(req, resp)
+	}
+}
+
+// handleFlush handles Flush and FlushQ whose extras is an optional delay.
+func (bc *binaryConn) handleFlush(req *binaryRequest) {
+	if len(req.extras) != 0 && len(req.extras) != 4 || len(req.key) > 0 || len(req.value) > 0 {
+		bc.writeStatus(req, binaryStatusInvalid)
+		return
+	}
+
+	var delay time.Duration
+	if len(req.extras) == 4 {
+		delay = time.Duration(binary.BigEndian.Uint32(req.extras)) * time.Second
+	}
+
+	bc.server.flush(delay)
+
+	if !req.quiet {
+		bc.write(req, &binaryResponse{})
+	}
+}
+
+// handleStat handles Stat which is responded with a response of each stat and an empty one in the end.
+// Groups of stats aren't supported.
+func (bc *binaryConn) handleStat(req *binaryRequest) {
+	if len(req.key) > 0 {
+		bc.writeStatus(req, binaryStatusKeyNotFound)
+		return
+	}
+
+	for _, stat := range bc.server.listStats() {
+		bc.write(req, &binaryResponse{key: stat.name, value: []byte(stat.value)})
+	}
+
+	bc.write(req, &binaryResponse{})
+}
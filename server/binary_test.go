@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+// golden returns the bytes of hex which can have spaces, and body is appended to them.
+func golden(t *testing.T, hexString string, body string) string {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.ReplaceAll(hexString, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b) + body
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerBinary$
+func TestServerBinary(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithMaxItemSize(16))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	testCases := []struct {
+		name     string
+		request  string
+		response string
+	}{
+		{
+			name:     "get missed",
+			request:  golden(t, "80 00 0005 00 00 0000 00000005 00000000 0000000000000000", "Hello"),
+			response: golden(t, "81 00 0000 00 00 0001 00000009 00000000 0000000000000000", "Not found"),
+		},
+		{
+			name:     "set",
+			request:  golden(t, "80 01 0005 08 00 0000 00000012 00000000 0000000000000000 deadbeef 00000e10", "HelloWorld"),
+			response: golden(t, "81 01 0000 00 00 0000 00000000 00000000 0000000000000001", ""),
+		},
+		{
+			name:     "get",
+			request:  golden(t, "80 00 0005 00 00 0000 00000005 01020304 0000000000000000", "Hello"),
+			response: golden(t, "81 00 0000 04 00 0000 00000009 01020304 0000000000000001 deadbeef", "World"),
+		},
+		{
+			name:     "getk",
+			request:  golden(t, "80 0c 0005 00 00 0000 00000005 00000000 0000000000000000", "Hello"),
+			response: golden(t, "81 0c 0005 04 00 0000 0000000e 00000000 0000000000000001 deadbeef", "HelloWorld"),
+		},
+		{
+			name:     "add existing",
+			request:  golden(t, "80 02 0005 08 00 0000 0000000e 00000000 0000000000000000 00000000 00000000", "Hellox"),
+			response: golden(t, "81 02 0000 00 00 0002 00000014 00000000 0000000000000000", "Data exists for key."),
+		},
+		{
+			name:     "set with wrong cas",
+			request:  golden(t, "80 01 0005 08 00 0000 0000000e 00000000 0000000000000005 00000000 00000000", "Hellox"),
+			response: golden(t, "81 01 0000 00 00 0002 00000014 00000000 0000000000000000", "Data exists for key."),
+		},
+		{
+			name:     "replace missing",
+			request:  golden(t, "80 03 0007 08 00 0000 00000010 00000000 0000000000000000 00000000 00000000", "missingx"),
+			response: golden(t, "81 03 0000 00 00 0001 00000009 00000000 0000000000000000", "Not found"),
+		},
+		{
+			name:     "append",
+			request:  golden(t, "80 0e 0005 00 00 0000 00000006 00000000 0000000000000000", "Hello!"),
+			response: golden(t, "81 0e 0000 00 00 0000 00000000 00000000 0000000000000002", ""),
+		},
+		{
+			name:     "touch",
+			request:  golden(t, "80 1c 0005 04 00 0000 00000009 00000000 0000000000000000 00000000", "Hello"),
+			response: golden(t, "81 1c 0000 00 00 0000 00000000 00000000 0000000000000002", ""),
+		},
+		{
+			name:     "gat",
+			request:  golden(t, "80 1d 0005 04 00 0000 00000009 00000000 0000000000000000 00000000", "Hello"),
+			response: golden(t, "81 1d 0000 04 00 0000 0000000a 00000000 0000000000000002 deadbeef", "World!"),
+		},
+		{
+			name:     "delete",
+			request:  golden(t, "80 04 0005 00 00 0000 00000005 00000000 0000000000000000", "Hello"),
+			response: golden(t, "81 04 0000 00 00 0000 00000000 00000000 0000000000000000", ""),
+		},
+		{
+			name:     "delete missing",
+			request:  golden(t, "80 04 0005 00 00 0000 00000005 00000000 0000000000000000", "Hello"),
+			response: golden(t, "81 04 0000 00 00 0001 00000009 00000000 0000000000000000", "Not found"),
+		},
+		{
+			name:     "incr missing",
+			request:  golden(t, "80 05 0007 14 00 0000 0000001b 00000000 0000000000000000 0000000000000001 0000000000000000 ffffffff", "counter"),
+			response: golden(t, "81 05 0000 00 00 0001 00000009 00000000 0000000000000000", "Not found"),
+		},
+		{
+			name:     "incr initial",
+			request:  golden(t, "80 05 0007 14 00 0000 0000001b 00000000 0000000000000000 0000000000000001 0000000000000000 00000e10", "counter"),
+			response: golden(t, "81 05 0000 00 00 0000 00000008 00000000 0000000000000003 0000000000000000", ""),
+		},
+		{
+			name:     "incr",
+			request:  golden(t, "80 05 0007 14 00 0000 0000001b 00000000 0000000000000000 000000000000000a 0000000000000000 00000e10", "counter"),
+			response: golden(t, "81 05 0000 00 00 0000 00000008 00000000 0000000000000004 000000000000000a", ""),
+		},
+		{
+			name:     "decr",
+			request:  golden(t, "80 06 0007 14 00 0000 0000001b 00000000 0000000000000000 0000000000000064 0000000000000000 00000e10", "counter"),
+			response: golden(t, "81 06 0000 00 00 0000 00000008 00000000 0000000000000005 0000000000000000", ""),
+		},
+		{
+			name:     "too large",
+			request:  golden(t, "80 01 0001 08 00 0000 00000200 00000000 0000000000000000 00000000 00000000", "k"+strings.Repeat("v", 0x200-9)),
+			response: golden(t, "81 01 0000 00 00 0003 0000000a 00000000 0000000000000000", "Too large."),
+		},
+		{
+			name:     "invalid arguments",
+			request:  golden(t, "80 00 0000 00 00 0000 00000000 00000000 0000000000000000", ""),
+			response: golden(t, "81 00 0000 00 00 0004 00000011 00000000 0000000000000000", "Invalid arguments"),
+		},
+		{
+			name:     "version",
+			request:  golden(t, "80 0b 0000 00 00 0000 00000000 00000000 0000000000000000", ""),
+			response: golden(t, "81 0b 0000 00 00 0000 00000005 00000000 0000000000000000", Version),
+		},
+		{
+			name:     "unknown command",
+			request:  golden(t, "80 50 0000 00 00 0000 00000000 00000000 0000000000000000", ""),
+			response: golden(t, "81 50 0000 00 00 0081 0000000f 00000000 0000000000000000", "Unknown command"),
+		},
+		{
+			name:     "flush",
+			request:  golden(t, "80 08 0000 00 00 0000 00000000 00000000 0000000000000000", ""),
+			response: golden(t, "81 08 0000 00 00 0000 00000000 00000000 0000000000000000", ""),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client.t = t
+			client.do(testCase.request, testCase.response)
+		})
+	}
+
+	if size := cache.Size(); size != 0 {
+		t.Fatalf("size %d != 0", size)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerBinaryQuiet$
+func TestServerBinaryQuiet(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache)
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	// Quiet requests are only responded when failing, and getk pipelines end with a noop.
+	request := golden(t, "80 11 0001 08 00 0000 0000000a 00000000 0000000000000000 00000000 00000000", "a1") +
+		golden(t, "80 11 0001 08 00 0000 0000000a 00000000 0000000000000000 00000001 00000000", "b2") +
+		golden(t, "80 12 0001 08 00 0000 0000000a 00000000 0000000000000000 00000000 00000000", "a3") +
+		golden(t, "80 0d 0001 00 00 0000 00000001 00000001 0000000000000000", "a") +
+		golden(t, "80 0d 0007 00 00 0000 00000007 00000002 0000000000000000", "missing") +
+		golden(t, "80 0d 0001 00 00 0000 00000001 00000003 0000000000000000", "b") +
+		golden(t, "80 09 0001 00 00 0000 00000001 00000004 0000000000000000", "a") +
+		golden(t, "80 0a 0000 00 00 0000 00000000 00000005 0000000000000000", "")
+
+	response := golden(t, "81 12 0000 00 00 0002 00000014 00000000 0000000000000000", "Data exists for key.") +
+		golden(t, "81 0d 0001 04 00 0000 00000006 00000001 0000000000000001 00000000", "a1") +
+		golden(t, "81 0d 0001 04 00 0000 00000006 00000003 0000000000000002 00000001", "b2") +
+		golden(t, "81 09 0000 04 00 0000 00000005 00000004 0000000000000001 00000000", "1") +
+		golden(t, "81 0a 0000 00 00 0000 00000000 00000005 0000000000000000", "")
+
+	client.do(request, response)
+
+	// Quit quietly closes the connection without a response.
+	client.do(golden(t, "80 17 0000 00 00 0000 00000000 00000000 0000000000000000", ""), "")
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("err %+v != io.EOF", err)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerBinaryStat$
+func TestServerBinaryStat(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache)
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do(golden(t, "80 10 0000 00 00 0000 00000000 01020304 0000000000000000", ""), "")
+
+	// Each stat is responded with its name as key and its value as value, and the last response is empty.
+	stats := make(map[string]string)
+	for {
+		header := make([]byte, binaryHeaderSize)
+		if _, err := io.ReadFull(client.reader, header); err != nil {
+			t.Fatal(err)
+		}
+
+		var bh binaryHeader
+		bh.decode(header)
+
+		if bh.magic != binaryResponseMagic || bh.opcode != opStat || bh.status != binaryStatusOK || bh.opaque != 0x01020304 {
+			t.Fatalf("bad header %+v", bh)
+		}
+
+		if bh.bodyLength == 0 {
+			break
+		}
+
+		body := make([]byte, bh.bodyLength)
+		if _, err := io.ReadFull(client.reader, body); err != nil {
+			t.Fatal(err)
+		}
+
+		stats[string(body[:bh.keyLength])] = string(body[bh.keyLength:])
+	}
+
+	if stats["version"] != Version {
+		t.Fatalf("stats[version] %q != %q", stats["version"], Version)
+	}
+
+	if stats["curr_connections"] != "1" {
+		t.Fatalf("stats[curr_connections] %q != %q", stats["curr_connections"], "1")
+	}
+
+	client.do(golden(t, "80 10 0003 00 00 0000 00000003 00000000 0000000000000000", "foo"), golden(t, "81 10 0000 00 00 0001 00000009 00000000 0000000000000000", "Not found"))
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+// status is the result of a command which is written by protocols in their own ways.
+type status int
+
+const (
+	statusStored status = iota
+	statusNotStored
+	statusExists
+	statusNotFound
+	statusDeleted
+	statusTouched
+	statusNonNumeric
+)
+
+// storeMode is the mode of storing an item.
+type storeMode int
+
+const (
+	modeSet storeMode = iota
+	modeAdd
+	modeReplace
+	modeAppend
+	modePrepend
+	modeCAS
+)
+
+// nextCAS returns a new unique cas.
+func (s *Server) nextCAS() uint64 {
+	return atomic.AddUint64(&s.cas, 1)
+}
+
+// get returns the items of keys, and the item is nil if its key isn't found.
+func (s *Server) get(keys []string) (items []*Item) {
+	values, founds := s.cache.MGet(keys, nil)
+	items = make([]*Item, len(keys))
+
+	for i, found := range founds {
+		if found {
+			items[i] = itemOf(values[i])
+		}
+	}
+
+	s.stats.recordGet(items)
+	return items
+}
+
+// merge returns the item stored by mode with item and the old item, and nil if nothing should be stored.
+func merge(mode storeMode, old *Item, item *Item, cas uint64) (stored *Item, st status) {
+	switch mode {
+	case modeAdd:
+		if old != nil {
+			return nil, statusNotStored
+		}
+	case modeReplace:
+		if old == nil {
+			return nil, statusNotStored
+		}
+	case modeAppend, modePrepend:
+		if old == nil {
+			return nil, statusNotStored
+		}
+
+		// Appending keeps the flags and expiration of the old item.
+		stored = old.clone()
+		stored.Value = make([]byte, 0, len(old.Value)+len(item.Value))
+
+		if mode == modeAppend {
+			stored.Value = append(append(stored.Value, old.Value...), item.Value...)
+		} else {
+			stored.Value = append(append(stored.Value, item.Value...), old.Value...)
+		}
+
+		return stored, statusStored
+	case modeCAS:
+		if old == nil {
+			return nil, statusNotFound
+		}
+
+		if old.CAS != cas {
+			return nil, statusExists
+		}
+	}
+
+	return item, statusStored
+}
+
+// store stores item to key by mode, and cas is only used by modeCAS.
+// Exptime is in seconds, see expirationOf.
+func (s *Server) store(mode storeMode, key string, item *Item, exptime int64, cas uint64) (st status) {
+	_, st = s.storeBy(key, item, exptime, 0, func(old *Item) (*Item, status) {
+		return merge(mode, old, item, cas)
+	})
+
+	s.stats.recordStore(mode, st)
+	return st
+}
+
+// storeBy stores the item returned by fn with the old item of key, and nothing is stored if it returns nil.
+// The stored item has newCAS as its cas, and zero newCAS means a new unique one.
+func (s *Server) storeBy(key string, item *Item, exptime int64, newCAS uint64, fn func(old *Item) (*Item, status)) (stored *Item, st status) {
+	now := s.now()
+
+	expiration, expired := expirationOf(exptime, now)
+	item.Expiration = expiration
+
+	return s.storeAt(now, key, item, expired, newCAS, fn)
+}
+
+// storeAt is storeBy with the expiration of item set already, and expired reports if item should be removed.
+func (s *Server) storeAt(now int64, key string, item *Item, expired bool, newCAS uint64, fn func(old *Item) (*Item, status)) (stored *Item, st status) {
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		var old *Item
+		if exists {
+			old = itemOf(oldValue)
+		}
+
+		stored, st = fn(old)
+		if stored == nil {
+			if old == nil {
+				return nil, 0, false
+			}
+
+			return oldValue, memcache.KeepTTL, true
+		}
+
+		// An item stored with an expired exptime is removed immediately.
+		if expired && stored == item {
+			return nil, 0, false
+		}
+
+		stored.CAS = newCAS
+		if newCAS == 0 {
+			stored.CAS = s.nextCAS()
+		}
+
+		// An item merged with the old one like appending keeps the ttl of key.
+		if stored != item {
+			return stored, memcache.KeepTTL, true
+		}
+
+		return stored, stored.ttl(now), true
+	})
+
+	return stored, st
+}
+
+// remove removes key if its cas equals to cas, and zero cas removes key anyway.
+func (s *Server) remove(key string, cas uint64) (st status) {
+	if cas == 0 {
+		st = statusNotFound
+		if removedValue := s.cache.Remove(key); removedValue != nil {
+			st = statusDeleted
+		}
+
+		s.stats.recordRemove(st)
+		return st
+	}
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			st = statusNotFound
+			return nil, 0, false
+		}
+
+		if old := itemOf(oldValue); old.CAS != cas {
+			st = statusExists
+			return oldValue, memcache.KeepTTL, true
+		}
+
+		st = statusDeleted
+		return nil, 0, false
+	})
+
+	s.stats.recordRemove(st)
+	return st
+}
+
+// applyDelta increases number by delta, or decreases it if decr is true.
+// Increasing wraps around and decreasing stops at zero.
+func applyDelta(number uint64, delta uint64, decr bool) uint64 {
+	switch {
+	case !decr:
+		return number + delta
+	case number > delta:
+		return number - delta
+	default:
+		return 0
+	}
+}
+
+// incr increases the value of key by delta, or decreases it if decr is true.
+// Values are unsigned 64-bit integers, so increasing wraps around and decreasing stops at zero.
+func (s *Server) incr(key string, delta uint64, decr bool) (value uint64, st status) {
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			st = statusNotFound
+			return nil, 0, false
+		}
+
+		old := itemOf(oldValue)
+
+		number, err := strconv.ParseUint(string(old.Value), 10, 64)
+		if err != nil {
+			st = statusNonNumeric
+			return oldValue, memcache.KeepTTL, true
+		}
+
+		value = applyDelta(number, delta, decr)
+
+		item := old.clone()
+		item.Value = strconv.AppendUint(nil, value, 10)
+		item.CAS = s.nextCAS()
+
+		st = statusStored
+		return item, memcache.KeepTTL, true
+	})
+
+	s.stats.recordIncr(decr, st)
+	return value, st
+}
+
+// touch updates the exptime of key and returns its item.
+func (s *Server) touch(key string, exptime int64) (item *Item, st status) {
+	now := s.now()
+	expiration, expired := expirationOf(exptime, now)
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			st = statusNotFound
+			return nil, 0, false
+		}
+
+		item = itemOf(oldValue).clone()
+		item.Expiration = expiration
+
+		st = statusTouched
+		return item, item.ttl(now), !expired
+	})
+
+	s.stats.recordTouch(st)
+	return item, st
+}
+
+// flush removes all keys after delay.
+func (s *Server) flush(delay time.Duration) {
+	atomic.AddUint64(&s.stats.cmdFlush, 1)
+
+	if delay <= 0 {
+		s.cache.Reset()
+		return
+	}
+
+	time.AfterFunc(delay, s.cache.Reset)
+}
+
+// listStats returns the stats of server in order.
+func (s *Server) listStats() []stat {
+	now := s.now()
+
+	stats := []stat{
+		{"pid", strconv.Itoa(s.pid)},
+		{"uptime", strconv.FormatInt(int64(time.Duration(now-s.startTime)/time.Second), 10)},
+		{"time", strconv.FormatInt(int64(time.Duration(now)/time.Second), 10)},
+		{"version", Version},
+		{"curr_items", strconv.Itoa(s.cache.Size())},
+	}
+
+	return append(stats, s.stats.list()...)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	// maxRelativeExptime is the max exptime which is relative to now, and a larger one is a unix timestamp.
+	maxRelativeExptime = 60 * 60 * 24 * 30
+)
+
+func init() {
+	// Items are stored in cache as values, so they can be saved in snapshots with the default codec.
+	gob.Register(&Item{})
+}
+
+// Item is the value of a key stored by server.
+// Values set to cache by other ways are served as bytes, see itemOf.
+type Item struct {
+	// Value is the data of item.
+	Value []byte
+
+	// Flags is an opaque number stored with value by clients.
+	Flags uint32
+
+	// CAS is the unique number of item which changes every time item is modified.
+	CAS uint64
+
+	// Expiration is the unix time in nanoseconds when item expires, and zero means never.
+	Expiration int64
+
+	// Stale reports if item is invalidated, and it's served as stale until it's stored again.
+	Stale bool
+
+	// Won reports if a client has won the right to recache item, so other clients don't recache it.
+	Won bool
+}
+
+// ttl returns the remaining ttl of item at now.
+func (i *Item) ttl(now int64) time.Duration {
+	if i.Expiration <= 0 {
+		return memcache.NoTTL
+	}
+
+	if ttl := time.Duration(i.Expiration - now); ttl > 0 {
+		return ttl
+	}
+
+	// The item is just expired, so it should expire as soon as possible.
+	return time.Nanosecond
+}
+
+// clone returns a copy of item which shares the same value.
+// ttlOrKeep returns the ttl of item if it's touched, or KeepTTL to keep the remaining ttl of its key.
+// Items of values set in process have no expiration, so their ttls can only be kept by the cache.
+func (i *Item) ttlOrKeep(now int64, touched bool) time.Duration {
+	if touched {
+		return i.ttl(now)
+	}
+
+	return memcache.KeepTTL
+}
+
+func (i *Item) clone() *Item {
+	item := *i
+	return &item
+}
+
+// itemOf returns the item of value which is got from cache.
+// Values not set by server are formatted to bytes, and their flags and cas are zero.
+func itemOf(value interface{}) *Item {
+	switch v := value.(type) {
+	case *Item:
+		return v
+	case []byte:
+		return &Item{Value: v}
+	case string:
+		return &Item{Value: []byte(v)}
+	case int64:
+		return &Item{Value: strconv.AppendInt(nil, v, 10)}
+	case uint64:
+		return &Item{Value: strconv.AppendUint(nil, v, 10)}
+	case int:
+		return &Item{Value: strconv.AppendInt(nil, int64(v), 10)}
+	case float64:
+		return &Item{Value: strconv.AppendFloat(nil, v, 'f', -1, 64)}
+	default:
+		return &Item{Value: []byte(fmt.Sprint(v))}
+	}
+}
+
+// expirationOf returns the expiration in unix nanoseconds of exptime at now.
+// Exptime is in seconds, and it's a unix timestamp if it's larger than 30 days.
+// Zero means never expiring, and expired reports if exptime is in the past.
+func expirationOf(exptime int64, now int64) (expiration int64, expired bool) {
+	if exptime == 0 {
+		return 0, false
+	}
+
+	if exptime < 0 {
+		return 0, true
+	}
+
+	if exptime > maxRelativeExptime {
+		expiration = time.Unix(exptime, 0).UnixNano()
+	} else {
+		expiration = now + int64(time.Duration(exptime)*time.Second)
+	}
+
+	return expiration, expiration <= now
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestExpirationOf$
+func TestExpirationOf(t *testing.T) {
+	now := time.Now().UnixNano()
+	unix := time.Unix(now/int64(time.Second), 0)
+
+	testCases := []struct {
+		exptime    int64
+		expiration int64
+		expired    bool
+	}{
+		{exptime: 0, expiration: 0, expired: false},
+		{exptime: -1, expiration: 0, expired: true},
+		{exptime: 10, expiration: now + int64(10*time.Second), expired: false},
+		{exptime: maxRelativeExptime, expiration: now + int64(maxRelativeExptime*time.Second), expired: false},
+		{exptime: unix.Unix() + 10, expiration: unix.Add(10 * time.Second).UnixNano(), expired: false},
+		{exptime: unix.Unix() - 10, expiration: unix.Add(-10 * time.Second).UnixNano(), expired: true},
+	}
+
+	for _, testCase := range testCases {
+		expiration, expired := expirationOf(testCase.exptime, now)
+		if expiration != testCase.expiration || expired != testCase.expired {
+			t.Fatalf("exptime %d: expiration %d, expired %+v is wrong", testCase.exptime, expiration, expired)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestItemOf$
+func TestItemOf(t *testing.T) {
+	item := &Item{Value: []byte("value"), Flags: 1, CAS: 2}
+	if got := itemOf(item); got != item {
+		t.Fatalf("got %+v != %+v", got, item)
+	}
+
+	testCases := map[interface{}]string{
+		"string":   "string",
+		int64(-1):  "-1",
+		uint64(1):  "1",
+		3:          "3",
+		1.5:        "1.5",
+		true:       "true",
+		struct{}{}: "{}",
+	}
+
+	for value, want := range testCases {
+		if got := itemOf(value); string(got.Value) != want || got.Flags != 0 || got.CAS != 0 {
+			t.Fatalf("got %+v of %+v is wrong", got, value)
+		}
+	}
+
+	if got := itemOf([]byte("bytes")); string(got.Value) != "bytes" {
+		t.Fatalf("got %+v is wrong", got)
+	}
+}
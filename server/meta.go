@@ -0,0 +1,692 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	// Flags allowed by each meta command.
+	metaGetFlags        = "bcfkOqstvNRT"
+	metaSetFlags        = "bcCEFIkOqTM"
+	metaDeleteFlags     = "bCEIkOqT"
+	metaArithmeticFlags = "bcCEJDNMOqtTvk"
+)
+
+var (
+	errBadFlag = errors.New("invalid flag")
+	errBadMode = errors.New("invalid mode")
+)
+
+var (
+	metaStatuses = map[status]string{
+		statusStored:     "HD",
+		statusNotStored:  "NS",
+		statusExists:     "EX",
+		statusNotFound:   "NF",
+		statusDeleted:    "HD",
+		statusTouched:    "HD",
+		statusNonNumeric: textStatuses[statusNonNumeric],
+	}
+
+	metaStoreModes = map[string]storeMode{
+		"E": modeAdd,
+		"A": modeAppend,
+		"P": modePrepend,
+		"R": modeReplace,
+		"S": modeSet,
+	}
+)
+
+// staleFlags are the flags of serving stale items which are returned to clients.
+type staleFlags struct {
+	// win means the client should recache the item (W).
+	win bool
+
+	// stale means the item is stale (X).
+	stale bool
+
+	// won means another client has won the right to recache the item (Z).
+	won bool
+}
+
+type metaGetOptions struct {
+	// touch updates the exptime of item to exptime.
+	touch   bool
+	exptime int64
+
+	// vivify creates an empty item with vivifyExptime on miss, and the client wins to recache it.
+	vivify        bool
+	vivifyExptime int64
+
+	// recache lets the client win to recache the item if its remaining ttl is less than recacheSeconds.
+	recache        bool
+	recacheSeconds int64
+}
+
+// metaGet gets the item of key by options.
+// A stale item is still returned, and only one client wins to recache it.
+func (s *Server) metaGet(key string, opts metaGetOptions) (item *Item, sf staleFlags) {
+	if !opts.touch && !opts.vivify && !opts.recache {
+		if value, found := s.cache.Get(key, nil); !found {
+			s.stats.recordGet([]*Item{nil})
+			return nil, sf
+		} else if item = itemOf(value); !item.Stale && !item.Won {
+			s.stats.recordGet([]*Item{item})
+			return item, sf
+		}
+	}
+
+	now := s.now()
+	hit := false
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			if !opts.vivify {
+				item = nil
+				return nil, 0, false
+			}
+
+			expiration, _ := expirationOf(opts.vivifyExptime, now)
+			item = &Item{CAS: s.nextCAS(), Expiration: expiration, Won: true}
+			sf.win = true
+			return item, item.ttl(now), true
+		}
+
+		hit = true
+		item = itemOf(oldValue).clone()
+
+		expired := false
+		if opts.touch {
+			item.Expiration, expired = expirationOf(opts.exptime, now)
+		}
+
+		recache := item.Stale
+		if opts.recache && item.Expiration > 0 {
+			recache = recache || item.Expiration-now < int64(time.Duration(opts.recacheSeconds)*time.Second)
+		}
+
+		sf.stale = item.Stale
+		if recache && !item.Won {
+			item.Won = true
+			sf.win = true
+		} else if item.Won {
+			sf.won = true
+		}
+
+		return item, item.ttlOrKeep(now, opts.touch), !expired
+	})
+
+	if hit {
+		s.stats.recordGet([]*Item{item})
+	} else {
+		s.stats.recordGet([]*Item{nil})
+	}
+
+	return item, sf
+}
+
+type metaStoreOptions struct {
+	mode storeMode
+
+	// cas is compared with the cas of item if it's not zero.
+	cas uint64
+
+	// invalidate stores the item as stale if cas is older than the cas of item.
+	invalidate bool
+
+	// newCAS is the cas of the stored item, and zero means a new unique one.
+	newCAS uint64
+}
+
+// metaStore stores item to key by options and returns the stored item.
+func (s *Server) metaStore(key string, item *Item, exptime int64, opts metaStoreOptions) (stored *Item, st status) {
+	stored, st = s.storeBy(key, item, exptime, opts.newCAS, func(old *Item) (*Item, status) {
+		stale := false
+		if opts.cas != 0 {
+			if old == nil {
+				return nil, statusNotFound
+			}
+
+			if old.CAS != opts.cas {
+				if !opts.invalidate || opts.cas > old.CAS {
+					return nil, statusExists
+				}
+
+				stale = true
+			}
+		}
+
+		stored, st := merge(opts.mode, old, item, 0)
+		if stored != nil && stale {
+			stored.Stale = true
+		}
+
+		return stored, st
+	})
+
+	mode := opts.mode
+	if opts.cas != 0 {
+		mode = modeCAS
+	}
+
+	s.stats.recordStore(mode, st)
+	return stored, st
+}
+
+type metaDeleteOptions struct {
+	// cas is compared with the cas of item if it's not zero.
+	cas uint64
+
+	// invalidate marks the item as stale instead of removing it.
+	invalidate bool
+
+	// touch updates the exptime of the invalidated item to exptime.
+	touch   bool
+	exptime int64
+
+	// newCAS is the cas of the invalidated item, and zero means a new unique one.
+	newCAS uint64
+}
+
+// metaDelete removes key or marks its item as stale by options.
+func (s *Server) metaDelete(key string, opts metaDeleteOptions) (st status) {
+	now := s.now()
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			st = statusNotFound
+			return nil, 0, false
+		}
+
+		old := itemOf(oldValue)
+		if opts.cas != 0 && old.CAS != opts.cas {
+			st = statusExists
+			return oldValue, memcache.KeepTTL, true
+		}
+
+		st = statusDeleted
+		if !opts.invalidate {
+			return nil, 0, false
+		}
+
+		item := old.clone()
+		item.Stale = true
+		item.Won = false
+
+		item.CAS = opts.newCAS
+		if item.CAS == 0 {
+			item.CAS = s.nextCAS()
+		}
+
+		expired := false
+		if opts.touch {
+			item.Expiration, expired = expirationOf(opts.exptime, now)
+		}
+
+		return item, item.ttlOrKeep(now, opts.touch), !expired
+	})
+
+	s.stats.recordRemove(st)
+	return st
+}
+
+type metaArithmeticOptions struct {
+	decr  bool
+	delta uint64
+
+	// cas is compared with the cas of item if it's not zero.
+	cas uint64
+
+	// vivify creates an item of initial with vivifyExptime on miss.
+	vivify        bool
+	vivifyExptime int64
+	initial       uint64
+
+	// touch updates the exptime of item to exptime.
+	touch   bool
+	exptime int64
+
+	// newCAS is the cas of the updated item, and zero means a new unique one.
+	newCAS uint64
+}
+
+// metaArithmetic increases or decreases the value of key by options.
+func (s *Server) metaArithmetic(key string, opts metaArithmeticOptions) (item *Item, value uint64, st status) {
+	now := s.now()
+
+	newCAS := func() uint64 {
+		if opts.newCAS != 0 {
+			return opts.newCAS
+		}
+
+		return s.nextCAS()
+	}
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			if !opts.vivify {
+				st = statusNotFound
+				return nil, 0, false
+			}
+
+			expiration, _ := expirationOf(opts.vivifyExptime, now)
+			item = &Item{Value: strconv.AppendUint(nil, opts.initial, 10), CAS: newCAS(), Expiration: expiration}
+			value, st = opts.initial, statusStored
+			return item, item.ttl(now), true
+		}
+
+		old := itemOf(oldValue)
+		if opts.cas != 0 && old.CAS != opts.cas {
+			st = statusExists
+			return oldValue, memcache.KeepTTL, true
+		}
+
+		number, err := strconv.ParseUint(string(old.Value), 10, 64)
+		if err != nil {
+			st = statusNonNumeric
+			return oldValue, memcache.KeepTTL, true
+		}
+
+		value = applyDelta(number, opts.delta, opts.decr)
+
+		item = old.clone()
+		item.Value = strconv.AppendUint(nil, value, 10)
+		item.CAS = newCAS()
+
+		expired := false
+		if opts.touch {
+			item.Expiration, expired = expirationOf(opts.exptime, now)
+		}
+
+		st = statusStored
+		return item, item.ttlOrKeep(now, opts.touch), !expired
+	})
+
+	s.stats.recordIncr(opts.decr, st)
+	return item, value, st
+}
+
+// metaFlag is a flag of meta commands with its token.
+type metaFlag struct {
+	name  byte
+	token string
+}
+
+// metaRequest is a meta command with its key and flags.
+type metaRequest struct {
+	key   string
+	flags []metaFlag
+}
+
+// parseMetaRequest parses the key and flags of a meta command, and only flags in allowed are valid.
+func parseMetaRequest(key string, flags []string, allowed string) (req *metaRequest, err error) {
+	req = &metaRequest{flags: make([]metaFlag, 0, len(flags))}
+
+	for _, flag := range flags {
+		if !strings.Contains(allowed, flag[:1]) {
+			return nil, errBadFlag
+		}
+
+		req.flags = append(req.flags, metaFlag{name: flag[0], token: flag[1:]})
+	}
+
+	req.key = key
+	if _, ok := req.flag('b'); ok {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, errBadFormat
+		}
+
+		req.key = string(decoded)
+	}
+
+	if !validKeys([]string{req.key}) {
+		return nil, errBadFormat
+	}
+
+	return req, nil
+}
+
+func (mr *metaRequest) flag(name byte) (token string, ok bool) {
+	for _, flag := range mr.flags {
+		if flag.name == name {
+			return flag.token, true
+		}
+	}
+
+	return "", false
+}
+
+// int64Flag returns the token of flag in int64 and reports if flag exists.
+func (mr *metaRequest) int64Flag(name byte) (value int64, ok bool, err error) {
+	token, ok := mr.flag(name)
+	if !ok {
+		return 0, false, nil
+	}
+
+	value, err = strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return 0, false, errBadFormat
+	}
+
+	return value, true, nil
+}
+
+// uint64Flag returns the token of flag in uint64 and reports if flag exists.
+func (mr *metaRequest) uint64Flag(name byte) (value uint64, ok bool, err error) {
+	token, ok := mr.flag(name)
+	if !ok {
+		return 0, false, nil
+	}
+
+	value, err = strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return 0, false, errBadFormat
+	}
+
+	return value, true, nil
+}
+
+func (mr *metaRequest) quiet() bool {
+	_, ok := mr.flag('q')
+	return ok
+}
+
+// writeMeta writes a response line of code with flags returned in the order of request.
+// Flags of item are only returned if item isn't nil.
+func (tc *textConn) writeMeta(code string, req *metaRequest, item *Item, sf staleFlags) {
+	tc.writer.WriteString(code)
+
+	for _, flag := range req.flags {
+		var returned string
+
+		switch flag.name {
+		case 'b':
+			if _, ok := req.flag('k'); ok {
+				returned = "b"
+			}
+		case 'k':
+			returned = "k" + req.key
+			if _, ok := req.flag('b'); ok {
+				returned = "k" + base64.StdEncoding.EncodeToString([]byte(req.key))
+			}
+		case 'O':
+			returned = "O" + flag.token
+		}
+
+		if item != nil {
+			switch flag.name {
+			case 'c':
+				returned = "c" + strconv.FormatUint(item.CAS, 10)
+			case 'f':
+				returned = "f" + strconv.FormatUint(uint64(item.Flags), 10)
+			case 's':
+				returned = "s" + strconv.Itoa(len(item.Value))
+			case 't':
+				returned = "t" + strconv.FormatInt(tc.ttlSeconds(item), 10)
+			}
+		}
+
+		if returned != "" {
+			tc.writer.WriteByte(' ')
+			tc.writer.WriteString(returned)
+		}
+	}
+
+	if sf.win {
+		tc.writer.WriteString(" W")
+	}
+
+	if sf.stale {
+		tc.writer.WriteString(" X")
+	}
+
+	if sf.won {
+		tc.writer.WriteString(" Z")
+	}
+
+	tc.writer.WriteString("\r\n")
+}
+
+// ttlSeconds returns the remaining ttl of item in seconds, and -1 means never expiring.
+func (tc *textConn) ttlSeconds(item *Item) int64 {
+	if item.Expiration <= 0 {
+		return -1
+	}
+
+	ttl := time.Duration(item.Expiration - tc.server.now())
+	return int64((ttl + time.Second - 1) / time.Second)
+}
+
+// writeMetaValue writes a response of item with its value, or HD if the value isn't requested.
+func (tc *textConn) writeMetaValue(req *metaRequest, item *Item, sf staleFlags) {
+	if _, ok := req.flag('v'); !ok {
+		tc.writeMeta("HD", req, item, sf)
+		return
+	}
+
+	tc.writeMeta("VA "+strconv.Itoa(len(item.Value)), req, item, sf)
+	tc.writer.Write(item.Value)
+	tc.writer.WriteString("\r\n")
+}
+
+// writeMetaStatus writes a response of st, and codes in quietCodes aren't written in quiet mode.
+func (tc *textConn) writeMetaStatus(st status, req *metaRequest, item *Item, quietCodes ...string) {
+	code := metaStatuses[st]
+	if st == statusNonNumeric {
+		tc.writeLine(code)
+		return
+	}
+
+	if req.quiet() {
+		for _, quietCode := range quietCodes {
+			if code == quietCode {
+				return
+			}
+		}
+	}
+
+	tc.writeMeta(code, req, item, staleFlags{})
+}
+
+// handleMetaGet handles "mg <key> <flags>*".
+func (tc *textConn) handleMetaGet(args []string) {
+	if len(args) < 1 {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	req, err := parseMetaRequest(args[0], args[1:], metaGetFlags)
+	if err != nil {
+		tc.writeError(err)
+		return
+	}
+
+	var opts metaGetOptions
+	var errs [3]error
+
+	opts.exptime, opts.touch, errs[0] = req.int64Flag('T')
+	opts.vivifyExptime, opts.vivify, errs[1] = req.int64Flag('N')
+	opts.recacheSeconds, opts.recache, errs[2] = req.int64Flag('R')
+
+	if err = errors.Join(errs[:]...); err != nil {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	item, sf := tc.server.metaGet(req.key, opts)
+	if item == nil {
+		if !req.quiet() {
+			tc.writeMeta("EN", req, nil, sf)
+		}
+
+		return
+	}
+
+	tc.writeMetaValue(req, item, sf)
+}
+
+// handleMetaSet handles "ms <key> <datalen> <flags>*" with a data block.
+// The returned error means the data block can't be read.
+func (tc *textConn) handleMetaSet(args []string) error {
+	if len(args) < 2 {
+		tc.writeError(errBadFormat)
+		return nil
+	}
+
+	size, err := strconv.Atoi(args[1])
+	if err != nil || size < 0 {
+		tc.writeError(errBadFormat)
+		return nil
+	}
+
+	// The data block is always consumed, so the connection won't treat it as commands.
+	if size > tc.server.maxItemSize {
+		if _, err = io.CopyN(io.Discard, tc.reader, int64(size)+2); err != nil {
+			return err
+		}
+
+		tc.writeLine("SERVER_ERROR object too large for cache")
+		return nil
+	}
+
+	data, err := tc.readData(size)
+	if errors.Is(err, errBadChunk) {
+		tc.writeError(err)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	req, err := parseMetaRequest(args[0], args[2:], metaSetFlags)
+	if err != nil {
+		tc.writeError(err)
+		return nil
+	}
+
+	opts := metaStoreOptions{mode: modeSet}
+	if token, ok := req.flag('M'); ok {
+		if opts.mode, ok = metaStoreModes[strings.ToUpper(token)]; !ok {
+			tc.writeError(errBadMode)
+			return nil
+		}
+	}
+
+	var errs [4]error
+	var flags uint64
+	var exptime int64
+
+	flags, _, errs[0] = req.uint64Flag('F')
+	exptime, _, errs[1] = req.int64Flag('T')
+	opts.cas, _, errs[2] = req.uint64Flag('C')
+	opts.newCAS, _, errs[3] = req.uint64Flag('E')
+	_, opts.invalidate = req.flag('I')
+
+	if err = errors.Join(errs[:]...); err != nil || flags > 1<<32-1 {
+		tc.writeError(errBadFormat)
+		return nil
+	}
+
+	item := &Item{Value: data, Flags: uint32(flags)}
+	stored, st := tc.server.metaStore(req.key, item, exptime, opts)
+	tc.writeMetaStatus(st, req, stored, "HD")
+	return nil
+}
+
+// handleMetaDelete handles "md <key> <flags>*".
+func (tc *textConn) handleMetaDelete(args []string) {
+	if len(args) < 1 {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	req, err := parseMetaRequest(args[0], args[1:], metaDeleteFlags)
+	if err != nil {
+		tc.writeError(err)
+		return
+	}
+
+	var opts metaDeleteOptions
+	var errs [3]error
+
+	opts.cas, _, errs[0] = req.uint64Flag('C')
+	opts.newCAS, _, errs[1] = req.uint64Flag('E')
+	opts.exptime, opts.touch, errs[2] = req.int64Flag('T')
+	_, opts.invalidate = req.flag('I')
+
+	if err = errors.Join(errs[:]...); err != nil {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	st := tc.server.metaDelete(req.key, opts)
+	tc.writeMetaStatus(st, req, nil, "HD", "NF")
+}
+
+// handleMetaArithmetic handles "ma <key> <flags>*".
+func (tc *textConn) handleMetaArithmetic(args []string) {
+	if len(args) < 1 {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	req, err := parseMetaRequest(args[0], args[1:], metaArithmeticFlags)
+	if err != nil {
+		tc.writeError(err)
+		return
+	}
+
+	opts := metaArithmeticOptions{delta: 1}
+	if token, ok := req.flag('M'); ok {
+		switch strings.ToUpper(token) {
+		case "I", "+":
+			opts.decr = false
+		case "D", "-":
+			opts.decr = true
+		default:
+			tc.writeError(errBadMode)
+			return
+		}
+	}
+
+	var errs [6]error
+	var hasDelta bool
+	var delta uint64
+
+	delta, hasDelta, errs[0] = req.uint64Flag('D')
+	opts.cas, _, errs[1] = req.uint64Flag('C')
+	opts.newCAS, _, errs[2] = req.uint64Flag('E')
+	opts.vivifyExptime, opts.vivify, errs[3] = req.int64Flag('N')
+	opts.initial, _, errs[4] = req.uint64Flag('J')
+	opts.exptime, opts.touch, errs[5] = req.int64Flag('T')
+
+	if err = errors.Join(errs[:]...); err != nil {
+		tc.writeError(errBadDelta)
+		return
+	}
+
+	if hasDelta {
+		opts.delta = delta
+	}
+
+	item, _, st := tc.server.metaArithmetic(req.key, opts)
+	if st != statusStored {
+		tc.writeMetaStatus(st, req, nil, "NF")
+		return
+	}
+
+	if _, ok := req.flag('v'); !ok && req.quiet() {
+		return
+	}
+
+	tc.writeMetaValue(req, item, staleFlags{})
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerMeta$
+func TestServerMeta(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithNow(fakeClock.Now))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do("mg key v\r\n", "EN\r\n")
+	client.do("mg key v k Oabc\r\n", "EN kkey Oabc\r\n")
+	client.do("ms key 5 T10 F3 c\r\nvalue\r\n", "HD c1\r\n")
+	client.do("mg key\r\n", "HD\r\n")
+	client.do("mg key v c f t s k O123\r\n", "VA 5 c1 f3 t10 s5 kkey O123\r\nvalue\r\n")
+
+	fakeClock.Advance(4 * time.Second)
+	client.do("mg key t T100\r\n", "HD t100\r\n")
+	client.do("mg key t\r\n", "HD t100\r\n")
+
+	// Compare and swap by cas.
+	client.do("ms key 1 C99\r\nx\r\n", "EX\r\n")
+	client.do("ms key 1 C1 c\r\nx\r\n", "HD c2\r\n")
+	client.do("ms missing 1 C1\r\nx\r\n", "NF\r\n")
+	client.do("ms key 1 E100 c\r\ny\r\n", "HD c100\r\n")
+
+	// Modes of storing.
+	client.do("ms key 1 MA\r\n!\r\n", "HD\r\n")
+	client.do("ms key 1 MP\r\n<\r\n", "HD\r\n")
+	client.do("mg key v\r\n", "VA 3\r\n<y!\r\n")
+	client.do("ms new 1 ME\r\na\r\n", "HD\r\n")
+	client.do("ms new 1 ME\r\nb\r\n", "NS\r\n")
+	client.do("ms missing 1 MR\r\nc\r\n", "NS\r\n")
+	client.do("ms key 1 MX\r\nd\r\n", "CLIENT_ERROR invalid mode\r\n")
+	client.do("mg key x\r\n", "CLIENT_ERROR invalid flag\r\n")
+
+	// Quiet mode only hides the codes of success, and mn flushes the pipeline.
+	client.do("ms quiet 1 q\r\nq\r\nmg missing v q\r\nmd missing q\r\nmg quiet v q\r\nmn\r\n", "VA 1\r\nq\r\nMN\r\n")
+	client.do("md quiet q\r\nmn\r\n", "MN\r\n")
+	client.do("mg quiet v\r\n", "EN\r\n")
+
+	// Deleting by cas.
+	client.do("md new C1\r\n", "EX\r\n")
+	client.do("md new\r\n", "HD\r\n")
+	client.do("md new\r\n", "NF\r\n")
+
+	// Base64 keys.
+	client.do("ms Zm9v 1 b\r\nf\r\n", "HD\r\n")
+	client.do("mg foo v\r\n", "VA 1\r\nf\r\n")
+	client.do("mg Zm9v b k v\r\n", "VA 1 b kZm9v\r\nf\r\n")
+	client.do("mg !!! b\r\n", "CLIENT_ERROR bad command line format\r\n")
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerMetaStale$
+func TestServerMetaStale(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithNow(fakeClock.Now))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	// An invalidated item is served as stale, and only the first client wins to recache it.
+	client.do("ms key 5 T100\r\nvalue\r\n", "HD\r\n")
+	client.do("md key I T30\r\n", "HD\r\n")
+	client.do("mg key v t\r\n", "VA 5 t30 W X\r\nvalue\r\n")
+	client.do("mg key v\r\n", "VA 5 X Z\r\nvalue\r\n")
+	client.do("ms key 5\r\nfresh\r\n", "HD\r\n")
+	client.do("mg key v\r\n", "VA 5\r\nfresh\r\n")
+
+	// Setting with an older cas and invalidating stores a stale item.
+	client.do("mg key c\r\n", "HD c3\r\n")
+	client.do("ms key 5 C2 I\r\nolder\r\n", "HD\r\n")
+	client.do("mg key v\r\n", "VA 5 W X\r\nolder\r\n")
+	client.do("ms key 5 C99 I\r\nnewer\r\n", "EX\r\n")
+
+	// A client wins to recache an item whose ttl is less than the token of R.
+	client.do("ms recache 1 T100\r\nr\r\n", "HD\r\n")
+	client.do("mg recache v R30\r\n", "VA 1\r\nr\r\n")
+
+	fakeClock.Advance(80 * time.Second)
+	client.do("mg recache v R30\r\n", "VA 1 W\r\nr\r\n")
+	client.do("mg recache v R30\r\n", "VA 1 Z\r\nr\r\n")
+
+	// Missing keys are vivified, and the first client wins to fill them.
+	client.do("mg vivify t N30\r\n", "HD t30 W\r\n")
+	client.do("mg vivify v t N30\r\n", "VA 0 t30 Z\r\n\r\n")
+	client.do("ms vivify 1\r\nv\r\n", "HD\r\n")
+	client.do("mg vivify v\r\n", "VA 1\r\nv\r\n")
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerMetaArithmetic$
+func TestServerMetaArithmetic(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithNow(fakeClock.Now))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do("ma counter\r\n", "NF\r\n")
+	client.do("ma counter q\r\nmn\r\n", "MN\r\n")
+	client.do("ma counter N60 J10 v t\r\n", "VA 2 t60\r\n10\r\n")
+	client.do("ma counter v\r\n", "VA 2\r\n11\r\n")
+	client.do("ma counter D9 v c\r\n", "VA 2 c3\r\n20\r\n")
+	client.do("ma counter MD D100 v\r\n", "VA 1\r\n0\r\n")
+	client.do("ma counter C1\r\n", "EX\r\n")
+	client.do("ma counter q\r\nmn\r\n", "MN\r\n")
+	client.do("ma counter T0 t v\r\n", "VA 1 t-1\r\n2\r\n")
+	client.do("ma counter Dx\r\n", "CLIENT_ERROR invalid numeric delta argument\r\n")
+	client.do("ma counter MX\r\n", "CLIENT_ERROR invalid mode\r\n")
+
+	client.do("ms text 1\r\nx\r\n", "HD\r\n")
+	client.do("ma text\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+}
@@ -0,0 +1,63 @@
+package server
+
+import "time"
+
+const (
+	// defaultMaxItemSize is the default max size of item values, which is the same as memcached.
+	defaultMaxItemSize = 1024 * 1024
+)
+
+type config struct {
+	maxItemSize int
+	idleTimeout time.Duration
+	now         func() int64
+}
+
+func newDefaultConfig() *config {
+	return &config{
+		maxItemSize: defaultMaxItemSize,
+		idleTimeout: 0,
+		now: func() int64 {
+			return time.Now().UnixNano()
+		},
+	}
+}
+
+// Option applies to config and sets some values to config.
+type Option func(conf *config)
+
+func (o Option) applyTo(conf *config) {
+	o(conf)
+}
+
+func applyOptions(conf *config, opts []Option) {
+	for _, opt := range opts {
+		opt.applyTo(conf)
+	}
+}
+
+// WithMaxItemSize returns an option setting the max size in bytes of item values.
+// Storing a larger value is refused.
+func WithMaxItemSize(maxItemSize int) Option {
+	return func(conf *config) {
+		conf.maxItemSize = maxItemSize
+	}
+}
+
+// WithIdleTimeout returns an option closing connections which send nothing in idleTimeout.
+// Zero idleTimeout means never.
+func WithIdleTimeout(idleTimeout time.Duration) Option {
+	return func(conf *config) {
+		conf.idleTimeout = idleTimeout
+	}
+}
+
+// WithNow returns an option setting the now function of server.
+// A now function should return a nanosecond unix time, and it should be the same one of cache, see memcache.WithNow.
+func WithNow(now func() int64) Option {
+	return func(conf *config) {
+		if now != nil {
+			conf.now = now
+		}
+	}
+}
@@ -0,0 +1,741 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	// respVersion is the version of redis reported to clients.
+	respVersion = "7.0.0"
+
+	// maxRESPArgs is the max count of arguments of a command.
+	maxRESPArgs = 1024 * 1024
+)
+
+var (
+	errRESPProtocol        = errors.New("ERR Protocol error")
+	errRESPMultibulkLength = fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	errRESPBulkLength      = fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+	errRESPBadBulk         = fmt.Errorf("%w: expected '$'", errRESPProtocol)
+	errRESPInlineLength    = fmt.Errorf("%w: too big inline request", errRESPProtocol)
+
+	errRESPSyntax     = errors.New("ERR syntax error")
+	errRESPNotInteger = errors.New("ERR value is not an integer or out of range")
+	errRESPOverflow   = errors.New("ERR increment or decrement would overflow")
+	errRESPCursor     = errors.New("ERR invalid cursor")
+	errRESPDB         = errors.New("ERR DB index is out of range")
+	errRESPNoProto    = errors.New("NOPROTO unsupported protocol version")
+)
+
+// respArities are the arities of commands including their names.
+// A negative arity means at least -arity arguments like redis.
+var respArities = map[string]int{
+	"ping":    -1,
+	"hello":   -1,
+	"select":  2,
+	"client":  -2,
+	"quit":    -1,
+	"get":     2,
+	"set":     -3,
+	"mget":    -2,
+	"mset":    -3,
+	"del":     -2,
+	"exists":  -2,
+	"expire":  3,
+	"ttl":     2,
+	"persist": 2,
+	"incr":    2,
+	"decr":    2,
+	"incrby":  3,
+	"decrby":  3,
+	"scan":    -2,
+	"dbsize":  1,
+	"flushdb": -1,
+	"info":    -1,
+}
+
+// respExpiration returns the expiration in unix nanoseconds of ttl in unit at now.
+// A non-positive ttl returns now which is expired, and ok is false if the expiration overflows.
+func respExpiration(ttl int64, unit time.Duration, now int64) (expiration int64, ok bool) {
+	if ttl <= 0 {
+		return now, true
+	}
+
+	if ttl > (math.MaxInt64-now)/int64(unit) {
+		return 0, false
+	}
+
+	return now + ttl*int64(unit), true
+}
+
+// storeValue stores value to key by mode, and the item expires at expiration which is zero if never.
+func (s *Server) storeValue(mode storeMode, key string, value []byte, expiration int64) (st status) {
+	item := &Item{Value: value, Expiration: expiration}
+
+	_, st = s.storeAt(s.now(), key, item, false, 0, func(old *Item) (*Item, status) {
+		return merge(mode, old, item, 0)
+	})
+
+	s.stats.recordStore(mode, st)
+	return st
+}
+
+// expire sets the expiration of key and returns its old item, and zero expiration means never.
+// The key is removed if expiration is expired, and the old item is nil if key isn't found.
+func (s *Server) expire(key string, expiration int64) (old *Item) {
+	now := s.now()
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			return nil, 0, false
+		}
+
+		old = itemOf(oldValue)
+		if expiration != 0 && expiration <= now {
+			return nil, 0, false
+		}
+
+		item := old.clone()
+		item.Expiration = expiration
+		return item, item.ttl(now), true
+	})
+
+	return old
+}
+
+// incrBy increases the value of key by delta as a signed 64-bit integer like redis.
+// A missing key is increased from zero, and an overflow fails instead of wrapping around.
+func (s *Server) incrBy(key string, delta int64) (value int64, err error) {
+	now := s.now()
+	st := statusStored
+
+	s.cache.Update(key, func(oldValue interface{}, exists bool) (interface{}, time.Duration, bool) {
+		item := new(Item)
+		number := int64(0)
+
+		if exists {
+			old := itemOf(oldValue)
+			item = old.clone()
+
+			if number, err = strconv.ParseInt(string(old.Value), 10, 64); err != nil {
+				err = errRESPNotInteger
+				st = statusNonNumeric
+				return oldValue, memcache.KeepTTL, true
+			}
+		} else {
+			st = statusNotFound
+		}
+
+		if (delta > 0 && number > math.MaxInt64-delta) || (delta < 0 && number < math.MinInt64-delta) {
+			err = errRESPOverflow
+			return oldValue, memcache.KeepTTL, exists
+		}
+
+		value = number + delta
+		item.Value = strconv.AppendInt(nil, value, 10)
+		item.CAS = s.nextCAS()
+		return item, item.ttlOrKeep(now, !exists), true
+	})
+
+	s.stats.recordIncr(delta < 0, st)
+	return value, err
+}
+
+// respConn serves a connection over redis protocol, which is RESP2 by default and RESP3 after "HELLO 3".
+// Supported commands are listed in respArities, and keys are shared by all databases.
+type respConn struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	// protocol is the version of RESP used by responses.
+	protocol int
+}
+
+// serve reads commands and writes their responses until the connection is closed or quits.
+// Responses are flushed when no more commands are buffered, so pipelined commands are written in batch.
+func (rc *respConn) serve() {
+	for {
+		if rc.server.idleTimeout > 0 {
+			rc.conn.SetReadDeadline(time.Now().Add(rc.server.idleTimeout))
+		}
+
+		args, err := rc.readCommand()
+		if errors.Is(err, errRESPProtocol) {
+			rc.writeError(err)
+			rc.writer.Flush()
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		if len(args) > 0 && rc.handle(args) {
+			rc.writer.Flush()
+			return
+		}
+
+		if rc.reader.Buffered() > 0 {
+			continue
+		}
+
+		if err = rc.writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readLine reads a line without its line break.
+func (rc *respConn) readLine() (line []byte, err error) {
+	line, err = rc.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errRESPInlineLength
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// readCommand reads a command which is an array of bulk strings or an inline command separated by spaces.
+// Bulk strings longer than the max item size are refused, see WithMaxItemSize.
+func (rc *respConn) readCommand() (args []string, err error) {
+	line, err := rc.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) <= 0 || line[0] != '*' {
+		return strings.Fields(string(line)), nil
+	}
+
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > maxRESPArgs {
+		return nil, errRESPMultibulkLength
+	}
+
+	for i := 0; i < count; i++ {
+		if line, err = rc.readLine(); err != nil {
+			return nil, err
+		}
+
+		if len(line) <= 0 || line[0] != '$' {
+			return nil, errRESPBadBulk
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > rc.server.maxItemSize {
+			return nil, errRESPBulkLength
+		}
+
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(rc.reader, data); err != nil {
+			return nil, err
+		}
+
+		if data[size] != '\r' || data[size+1] != '\n' {
+			return nil, errRESPBulkLength
+		}
+
+		args = append(args, string(data[:size]))
+	}
+
+	return args, nil
+}
+
+func (rc *respConn) writeHeader(prefix byte, n int64) {
+	rc.writer.WriteByte(prefix)
+	rc.writer.WriteString(strconv.FormatInt(n, 10))
+	rc.writer.WriteString("\r\n")
+}
+
+func (rc *respConn) writeSimple(s string) {
+	rc.writer.WriteByte('+')
+	rc.writer.WriteString(s)
+	rc.writer.WriteString("\r\n")
+}
+
+func (rc *respConn) writeError(err error) {
+	rc.writer.WriteByte('-')
+	rc.writer.WriteString(err.Error())
+	rc.writer.WriteString("\r\n")
+}
+
+func (rc *respConn) writeInteger(n int64) {
+	rc.writeHeader(':', n)
+}
+
+func (rc *respConn) writeBulk(b []byte) {
+	rc.writeHeader('$', int64(len(b)))
+	rc.writer.Write(b)
+	rc.writer.WriteString("\r\n")
+}
+
+func (rc *respConn) writeBulkString(s string) {
+	rc.writeBulk([]byte(s))
+}
+
+func (rc *respConn) writeNull() {
+	if rc.protocol >= 3 {
+		rc.writer.WriteString("_\r\n")
+		return
+	}
+
+	rc.writer.WriteString("$-1\r\n")
+}
+
+func (rc *respConn) writeArray(n int) {
+	rc.writeHeader('*', int64(n))
+}
+
+// writeMap writes the header of a map with n pairs, and it's an array of 2n elements in RESP2.
+func (rc *respConn) writeMap(n int) {
+	if rc.protocol >= 3 {
+		rc.writeHeader('%', int64(n))
+		return
+	}
+
+	rc.writeArray(2 * n)
+}
+
+// handle handles a command and reports if the connection should quit.
+func (rc *respConn) handle(args []string) (quit bool) {
+	command := strings.ToLower(args[0])
+
+	arity, ok := respArities[command]
+	if !ok {
+		rc.writeError(fmt.Errorf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+
+	if (arity > 0 && len(args) != arity) || len(args) < -arity {
+		rc.writeError(fmt.Errorf("ERR wrong number of arguments for '%s' command", command))
+		return false
+	}
+
+	args = args[1:]
+
+	switch command {
+	case "ping":
+		rc.handlePing(args)
+	case "hello":
+		rc.handleHello(args)
+	case "select":
+		rc.handleSelect(args)
+	case "client":
+		rc.handleClient(args)
+	case "quit":
+		rc.writeSimple("OK")
+		return true
+	case "get":
+		rc.handleGet(args)
+	case "set":
+		rc.handleSet(args)
+	case "mget":
+		rc.handleMGet(args)
+	case "mset":
+		rc.handleMSet(args)
+	case "del":
+		rc.handleDel(args)
+	case "exists":
+		rc.handleExists(args)
+	case "expire":
+		rc.handleExpire(args)
+	case "ttl":
+		rc.handleTTL(args)
+	case "persist":
+		rc.handlePersist(args)
+	case "incr", "decr", "incrby", "decrby":
+		rc.handleIncr(command, args)
+	case "scan":
+		rc.handleScan(args)
+	case "dbsize":
+		rc.writeInteger(int64(rc.server.cache.Size()))
+	case "flushdb":
+		rc.handleFlushDB(args)
+	case "info":
+		rc.handleInfo()
+	}
+
+	return false
+}
+
+// handlePing handles "PING [message]".
+func (rc *respConn) handlePing(args []string) {
+	switch len(args) {
+	case 0:
+		rc.writeSimple("PONG")
+	case 1:
+		rc.writeBulkString(args[0])
+	default:
+		rc.writeError(errors.New("ERR wrong number of arguments for 'ping' command"))
+	}
+}
+
+// handleHello handles "HELLO [protover [AUTH username password] [SETNAME clientname]]".
+// Authentication isn't supported, so any credentials are accepted.
+func (rc *respConn) handleHello(args []string) {
+	protocol := rc.protocol
+	if len(args) > 0 {
+		var err error
+		if protocol, err = strconv.Atoi(args[0]); err != nil {
+			rc.writeError(errRESPNotInteger)
+			return
+		}
+
+		if protocol != 2 && protocol != 3 {
+			rc.writeError(errRESPNoProto)
+			return
+		}
+
+		args = args[1:]
+	}
+
+	for len(args) > 0 {
+		switch {
+		case strings.EqualFold(args[0], "auth") && len(args) >= 3:
+			args = args[3:]
+		case strings.EqualFold(args[0], "setname") && len(args) >= 2:
+			args = args[2:]
+		default:
+			rc.writeError(errRESPSyntax)
+			return
+		}
+	}
+
+	rc.protocol = protocol
+
+	rc.writeMap(6)
+	rc.writeBulkString("server")
+	rc.writeBulkString("redis")
+	rc.writeBulkString("version")
+	rc.writeBulkString(respVersion)
+	rc.writeBulkString("proto")
+	rc.writeInteger(int64(protocol))
+	rc.writeBulkString("mode")
+	rc.writeBulkString("standalone")
+	rc.writeBulkString("role")
+	rc.writeBulkString("master")
+	rc.writeBulkString("modules")
+	rc.writeArray(0)
+}
+
+// handleSelect handles "SELECT index", and only database 0 exists.
+func (rc *respConn) handleSelect(args []string) {
+	if args[0] != "0" {
+		rc.writeError(errRESPDB)
+		return
+	}
+
+	rc.writeSimple("OK")
+}
+
+// handleClient handles "CLIENT SETNAME|SETINFO ...", which are accepted and ignored as clients send them on connecting.
+func (rc *respConn) handleClient(args []string) {
+	switch strings.ToLower(args[0]) {
+	case "setname", "setinfo":
+		rc.writeSimple("OK")
+	default:
+		rc.writeError(fmt.Errorf("ERR unknown subcommand '%s'", args[0]))
+	}
+}
+
+// handleGet handles "GET key".
+func (rc *respConn) handleGet(args []string) {
+	item := rc.server.get(args)[0]
+	if item == nil {
+		rc.writeNull()
+		return
+	}
+
+	rc.writeBulk(item.Value)
+}
+
+// handleSet handles "SET key value [NX|XX] [EX seconds|PX milliseconds]".
+func (rc *respConn) handleSet(args []string) {
+	key, value, options := args[0], args[1], args[2:]
+
+	mode := modeSet
+	ttl := int64(0)
+	unit := time.Duration(0)
+
+	for len(options) > 0 {
+		option := strings.ToLower(options[0])
+
+		switch {
+		case (option == "nx" || option == "xx") && mode == modeSet:
+			mode = modeAdd
+			if option == "xx" {
+				mode = modeReplace
+			}
+
+			options = options[1:]
+		case (option == "ex" || option == "px") && unit == 0 && len(options) >= 2:
+			var err error
+			if ttl, err = strconv.ParseInt(options[1], 10, 64); err != nil {
+				rc.writeError(errRESPNotInteger)
+				return
+			}
+
+			unit = time.Second
+			if option == "px" {
+				unit = time.Millisecond
+			}
+
+			options = options[2:]
+		default:
+			rc.writeError(errRESPSyntax)
+			return
+		}
+	}
+
+	expiration := int64(0)
+	if unit != 0 {
+		var ok bool
+		if expiration, ok = respExpiration(ttl, unit, rc.server.now()); ttl <= 0 || !ok {
+			rc.writeError(errors.New("ERR invalid expire time in 'set' command"))
+			return
+		}
+	}
+
+	if st := rc.server.storeValue(mode, key, []byte(value), expiration); st != statusStored {
+		rc.writeNull()
+		return
+	}
+
+	rc.writeSimple("OK")
+}
+
+// handleMGet handles "MGET key [key ...]".
+func (rc *respConn) handleMGet(keys []string) {
+	items := rc.server.get(keys)
+
+	rc.writeArray(len(items))
+	for _, item := range items {
+		if item == nil {
+			rc.writeNull()
+		} else {
+			rc.writeBulk(item.Value)
+		}
+	}
+}
+
+// handleMSet handles "MSET key value [key value ...]".
+func (rc *respConn) handleMSet(args []string) {
+	if len(args)%2 != 0 {
+		rc.writeError(errors.New("ERR wrong number of arguments for 'mset' command"))
+		return
+	}
+
+	keys := make([]string, 0, len(args)/2)
+	values := make([]interface{}, 0, len(args)/2)
+	ttls := make([]time.Duration, 0, len(args)/2)
+
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+		values = append(values, &Item{Value: []byte(args[i+1]), CAS: rc.server.nextCAS()})
+		ttls = append(ttls, memcache.NoTTL)
+		rc.server.stats.recordStore(modeSet, statusStored)
+	}
+
+	// Keys set by MSET never expire like redis, so ttls must be specified or the default ttl is used.
+	rc.server.cache.MSet(keys, values, ttls...)
+	rc.writeSimple("OK")
+}
+
+// handleDel handles "DEL key [key ...]".
+func (rc *respConn) handleDel(keys []string) {
+	removed := int64(0)
+	for _, key := range keys {
+		if rc.server.remove(key, 0) == statusDeleted {
+			removed++
+		}
+	}
+
+	rc.writeInteger(removed)
+}
+
+// handleExists handles "EXISTS key [key ...]", and a key is counted as many times as it's given.
+func (rc *respConn) handleExists(keys []string) {
+	_, founds := rc.server.cache.MGet(keys, nil)
+
+	count := int64(0)
+	for _, found := range founds {
+		if found {
+			count++
+		}
+	}
+
+	rc.writeInteger(count)
+}
+
+// handleExpire handles "EXPIRE key seconds", and a non-positive seconds removes key.
+func (rc *respConn) handleExpire(args []string) {
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		rc.writeError(errRESPNotInteger)
+		return
+	}
+
+	expiration, ok := respExpiration(seconds, time.Second, rc.server.now())
+	if !ok {
+		rc.writeError(errors.New("ERR invalid expire time in 'expire' command"))
+		return
+	}
+
+	if rc.server.expire(args[0], expiration) == nil {
+		rc.writeInteger(0)
+		return
+	}
+
+	rc.writeInteger(1)
+}
+
+// handleTTL handles "TTL key", which returns -2 if key isn't found and -1 if key never expires.
+// The remaining ttl is rounded to seconds like redis.
+func (rc *respConn) handleTTL(args []string) {
+	value, found := rc.server.cache.Get(args[0], nil)
+	if !found {
+		rc.writeInteger(-2)
+		return
+	}
+
+	item := itemOf(value)
+	if item.Expiration <= 0 {
+		rc.writeInteger(-1)
+		return
+	}
+
+	ttl := item.ttl(rc.server.now())
+	rc.writeInteger(int64((ttl + time.Second/2) / time.Second))
+}
+
+// handlePersist handles "PERSIST key", which returns 1 if the expiration of key is removed.
+func (rc *respConn) handlePersist(args []string) {
+	old := rc.server.expire(args[0], 0)
+	if old == nil || old.Expiration <= 0 {
+		rc.writeInteger(0)
+		return
+	}
+
+	rc.writeInteger(1)
+}
+
+// handleIncr handles "INCR key", "DECR key", "INCRBY key increment" and "DECRBY key decrement".
+func (rc *respConn) handleIncr(command string, args []string) {
+	delta := int64(1)
+	if len(args) > 1 {
+		var err error
+		if delta, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			rc.writeError(errRESPNotInteger)
+			return
+		}
+	}
+
+	if command == "decr" || command == "decrby" {
+		if delta == math.MinInt64 {
+			rc.writeError(errors.New("ERR decrement would overflow"))
+			return
+		}
+
+		delta = -delta
+	}
+
+	value, err := rc.server.incrBy(args[0], delta)
+	if err != nil {
+		rc.writeError(err)
+		return
+	}
+
+	rc.writeInteger(value)
+}
+
+// handleScan handles "SCAN cursor [MATCH pattern] [COUNT count]".
+func (rc *respConn) handleScan(args []string) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		rc.writeError(errRESPCursor)
+		return
+	}
+
+	match := ""
+	count := 0
+
+	for options := args[1:]; len(options) > 0; options = options[2:] {
+		if len(options) < 2 {
+			rc.writeError(errRESPSyntax)
+			return
+		}
+
+		switch strings.ToLower(options[0]) {
+		case "match":
+			match = options[1]
+		case "count":
+			if count, err = strconv.Atoi(options[1]); err != nil {
+				rc.writeError(errRESPNotInteger)
+				return
+			}
+
+			if count < 1 {
+				rc.writeError(errRESPSyntax)
+				return
+			}
+		default:
+			rc.writeError(errRESPSyntax)
+			return
+		}
+	}
+
+	keys, next := rc.server.cache.Scan(cursor, match, count)
+
+	rc.writeArray(2)
+	rc.writeBulkString(strconv.FormatUint(next, 10))
+	rc.writeArray(len(keys))
+
+	for _, key := range keys {
+		rc.writeBulkString(key)
+	}
+}
+
+// handleFlushDB handles "FLUSHDB [ASYNC|SYNC]", and keys are always removed synchronously.
+func (rc *respConn) handleFlushDB(args []string) {
+	if len(args) > 1 || (len(args) == 1 && !strings.EqualFold(args[0], "async") && !strings.EqualFold(args[0], "sync")) {
+		rc.writeError(errRESPSyntax)
+		return
+	}
+
+	rc.server.flush(0)
+	rc.writeSimple("OK")
+}
+
+// handleInfo handles "INFO [section ...]", and all sections are returned anyway.
+func (rc *respConn) handleInfo() {
+	var info strings.Builder
+	info.WriteString("# Server\r\n")
+	info.WriteString("redis_version:" + respVersion + "\r\n")
+	info.WriteString("\r\n# Stats\r\n")
+
+	for _, stat := range rc.server.listStats() {
+		info.WriteString(stat.name + ":" + stat.value + "\r\n")
+	}
+
+	info.WriteString("\r\n# Keyspace\r\n")
+	info.WriteString("db0:keys=" + strconv.Itoa(rc.server.cache.Size()) + "\r\n")
+
+	rc.writeBulkString(info.String())
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// serveTestRESP serves server over redis protocol and returns the address.
+func serveTestRESP(t *testing.T, server *Server) (address string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go server.ServeRESP(listener)
+	return listener.Addr().String()
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerRESP$
+func TestServerRESP(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	server, _ := newTestServer(t, cache, WithMaxItemSize(16))
+
+	client := newTestClient(t, "tcp", serveTestRESP(t, server))
+	defer client.Close()
+
+	client.do("*1\r\n$4\r\nPING\r\n", "+PONG\r\n")
+	client.do("*2\r\n$4\r\nping\r\n$5\r\nhello\r\n", "$5\r\nhello\r\n")
+	client.do("PING\r\n", "+PONG\r\n")
+	client.do("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$-1\r\n")
+	client.do("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", "+OK\r\n")
+	client.do("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$5\r\nvalue\r\n")
+	client.do("GET key\r\nGET missing\r\n", "$5\r\nvalue\r\n$-1\r\n")
+
+	// Setting with conditions.
+	client.do("SET key other NX\r\n", "$-1\r\n")
+	client.do("SET new value NX\r\n", "+OK\r\n")
+	client.do("SET missing value XX\r\n", "$-1\r\n")
+	client.do("SET key other xx\r\n", "+OK\r\n")
+	client.do("SET key other NX XX\r\n", "-ERR syntax error\r\n")
+	client.do("SET key other EX\r\n", "-ERR syntax error\r\n")
+	client.do("SET key other EX x\r\n", "-ERR value is not an integer or out of range\r\n")
+	client.do("SET key other EX 0\r\n", "-ERR invalid expire time in 'set' command\r\n")
+	client.do("SET key other PX 9223372036854775807\r\n", "-ERR invalid expire time in 'set' command\r\n")
+
+	// Multiple keys.
+	client.do("MSET a 1 b 2\r\n", "+OK\r\n")
+	client.do("MSET a 1 b\r\n", "-ERR wrong number of arguments for 'mset' command\r\n")
+	client.do("MGET a missing b\r\n", "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n")
+	client.do("EXISTS a a missing b\r\n", ":3\r\n")
+	client.do("DBSIZE\r\n", ":4\r\n")
+	client.do("DEL a missing b\r\n", ":2\r\n")
+	client.do("DBSIZE\r\n", ":2\r\n")
+
+	// Counters are signed integers.
+	client.do("INCR counter\r\n", ":1\r\n")
+	client.do("INCRBY counter 10\r\n", ":11\r\n")
+	client.do("DECRBY counter 20\r\n", ":-9\r\n")
+	client.do("DECR counter\r\n", ":-10\r\n")
+	client.do("DECRBY counter x\r\n", "-ERR value is not an integer or out of range\r\n")
+	client.do("INCR key\r\n", "-ERR value is not an integer or out of range\r\n")
+	client.do("SET max 9223372036854775807\r\n", "+OK\r\n")
+	client.do("INCR max\r\n", "-ERR increment or decrement would overflow\r\n")
+	client.do("GET max\r\n", "$19\r\n9223372036854775807\r\n")
+
+	// Errors.
+	client.do("GET\r\n", "-ERR wrong number of arguments for 'get' command\r\n")
+	client.do("UNKNOWN a\r\n", "-ERR unknown command 'UNKNOWN'\r\n")
+	client.do("SELECT 0\r\n", "+OK\r\n")
+	client.do("SELECT 1\r\n", "-ERR DB index is out of range\r\n")
+	client.do("CLIENT SETNAME test\r\n", "+OK\r\n")
+
+	// Scanning all keys.
+	for cursor, keys := "0", 0; ; {
+		client.do("SCAN "+cursor+" MATCH * COUNT 1\r\n", "*2\r\n$")
+
+		line, err := client.reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cursor, err = client.reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+
+		cursor = cursor[:len(cursor)-2]
+		if line, err = client.reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+
+		for n := int(line[1] - '0'); n > 0; n-- {
+			client.reader.ReadString('\n')
+			client.reader.ReadString('\n')
+			keys++
+		}
+
+		if cursor == "0" {
+			if keys != 4 {
+				t.Fatalf("keys %d != 4", keys)
+			}
+
+			break
+		}
+	}
+
+	client.do("SCAN 0 MATCH c* COUNT 10\r\n", "*2\r\n$1\r\n0\r\n*1\r\n$7\r\ncounter\r\n")
+	client.do("SCAN x\r\n", "-ERR invalid cursor\r\n")
+	client.do("SCAN 0 COUNT 0\r\n", "-ERR syntax error\r\n")
+
+	client.do("FLUSHDB\r\n", "+OK\r\n")
+	client.do("DBSIZE\r\n", ":0\r\n")
+	client.do("INFO\r\n", "$")
+
+	var size int
+	if _, err := fmt.Fscanf(client.reader, "%d\r\n", &size); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.CopyN(io.Discard, client.reader, int64(size+2)); err != nil {
+		t.Fatal(err)
+	}
+
+	client.do("QUIT\r\n", "+OK\r\n")
+
+	// Protocol errors close the connection.
+	client = newTestClient(t, "tcp", serveTestRESP(t, server))
+	defer client.Close()
+
+	client.do("*2\r\n$3\r\nGET\r\n$17\r\n", "-ERR Protocol error: invalid bulk length\r\n")
+	client.do("PING\r\n", "")
+
+	if _, err := client.reader.ReadByte(); err == nil {
+		t.Fatal("connection isn't closed")
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerRESPExpire$
+func TestServerRESPExpire(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	server, _ := newTestServer(t, cache, WithNow(fakeClock.Now))
+
+	client := newTestClient(t, "tcp", serveTestRESP(t, server))
+	defer client.Close()
+
+	client.do("TTL key\r\n", ":-2\r\n")
+	client.do("SET key value\r\n", "+OK\r\n")
+	client.do("TTL key\r\n", ":-1\r\n")
+	client.do("MSET a 1 b 2\r\n", "+OK\r\n")
+	client.do("TTL a\r\n", ":-1\r\n")
+	client.do("SET key value EX 10\r\n", "+OK\r\n")
+	client.do("TTL key\r\n", ":10\r\n")
+
+	fakeClock.Advance(3400 * time.Millisecond)
+	client.do("TTL key\r\n", ":7\r\n")
+
+	client.do("PERSIST key\r\n", ":1\r\n")
+	client.do("PERSIST key\r\n", ":0\r\n")
+	client.do("TTL key\r\n", ":-1\r\n")
+	client.do("EXPIRE key 100\r\n", ":1\r\n")
+	client.do("TTL key\r\n", ":100\r\n")
+	client.do("EXPIRE missing 100\r\n", ":0\r\n")
+	client.do("EXPIRE key x\r\n", "-ERR value is not an integer or out of range\r\n")
+
+	// Incrementing keeps the ttl.
+	client.do("SET counter 1 PX 1500\r\n", "+OK\r\n")
+	client.do("INCR counter\r\n", ":2\r\n")
+	client.do("TTL counter\r\n", ":2\r\n")
+
+	fakeClock.Advance(2 * time.Second)
+	client.do("GET counter\r\n", "$-1\r\n")
+
+	// Expiring with a non-positive ttl removes the key.
+	client.do("EXPIRE key 0\r\n", ":1\r\n")
+	client.do("GET key\r\n", "$-1\r\n")
+
+	// Keys set by MSET never expire.
+	fakeClock.Advance(time.Hour)
+	client.do("GET b\r\n", "$1\r\n2\r\n")
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerRESP3$
+func TestServerRESP3(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	server, address := newTestServer(t, cache)
+
+	client := newTestClient(t, "tcp", serveTestRESP(t, server))
+	defer client.Close()
+
+	client.do("HELLO 4\r\n", "-NOPROTO unsupported protocol version\r\n")
+	client.do("HELLO 3 AUTH default password SETNAME test\r\n", "%6\r\n"+
+		"$6\r\nserver\r\n$5\r\nredis\r\n"+
+		"$7\r\nversion\r\n$5\r\n7.0.0\r\n"+
+		"$5\r\nproto\r\n:3\r\n"+
+		"$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+		"$4\r\nrole\r\n$6\r\nmaster\r\n"+
+		"$7\r\nmodules\r\n*0\r\n")
+
+	client.do("GET key\r\n", "_\r\n")
+	client.do("MGET key\r\n", "*1\r\n_\r\n")
+
+	// Keys are shared with memcached protocol.
+	text := newTestClient(t, "tcp", address)
+	defer text.Close()
+
+	text.do("set key 1 0 5\r\nvalue\r\n", "STORED\r\n")
+	client.do("GET key\r\n", "$5\r\nvalue\r\n")
+	client.do("SET key other\r\n", "+OK\r\n")
+	text.do("get key\r\n", "VALUE key 0 5\r\nother\r\nEND\r\n")
+
+	client.do("HELLO 2\r\n", "*12\r\n")
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+)
+
+const (
+	// Version is the version of memcached protocol served by server.
+	Version = "1.6.0"
+
+	// readBufferSize is the size of read buffer of connections, and command lines can't be longer than it.
+	readBufferSize = 4096
+)
+
+var (
+	// ErrServerClosed is returned by Serve after server is closed.
+	ErrServerClosed = errors.New("cachego: server is closed")
+)
+
+// Server serves a cache over memcached protocol, and optionally over redis protocol.
+// Both text and binary memcached protocols are served on the same listener, and each connection speaks one of them.
+// Redis protocol is served on its own listeners, see ServeRESP.
+// Keys stored by server have items as their values, see Item.
+type Server struct {
+	*config
+
+	cache memcache.Cache
+	stats stats
+	cas   uint64
+
+	pid       int
+	startTime int64
+
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	group     sync.WaitGroup
+	lock      sync.Mutex
+}
+
+// New returns a server serving cache with options.
+func New(cache memcache.Cache, opts ...Option) *Server {
+	conf := newDefaultConfig()
+	applyOptions(conf, opts)
+
+	return &Server{
+		config:    conf,
+		cache:     cache,
+		pid:       os.Getpid(),
+		startTime: conf.now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the address of network and serves connections.
+// Network can be "tcp" or "unix", see net.Listen.
+func (s *Server) ListenAndServe(network string, address string) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve accepts connections from listener and serves them until server is closed.
+// It always returns a non-nil error, and it's ErrServerClosed after server is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	return s.serve(listener, s.serveMemcached)
+}
+
+// ListenAndServeRESP listens on the address of network and serves connections over redis protocol.
+func (s *Server) ListenAndServeRESP(network string, address string) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeRESP(listener)
+}
+
+// ServeRESP is like Serve, but connections are served over redis protocol, see respConn for supported commands.
+// Keys are shared with memcached protocol, so a value set by one protocol can be got by the other.
+func (s *Server) ServeRESP(listener net.Listener) error {
+	return s.serve(listener, s.serveRESP)
+}
+
+// serve accepts connections from listener and serves them by serveConn.
+func (s *Server) serve(listener net.Listener, serveConn func(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer)) error {
+	if !s.track(listener, nil) {
+		listener.Close()
+		return ErrServerClosed
+	}
+
+	defer s.untrack(listener, nil)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			return err
+		}
+
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		s.group.Add(1)
+		go s.serveConn(conn, serveConn)
+	}
+}
+
+// Close closes all listeners and connections of server and waits for connections to finish.
+// Notice that the cache isn't closed.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+
+	for listener := range s.listeners {
+		listener.Close()
+	}
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	s.lock.Unlock()
+
+	s.group.Wait()
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.closed
+}
+
+// track tracks listener or conn and reports if server is still open.
+func (s *Server) track(listener net.Listener, conn net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if listener != nil {
+		s.listeners[listener] = struct{}{}
+	}
+
+	if conn != nil {
+		s.conns[conn] = struct{}{}
+	}
+
+	return true
+}
+
+func (s *Server) untrack(listener net.Listener, conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.listeners, listener)
+	delete(s.conns, conn)
+}
+
+// serveConn serves conn by serve with buffered reader and writer, and conn is closed after serving.
+func (s *Server) serveConn(conn net.Conn, serve func(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer)) {
+	s.stats.connect()
+
+	defer func() {
+		conn.Close()
+		s.untrack(nil, conn)
+		s.stats.disconnect()
+		s.group.Done()
+	}()
+
+	reader := bufio.NewReaderSize(conn, readBufferSize)
+	writer := bufio.NewWriter(conn)
+	serve(conn, reader, writer)
+}
+
+func (s *Server) serveMemcached(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer) {
+	if s.idleTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	}
+
+	// The protocol of connection is detected by the first byte, which is a magic byte in binary protocol.
+	if b, err := reader.Peek(1); err == nil && b[0] == binaryRequestMagic {
+		bc := &binaryConn{server: s, conn: conn, reader: reader, writer: writer}
+		bc.serve()
+		return
+	}
+
+	tc := &textConn{server: s, conn: conn, reader: reader, writer: writer}
+	tc.serve()
+}
+
+func (s *Server) serveRESP(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer) {
+	rc := &respConn{server: s, conn: conn, reader: reader, writer: writer, protocol: 2}
+	rc.serve()
+}
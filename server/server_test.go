@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache"
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// testClient is a client of memcached text protocol for tests.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newTestClient(t *testing.T, network string, address string) *testClient {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do sends request and checks if the response equals to want.
+func (tc *testClient) do(request string, want string) {
+	tc.t.Helper()
+
+	if _, err := tc.conn.Write([]byte(request)); err != nil {
+		tc.t.Fatal(err)
+	}
+
+	got := make([]byte, len(want))
+	tc.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := io.ReadFull(tc.reader, got); err != nil {
+		tc.t.Fatalf("request %q: err %+v, got %q", request, err, got)
+	}
+
+	if string(got) != want {
+		tc.t.Fatalf("request %q: got %q != %q", request, got, want)
+	}
+}
+
+func (tc *testClient) Close() {
+	tc.conn.Close()
+}
+
+func newTestServer(t *testing.T, cache memcache.Cache, opts ...Option) (server *Server, address string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server = New(cache, opts...)
+	go server.Serve(listener)
+
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return server, listener.Addr().String()
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerText$
+func TestServerText(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithMaxItemSize(16))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do("get key\r\n", "END\r\n")
+	client.do("set key 5 0 5\r\nvalue\r\n", "STORED\r\n")
+	client.do("get key\r\n", "VALUE key 5 5\r\nvalue\r\nEND\r\n")
+	client.do("gets key\r\n", "VALUE key 5 5 1\r\nvalue\r\nEND\r\n")
+	client.do("add key 0 0 1\r\nx\r\n", "NOT_STORED\r\n")
+	client.do("add new 0 0 1\r\nx\r\n", "STORED\r\n")
+	client.do("replace missing 0 0 1\r\nx\r\n", "NOT_STORED\r\n")
+	client.do("replace new 0 0 1\r\ny\r\n", "STORED\r\n")
+	client.do("append key 0 0 2\r\n!!\r\n", "STORED\r\n")
+	client.do("prepend key 0 0 2\r\n<<\r\n", "STORED\r\n")
+	client.do("get key new\r\n", "VALUE key 5 9\r\n<<value!!\r\nVALUE new 0 1\r\ny\r\nEND\r\n")
+	client.do("gets key\r\n", "VALUE key 5 9 5\r\n<<value!!\r\nEND\r\n")
+	client.do("cas key 0 0 1 1\r\na\r\n", "EXISTS\r\n")
+	client.do("cas key 0 0 1 5\r\na\r\n", "STORED\r\n")
+	client.do("cas missing 0 0 1 5\r\na\r\n", "NOT_FOUND\r\n")
+	client.do("set counter 0 0 2\r\n10\r\n", "STORED\r\n")
+	client.do("incr counter 5\r\n", "15\r\n")
+	client.do("decr counter 100\r\n", "0\r\n")
+	client.do("incr key 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	client.do("incr missing 1\r\n", "NOT_FOUND\r\n")
+	client.do("incr counter x\r\n", "CLIENT_ERROR invalid numeric delta argument\r\n")
+	client.do("touch key 100\r\n", "TOUCHED\r\n")
+	client.do("touch missing 100\r\n", "NOT_FOUND\r\n")
+	client.do("gat 100 key missing\r\n", "VALUE key 0 1\r\na\r\nEND\r\n")
+	client.do("delete key\r\n", "DELETED\r\n")
+	client.do("delete key 0\r\n", "NOT_FOUND\r\n")
+	client.do("set key 0 0 17\r\n01234567890123456\r\n", "SERVER_ERROR object too large for cache\r\n")
+	client.do("set key 0 0 1\r\nxx\r\n", "CLIENT_ERROR bad data chunk\r\n")
+	client.do("set key 0 0\r\n", "CLIENT_ERROR bad command line format\r\n")
+	client.do("get "+strings.Repeat("k", maxKeyLength+1)+"\r\n", "CLIENT_ERROR bad command line format\r\n")
+	client.do("unknown\r\n", "ERROR\r\n")
+	client.do("version\r\n", "VERSION "+Version+"\r\n")
+	client.do("verbosity 1\r\n", "OK\r\n")
+
+	// Noreply commands have no responses, so the next response is of get.
+	client.do("set quiet 0 0 1 noreply\r\nq\r\ndelete missing noreply\r\nget quiet\r\n", "VALUE quiet 0 1\r\nq\r\nEND\r\n")
+
+	// Pipelined commands are responded in order.
+	client.do("set a 0 0 1\r\na\r\nget a\r\ndelete a\r\n", "STORED\r\nVALUE a 0 1\r\na\r\nEND\r\nDELETED\r\n")
+
+	client.do("flush_all\r\n", "OK\r\n")
+	client.do("get new counter\r\n", "END\r\n")
+
+	if size := cache.Size(); size != 0 {
+		t.Fatalf("size %d != 0", size)
+	}
+
+	client.do("quit\r\n", "")
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("err %+v != io.EOF", err)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerExptime$
+func TestServerExptime(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithNow(fakeClock.Now))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do("set key 0 10 5\r\nvalue\r\n", "STORED\r\n")
+	client.do("set expired 0 -1 5\r\nvalue\r\n", "STORED\r\n")
+	client.do("get expired\r\n", "END\r\n")
+
+	// Appending keeps the exptime of key.
+	fakeClock.Advance(5 * time.Second)
+	client.do("append key 0 0 1\r\n!\r\n", "STORED\r\n")
+	client.do("get key\r\n", "VALUE key 0 6\r\nvalue!\r\nEND\r\n")
+
+	fakeClock.Advance(6 * time.Second)
+	client.do("get key\r\n", "END\r\n")
+
+	// An exptime larger than 30 days is a unix timestamp.
+	exptime := strconv.FormatInt(fakeClock.Now()/int64(time.Second)+10, 10)
+	client.do("set key 0 "+exptime+" 1\r\nx\r\n", "STORED\r\n")
+	client.do("touch key 0\r\n", "TOUCHED\r\n")
+
+	fakeClock.Advance(time.Hour)
+	client.do("get key\r\n", "VALUE key 0 1\r\nx\r\nEND\r\n")
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerForeignValues$
+func TestServerForeignValues(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache)
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	cache.Set("string", "value")
+	cache.Incr("counter")
+
+	client.do("get string counter\r\n", "VALUE string 0 5\r\nvalue\r\nVALUE counter 0 1\r\n1\r\nEND\r\n")
+	client.do("incr counter 1\r\n", "2\r\n")
+
+	value, found := cache.Get("counter", nil)
+	if item, ok := value.(*Item); !found || !ok || string(item.Value) != "2" {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerForeignTTL$
+func TestServerForeignTTL(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0), memcache.WithNow(fakeClock.Now))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithNow(fakeClock.Now))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	// Values set in process have no expiration in items, so commands not changing keys should keep their ttls.
+	cache.Set("string", "value", 10*time.Second)
+	cache.Set("counter", "1", 10*time.Second)
+	cache.Set("text", "x", 10*time.Second)
+
+	client.do("add string 0 0 1\r\nx\r\n", "NOT_STORED\r\n")
+	client.do("incr counter 1\r\n", "2\r\n")
+	client.do("incr text 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	client.do("append text 0 0 1\r\n!\r\n", "STORED\r\n")
+	client.do("mg string v\r\n", "VA 5\r\nvalue\r\n")
+
+	fakeClock.Advance(11 * time.Second)
+	client.do("get string counter text\r\n", "END\r\n")
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerStats$
+func TestServerStats(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache)
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do("set key 0 0 1\r\nx\r\n", "STORED\r\n")
+	client.do("get key missing\r\n", "VALUE key 0 1\r\nx\r\nEND\r\n")
+	client.do("stats\r\n", "STAT pid ")
+
+	stats := make(map[string]string)
+	for {
+		line, err := client.reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line == "END\r\n" {
+			break
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "STAT "))
+		if len(fields) == 2 {
+			stats[fields[0]] = fields[1]
+		}
+	}
+
+	want := map[string]string{"curr_items": "1", "curr_connections": "1", "cmd_get": "2", "cmd_set": "1", "get_hits": "1", "get_misses": "1"}
+	for name, value := range want {
+		if stats[name] != value {
+			t.Fatalf("stat %s %s != %s", name, stats[name], value)
+		}
+	}
+
+	client.do("stats items\r\n", "ERROR\r\n")
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerUnixSocket$
+func TestServerUnixSocket(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	path := filepath.Join(t.TempDir(), "memcached.sock")
+	server := New(cache)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe("unix", path)
+	}()
+
+	var client *testClient
+	for i := 0; i < 100 && client == nil; i++ {
+		if conn, err := net.Dial("unix", path); err == nil {
+			client = &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if client == nil {
+		t.Fatal("server isn't listening")
+	}
+
+	client.do("set key 0 0 1\r\nx\r\n", "STORED\r\n")
+	client.do("get key\r\n", "VALUE key 0 1\r\nx\r\nEND\r\n")
+
+	server.Close()
+
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("err %+v != ErrServerClosed", err)
+	}
+
+	// Connections are closed with server.
+	if _, err := client.reader.ReadByte(); err == nil {
+		t.Fatal("connection isn't closed")
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestServerIdleTimeout$
+func TestServerIdleTimeout(t *testing.T) {
+	cache := memcache.NewCache(memcache.WithLRU(16), memcache.WithGC(0))
+	defer cache.Close()
+
+	_, address := newTestServer(t, cache, WithIdleTimeout(50*time.Millisecond))
+
+	client := newTestClient(t, "tcp", address)
+	defer client.Close()
+
+	client.do("version\r\n", "VERSION "+Version+"\r\n")
+
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("err %+v != io.EOF", err)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// stat is a stat of server with its name.
+type stat struct {
+	name  string
+	value string
+}
+
+// stats counts the commands of server.
+type stats struct {
+	currConns  int64
+	totalConns uint64
+
+	cmdGet   uint64
+	cmdSet   uint64
+	cmdFlush uint64
+	cmdTouch uint64
+
+	getHits      uint64
+	getMisses    uint64
+	deleteHits   uint64
+	deleteMisses uint64
+	incrHits     uint64
+	incrMisses   uint64
+	decrHits     uint64
+	decrMisses   uint64
+	casHits      uint64
+	casMisses    uint64
+	casBadval    uint64
+	touchHits    uint64
+	touchMisses  uint64
+}
+
+func (s *stats) connect() {
+	atomic.AddInt64(&s.currConns, 1)
+	atomic.AddUint64(&s.totalConns, 1)
+}
+
+func (s *stats) disconnect() {
+	atomic.AddInt64(&s.currConns, -1)
+}
+
+// hitOrMiss increases hits if hit or misses if not.
+func hitOrMiss(hit bool, hits *uint64, misses *uint64) {
+	if hit {
+		atomic.AddUint64(hits, 1)
+	} else {
+		atomic.AddUint64(misses, 1)
+	}
+}
+
+func (s *stats) recordGet(items []*Item) {
+	atomic.AddUint64(&s.cmdGet, uint64(len(items)))
+
+	for _, item := range items {
+		hitOrMiss(item != nil, &s.getHits, &s.getMisses)
+	}
+}
+
+func (s *stats) recordStore(mode storeMode, st status) {
+	atomic.AddUint64(&s.cmdSet, 1)
+
+	if mode != modeCAS {
+		return
+	}
+
+	switch st {
+	case statusStored:
+		atomic.AddUint64(&s.casHits, 1)
+	case statusExists:
+		atomic.AddUint64(&s.casBadval, 1)
+	default:
+		atomic.AddUint64(&s.casMisses, 1)
+	}
+}
+
+func (s *stats) recordRemove(st status) {
+	hitOrMiss(st == statusDeleted, &s.deleteHits, &s.deleteMisses)
+}
+
+func (s *stats) recordIncr(decr bool, st status) {
+	if decr {
+		hitOrMiss(st != statusNotFound, &s.decrHits, &s.decrMisses)
+	} else {
+		hitOrMiss(st != statusNotFound, &s.incrHits, &s.incrMisses)
+	}
+}
+
+func (s *stats) recordTouch(st status) {
+	atomic.AddUint64(&s.cmdTouch, 1)
+	hitOrMiss(st == statusTouched, &s.touchHits, &s.touchMisses)
+}
+
+// list returns all stats in order.
+func (s *stats) list() []stat {
+	counters := []struct {
+		name    string
+		counter *uint64
+	}{
+		{"total_connections", &s.totalConns},
+		{"cmd_get", &s.cmdGet},
+		{"cmd_set", &s.cmdSet},
+		{"cmd_flush", &s.cmdFlush},
+		{"cmd_touch", &s.cmdTouch},
+		{"get_hits", &s.getHits},
+		{"get_misses", &s.getMisses},
+		{"delete_hits", &s.deleteHits},
+		{"delete_misses", &s.deleteMisses},
+		{"incr_hits", &s.incrHits},
+		{"incr_misses", &s.incrMisses},
+		{"decr_hits", &s.decrHits},
+		{"decr_misses", &s.decrMisses},
+		{"cas_hits", &s.casHits},
+		{"cas_misses", &s.casMisses},
+		{"cas_badval", &s.casBadval},
+		{"touch_hits", &s.touchHits},
+		{"touch_misses", &s.touchMisses},
+	}
+
+	list := make([]stat, 0, len(counters)+1)
+	list = append(list, stat{"curr_connections", strconv.FormatInt(atomic.LoadInt64(&s.currConns), 10)})
+
+	for _, c := range counters {
+		list = append(list, stat{c.name, strconv.FormatUint(atomic.LoadUint64(c.counter), 10)})
+	}
+
+	return list
+}
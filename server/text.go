@@ -0,0 +1,442 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxKeyLength is the max length of keys, which is the same as memcached.
+	maxKeyLength = 250
+)
+
+var (
+	errBadFormat  = errors.New("bad command line format")
+	errBadChunk   = errors.New("bad data chunk")
+	errLineLength = errors.New("line is too long")
+	errBadDelta   = errors.New("invalid numeric delta argument")
+)
+
+var (
+	textStatuses = map[status]string{
+		statusStored:     "STORED",
+		statusNotStored:  "NOT_STORED",
+		statusExists:     "EXISTS",
+		statusNotFound:   "NOT_FOUND",
+		statusDeleted:    "DELETED",
+		statusTouched:    "TOUCHED",
+		statusNonNumeric: "CLIENT_ERROR cannot increment or decrement non-numeric value",
+	}
+
+	textStoreModes = map[string]storeMode{
+		"set":     modeSet,
+		"add":     modeAdd,
+		"replace": modeReplace,
+		"append":  modeAppend,
+		"prepend": modePrepend,
+		"cas":     modeCAS,
+	}
+)
+
+// textConn serves a connection over memcached text protocol.
+type textConn struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// serve reads commands and writes their responses until the connection is closed or quits.
+// Responses are flushed when no more commands are buffered, so pipelined commands are written in batch.
+func (tc *textConn) serve() {
+	for {
+		if tc.server.idleTimeout > 0 {
+			tc.conn.SetReadDeadline(time.Now().Add(tc.server.idleTimeout))
+		}
+
+		line, err := tc.readLine()
+		if errors.Is(err, errLineLength) {
+			tc.writeError(err)
+			tc.writer.Flush()
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		quit, err := tc.handle(line)
+		if err != nil {
+			return
+		}
+
+		if quit {
+			tc.writer.Flush()
+			return
+		}
+
+		if tc.reader.Buffered() > 0 {
+			continue
+		}
+
+		if err = tc.writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readLine reads a line without its line break.
+func (tc *textConn) readLine() (line []byte, err error) {
+	line, err = tc.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errLineLength
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// readData reads a data block of size and its line break.
+func (tc *textConn) readData(size int) (data []byte, err error) {
+	data = make([]byte, size+2)
+	if _, err = io.ReadFull(tc.reader, data); err != nil {
+		return nil, err
+	}
+
+	if data[size] != '\r' || data[size+1] != '\n' {
+		// The rest of the broken line is skipped, so it won't be treated as a command.
+		if data[size+1] != '\n' {
+			_, err = tc.reader.ReadBytes('\n')
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errBadChunk
+	}
+
+	return data[:size], nil
+}
+
+func (tc *textConn) writeLine(line string) {
+	tc.writer.WriteString(line)
+	tc.writer.WriteString("\r\n")
+}
+
+func (tc *textConn) writeError(err error) {
+	tc.writeLine("CLIENT_ERROR " + err.Error())
+}
+
+func (tc *textConn) writeStatusLine(line string, noreply bool) {
+	if !noreply {
+		tc.writeLine(line)
+	}
+}
+
+func (tc *textConn) writeStatus(st status, noreply bool) {
+	if !noreply {
+		tc.writeLine(textStatuses[st])
+	}
+}
+
+// handle handles a command line and reports if the connection should quit.
+// The returned error means the connection is broken.
+func (tc *textConn) handle(line []byte) (quit bool, err error) {
+	fields := strings.Fields(string(line))
+	if len(fields) <= 0 {
+		tc.writeLine("ERROR")
+		return false, nil
+	}
+
+	command, args := fields[0], fields[1:]
+	if mode, ok := textStoreModes[command]; ok {
+		return false, tc.handleStore(mode, args)
+	}
+
+	if command == "ms" {
+		return false, tc.handleMetaSet(args)
+	}
+
+	switch command {
+	case "get", "gets":
+		tc.handleGet(args, command == "gets")
+	case "gat", "gats":
+		tc.handleGetAndTouch(args, command == "gats")
+	case "delete":
+		tc.handleDelete(args)
+	case "incr", "decr":
+		tc.handleIncr(args, command == "decr")
+	case "touch":
+		tc.handleTouch(args)
+	case "flush_all":
+		tc.handleFlush(args)
+	case "mg":
+		tc.handleMetaGet(args)
+	case "md":
+		tc.handleMetaDelete(args)
+	case "ma":
+		tc.handleMetaArithmetic(args)
+	case "mn":
+		tc.writeLine("MN")
+	case "stats":
+		tc.handleStats(args)
+	case "version":
+		tc.writeLine("VERSION " + Version)
+	case "verbosity":
+		tc.writeStatusLine("OK", hasNoreply(args))
+	case "quit":
+		return true, nil
+	default:
+		tc.writeLine("ERROR")
+	}
+
+	return false, nil
+}
+
+// hasNoreply reports if the last argument is noreply.
+func hasNoreply(args []string) bool {
+	return len(args) > 0 && args[len(args)-1] == "noreply"
+}
+
+func validKeys(keys []string) bool {
+	for _, key := range keys {
+		if len(key) > maxKeyLength {
+			return false
+		}
+	}
+
+	return len(keys) > 0
+}
+
+func (tc *textConn) writeItem(key string, item *Item, withCAS bool) {
+	tc.writer.WriteString("VALUE ")
+	tc.writer.WriteString(key)
+	tc.writer.WriteByte(' ')
+	tc.writer.WriteString(strconv.FormatUint(uint64(item.Flags), 10))
+	tc.writer.WriteByte(' ')
+	tc.writer.WriteString(strconv.Itoa(len(item.Value)))
+
+	if withCAS {
+		tc.writer.WriteByte(' ')
+		tc.writer.WriteString(strconv.FormatUint(item.CAS, 10))
+	}
+
+	tc.writer.WriteString("\r\n")
+	tc.writer.Write(item.Value)
+	tc.writer.WriteString("\r\n")
+}
+
+// handleGet handles "get|gets <key>*".
+func (tc *textConn) handleGet(keys []string, withCAS bool) {
+	if !validKeys(keys) {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	for i, item := range tc.server.get(keys) {
+		if item != nil {
+			tc.writeItem(keys[i], item, withCAS)
+		}
+	}
+
+	tc.writeLine("END")
+}
+
+// handleGetAndTouch handles "gat|gats <exptime> <key>*".
+func (tc *textConn) handleGetAndTouch(args []string, withCAS bool) {
+	if len(args) < 2 || !validKeys(args[1:]) {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	exptime, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	for _, key := range args[1:] {
+		if item, st := tc.server.touch(key, exptime); st == statusTouched {
+			tc.writeItem(key, item, withCAS)
+		}
+	}
+
+	tc.writeLine("END")
+}
+
+// handleStore handles "<command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]".
+// The returned error means the data block can't be read.
+func (tc *textConn) handleStore(mode storeMode, args []string) error {
+	noreply := hasNoreply(args)
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	wantArgs := 4
+	if mode == modeCAS {
+		wantArgs = 5
+	}
+
+	if len(args) != wantArgs {
+		tc.writeError(errBadFormat)
+		return nil
+	}
+
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		tc.writeError(errBadFormat)
+		return nil
+	}
+
+	// The data block is always consumed, so the connection won't treat it as commands.
+	if size > tc.server.maxItemSize {
+		if _, err = io.CopyN(io.Discard, tc.reader, int64(size)+2); err != nil {
+			return err
+		}
+
+		tc.writeStatusLine("SERVER_ERROR object too large for cache", noreply)
+		return nil
+	}
+
+	data, err := tc.readData(size)
+	if errors.Is(err, errBadChunk) {
+		tc.writeError(err)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	key := args[0]
+	flags, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, exptimeErr := strconv.ParseInt(args[2], 10, 64)
+
+	var cas uint64
+	var casErr error
+	if mode == modeCAS {
+		cas, casErr = strconv.ParseUint(args[4], 10, 64)
+	}
+
+	if !validKeys([]string{key}) || flagsErr != nil || exptimeErr != nil || casErr != nil {
+		tc.writeError(errBadFormat)
+		return nil
+	}
+
+	item := &Item{Value: data, Flags: uint32(flags)}
+	tc.writeStatus(tc.server.store(mode, key, item, exptime, cas), noreply)
+	return nil
+}
+
+// handleDelete handles "delete <key> [0] [noreply]".
+func (tc *textConn) handleDelete(args []string) {
+	noreply := hasNoreply(args)
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	// The time argument is deprecated and only zero is allowed.
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+
+	if len(args) != 1 || !validKeys(args) {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	tc.writeStatus(tc.server.remove(args[0], 0), noreply)
+}
+
+// handleIncr handles "incr|decr <key> <value> [noreply]".
+func (tc *textConn) handleIncr(args []string, decr bool) {
+	noreply := hasNoreply(args)
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	if len(args) != 2 || !validKeys(args[:1]) {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		tc.writeError(errBadDelta)
+		return
+	}
+
+	value, st := tc.server.incr(args[0], delta, decr)
+	if st == statusStored {
+		tc.writeStatusLine(strconv.FormatUint(value, 10), noreply)
+		return
+	}
+
+	tc.writeStatus(st, noreply)
+}
+
+// handleTouch handles "touch <key> <exptime> [noreply]".
+func (tc *textConn) handleTouch(args []string) {
+	noreply := hasNoreply(args)
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	if len(args) != 2 || !validKeys(args[:1]) {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		tc.writeError(errBadFormat)
+		return
+	}
+
+	_, st := tc.server.touch(args[0], exptime)
+	tc.writeStatus(st, noreply)
+}
+
+// handleFlush handles "flush_all [delay] [noreply]".
+func (tc *textConn) handleFlush(args []string) {
+	noreply := hasNoreply(args)
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	var delay int64
+	if len(args) > 0 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || len(args) > 1 {
+			tc.writeError(errBadFormat)
+			return
+		}
+	}
+
+	tc.server.flush(time.Duration(delay) * time.Second)
+	tc.writeStatusLine("OK", noreply)
+}
+
+// handleStats handles "stats", and other groups of stats aren't supported.
+func (tc *textConn) handleStats(args []string) {
+	if len(args) > 0 {
+		tc.writeLine("ERROR")
+		return
+	}
+
+	for _, stat := range tc.server.listStats() {
+		tc.writeLine("STAT " + stat.name + " " + stat.value)
+	}
+
+	tc.writeLine("END")
+}
@@ -1,6 +1,8 @@
 package memcache
 
 import (
+	"io"
+	"math"
 	"math/bits"
 	"sync"
 	"time"
@@ -126,19 +128,215 @@ func (sc *shardingCache) MSet(keys []string, values []interface{}, ttls ...time.
 	for cache, mio := range cacheMap {
 		go func(cache Cache, mio MInOuput) {
 			defer wg.Done()
-			evictedValues = cache.MSet(mio.Keys, mio.Values, mio.Ttls...)
+			curEvicteds := cache.MSet(mio.Keys, mio.Values, mio.Ttls...)
+			for i, index := range mio.Indexes {
+				if i < len(curEvicteds) {
+					evictedValues[index] = curEvicteds[i]
+				}
+			}
 		}(cache, mio)
 	}
 	wg.Wait()
 	return evictedValues
 }
 
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (sc *shardingCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	return sc.cacheOf(key).SetWithTags(key, value, ttl, tags...)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (sc *shardingCache) InvalidateTag(tag string) (removed int) {
+	for _, cache := range sc.caches {
+		removed += cache.InvalidateTag(tag)
+	}
+
+	return removed
+}
+
 // Remove removes key and returns the removed value of key.
 // See Cache interface.
 func (sc *shardingCache) Remove(key string) (removedValue interface{}) {
 	return sc.cacheOf(key).Remove(key)
 }
 
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (sc *shardingCache) RemovePrefix(prefix string) (removed int) {
+	for _, cache := range sc.caches {
+		removed += cache.RemovePrefix(prefix)
+	}
+
+	return removed
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (sc *shardingCache) RemoveMatch(pattern string) (removed int) {
+	for _, cache := range sc.caches {
+		removed += cache.RemoveMatch(pattern)
+	}
+
+	return removed
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (sc *shardingCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	return sc.cacheOf(key).GetOrSet(key, value, ttl...)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (sc *shardingCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	return sc.cacheOf(key).CompareAndSwap(key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (sc *shardingCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	return sc.cacheOf(key).CompareAndDelete(key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (sc *shardingCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	return sc.cacheOf(key).Update(key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *shardingCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *shardingCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (sc *shardingCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	return sc.cacheOf(key).IncrBy(key, delta, ttl...)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (sc *shardingCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	return sc.cacheOf(key).IncrByFloat(key, delta, ttl...)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// Caches are ranged one by one, so only one of them is locked at the same time.
+// See Cache interface.
+func (sc *shardingCache) Range(fn RangeFunc) {
+	stopped := false
+	rangeFn := func(key string, value interface{}, ttl time.Duration) bool {
+		stopped = !fn(key, value, ttl)
+		return !stopped
+	}
+
+	for _, cache := range sc.caches {
+		if cache.Range(rangeFn); stopped {
+			return
+		}
+	}
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (sc *shardingCache) Keys() (keys []string) {
+	for _, cache := range sc.caches {
+		keys = append(keys, cache.Keys()...)
+	}
+
+	return keys
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// The high 32 bits of cursor is the index of cache and the low 32 bits is the cursor in cache.
+// See Cache interface.
+func (sc *shardingCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	index := int(cursor >> 32)
+	if index >= len(sc.caches) {
+		return nil, 0
+	}
+
+	// Count bounds the keys visited, so a call only scans one shard.
+	keys, next = sc.caches[index].Scan(cursor&math.MaxUint32, match, count)
+	if next > 0 {
+		return keys, uint64(index)<<32 | next
+	}
+
+	if index++; index < len(sc.caches) {
+		return keys, uint64(index) << 32
+	}
+
+	return keys, 0
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (sc *shardingCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(sc.config, sc, name, quota)
+}
+
+func (sc *shardingCache) watchNamespace(ns *namespace) {
+	for _, cache := range sc.caches {
+		watchNamespaceOf(cache, ns)
+	}
+}
+
+// evictPrefix evicts from the cache of skip first because it's the one which just got a new key.
+func (sc *shardingCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	first := sc.cacheOf(skip)
+	if evictPrefixOf(first, prefix, skip) {
+		return true
+	}
+
+	for _, cache := range sc.caches {
+		if cache != first && evictPrefixOf(cache, prefix, skip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sc *shardingCache) stateOf(key string) (state keyState, found bool) {
+	return stateOfCache(sc.cacheOf(key), key)
+}
+
+func (sc *shardingCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	return ttlOfCache(sc.cacheOf(key), key)
+}
+
+// Flush does nothing because cache has no store.
+// See Cache interface.
+func (sc *shardingCache) Flush() error {
+	return nil
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (sc *shardingCache) SaveSnapshot(w io.Writer) error {
+	return saveSnapshot(sc, sc.codec, w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (sc *shardingCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(sc, sc.codec, r)
+}
+
 // Size returns the count of keys in cache.
 // See Cache interface.
 func (sc *shardingCache) Size() (size int) {
@@ -156,6 +354,11 @@ func (sc *shardingCache) GC() (cleans int) {
 		cleans += cache.GC()
 	}
 
+	// Shards share one overflow, so it's cleaned once here.
+	if sc.overflow != nil {
+		cleans += sc.overflow.gc(sc.now())
+	}
+
 	return cleans
 }
 
@@ -165,6 +368,20 @@ func (sc *shardingCache) Reset() {
 	for _, cache := range sc.caches {
 		cache.Reset()
 	}
+
+	if sc.overflow != nil {
+		sc.overflow.reset()
+	}
+}
+
+// Close closes all caches in sharding cache.
+// See Cache interface.
+func (sc *shardingCache) Close() error {
+	for _, cache := range sc.caches {
+		cache.Close()
+	}
+
+	return nil
 }
 
 // Load loads a value by load function and sets it to cache.
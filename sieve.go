@@ -0,0 +1,547 @@
+package memcache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"time"
+)
+
+type sieveCache struct {
+	*config
+
+	elementMap  map[string]*list.Element
+	elementList *list.List
+
+	// hand points to the next element to check when evicting.
+	// It moves from back to front and wraps around.
+	hand  *list.Element
+	index *keyIndex
+	lock  sync.RWMutex
+}
+
+func newSieveCache(conf *config) Cache {
+	if conf.maxEntries <= 0 {
+		panic("cachego: sieve cache must specify max entries")
+	}
+
+	cache := &sieveCache{
+		config:      conf,
+		elementMap:  make(map[string]*list.Element, mapInitialCap),
+		elementList: list.New(),
+		index:       newKeyIndex(conf),
+	}
+
+	return cache
+}
+
+func (sc *sieveCache) unwrap(element *list.Element) *entry {
+	entry, ok := element.Value.(*entry)
+	if !ok {
+		panic("cachego: failed to unwrap sieve element's value to entry")
+	}
+
+	return entry
+}
+
+func (sc *sieveCache) evict() (evictedValue interface{}) {
+	element := sc.hand
+	if element == nil {
+		element = sc.elementList.Back()
+	}
+
+	for element != nil {
+		if sc.unwrap(element).unvisit() <= 0 {
+			break
+		}
+
+		element = element.Prev()
+		if element == nil {
+			element = sc.elementList.Back()
+		}
+	}
+
+	if element == nil {
+		return nil
+	}
+
+	sc.hand = element
+	return sc.removeElement(element)
+}
+
+func (sc *sieveCache) get(key string) (value interface{}, found bool) {
+	element, ok := sc.elementMap[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := sc.unwrap(element)
+	if entry.expired(0) {
+		return nil, false
+	}
+
+	entry.visit(1)
+	if entry.value == nil {
+		return nil, false
+	}
+
+	return *entry.value, true
+}
+
+func (sc *sieveCache) set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	curTtl := sc.ttlOf(value, ttl)
+
+	if element, ok := sc.elementMap[key]; ok {
+		entry := sc.unwrap(element)
+		sc.index.untagExpired(entry)
+		entry.setup(key, &value, curTtl)
+		entry.visit(1)
+		return nil
+	}
+
+	evictedValue = makeRoom(sc, sc.index, key, sc.size())
+
+	if sc.maxEntries > 0 && sc.elementList.Len() >= sc.maxEntries {
+		evictedValue = sc.evict()
+	}
+
+	sc.elementMap[key] = sc.elementList.PushFront(newEntry(key, &value, curTtl, sc.now))
+	sc.index.add(key)
+	sc.index.touch(key, 0)
+	return evictedValue
+}
+
+func (sc *sieveCache) entryOf(key string) *entry {
+	element, ok := sc.elementMap[key]
+	if !ok {
+		return nil
+	}
+
+	entry := sc.unwrap(element)
+	if entry.expired(0) {
+		return nil
+	}
+
+	entry.visit(1)
+	return entry
+}
+
+func (sc *sieveCache) removeElement(element *list.Element) (removedValue interface{}) {
+	entry := sc.unwrap(element)
+
+	if sc.hand == element {
+		sc.hand = element.Prev()
+	}
+
+	delete(sc.elementMap, entry.key)
+	sc.elementList.Remove(element)
+	sc.index.remove(entry.key)
+
+	return *entry.value
+}
+
+// evictKey evicts key chosen by namespaces or tenants, which is the same as removing it.
+func (sc *sieveCache) evictKey(key string) (evictedValue interface{}) {
+	return sc.remove(key)
+}
+
+func (sc *sieveCache) remove(key string) (removedValue interface{}) {
+	if element, ok := sc.elementMap[key]; ok {
+		return sc.removeElement(element)
+	}
+
+	return nil
+}
+
+func (sc *sieveCache) peek(key string) *entry {
+	if element, ok := sc.elementMap[key]; ok {
+		return sc.unwrap(element)
+	}
+
+	return nil
+}
+
+func (sc *sieveCache) walk(fn func(e *entry) bool) {
+	for element := sc.elementList.Front(); element != nil; element = element.Next() {
+		if !fn(sc.unwrap(element)) {
+			return
+		}
+	}
+}
+
+// walkCold walks entries from the back which is evicted first.
+func (sc *sieveCache) walkCold(fn func(e *entry, segment int) bool) {
+	for element := sc.elementList.Back(); element != nil; element = element.Prev() {
+		if !fn(sc.unwrap(element), 0) {
+			return
+		}
+	}
+}
+
+func (sc *sieveCache) size() (size int) {
+	return len(sc.elementMap)
+}
+
+func (sc *sieveCache) gc() (cleans int) {
+	now := sc.now()
+	scans := 0
+
+	for _, element := range sc.elementMap {
+		scans++
+
+		if entry := sc.unwrap(element); entry.expired(now) {
+			sc.removeElement(element)
+			cleans++
+		}
+
+		if sc.maxScans > 0 && scans >= sc.maxScans {
+			break
+		}
+	}
+
+	return cleans
+}
+
+func (sc *sieveCache) reset() {
+	sc.elementMap = make(map[string]*list.Element, mapInitialCap)
+	sc.elementList = list.New()
+	sc.hand = nil
+	sc.index = sc.index.renew(sc.config)
+}
+
+// Get gets the value of key from cache and returns value if found.
+// A hit only takes the read lock because sieve doesn't reorder entries.
+// See Cache interface.
+func (sc *sieveCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	sc.lock.RLock()
+	value, found = sc.get(key)
+	sc.lock.RUnlock()
+
+	if !found && sc.loadFunc != nil {
+		newVals, err := sc.loadFunc([]string{key}, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			sc.Set(key, newVals[0])
+		}
+	}
+
+	return value, found
+}
+
+// MGet gets the values of keys from cache and returns values with founds.
+// See Cache interface.
+func (sc *sieveCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	values = make([]interface{}, len(keys))
+	founds = make([]bool, len(keys))
+	mio := &MInOuput{}
+
+	sc.lock.RLock()
+	for i, key := range keys {
+		value, found := sc.get(key)
+		founds[i] = found
+
+		if !found {
+			mio.Keys = append(mio.Keys, key)
+			mio.Indexes = append(mio.Indexes, i)
+		} else {
+			values[i] = value
+		}
+	}
+	sc.lock.RUnlock()
+
+	if len(mio.Keys) > 0 && sc.loadFunc != nil {
+		newVals, err := sc.loadFunc(mio.Keys, deserializeF)
+		if err == nil && len(newVals) > 0 {
+			sc.lock.Lock()
+			defer sc.lock.Unlock()
+
+			// The load function may return fewer values than keys, and keys without values are missed.
+			for i, index := range mio.Indexes {
+				if i < len(newVals) {
+					values[index] = newVals[i]
+					sc.set(mio.Keys[i], newVals[i])
+				}
+			}
+		}
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to cache with ttl and returns evicted value if exists.
+// See Cache interface.
+func (sc *sieveCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.set(key, value, ttl...)
+}
+
+// MSet sets keys and values to cache with ttls and returns evicted values.
+// See Cache interface.
+func (sc *sieveCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	// Keys and values must have the same length, or nothing is set.
+	if len(keys) != len(values) {
+		return nil
+	}
+
+	for i := 0; i < len(keys); i++ {
+		if len(ttls) > i {
+			evictedValues = append(evictedValues, sc.set(keys[i], values[i], ttls[i]))
+		} else {
+			evictedValues = append(evictedValues, sc.set(keys[i], values[i]))
+		}
+	}
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and returns evicted value if exists.
+// See Cache interface.
+func (sc *sieveCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return setWithTags(sc, sc.index, key, value, ttl, tags)
+}
+
+// InvalidateTag removes all keys having tag and returns the count removed.
+// See Cache interface.
+func (sc *sieveCache) InvalidateTag(tag string) (removed int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return invalidateTag(sc, sc, sc.index, tag)
+}
+
+// Remove removes key and returns the removed value of key.
+// See Cache interface.
+func (sc *sieveCache) Remove(key string) (removedValue interface{}) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.remove(key)
+}
+
+// RemovePrefix removes all keys starting with prefix and returns the count removed.
+// See Cache interface.
+func (sc *sieveCache) RemovePrefix(prefix string) (removed int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return removeMatched(sc, sc, sc.index, prefix, func(key string) bool {
+		return true
+	})
+}
+
+// RemoveMatch removes all keys matching the glob pattern and returns the count removed.
+// See Cache interface.
+func (sc *sieveCache) RemoveMatch(pattern string) (removed int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return removeMatched(sc, sc, sc.index, literalPrefix(pattern), func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and returns it.
+// See Cache interface.
+func (sc *sieveCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return getOrSet(sc, key, value, ttl)
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and reports if swapped.
+// See Cache interface.
+func (sc *sieveCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return compareAndSwap(sc, key, oldValue, newValue)
+}
+
+// CompareAndDelete removes key if its value equals oldValue and reports if removed.
+// See Cache interface.
+func (sc *sieveCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return compareAndDelete(sc, key, oldValue)
+}
+
+// Update updates the value of key by fn atomically and returns the new value and if key is kept.
+// See Cache interface.
+func (sc *sieveCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return update(sc, key, fn)
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *sieveCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *sieveCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (sc *sieveCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return incrBy(sc, key, delta, ttl)
+}
+
+// IncrByFloat increases the value of key by delta atomically and returns the new value.
+// See Cache interface.
+func (sc *sieveCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return incrByFloat(sc, key, delta, ttl)
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (sc *sieveCache) Range(fn RangeFunc) {
+	sc.lock.RLock()
+	items := collect(sc, sc.now())
+	sc.lock.RUnlock()
+
+	rangeItems(items, fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (sc *sieveCache) Keys() (keys []string) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	now := sc.now()
+	sc.walk(func(e *entry) bool {
+		if _, found := valueOf(e); found && !e.expired(now) {
+			keys = append(keys, e.key)
+		}
+
+		return true
+	})
+
+	return keys
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (sc *sieveCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	return scan(sc, sc.index, sc.now(), cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (sc *sieveCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(sc.config, sc, name, quota)
+}
+
+func (sc *sieveCache) watchNamespace(ns *namespace) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	watchNamespace(sc, sc.index, ns)
+}
+
+func (sc *sieveCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return evictPrefix(sc, sc.index, prefix, skip)
+}
+
+// stateOf returns the state of key without recording an access.
+func (sc *sieveCache) stateOf(key string) (state keyState, found bool) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	element, ok := sc.elementMap[key]
+	if !ok {
+		return state, false
+	}
+
+	return stateOfEntry(sc.unwrap(element), sc.index)
+}
+
+// ttlOfKey returns the remaining ttl of key without recording an access.
+func (sc *sieveCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	return ttlOfEntry(sc.peek(key), sc.now())
+}
+
+// Flush does nothing because cache has no store.
+// See Cache interface.
+func (sc *sieveCache) Flush() error {
+	return nil
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (sc *sieveCache) SaveSnapshot(w io.Writer) error {
+	return saveSnapshot(sc, sc.codec, w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// See Cache interface.
+func (sc *sieveCache) LoadSnapshot(r io.Reader) error {
+	return loadSnapshot(sc, sc.codec, r)
+}
+
+// Size returns the count of keys in cache.
+// See Cache interface.
+func (sc *sieveCache) Size() (size int) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	return sc.size()
+}
+
+// GC cleans the expired keys in cache and returns the exact count cleaned.
+// See Cache interface.
+func (sc *sieveCache) GC() (cleans int) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.gc()
+}
+
+// Reset resets cache to initial status which is like a new cache.
+// See Cache interface.
+func (sc *sieveCache) Reset() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.reset()
+}
+
+// Close releases all entries in cache.
+// See Cache interface.
+func (sc *sieveCache) Close() error {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.reset()
+	return nil
+}
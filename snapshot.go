@@ -0,0 +1,289 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/task"
+)
+
+const (
+	snapshotMagic   = "MCSS"
+	snapshotVersion = 1
+
+	// maxSnapshotField limits the length of keys and values read from a snapshot,
+	// so a corrupted snapshot won't allocate too much memory.
+	maxSnapshotField = 1 << 30
+)
+
+// saveSnapshot writes all unexpired entries of cache with their remaining ttls to w.
+// The format of a snapshot is:
+//
+//	magic "MCSS" | version (1 byte) | count (uvarint) | entries | crc32 of all bytes above (4 bytes, big endian)
+//
+// And the format of an entry is:
+//
+//	key length (uvarint) | key | ttl in nanoseconds (varint, zero means NoTTL) | value length (uvarint) | value
+func saveSnapshot(cache Cache, codec Codec, w io.Writer) error {
+	var items []rangeItem
+	cache.Range(func(key string, value interface{}, ttl time.Duration) bool {
+		items = append(items, rangeItem{key: key, value: value, ttl: ttl})
+		return true
+	})
+
+	checksum := crc32.NewIEEE()
+	writer := bufio.NewWriter(io.MultiWriter(w, checksum))
+
+	var buffer [binary.MaxVarintLen64]byte
+	writeUvarint := func(x uint64) {
+		writer.Write(buffer[:binary.PutUvarint(buffer[:], x)])
+	}
+
+	writer.WriteString(snapshotMagic)
+	writer.WriteByte(snapshotVersion)
+	writeUvarint(uint64(len(items)))
+
+	for _, item := range items {
+		data, err := codec.Encode(item.value)
+		if err != nil {
+			return err
+		}
+
+		writeUvarint(uint64(len(item.key)))
+		writer.WriteString(item.key)
+		writer.Write(buffer[:binary.PutVarint(buffer[:], int64(item.ttl))])
+		writeUvarint(uint64(len(data)))
+		writer.Write(data)
+	}
+
+	// Errors of writing are kept by writer and returned by flushing.
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	binary.BigEndian.PutUint32(buffer[:4], checksum.Sum32())
+	_, err := w.Write(buffer[:4])
+	return err
+}
+
+// snapshotChecksum is the checksum of snapshots which is implemented by crc32.
+type snapshotChecksum interface {
+	io.Writer
+	Sum32() uint32
+}
+
+// snapshotReader reads a snapshot and computes its checksum.
+type snapshotReader struct {
+	reader   *bufio.Reader
+	checksum snapshotChecksum
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.reader.ReadByte()
+	if err == nil {
+		sr.checksum.Write([]byte{b})
+	}
+
+	return b, err
+}
+
+func (sr *snapshotReader) readFull(n uint64) ([]byte, error) {
+	if n > maxSnapshotField {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(sr.reader, data); err != nil {
+		return nil, err
+	}
+
+	sr.checksum.Write(data)
+	return data, nil
+}
+
+func readSnapshot(r io.Reader) (keys []string, ttls []time.Duration, values [][]byte, err error) {
+	sr := &snapshotReader{reader: bufio.NewReader(r), checksum: crc32.NewIEEE()}
+
+	magic, err := sr.readFull(uint64(len(snapshotMagic)))
+	if err != nil || string(magic) != snapshotMagic {
+		return nil, nil, nil, ErrSnapshotCorrupted
+	}
+
+	version, err := sr.ReadByte()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if version != snapshotVersion {
+		return nil, nil, nil, ErrSnapshotVersion
+	}
+
+	count, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for i := uint64(0); i < count; i++ {
+		length, err := binary.ReadUvarint(sr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		key, err := sr.readFull(length)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		ttl, err := binary.ReadVarint(sr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if length, err = binary.ReadUvarint(sr); err != nil {
+			return nil, nil, nil, err
+		}
+
+		value, err := sr.readFull(length)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		keys = append(keys, string(key))
+		ttls = append(ttls, time.Duration(ttl))
+		values = append(values, value)
+	}
+
+	var checksum [4]byte
+	if _, err = io.ReadFull(sr.reader, checksum[:]); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if binary.BigEndian.Uint32(checksum[:]) != sr.checksum.Sum32() {
+		return nil, nil, nil, ErrSnapshotCorrupted
+	}
+
+	return keys, ttls, values, nil
+}
+
+// loadSnapshot reads a snapshot from r and sets all entries to cache.
+// Nothing is set if the snapshot is corrupted.
+func loadSnapshot(cache Cache, codec Codec, r io.Reader) error {
+	keys, ttls, values, err := readSnapshot(r)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrSnapshotCorrupted
+	}
+
+	if err != nil {
+		return err
+	}
+
+	decoded := make([]interface{}, 0, len(values))
+	for i, value := range values {
+		value, err := codec.Decode(keys[i], value)
+		if err != nil {
+			return err
+		}
+
+		decoded = append(decoded, value)
+	}
+
+	for i, key := range keys {
+		cache.Set(key, decoded[i], ttls[i])
+	}
+
+	return nil
+}
+
+// SaveSnapshotFile saves the snapshot of cache to path.
+// The snapshot is written to a temporary file and renamed to path, so path always has a complete snapshot.
+func SaveSnapshotFile(cache Cache, path string) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err = cache.SaveSnapshot(file); err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// LoadSnapshotFile loads the snapshot of path to cache.
+func LoadSnapshotFile(cache Cache, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	return cache.LoadSnapshot(file)
+}
+
+// runSnapshotTask loads the snapshot of cache and runs a task saving snapshots periodically.
+// checkpoint is called before saving each snapshot if it's not nil, and the finish it returns is called after saving.
+// It returns a cancel function which cancels the task and saves the last snapshot.
+func runSnapshotTask(conf *config, cache Cache, checkpoint func() (finish func(saved bool))) (cancel func()) {
+	reportError := func(err error) {
+		if err != nil && conf.snapshotError != nil {
+			conf.snapshotError(err)
+		}
+	}
+
+	if err := LoadSnapshotFile(cache, conf.snapshotPath); !errors.Is(err, fs.ErrNotExist) {
+		reportError(err)
+	}
+
+	var lock sync.Mutex
+	save := func() {
+		lock.Lock()
+		defer lock.Unlock()
+
+		finish := func(saved bool) {}
+		if checkpoint != nil {
+			finish = checkpoint()
+		}
+
+		err := SaveSnapshotFile(cache, conf.snapshotPath)
+		finish(err == nil)
+		reportError(err)
+	}
+
+	ctx, cancelTask := context.WithCancel(context.Background())
+	if conf.snapshotDuration > 0 {
+		fn := func(ctx context.Context) {
+			save()
+		}
+
+		task.New(fn).Context(ctx).Duration(conf.snapshotDuration).Ticker(conf.newTicker).Start()
+	}
+
+	return func() {
+		cancelTask()
+		save()
+	}
+}
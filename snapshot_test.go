@@ -0,0 +1,152 @@
+package memcache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheSnapshot$
+func TestCacheSnapshot(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		fakeClock := clock.NewFake(time.Now())
+
+		cache := NewCache(withPolicy(16), WithShardings(2), WithGC(0), WithNow(fakeClock.Now))
+		cache.Set("key", "value", NoTTL)
+		cache.Set("ttl", 1, 10*time.Second)
+		cache.Set("expired", []byte("expired"), time.Second)
+		cache.Set("float", 1.5, NoTTL)
+
+		fakeClock.Advance(2 * time.Second)
+
+		var buffer bytes.Buffer
+		if err := cache.SaveSnapshot(&buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := NewCache(withPolicy(16), WithGC(0), WithNow(fakeClock.Now))
+		if err := loaded.LoadSnapshot(bytes.NewReader(buffer.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+
+		if size := loaded.Size(); size != 3 {
+			t.Fatalf("%s: size %d != 3", name, size)
+		}
+
+		for key, want := range map[string]interface{}{"key": "value", "ttl": 1, "float": 1.5} {
+			if value, found := loaded.Get(key, nil); !found || value != want {
+				t.Fatalf("%s: value %+v of %s != %+v", name, value, key, want)
+			}
+		}
+
+		loaded.Range(func(key string, value interface{}, ttl time.Duration) bool {
+			if key == "ttl" && ttl != 8*time.Second {
+				t.Fatalf("%s: ttl %s != 8s", name, ttl)
+			}
+
+			if key != "ttl" && ttl != NoTTL {
+				t.Fatalf("%s: ttl %s of %s != NoTTL", name, ttl, key)
+			}
+
+			return true
+		})
+
+		cache.Close()
+		loaded.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheSnapshotCorrupted$
+func TestCacheSnapshotCorrupted(t *testing.T) {
+	cache := NewCache(WithLRU(16), WithGC(0))
+	cache.Set("key", "value", NoTTL)
+	cache.Set("key1", "value1", NoTTL)
+
+	var buffer bytes.Buffer
+	if err := cache.SaveSnapshot(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := buffer.Bytes()
+
+	flipped := append([]byte(nil), snapshot...)
+	flipped[len(flipped)-6] ^= 0xFF
+
+	versioned := append([]byte(nil), snapshot...)
+	versioned[len(snapshotMagic)] = snapshotVersion + 1
+
+	testCases := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"flipped":   {data: flipped, err: ErrSnapshotCorrupted},
+		"truncated": {data: snapshot[:len(snapshot)-1], err: ErrSnapshotCorrupted},
+		"empty":     {data: nil, err: ErrSnapshotCorrupted},
+		"magic":     {data: []byte("JUNK"), err: ErrSnapshotCorrupted},
+		"version":   {data: versioned, err: ErrSnapshotVersion},
+	}
+
+	for name, testCase := range testCases {
+		loaded := NewCache(WithLRU(16), WithGC(0))
+		if err := loaded.LoadSnapshot(bytes.NewReader(testCase.data)); err != testCase.err {
+			t.Fatalf("%s: err %+v != %+v", name, err, testCase.err)
+		}
+
+		if size := loaded.Size(); size != 0 {
+			t.Fatalf("%s: size %d != 0", name, size)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheSnapshotFile$
+func TestCacheSnapshotFile(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	var errs []error
+	onError := func(err error) {
+		errs = append(errs, err)
+	}
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithNewTicker(fakeClock.NewTicker), WithSnapshot(path, time.Minute), WithSnapshotError(onError))
+	cache.Set("key", "value", NoTTL)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("err %+v should be not exist", err)
+	}
+
+	fakeClock.Advance(time.Minute)
+
+	loaded := NewCache(WithLRU(16), WithGC(0))
+	if err := LoadSnapshotFile(loaded, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, found := loaded.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	// The last snapshot is saved when closing and loaded when creating.
+	cache.Set("closed", 1, NoTTL)
+	cache.Close()
+
+	warm := NewCache(WithLRU(16), WithGC(0), WithSnapshot(path, 0), WithSnapshotError(onError))
+	if size := warm.Size(); size != 2 {
+		t.Fatalf("size %d != 2", size)
+	}
+
+	warm.Close()
+
+	matches, err := filepath.Glob(path + ".*.tmp")
+	if err != nil || len(matches) != 0 {
+		t.Fatalf("matches %+v, err %+v is wrong", matches, err)
+	}
+
+	if len(errs) != 0 {
+		t.Fatalf("errs %+v is wrong", errs)
+	}
+}
@@ -0,0 +1,645 @@
+package memcache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/task"
+)
+
+// Store is a backing store of cache, such as a database.
+// Cache loads keys missed from store, and writes keys set or removed to store.
+// See WithWriteThrough and WithWriteBehind.
+type Store interface {
+	// Load loads the value of key and returns found if key exists in store.
+	Load(key string) (value interface{}, found bool, err error)
+
+	// LoadBatch loads the values of keys and returns founds if keys exist in store.
+	LoadBatch(keys []string) (values []interface{}, founds []bool, err error)
+
+	// Store stores the value of key to store.
+	Store(key string, value interface{}) error
+
+	// StoreBatch stores the values of keys to store.
+	StoreBatch(keys []string, values []interface{}) error
+
+	// Delete deletes key from store.
+	Delete(key string) error
+
+	// DeleteBatch deletes keys from store.
+	DeleteBatch(keys []string) error
+}
+
+const (
+	// flushBackoff is the backoff before the first retry of a batch, and it doubles after each retry.
+	flushBackoff = 10 * time.Millisecond
+)
+
+// pendingWrite is a write of key which hasn't been flushed to store.
+type pendingWrite struct {
+	value   interface{}
+	deleted bool
+}
+
+// writeQueue coalesces writes of keys, so only the last write of a key is flushed to store.
+// Drained writes are kept in flushing until they're written, so keys being flushed are still visible.
+type writeQueue struct {
+	writes   map[string]pendingWrite
+	keys     []string
+	flushing map[string]pendingWrite
+	lock     sync.Mutex
+
+	// flushLock makes flushes run one by one, so an older write never overwrites a newer one.
+	flushLock sync.Mutex
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{
+		writes: make(map[string]pendingWrite, mapInitialCap),
+	}
+}
+
+func (wq *writeQueue) push(key string, write pendingWrite) {
+	wq.lock.Lock()
+	defer wq.lock.Unlock()
+
+	if _, ok := wq.writes[key]; !ok {
+		wq.keys = append(wq.keys, key)
+	}
+
+	wq.writes[key] = write
+}
+
+// pending returns the pending or flushing write of key and reports if it exists.
+func (wq *writeQueue) pending(key string) (write pendingWrite, ok bool) {
+	wq.lock.Lock()
+	defer wq.lock.Unlock()
+
+	if write, ok = wq.writes[key]; ok {
+		return write, true
+	}
+
+	write, ok = wq.flushing[key]
+	return write, ok
+}
+
+// drain returns all pending writes in order and moves them to flushing.
+// It should be called with flushLock held, and finish should be called after writing them.
+func (wq *writeQueue) drain() (keys []string, writes map[string]pendingWrite) {
+	wq.lock.Lock()
+	defer wq.lock.Unlock()
+
+	keys, writes = wq.keys, wq.writes
+	wq.keys = nil
+	wq.writes = make(map[string]pendingWrite, mapInitialCap)
+	wq.flushing = writes
+
+	return keys, writes
+}
+
+// finish removes keys from flushing after they're written or dropped.
+func (wq *writeQueue) finish(keys []string) {
+	wq.lock.Lock()
+	defer wq.lock.Unlock()
+
+	for _, key := range keys {
+		delete(wq.flushing, key)
+	}
+}
+
+// storeCache writes keys to store in write-through or write-behind mode, and loads keys missed from store.
+// Set, MSet, SetWithTags and Remove write store before updating cache in write-through mode,
+// and other writing methods write their results to store after updating cache.
+// Writes of a key hold its striped lock in write-through mode, so store and cache see them in the same order.
+// Cache isn't updated if writing store fails, and a key updated before failing is removed from cache.
+// Nil values are cached to protect store and never written to store.
+// RemovePrefix, RemoveMatch, InvalidateTag and Reset only remove keys from cache.
+type storeCache struct {
+	*config
+	cache Cache
+
+	// queue is nil in write-through mode.
+	queue *writeQueue
+
+	// locks is nil in write-behind mode.
+	locks *keyLocks
+}
+
+func newStoreCache(conf *config, cache Cache) *storeCache {
+	sc := &storeCache{
+		config: conf,
+		cache:  cache,
+	}
+
+	if conf.writeBehind {
+		sc.queue = newWriteQueue()
+	} else {
+		sc.locks = newKeyLocks(conf.hash)
+	}
+
+	return sc
+}
+
+// lock locks the striped locks of keys in write-through mode and returns a function unlocking them.
+func (sc *storeCache) lock(keys ...string) (unlock func()) {
+	if sc.locks == nil {
+		return func() {}
+	}
+
+	return sc.locks.lock(keys...)
+}
+
+// runFlushTask runs a task flushing pending writes to store and returns a cancel function to cancel the task.
+func (sc *storeCache) runFlushTask() (cancel func()) {
+	fn := func(ctx context.Context) {
+		sc.Flush()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	task.New(fn).Context(ctx).Duration(sc.flushDuration).Ticker(sc.newTicker).Start()
+
+	return cancel
+}
+
+// reportError reports err of keys to the store error function, or prints it if the function isn't set.
+func (sc *storeCache) reportError(keys []string, err error) {
+	if sc.storeError == nil {
+		fmt.Printf("cachego: store keys %v failed: %v\n", keys, err)
+		return
+	}
+
+	sc.storeError(keys, err)
+}
+
+// retry calls fn until it succeeds or has been retried flushRetries times.
+// It waits a backoff before each retry, which doubles each time and is at most flushDuration.
+func (sc *storeCache) retry(fn func() error) (err error) {
+	backoff := flushBackoff
+
+	for i := 0; i <= sc.flushRetries; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+
+			if backoff *= 2; backoff > sc.flushDuration {
+				backoff = sc.flushDuration
+			}
+		}
+
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// write writes value of key to store before updating cache, and reports if cache can be updated.
+func (sc *storeCache) write(key string, value interface{}) bool {
+	if value == nil || sc.queue != nil {
+		return true
+	}
+
+	if err := sc.store.Store(key, value); err != nil {
+		sc.reportError([]string{key}, err)
+		return false
+	}
+
+	return true
+}
+
+// writeBehind queues value of key if cache is in write-behind mode.
+func (sc *storeCache) writeBehind(key string, value interface{}) {
+	if value != nil && sc.queue != nil {
+		sc.queue.push(key, pendingWrite{value: value})
+	}
+}
+
+// persist writes value of key to store after updating cache.
+// Key is removed from cache if writing store fails, so cache never keeps a value which store doesn't have.
+func (sc *storeCache) persist(key string, value interface{}) {
+	if sc.queue != nil {
+		sc.writeBehind(key, value)
+		return
+	}
+
+	if !sc.write(key, value) {
+		sc.cache.Remove(key)
+	}
+}
+
+// delete deletes key from store in write-through mode, and reports if cache can be updated.
+func (sc *storeCache) delete(key string) bool {
+	if sc.queue != nil {
+		sc.queue.push(key, pendingWrite{deleted: true})
+		return true
+	}
+
+	if err := sc.store.Delete(key); err != nil {
+		sc.reportError([]string{key}, err)
+		return false
+	}
+
+	return true
+}
+
+// loadPending returns the value of key which hasn't been written to store, and ok is false if key has no pending write.
+// A pending write of key is newer than the value in store, so key shouldn't be loaded from store if ok is true.
+func (sc *storeCache) loadPending(key string) (value interface{}, found bool, ok bool) {
+	if sc.queue == nil {
+		return nil, false, false
+	}
+
+	write, ok := sc.queue.pending(key)
+	if !ok {
+		return nil, false, false
+	}
+
+	return write.value, !write.deleted, true
+}
+
+// load loads key from store and sets it to cache if found.
+func (sc *storeCache) load(key string) (value interface{}, found bool) {
+	if value, found, ok := sc.loadPending(key); ok {
+		return value, found
+	}
+
+	value, found, err := sc.store.Load(key)
+	if err != nil {
+		sc.reportError([]string{key}, err)
+		return nil, false
+	}
+
+	// A key set while loading is newer than the value loaded, so it isn't overwritten.
+	if found {
+		value, _ = sc.cache.GetOrSet(key, value)
+	}
+
+	return value, found
+}
+
+// Get gets the value of key from cache and loads it from store if missed.
+// See Cache interface.
+func (sc *storeCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	if value, found = sc.cache.Get(key, deserializeF); found {
+		return value, true
+	}
+
+	return sc.load(key)
+}
+
+// MGet gets the values of keys from cache and loads keys missed from store.
+// See Cache interface.
+func (sc *storeCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	values, founds = sc.cache.MGet(keys, deserializeF)
+
+	var missedKeys []string
+	var missedIndexes []int
+	for i, found := range founds {
+		if found {
+			continue
+		}
+
+		if value, found, ok := sc.loadPending(keys[i]); ok {
+			values[i], founds[i] = value, found
+			continue
+		}
+
+		missedKeys = append(missedKeys, keys[i])
+		missedIndexes = append(missedIndexes, i)
+	}
+
+	if len(missedKeys) <= 0 {
+		return values, founds
+	}
+
+	loadedValues, loadedFounds, err := sc.store.LoadBatch(missedKeys)
+	if err != nil {
+		sc.reportError(missedKeys, err)
+		return values, founds
+	}
+
+	// A store returning fewer results than keys means the rest aren't found.
+	for i, index := range missedIndexes {
+		if i < len(loadedFounds) && i < len(loadedValues) && loadedFounds[i] {
+			values[index], _ = sc.cache.GetOrSet(missedKeys[i], loadedValues[i])
+			founds[index] = true
+		}
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to cache with ttl and writes it to store.
+// See Cache interface.
+func (sc *storeCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	defer sc.lock(key)()
+
+	if !sc.write(key, value) {
+		return nil
+	}
+
+	evictedValue = sc.cache.Set(key, value, ttl...)
+	sc.writeBehind(key, value)
+
+	return evictedValue
+}
+
+// MSet sets keys and values to cache with ttls and writes them to store in one batch.
+// See Cache interface.
+func (sc *storeCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	// Keys and values must have the same length, or nothing is set.
+	if len(keys) != len(values) {
+		return nil
+	}
+
+	defer sc.lock(keys...)()
+
+	if sc.queue == nil {
+		var storeKeys []string
+		var storeValues []interface{}
+		for i, value := range values {
+			if value != nil {
+				storeKeys = append(storeKeys, keys[i])
+				storeValues = append(storeValues, value)
+			}
+		}
+
+		if len(storeKeys) > 0 {
+			if err := sc.store.StoreBatch(storeKeys, storeValues); err != nil {
+				sc.reportError(storeKeys, err)
+				return nil
+			}
+		}
+	}
+
+	evictedValues = sc.cache.MSet(keys, values, ttls...)
+	for i, key := range keys {
+		sc.writeBehind(key, values[i])
+	}
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value to cache with ttl and tags, and writes it to store.
+// See Cache interface.
+func (sc *storeCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	defer sc.lock(key)()
+
+	if !sc.write(key, value) {
+		return nil
+	}
+
+	evictedValue = sc.cache.SetWithTags(key, value, ttl, tags...)
+	sc.writeBehind(key, value)
+
+	return evictedValue
+}
+
+// InvalidateTag removes all keys having tag from cache and returns the count removed.
+// See Cache interface.
+func (sc *storeCache) InvalidateTag(tag string) (removed int) {
+	return sc.cache.InvalidateTag(tag)
+}
+
+// Remove removes key from cache and deletes it from store.
+// See Cache interface.
+func (sc *storeCache) Remove(key string) (removedValue interface{}) {
+	defer sc.lock(key)()
+
+	if !sc.delete(key) {
+		return nil
+	}
+
+	return sc.cache.Remove(key)
+}
+
+// RemovePrefix removes all keys starting with prefix from cache and returns the count removed.
+// See Cache interface.
+func (sc *storeCache) RemovePrefix(prefix string) (removed int) {
+	return sc.cache.RemovePrefix(prefix)
+}
+
+// RemoveMatch removes all keys matching the glob pattern from cache and returns the count removed.
+// See Cache interface.
+func (sc *storeCache) RemoveMatch(pattern string) (removed int) {
+	return sc.cache.RemoveMatch(pattern)
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to cache with ttl and writes it to store.
+// See Cache interface.
+func (sc *storeCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	defer sc.lock(key)()
+
+	actual, loaded = sc.cache.GetOrSet(key, value, ttl...)
+	if !loaded {
+		sc.persist(key, value)
+	}
+
+	return actual, loaded
+}
+
+// CompareAndSwap swaps the value of key to newValue if its value equals oldValue and writes it to store if swapped.
+// See Cache interface.
+func (sc *storeCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	defer sc.lock(key)()
+
+	swapped = sc.cache.CompareAndSwap(key, oldValue, newValue)
+	if swapped {
+		sc.persist(key, newValue)
+	}
+
+	return swapped
+}
+
+// CompareAndDelete removes key if its value equals oldValue and deletes it from store if removed.
+// See Cache interface.
+func (sc *storeCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	defer sc.lock(key)()
+
+	deleted = sc.cache.CompareAndDelete(key, oldValue)
+	if deleted {
+		sc.delete(key)
+	}
+
+	return deleted
+}
+
+// Update updates the value of key by fn atomically and writes the result to store.
+// See Cache interface.
+func (sc *storeCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	defer sc.lock(key)()
+
+	newValue, kept = sc.cache.Update(key, fn)
+	if kept {
+		sc.persist(key, newValue)
+	} else {
+		sc.delete(key)
+	}
+
+	return newValue, kept
+}
+
+// Incr increases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *storeCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key by 1 and returns the new value.
+// See Cache interface.
+func (sc *storeCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return sc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key by delta atomically and writes the new value to store.
+// See Cache interface.
+func (sc *storeCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	defer sc.lock(key)()
+
+	if value, err = sc.cache.IncrBy(key, delta, ttl...); err == nil {
+		sc.persist(key, value)
+	}
+
+	return value, err
+}
+
+// IncrByFloat increases the value of key by delta atomically and writes the new value to store.
+// See Cache interface.
+func (sc *storeCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	defer sc.lock(key)()
+
+	if value, err = sc.cache.IncrByFloat(key, delta, ttl...); err == nil {
+		sc.persist(key, value)
+	}
+
+	return value, err
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in cache until fn returns false.
+// See Cache interface.
+func (sc *storeCache) Range(fn RangeFunc) {
+	sc.cache.Range(fn)
+}
+
+// Keys returns all unexpired keys in cache.
+// See Cache interface.
+func (sc *storeCache) Keys() (keys []string) {
+	return sc.cache.Keys()
+}
+
+// Scan returns unexpired keys matching the glob pattern match from cursor and the next cursor.
+// See Cache interface.
+func (sc *storeCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	return sc.cache.Scan(cursor, match, count)
+}
+
+// Namespace returns a view of cache whose keys are prefixed with name.
+// See Cache interface.
+func (sc *storeCache) Namespace(name string, quota ...int) Cache {
+	return newNamespaceCache(sc.config, sc, name, quota)
+}
+
+func (sc *storeCache) watchNamespace(ns *namespace) {
+	watchNamespaceOf(sc.cache, ns)
+}
+
+func (sc *storeCache) evictPrefix(prefix string, skip string) (evicted bool) {
+	return evictPrefixOf(sc.cache, prefix, skip)
+}
+
+func (sc *storeCache) ttlOfKey(key string) (ttl time.Duration, found bool) {
+	return ttlOfCache(sc.cache, key)
+}
+
+// SaveSnapshot writes all unexpired entries with their remaining ttls to w.
+// See Cache interface.
+func (sc *storeCache) SaveSnapshot(w io.Writer) error {
+	return sc.cache.SaveSnapshot(w)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot from r and sets all entries to cache.
+// Entries loaded aren't written to store because they come from cache.
+// See Cache interface.
+func (sc *storeCache) LoadSnapshot(r io.Reader) error {
+	return sc.cache.LoadSnapshot(r)
+}
+
+// Size returns the count of keys in cache.
+// See Cache interface.
+func (sc *storeCache) Size() (size int) {
+	return sc.cache.Size()
+}
+
+// GC cleans the expired keys in cache and returns the exact count cleaned.
+// See Cache interface.
+func (sc *storeCache) GC() (cleans int) {
+	return sc.cache.GC()
+}
+
+// Reset resets cache to initial status which is like a new cache.
+// Pending writes are flushed first, and keys in store are kept.
+// See Cache interface.
+func (sc *storeCache) Reset() {
+	sc.Flush()
+	sc.cache.Reset()
+}
+
+// Flush writes all pending writes to store in batches and returns the last error.
+// Writes being flushed are still visible to Get and MGet until they're written.
+// Batches failed after retries are reported and dropped.
+// See Cache interface.
+func (sc *storeCache) Flush() (err error) {
+	if sc.queue == nil {
+		return nil
+	}
+
+	sc.queue.flushLock.Lock()
+	defer sc.queue.flushLock.Unlock()
+
+	keys, writes := sc.queue.drain()
+	for start := 0; start < len(keys); start += sc.flushBatch {
+		end := start + sc.flushBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var storeKeys, deleteKeys []string
+		var storeValues []interface{}
+		for _, key := range keys[start:end] {
+			if write := writes[key]; write.deleted {
+				deleteKeys = append(deleteKeys, key)
+			} else {
+				storeKeys = append(storeKeys, key)
+				storeValues = append(storeValues, write.value)
+			}
+		}
+
+		if len(storeKeys) > 0 {
+			if storeErr := sc.retry(func() error { return sc.store.StoreBatch(storeKeys, storeValues) }); storeErr != nil {
+				sc.reportError(storeKeys, storeErr)
+				err = storeErr
+			}
+		}
+
+		if len(deleteKeys) > 0 {
+			if deleteErr := sc.retry(func() error { return sc.store.DeleteBatch(deleteKeys) }); deleteErr != nil {
+				sc.reportError(deleteKeys, deleteErr)
+				err = deleteErr
+			}
+		}
+
+		sc.queue.finish(keys[start:end])
+	}
+
+	return err
+}
+
+// Close flushes all pending writes to store and closes cache.
+// See Cache interface.
+func (sc *storeCache) Close() error {
+	sc.Flush()
+	return sc.cache.Close()
+}
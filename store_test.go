@@ -0,0 +1,389 @@
+package memcache
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+var errTestStore = errors.New("memcache: test store error")
+
+// testStore is an in-memory store which can fail its next writes.
+type testStore struct {
+	data     map[string]interface{}
+	batches  int
+	failures int
+	lock     sync.Mutex
+
+	// storing is called before storing a batch if not nil.
+	storing func(keys []string)
+
+	// stored is called after storing a batch if not nil.
+	stored func(keys []string)
+}
+
+func newTestStore() *testStore {
+	return &testStore{data: make(map[string]interface{})}
+}
+
+func (ts *testStore) fail() error {
+	if ts.failures > 0 {
+		ts.failures--
+		return errTestStore
+	}
+
+	return nil
+}
+
+func (ts *testStore) get(key string) (value interface{}, found bool) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	value, found = ts.data[key]
+	return value, found
+}
+
+func (ts *testStore) Load(key string) (value interface{}, found bool, err error) {
+	value, found = ts.get(key)
+	return value, found, nil
+}
+
+func (ts *testStore) LoadBatch(keys []string) (values []interface{}, founds []bool, err error) {
+	for _, key := range keys {
+		value, found := ts.get(key)
+		values = append(values, value)
+		founds = append(founds, found)
+	}
+
+	return values, founds, nil
+}
+
+func (ts *testStore) Store(key string, value interface{}) error {
+	return ts.StoreBatch([]string{key}, []interface{}{value})
+}
+
+func (ts *testStore) StoreBatch(keys []string, values []interface{}) error {
+	if ts.storing != nil {
+		ts.storing(keys)
+	}
+
+	ts.lock.Lock()
+	if err := ts.fail(); err != nil {
+		ts.lock.Unlock()
+		return err
+	}
+
+	ts.batches++
+	for i, key := range keys {
+		ts.data[key] = values[i]
+	}
+
+	ts.lock.Unlock()
+
+	if ts.stored != nil {
+		ts.stored(keys)
+	}
+
+	return nil
+}
+
+func (ts *testStore) Delete(key string) error {
+	return ts.DeleteBatch([]string{key})
+}
+
+func (ts *testStore) DeleteBatch(keys []string) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if err := ts.fail(); err != nil {
+		return err
+	}
+
+	ts.batches++
+	for _, key := range keys {
+		delete(ts.data, key)
+	}
+
+	return nil
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheWriteThrough$
+func TestCacheWriteThrough(t *testing.T) {
+	store := newTestStore()
+	store.data["db"] = "loaded"
+
+	var failedKeys []string
+	cache := NewCache(WithLRU(16), WithGC(0), WithWriteThrough(store), WithStoreError(func(keys []string, err error) {
+		failedKeys = append(failedKeys, keys...)
+	}))
+
+	cache.Set("key", 1, NoTTL)
+	if value, found := store.get("key"); !found || value != 1 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	// A failed write shouldn't update cache.
+	store.failures = 1
+	cache.Set("key", 2, NoTTL)
+
+	if value, found := cache.Get("key", nil); !found || value != 1 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	if len(failedKeys) != 1 || failedKeys[0] != "key" {
+		t.Fatalf("failedKeys %+v is wrong", failedKeys)
+	}
+
+	cache.MSet([]string{"k1", "k2"}, []interface{}{1, 2}, NoTTL)
+	if value, found := store.get("k2"); !found || value != 2 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	if value, err := cache.Incr("k1"); err != nil || value != 2 {
+		t.Fatalf("value %+v, err %+v is wrong", value, err)
+	}
+
+	if value, found := store.get("k1"); !found || value != int64(2) {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	cache.Remove("k2")
+	if _, found := store.get("k2"); found {
+		t.Fatal("k2 should be deleted from store")
+	}
+
+	// Keys missed are loaded from store.
+	if value, found := cache.Get("db", nil); !found || value != "loaded" {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	store.data["db2"] = "loaded2"
+	values, founds := cache.MGet([]string{"db2", "k2"}, nil)
+	if values[0] != "loaded2" || !founds[0] || founds[1] {
+		t.Fatalf("values %+v, founds %+v is wrong", values, founds)
+	}
+
+	if size := cache.Size(); size != 4 {
+		t.Fatalf("size %d != 4", size)
+	}
+
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// shortStore is a test store returning fewer results than keys in LoadBatch.
+type shortStore struct {
+	*testStore
+}
+
+func (ss shortStore) LoadBatch(keys []string) (values []interface{}, founds []bool, err error) {
+	return ss.testStore.LoadBatch(keys[:1])
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheWriteThroughFailures$
+func TestCacheWriteThroughFailures(t *testing.T) {
+	store := newTestStore()
+	store.data["db1"] = "loaded1"
+	store.data["db2"] = "loaded2"
+
+	var failedKeys []string
+	cache := NewCache(WithLRU(16), WithGC(0), WithWriteThrough(shortStore{store}), WithStoreError(func(keys []string, err error) {
+		failedKeys = append(failedKeys, keys...)
+	}))
+
+	// Keys missing in a short batch aren't found.
+	values, founds := cache.MGet([]string{"db1", "db2"}, nil)
+	if values[0] != "loaded1" || !founds[0] || founds[1] {
+		t.Fatalf("values %+v, founds %+v is wrong", values, founds)
+	}
+
+	// A key updated before failing to write store is removed from cache.
+	cache.Set("counter", 1, NoTTL)
+
+	store.failures = 1
+	if _, err := cache.Incr("counter"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failedKeys) != 1 || failedKeys[0] != "counter" {
+		t.Fatalf("failedKeys %+v is wrong", failedKeys)
+	}
+
+	if value, found := cache.Get("counter", nil); !found || value != 1 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+}
+
+// go test -v -cover -count=1 -run=^TestCacheWriteThroughOrder$
+func TestCacheWriteThroughOrder(t *testing.T) {
+	// Writes returning from store in random order would update cache in another order without locks.
+	random := rand.New(rand.NewSource(1))
+	var randomLock sync.Mutex
+
+	store := newTestStore()
+	store.stored = func(keys []string) {
+		randomLock.Lock()
+		delay := time.Duration(random.Intn(100)) * time.Microsecond
+		randomLock.Unlock()
+
+		time.Sleep(delay)
+	}
+
+	cache := NewCache(WithLRU(16), WithGC(0), WithWriteThrough(store))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if j%2 == 0 {
+					cache.Set("key", i*100+j, NoTTL)
+				} else {
+					cache.MSet([]string{"other", "key"}, []interface{}{j, i*100 + j}, NoTTL, NoTTL)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Store and cache should see writes of key in the same order.
+	stored, _ := store.get("key")
+	if value, _ := cache.Get("key", nil); value != stored {
+		t.Fatalf("value %+v != stored %+v", value, stored)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheWriteBehind$
+func TestCacheWriteBehind(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	store := newTestStore()
+	store.data["removed"] = "stale"
+
+	cache := NewCache(WithLRU(1024), WithGC(0), WithNewTicker(fakeClock.NewTicker), WithWriteBehind(store, time.Second, 10, 2))
+
+	for i := 0; i < 25; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, NoTTL)
+		cache.Set("key"+strconv.Itoa(i), i*10, NoTTL)
+	}
+
+	cache.Remove("removed")
+
+	if _, found := store.get("key0"); found {
+		t.Fatal("key0 shouldn't be written before flushing")
+	}
+
+	// The deleted key hasn't been flushed, so it shouldn't be loaded from store.
+	if _, found := cache.Get("removed", nil); found {
+		t.Fatal("removed shouldn't be found")
+	}
+
+	fakeClock.Advance(time.Second)
+
+	// Writes of the same key are coalesced into 3 batches, and the deletion takes one more batch.
+	if store.batches != 4 {
+		t.Fatalf("store.batches %d != 4", store.batches)
+	}
+
+	var keys []string
+	for key, value := range store.data {
+		keys = append(keys, key)
+
+		i, _ := strconv.Atoi(key[len("key"):])
+		if value != i*10 {
+			t.Fatalf("value %+v of %s is wrong", value, key)
+		}
+	}
+
+	sort.Strings(keys)
+	if len(keys) != 25 {
+		t.Fatalf("keys %+v are wrong", keys)
+	}
+
+	// A batch is retried before being dropped.
+	store.failures = 2
+	cache.Set("retried", 1, NoTTL)
+
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, found := store.get("retried"); !found || value != 1 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+
+	store.failures = 3
+	cache.Set("dropped", 1, NoTTL)
+
+	if err := cache.Flush(); err != errTestStore {
+		t.Fatalf("err %+v != errTestStore", err)
+	}
+
+	if _, found := store.get("dropped"); found {
+		t.Fatal("dropped shouldn't be written")
+	}
+
+	// Pending writes are flushed when closing.
+	cache.Set("closed", 1, NoTTL)
+	cache.Close()
+
+	if value, found := store.get("closed"); !found || value != 1 {
+		t.Fatalf("value %+v, found %+v is wrong", value, found)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestCacheWriteBehindPending$
+func TestCacheWriteBehindPending(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	store := newTestStore()
+	store.data["key"] = "stale"
+
+	cache := NewCache(WithLRU(1), WithGC(0), WithNewTicker(fakeClock.NewTicker), WithWriteBehind(store, time.Second, 10, 2))
+	defer cache.Close()
+
+	// Key is evicted before being flushed, so its pending value should be returned instead of the stale one in store.
+	cache.Set("key", "new", NoTTL)
+	cache.Set("other", "value", NoTTL)
+
+	if value, found := cache.Get("key", nil); !found || value != "new" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	values, founds := cache.MGet([]string{"other", "key"}, nil)
+	if !founds[0] || !founds[1] || values[1] != "new" {
+		t.Fatalf("values %+v or founds %+v is wrong", values, founds)
+	}
+
+	// Keys being flushed are still visible until they're written.
+	cache.Set("flushing", "new", NoTTL)
+	cache.Set("evicted", "value", NoTTL)
+
+	var flushing []interface{}
+	store.storing = func(keys []string) {
+		value, _ := cache.Get("flushing", nil)
+		flushing = append(flushing, value)
+	}
+
+	store.failures = 1
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(flushing) != 2 || flushing[0] != "new" || flushing[1] != "new" {
+		t.Fatalf("flushing %+v is wrong", flushing)
+	}
+
+	if len(cache.MSet([]string{"a", "b"}, []interface{}{1})) != 0 {
+		t.Fatal("keys and values with different lengths shouldn't be set")
+	}
+}
@@ -0,0 +1,266 @@
+package memcache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// TenantFunc returns the tenant of key.
+type TenantFunc func(key string) (tenant string)
+
+// TenantShare is the share of a tenant in the max entries of cache, and it's counted by entries instead of their costs.
+// Min and Max are fractions of max entries in [0, 1], and the max entries of each sharding are shared separately.
+// Keys of a tenant under its Min are protected from being evicted by other tenants,
+// and a tenant can't hold more than Max of cache because it evicts its own keys first.
+// A zero Max means no limit.
+type TenantShare struct {
+	Tenant string
+	Min    float64
+	Max    float64
+}
+
+// TenantStats is the stats of a tenant.
+type TenantStats struct {
+	Tenant       string
+	Size         int
+	HitCount     uint64
+	MissedCount  uint64
+	EvictedCount uint64
+}
+
+// HitRate returns the hit rate of tenant.
+func (ts TenantStats) HitRate() float64 {
+	total := ts.HitCount + ts.MissedCount
+	if total <= 0 {
+		return 0.0
+	}
+
+	return float64(ts.HitCount) / float64(total)
+}
+
+type tenantCounter struct {
+	size         int64
+	hitCount     uint64
+	missedCount  uint64
+	evictedCount uint64
+}
+
+// tenantRegistry stores shares and stats of all tenants in cache.
+type tenantRegistry struct {
+	tenantOf     TenantFunc
+	shares       map[string]TenantShare
+	defaultShare TenantShare
+
+	counters map[string]*tenantCounter
+	lock     sync.RWMutex
+}
+
+// newTenantRegistry creates a registry with shares, and a share with empty tenant is the default one of tenants.
+func newTenantRegistry(tenantOf TenantFunc, shares []TenantShare) *tenantRegistry {
+	tr := &tenantRegistry{
+		tenantOf: tenantOf,
+		shares:   make(map[string]TenantShare, len(shares)),
+		counters: make(map[string]*tenantCounter),
+	}
+
+	for _, share := range shares {
+		if share.Tenant == "" {
+			tr.defaultShare = share
+			continue
+		}
+
+		tr.shares[share.Tenant] = share
+	}
+
+	return tr
+}
+
+func (tr *tenantRegistry) shareOf(tenant string) TenantShare {
+	if share, ok := tr.shares[tenant]; ok {
+		return share
+	}
+
+	return tr.defaultShare
+}
+
+func (tr *tenantRegistry) counterOf(tenant string) *tenantCounter {
+	tr.lock.RLock()
+	counter, ok := tr.counters[tenant]
+	tr.lock.RUnlock()
+
+	if ok {
+		return counter
+	}
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	if counter, ok = tr.counters[tenant]; !ok {
+		counter = new(tenantCounter)
+		tr.counters[tenant] = counter
+	}
+
+	return counter
+}
+
+func (tr *tenantRegistry) record(key string, found bool, recordHit bool, recordMissed bool) {
+	if found && recordHit {
+		atomic.AddUint64(&tr.counterOf(tr.tenantOf(key)).hitCount, 1)
+	}
+
+	if !found && recordMissed {
+		atomic.AddUint64(&tr.counterOf(tr.tenantOf(key)).missedCount, 1)
+	}
+}
+
+func (tr *tenantRegistry) stats() []TenantStats {
+	tr.lock.RLock()
+	defer tr.lock.RUnlock()
+
+	stats := make([]TenantStats, 0, len(tr.counters))
+	for tenant, counter := range tr.counters {
+		stats = append(stats, TenantStats{
+			Tenant:       tenant,
+			Size:         int(atomic.LoadInt64(&counter.size)),
+			HitCount:     atomic.LoadUint64(&counter.hitCount),
+			MissedCount:  atomic.LoadUint64(&counter.missedCount),
+			EvictedCount: atomic.LoadUint64(&counter.evictedCount),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Tenant < stats[j].Tenant
+	})
+
+	return stats
+}
+
+// tenantIndex counts keys of tenants in one cache and keeps keys of each tenant in a cold list for evicting.
+// It should be used with the lock of cache held.
+type tenantIndex struct {
+	*tenantRegistry
+
+	maxEntries int
+	counts     map[string]int
+	colds      map[string]*coldList
+}
+
+func newTenantIndex(conf *config) *tenantIndex {
+	return &tenantIndex{
+		tenantRegistry: conf.tenants,
+		maxEntries:     conf.maxEntries,
+		counts:         make(map[string]int),
+		colds:          make(map[string]*coldList),
+	}
+}
+
+func (ti *tenantIndex) count(key string, delta int) {
+	tenant := ti.tenantOf(key)
+
+	ti.counts[tenant] += delta
+	if ti.counts[tenant] <= 0 {
+		delete(ti.counts, tenant)
+	}
+
+	atomic.AddInt64(&ti.counterOf(tenant).size, int64(delta))
+}
+
+// touch moves key to the front of segment in the cold list of its tenant, see keyIndex.touch.
+func (ti *tenantIndex) touch(key string, segment int, stamp uint64) {
+	tenant := ti.tenantOf(key)
+
+	cold, ok := ti.colds[tenant]
+	if !ok {
+		cold = newColdList()
+		ti.colds[tenant] = cold
+	}
+
+	cold.touch(key, segment, stamp)
+}
+
+func (ti *tenantIndex) remove(key string) {
+	tenant := ti.tenantOf(key)
+
+	if cold, ok := ti.colds[tenant]; ok {
+		cold.remove(key)
+
+		if len(cold.elements) <= 0 {
+			delete(ti.colds, tenant)
+		}
+	}
+}
+
+// release releases all keys counted by index from stats of tenants.
+func (ti *tenantIndex) release() {
+	for tenant, count := range ti.counts {
+		atomic.AddInt64(&ti.counterOf(tenant).size, -int64(count))
+	}
+
+	ti.counts = make(map[string]int)
+}
+
+// minOf returns the count of keys of tenant which are protected.
+func (ti *tenantIndex) minOf(tenant string) int {
+	return int(ti.shareOf(tenant).Min * float64(ti.maxEntries))
+}
+
+// maxOf returns the max count of keys of tenant, and zero means no limit.
+func (ti *tenantIndex) maxOf(tenant string) int {
+	share := ti.shareOf(tenant)
+	if share.Max <= 0 || share.Max >= 1 {
+		return 0
+	}
+
+	if maxCount := int(share.Max * float64(ti.maxEntries)); maxCount > 0 {
+		return maxCount
+	}
+
+	return 1
+}
+
+// makeRoom evicts a key before adding key to cache with size and returns the evicted value.
+// If the tenant of key reaches its max share, its coldest key is evicted.
+// Otherwise, if cache is full, the coldest key of tenants over their min share is evicted.
+// Only the coldest keys of tenants are compared, so it doesn't walk all keys of cache.
+// It does nothing if no key can be evicted, and cache will evict by its policy.
+// It should be called with the lock held.
+func (ti *tenantIndex) makeRoom(ke keyEvictor, key string, size int) (evictedValue interface{}) {
+	tenant := ti.tenantOf(key)
+
+	var victim *coldElement
+	victimTenant := ""
+
+	if maxCount := ti.maxOf(tenant); maxCount > 0 && ti.counts[tenant] >= maxCount {
+		if cold, ok := ti.colds[tenant]; ok {
+			victim, victimTenant = cold.coldest(""), tenant
+		}
+	} else if ti.maxEntries > 0 && size >= ti.maxEntries {
+		for tenantOfKey, cold := range ti.colds {
+			if ti.counts[tenantOfKey] <= ti.minOf(tenantOfKey) {
+				continue
+			}
+
+			if ce := cold.coldest(""); ce != nil && (victim == nil || ce.colder(victim)) {
+				victim, victimTenant = ce, tenantOfKey
+			}
+		}
+	}
+
+	if victim == nil {
+		return nil
+	}
+
+	atomic.AddUint64(&ti.counterOf(victimTenant).evictedCount, 1)
+	return ke.evictKey(victim.key)
+}
+
+// makeRoom evicts a key for adding key by shares of tenants if cache has tenants.
+// It should be called with the lock held before adding a new key.
+func makeRoom(ke keyEvictor, index *keyIndex, key string, size int) (evictedValue interface{}) {
+	if index.tenants == nil {
+		return nil
+	}
+
+	return index.tenants.makeRoom(ke, key, size)
+}
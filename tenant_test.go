@@ -0,0 +1,189 @@
+package memcache
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testTenantOf(key string) string {
+	return key[:strings.IndexByte(key, ':')]
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTenantsFairEviction$
+func TestTenantsFairEviction(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		cache, reporter := NewCacheWithReport(withPolicy(100), WithGC(0), WithTenants(testTenantOf, TenantShare{Tenant: "quiet", Min: 0.3}))
+
+		for i := 0; i < 20; i++ {
+			cache.Set("quiet:"+strconv.Itoa(i), i, NoTTL)
+		}
+
+		// The noisy tenant can only evict its own keys because the quiet one is under its min share.
+		for i := 0; i < 1000; i++ {
+			cache.Set("noisy:"+strconv.Itoa(i), i, NoTTL)
+		}
+
+		for i := 0; i < 20; i++ {
+			if _, found := cache.Get("quiet:"+strconv.Itoa(i), nil); !found {
+				t.Fatalf("%s: quiet:%d should be found", name, i)
+			}
+		}
+
+		stats := reporter.Tenants()
+		if len(stats) != 2 {
+			t.Fatalf("%s: len(stats) %d != 2", name, len(stats))
+		}
+
+		if want := (TenantStats{Tenant: "noisy", Size: 80, EvictedCount: 920}); stats[0] != want {
+			t.Fatalf("%s: stats %+v != %+v", name, stats[0], want)
+		}
+
+		if want := (TenantStats{Tenant: "quiet", Size: 20, HitCount: 20}); stats[1] != want {
+			t.Fatalf("%s: stats %+v != %+v", name, stats[1], want)
+		}
+
+		cache.Reset()
+
+		if stats = reporter.Tenants(); stats[0].Size != 0 || stats[1].Size != 0 {
+			t.Fatalf("%s: stats %+v should have zero sizes", name, stats)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTenantsMaxShare$
+func TestTenantsMaxShare(t *testing.T) {
+	for name, withPolicy := range testPolicies {
+		shares := []TenantShare{{Max: 0.5}, {Tenant: "vip", Max: 0}}
+		cache, reporter := NewCacheWithReport(withPolicy(100), WithShardings(2), WithGC(0), WithTenants(testTenantOf, shares...))
+
+		for i := 0; i < 1000; i++ {
+			cache.Set("a:"+strconv.Itoa(i), i, NoTTL)
+			cache.Set("b:"+strconv.Itoa(i%30), i, NoTTL)
+		}
+
+		// Each sharding holds at most 50 keys of a, and b takes the rest.
+		for _, stats := range reporter.Tenants() {
+			if stats.Tenant == "a" && stats.Size != 100 {
+				t.Fatalf("%s: stats %+v should have size 100", name, stats)
+			}
+
+			if stats.Tenant == "b" && stats.Size != 30 {
+				t.Fatalf("%s: stats %+v should have size 30", name, stats)
+			}
+		}
+
+		if _, found := cache.Get("a:999", nil); !found {
+			t.Fatalf("%s: a:999 should be found", name)
+		}
+
+		for i := 0; i < 150; i++ {
+			cache.Set("vip:"+strconv.Itoa(i), i, NoTTL)
+		}
+
+		if size := cache.Size(); size != 200 {
+			t.Fatalf("%s: size %d != 200", name, size)
+		}
+
+		cache.Close()
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTenantsColdList$
+func TestTenantsColdList(t *testing.T) {
+	for name, cacheType := range map[string]CacheType{"lru": lru, "arc": arc, "s3fifo": s3fifo, "sieve": sieve} {
+		conf := newDefaultConfig()
+		conf.cacheType = cacheType
+		conf.maxEntries = 32
+		conf.tenants = newTenantRegistry(testTenantOf, []TenantShare{{Tenant: "a", Min: 0.25}, {Tenant: "b", Max: 0.25}})
+
+		cache := newCaches[cacheType](conf)
+
+		var index *keyIndex
+		switch c := cache.(type) {
+		case *lruCache:
+			index = c.index
+		case *arcCache:
+			index = c.index
+		case *s3fifoCache:
+			index = c.index
+		case *sieveCache:
+			index = c.index
+		}
+
+		// The cold list of each tenant should have the same order as walking cache from the coldest key.
+		check := func(i int) {
+			want := map[string][]string{}
+			cache.(coldWalkableCache).walkCold(func(e *entry, segment int) bool {
+				tenant := testTenantOf(e.key)
+				want[tenant] = append(want[tenant], e.key)
+				return true
+			})
+
+			got := map[string][]string{}
+			for tenant, cold := range index.tenants.colds {
+				for _, segment := range cold.segments {
+					for element := segment.Back(); element != nil; element = element.Prev() {
+						got[tenant] = append(got[tenant], element.Value.(*coldElement).key)
+					}
+				}
+			}
+
+			for _, tenant := range []string{"a", "b", "c"} {
+				if strings.Join(got[tenant], ",") != strings.Join(want[tenant], ",") {
+					t.Fatalf("%s: %d: cold list of %s %v != %v", name, i, tenant, got[tenant], want[tenant])
+				}
+			}
+		}
+
+		for i := 0; i < 300; i++ {
+			cache.Set("a:"+strconv.Itoa(i%13), i, NoTTL)
+			cache.Set("b:"+strconv.Itoa(i%17), i, NoTTL)
+			cache.Set("c:"+strconv.Itoa(i%29), i, NoTTL)
+			cache.Get("a:"+strconv.Itoa(i%5), nil)
+			cache.Get("c:"+strconv.Itoa(i%3), nil)
+
+			if i%7 == 0 {
+				cache.Remove("c:" + strconv.Itoa(i%11))
+			}
+
+			check(i)
+		}
+
+		if count := index.tenants.counts["b"]; count != 8 {
+			t.Fatalf("%s: count of b %d != 8", name, count)
+		}
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTenantsOverflow$
+func TestTenantsOverflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overflow")
+	cache := NewCache(WithLRU(100), WithGC(0), WithOverflow(path, 1024*1024), WithTenants(testTenantOf, TenantShare{Tenant: "small", Max: 0.05}))
+	defer cache.Close()
+
+	// Keys evicted by tenant shares and namespace quotas are spilled to overflow like keys evicted by lru.
+	for i := 0; i < 20; i++ {
+		cache.Set("small:"+strconv.Itoa(i), i, NoTTL)
+	}
+
+	users := cache.Namespace("user", 3)
+	for i := 0; i < 10; i++ {
+		users.Set(strconv.Itoa(i), i, NoTTL)
+	}
+
+	for i := 0; i < 20; i++ {
+		if value, found := cache.Get("small:"+strconv.Itoa(i), nil); !found || value != i {
+			t.Fatalf("small:%d: value %+v is wrong or not found", i, value)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if value, found := cache.Get("user:"+strconv.Itoa(i), nil); !found || value != i {
+			t.Fatalf("user:%d: value %+v is wrong or not found", i, value)
+		}
+	}
+}
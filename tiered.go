@@ -0,0 +1,600 @@
+package memcache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/singleflight"
+)
+
+const (
+	// defaultL1TTL is the default max ttl of keys in l1 cache.
+	defaultL1TTL = 10 * time.Second
+)
+
+// TieredLoadFunc loads the value of key with its ttl when key is missed in both l1 and l2.
+type TieredLoadFunc func(key string) (value interface{}, ttl time.Duration, err error)
+
+type tieredConfig struct {
+	l1TTL       time.Duration
+	load        TieredLoadFunc
+	bus         InvalidationBus
+	tieredError func(keys []string, err error)
+}
+
+func newDefaultTieredConfig() *tieredConfig {
+	return &tieredConfig{
+		l1TTL:       defaultL1TTL,
+		load:        nil,
+		bus:         nil,
+		tieredError: nil,
+	}
+}
+
+// TieredOption applies to tiered config and sets some values to it.
+type TieredOption func(conf *tieredConfig)
+
+func (to TieredOption) applyTo(conf *tieredConfig) {
+	to(conf)
+}
+
+func applyTieredOptions(conf *tieredConfig, opts []TieredOption) {
+	for _, opt := range opts {
+		opt.applyTo(conf)
+	}
+}
+
+// WithTieredL1TTL returns an option setting the max ttl of keys in l1 cache.
+// Keys in l1 may be stale for this ttl if their invalidations are lost, so it should be short.
+// Keys read from l2 also live in l1 no longer than their remaining ttls in l2, unless l2 can't tell them like a remote one.
+func WithTieredL1TTL(ttl time.Duration) TieredOption {
+	return func(conf *tieredConfig) {
+		if ttl > 0 {
+			conf.l1TTL = ttl
+		}
+	}
+}
+
+// WithTieredLoad returns an option setting the function loading keys missed in both l1 and l2.
+// Loaded keys are set to l2 with their ttls and to l1, and load is called in singleflight mode.
+func WithTieredLoad(load TieredLoadFunc) TieredOption {
+	return func(conf *tieredConfig) {
+		conf.load = load
+	}
+}
+
+// WithTieredBus returns an option setting the invalidation bus of l1 caches sharing the same l2.
+// Writes publish invalidations of their keys to bus, and keys in invalidations from others are removed from l1.
+func WithTieredBus(bus InvalidationBus) TieredOption {
+	return func(conf *tieredConfig) {
+		conf.bus = bus
+	}
+}
+
+// WithTieredError returns an option setting the function reporting errors of loading keys and publishing invalidations.
+func WithTieredError(tieredError func(keys []string, err error)) TieredOption {
+	return func(conf *tieredConfig) {
+		conf.tieredError = tieredError
+	}
+}
+
+// TieredCache is a near cache composed of a small l1 cache in process and an l2 cache, which may be a remote one.
+// Reads fall through l1, l2 and the loader in order and populate upward, and writes go to l2 and then l1.
+// Keys in l1 live for a short ttl, and they're removed when other caches sharing l2 publish invalidations of them.
+// See WithTieredBus.
+//
+// Methods reading many keys like Range, Keys and Scan only read l2 because l1 is a subset of l2.
+// Methods updating keys atomically like Update, CompareAndSwap and IncrBy run in l2 and remove keys from l1.
+// InvalidateTag invalidates all keys of l1 caches because l1 may not know the tags of keys.
+type TieredCache struct {
+	*tieredConfig
+
+	l1 Cache
+	l2 Cache
+
+	// prefix is the prefix of keys in namespace views, which is empty in the root one.
+	prefix string
+	source string
+
+	// generation increases when keys are invalidated, and values read from l2 are kept in l1 only if it doesn't change.
+	// It prevents l1 from keeping a stale value read from l2 before an invalidation.
+	generation  *uint64
+	loads       *singleflight.Group
+	unsubscribe func()
+}
+
+// NewTieredCache returns a tiered cache of l1 and l2 with options.
+// Closing the tiered cache closes both l1 and l2.
+func NewTieredCache(l1 Cache, l2 Cache, opts ...TieredOption) *TieredCache {
+	conf := newDefaultTieredConfig()
+	applyTieredOptions(conf, opts)
+
+	tc := &TieredCache{
+		tieredConfig: conf,
+		l1:           l1,
+		l2:           l2,
+		source:       newSourceID(),
+		generation:   new(uint64),
+		loads:        singleflight.NewGroup(mapInitialCap),
+	}
+
+	if conf.bus != nil {
+		tc.unsubscribe = conf.bus.Subscribe(tc.receive)
+	}
+
+	return tc
+}
+
+// newSourceID returns a random id of cache publishing invalidations.
+func newSourceID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// Use the time as id which is unique enough in most cases.
+		return time.Now().Format(time.RFC3339Nano)
+	}
+
+	return hex.EncodeToString(id[:])
+}
+
+func (tc *TieredCache) reportError(keys []string, err error) {
+	if tc.tieredError != nil {
+		tc.tieredError(keys, err)
+	}
+}
+
+// receive removes keys in invalidation published by other caches from l1.
+func (tc *TieredCache) receive(invalidation Invalidation) {
+	if invalidation.Source == tc.source {
+		return
+	}
+
+	atomic.AddUint64(tc.generation, 1)
+
+	if invalidation.All {
+		tc.l1.Reset()
+		return
+	}
+
+	for _, key := range invalidation.Keys {
+		tc.l1.Remove(key)
+	}
+
+	if invalidation.Prefix != "" {
+		tc.l1.RemovePrefix(invalidation.Prefix)
+	}
+
+	if invalidation.Match != "" {
+		tc.l1.RemoveMatch(invalidation.Match)
+	}
+}
+
+func (tc *TieredCache) publish(invalidation Invalidation) {
+	atomic.AddUint64(tc.generation, 1)
+
+	if tc.bus == nil {
+		return
+	}
+
+	invalidation.Source = tc.source
+	if err := tc.bus.Publish(invalidation); err != nil {
+		tc.reportError(invalidation.Keys, err)
+	}
+}
+
+// invalidate publishes invalidations of keys and removes them from l1.
+// Keys are removed after increasing the generation, so a stale value filled concurrently is always removed.
+func (tc *TieredCache) invalidate(keys ...string) {
+	fullKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fullKeys = append(fullKeys, tc.prefix+key)
+	}
+
+	tc.publish(Invalidation{Keys: fullKeys})
+
+	for _, key := range keys {
+		tc.l1.Remove(key)
+	}
+}
+
+// invalidateAll publishes an invalidation of all keys in cache, which is the keys of namespace in namespace views.
+func (tc *TieredCache) invalidateAll() {
+	if tc.prefix == "" {
+		tc.publish(Invalidation{All: true})
+		return
+	}
+
+	tc.publish(Invalidation{Prefix: tc.prefix})
+}
+
+// l1TTLOf returns the ttl of key in l1, which doesn't exceed the max ttl of l1.
+func (tc *TieredCache) l1TTLOf(ttl ...time.Duration) time.Duration {
+	if len(ttl) <= 0 || ttl[0] == NoTTL || ttl[0] > tc.l1TTL {
+		return tc.l1TTL
+	}
+
+	return ttl[0]
+}
+
+// fill sets key read from l2 to l1 if no keys are invalidated after generation.
+func (tc *TieredCache) fill(generation uint64, key string, value interface{}, ttl ...time.Duration) {
+	if atomic.LoadUint64(tc.generation) != generation {
+		return
+	}
+
+	tc.l1.Set(key, value, tc.l1TTLOf(ttl...))
+
+	// Keys may be invalidated between checking and setting, so check again to remove the stale one.
+	if atomic.LoadUint64(tc.generation) != generation {
+		tc.l1.Remove(key)
+	}
+}
+
+// fillFromL2 sets key read from l2 to l1 with its remaining ttl in l2, so l1 won't keep it after it expires in l2.
+func (tc *TieredCache) fillFromL2(generation uint64, key string, value interface{}) {
+	if ttl, found := ttlOfCache(tc.l2, key); found {
+		tc.fill(generation, key, value, ttl)
+	}
+}
+
+// loadKey gets key from l2 or loads it in singleflight mode, and fills it to l1.
+func (tc *TieredCache) loadKey(generation uint64, key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	if value, found = tc.l2.Get(key, deserializeF); found {
+		tc.fillFromL2(generation, key, value)
+		return value, true
+	}
+
+	return tc.loadMissed(generation, key, deserializeF)
+}
+
+// loadMissed loads key missed in l2 in singleflight mode, and fills it to l1.
+func (tc *TieredCache) loadMissed(generation uint64, key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	if tc.load == nil {
+		return nil, false
+	}
+
+	fullKey := tc.prefix + key
+	value, err := tc.loads.Call(fullKey, func() (interface{}, error) {
+		// Check l2 again because key may be loaded by others after the last check.
+		if value, found := tc.l2.Get(key, deserializeF); found {
+			return value, nil
+		}
+
+		value, ttl, err := tc.load(fullKey)
+		if err != nil {
+			return nil, err
+		}
+
+		tc.l2.Set(key, value, ttl)
+		tc.fill(generation, key, value, ttl)
+		return value, nil
+	})
+
+	if err != nil {
+		tc.reportError([]string{fullKey}, err)
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Get gets the value of key from l1, l2 or the loader in order.
+// See Cache interface.
+func (tc *TieredCache) Get(key string, deserializeF DeserializeFunc) (value interface{}, found bool) {
+	if value, found = tc.l1.Get(key, deserializeF); found {
+		return value, true
+	}
+
+	return tc.loadKey(atomic.LoadUint64(tc.generation), key, deserializeF)
+}
+
+// MGet gets the values of keys from l1, l2 or the loader in order.
+// See Cache interface.
+func (tc *TieredCache) MGet(keys []string, deserializeF DeserializeFunc) (values []interface{}, founds []bool) {
+	values, founds = tc.l1.MGet(keys, deserializeF)
+
+	var missedKeys []string
+	var missedIndexes []int
+
+	for i, found := range founds {
+		if !found {
+			missedKeys = append(missedKeys, keys[i])
+			missedIndexes = append(missedIndexes, i)
+		}
+	}
+
+	if len(missedKeys) <= 0 {
+		return values, founds
+	}
+
+	generation := atomic.LoadUint64(tc.generation)
+	l2Values, l2Founds := tc.l2.MGet(missedKeys, deserializeF)
+
+	for i, index := range missedIndexes {
+		if l2Founds[i] {
+			values[index], founds[index] = l2Values[i], true
+			tc.fillFromL2(generation, keys[index], l2Values[i])
+			continue
+		}
+
+		// Keys are just missed in l2, so they're loaded without getting from l2 again.
+		if tc.load != nil {
+			values[index], founds[index] = tc.loadMissed(generation, keys[index], deserializeF)
+		}
+	}
+
+	return values, founds
+}
+
+// Set sets key and value to l2 and l1, and returns the evicted value of l2.
+// See Cache interface.
+func (tc *TieredCache) Set(key string, value interface{}, ttl ...time.Duration) (evictedValue interface{}) {
+	evictedValue = tc.l2.Set(key, value, ttl...)
+	tc.publish(Invalidation{Keys: []string{tc.prefix + key}})
+	tc.l1.Set(key, value, tc.l1TTLOf(ttl...))
+
+	return evictedValue
+}
+
+// MSet sets keys and values to l2 and l1, and returns the evicted values of l2.
+// See Cache interface.
+func (tc *TieredCache) MSet(keys []string, values []interface{}, ttls ...time.Duration) (evictedValues []interface{}) {
+	evictedValues = tc.l2.MSet(keys, values, ttls...)
+
+	fullKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fullKeys = append(fullKeys, tc.prefix+key)
+	}
+
+	// Ttls are per key, so each key gets its own ttl capped by the max ttl of l1.
+	l1TTLs := make([]time.Duration, len(keys))
+	for i := range l1TTLs {
+		if i < len(ttls) {
+			l1TTLs[i] = tc.l1TTLOf(ttls[i])
+		} else {
+			l1TTLs[i] = tc.l1TTLOf()
+		}
+	}
+
+	tc.publish(Invalidation{Keys: fullKeys})
+	tc.l1.MSet(keys, values, l1TTLs...)
+
+	return evictedValues
+}
+
+// SetWithTags sets key and value with tags to l2 and l1, and returns the evicted value of l2.
+// See Cache interface.
+func (tc *TieredCache) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) (evictedValue interface{}) {
+	evictedValue = tc.l2.SetWithTags(key, value, ttl, tags...)
+	tc.publish(Invalidation{Keys: []string{tc.prefix + key}})
+	tc.l1.SetWithTags(key, value, tc.l1TTLOf(ttl), tags...)
+
+	return evictedValue
+}
+
+// InvalidateTag removes all keys having tag from l2 and l1, and returns the count removed from l2.
+// All keys of other l1 caches are invalidated because they may not know the tags of keys.
+// See Cache interface.
+func (tc *TieredCache) InvalidateTag(tag string) (removed int) {
+	removed = tc.l2.InvalidateTag(tag)
+	tc.invalidateAll()
+	tc.l1.InvalidateTag(tag)
+
+	return removed
+}
+
+// Remove removes key from l2 and l1, and returns the removed value of l2.
+// See Cache interface.
+func (tc *TieredCache) Remove(key string) (removedValue interface{}) {
+	removedValue = tc.l2.Remove(key)
+	tc.invalidate(key)
+
+	return removedValue
+}
+
+// RemovePrefix removes all keys starting with prefix from l2 and l1, and returns the count removed from l2.
+// See Cache interface.
+func (tc *TieredCache) RemovePrefix(prefix string) (removed int) {
+	removed = tc.l2.RemovePrefix(prefix)
+
+	if prefix == "" {
+		tc.invalidateAll()
+	} else {
+		tc.publish(Invalidation{Prefix: tc.prefix + prefix})
+	}
+
+	tc.l1.RemovePrefix(prefix)
+	return removed
+}
+
+// RemoveMatch removes all keys matching pattern from l2 and l1, and returns the count removed from l2.
+// See Cache interface.
+func (tc *TieredCache) RemoveMatch(pattern string) (removed int) {
+	removed = tc.l2.RemoveMatch(pattern)
+	tc.publish(Invalidation{Match: tc.prefix + pattern})
+	tc.l1.RemoveMatch(pattern)
+
+	return removed
+}
+
+// GetOrSet returns the value of key if found, otherwise sets value to l2 and l1 with ttl and returns it.
+// See Cache interface.
+func (tc *TieredCache) GetOrSet(key string, value interface{}, ttl ...time.Duration) (actual interface{}, loaded bool) {
+	if actual, loaded = tc.l1.Get(key, nil); loaded {
+		return actual, true
+	}
+
+	generation := atomic.LoadUint64(tc.generation)
+	if actual, loaded = tc.l2.GetOrSet(key, value, ttl...); loaded {
+		tc.fillFromL2(generation, key, actual)
+		return actual, true
+	}
+
+	tc.publish(Invalidation{Keys: []string{tc.prefix + key}})
+	tc.l1.Set(key, value, tc.l1TTLOf(ttl...))
+
+	return actual, false
+}
+
+// CompareAndSwap swaps the value of key in l2 and removes key from l1 if swapped.
+// See Cache interface.
+func (tc *TieredCache) CompareAndSwap(key string, oldValue interface{}, newValue interface{}) (swapped bool) {
+	if swapped = tc.l2.CompareAndSwap(key, oldValue, newValue); swapped {
+		tc.invalidate(key)
+	}
+
+	return swapped
+}
+
+// CompareAndDelete removes key from l2 and l1 if its value in l2 equals oldValue.
+// See Cache interface.
+func (tc *TieredCache) CompareAndDelete(key string, oldValue interface{}) (deleted bool) {
+	if deleted = tc.l2.CompareAndDelete(key, oldValue); deleted {
+		tc.invalidate(key)
+	}
+
+	return deleted
+}
+
+// Update updates the value of key in l2 and removes key from l1.
+// See Cache interface.
+func (tc *TieredCache) Update(key string, fn UpdateFunc) (newValue interface{}, kept bool) {
+	newValue, kept = tc.l2.Update(key, fn)
+	tc.invalidate(key)
+
+	return newValue, kept
+}
+
+// Incr increases the value of key in l2 by 1 and removes key from l1.
+// See Cache interface.
+func (tc *TieredCache) Incr(key string, ttl ...time.Duration) (value int64, err error) {
+	return tc.IncrBy(key, 1, ttl...)
+}
+
+// Decr decreases the value of key in l2 by 1 and removes key from l1.
+// See Cache interface.
+func (tc *TieredCache) Decr(key string, ttl ...time.Duration) (value int64, err error) {
+	return tc.IncrBy(key, -1, ttl...)
+}
+
+// IncrBy increases the value of key in l2 by delta and removes key from l1.
+// See Cache interface.
+func (tc *TieredCache) IncrBy(key string, delta int64, ttl ...time.Duration) (value int64, err error) {
+	if value, err = tc.l2.IncrBy(key, delta, ttl...); err == nil {
+		tc.invalidate(key)
+	}
+
+	return value, err
+}
+
+// IncrByFloat increases the value of key in l2 by delta and removes key from l1.
+// See Cache interface.
+func (tc *TieredCache) IncrByFloat(key string, delta float64, ttl ...time.Duration) (value float64, err error) {
+	if value, err = tc.l2.IncrByFloat(key, delta, ttl...); err == nil {
+		tc.invalidate(key)
+	}
+
+	return value, err
+}
+
+// Range calls fn with each unexpired key, value and its remaining ttl in l2.
+// See Cache interface.
+func (tc *TieredCache) Range(fn RangeFunc) {
+	tc.l2.Range(fn)
+}
+
+// Keys returns all unexpired keys in l2.
+// See Cache interface.
+func (tc *TieredCache) Keys() (keys []string) {
+	return tc.l2.Keys()
+}
+
+// Scan scans unexpired keys in l2.
+// See Cache interface.
+func (tc *TieredCache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	return tc.l2.Scan(cursor, match, count)
+}
+
+// Namespace returns a tiered view of namespace name in l1 and l2.
+// Invalidations published by views have the full keys, so they're received by the root caches of others.
+// See Cache interface.
+func (tc *TieredCache) Namespace(name string, quota ...int) Cache {
+	return &TieredCache{
+		tieredConfig: tc.tieredConfig,
+		l1:           tc.l1.Namespace(name),
+		l2:           tc.l2.Namespace(name, quota...),
+		prefix:       tc.prefix + name + ":",
+		source:       tc.source,
+		generation:   tc.generation,
+		loads:        tc.loads,
+	}
+}
+
+// Flush flushes l2 and l1, and returns the first error.
+// See Cache interface.
+func (tc *TieredCache) Flush() error {
+	err := tc.l2.Flush()
+	if l1Err := tc.l1.Flush(); err == nil {
+		err = l1Err
+	}
+
+	return err
+}
+
+// SaveSnapshot writes all unexpired entries in l2 to w.
+// See Cache interface.
+func (tc *TieredCache) SaveSnapshot(w io.Writer) error {
+	return tc.l2.SaveSnapshot(w)
+}
+
+// LoadSnapshot loads a snapshot to l2 and invalidates all keys in l1.
+// See Cache interface.
+func (tc *TieredCache) LoadSnapshot(r io.Reader) error {
+	err := tc.l2.LoadSnapshot(r)
+	tc.invalidateAll()
+	tc.l1.Reset()
+
+	return err
+}
+
+// Size returns the count of keys in l2.
+// See Cache interface.
+func (tc *TieredCache) Size() (size int) {
+	return tc.l2.Size()
+}
+
+// GC cleans the expired keys in l1 and l2, and returns the total count cleaned.
+// See Cache interface.
+func (tc *TieredCache) GC() (cleans int) {
+	return tc.l1.GC() + tc.l2.GC()
+}
+
+// Reset resets l2 and l1, and invalidates all keys in other l1 caches.
+// See Cache interface.
+func (tc *TieredCache) Reset() {
+	tc.l2.Reset()
+	tc.invalidateAll()
+	tc.l1.Reset()
+}
+
+// Close unsubscribes invalidations and closes l1 and l2, and returns the first error.
+// Close of namespace views does nothing just like other namespaces.
+// See Cache interface.
+func (tc *TieredCache) Close() error {
+	if tc.prefix != "" {
+		return nil
+	}
+
+	if tc.unsubscribe != nil {
+		tc.unsubscribe()
+	}
+
+	err := tc.l2.Close()
+	if l1Err := tc.l1.Close(); err == nil {
+		err = l1Err
+	}
+
+	return err
+}
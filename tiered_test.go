@@ -0,0 +1,367 @@
+package memcache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xd-luqiang/memcache/pkg/clock"
+)
+
+func newTestTieredCache(t *testing.T, l2 Cache, opts ...TieredOption) (tc *TieredCache, l1 Cache) {
+	l1 = NewCache(WithLRU(16), WithGC(0))
+	tc = NewTieredCache(l1, l2, opts...)
+
+	// l2 may be shared by caches, so only l1 is closed.
+	t.Cleanup(func() {
+		if tc.unsubscribe != nil {
+			tc.unsubscribe()
+		}
+
+		l1.Close()
+	})
+
+	return tc, l1
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestMemoryBus$
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+
+	var received []Invalidation
+	unsubscribe := bus.Subscribe(func(invalidation Invalidation) {
+		received = append(received, invalidation)
+	})
+
+	bus.Publish(Invalidation{Keys: []string{"key"}})
+	unsubscribe()
+	bus.Publish(Invalidation{All: true})
+
+	if len(received) != 1 || len(received[0].Keys) != 1 || received[0].Keys[0] != "key" {
+		t.Fatalf("received %+v is wrong", received)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTieredCache$
+func TestTieredCache(t *testing.T) {
+	l2 := NewCache(WithLRU(64), WithGC(0))
+	defer l2.Close()
+
+	var loads int64
+	load := func(key string) (value interface{}, ttl time.Duration, err error) {
+		atomic.AddInt64(&loads, 1)
+		time.Sleep(10 * time.Millisecond)
+
+		if key == "error" {
+			return nil, 0, errors.New("load failed")
+		}
+
+		return "loaded " + key, time.Minute, nil
+	}
+
+	var reported []string
+	tieredError := func(keys []string, err error) {
+		reported = append(reported, keys...)
+	}
+
+	tc, l1 := newTestTieredCache(t, l2, WithTieredLoad(load), WithTieredError(tieredError))
+
+	var cache Cache = tc
+	cache.Set("key", "value")
+
+	for _, c := range []Cache{cache, l1, l2} {
+		if value, found := c.Get("key", nil); !found || value != "value" {
+			t.Fatalf("value %+v is wrong or not found", value)
+		}
+	}
+
+	l1.Remove("key")
+	if value, found := cache.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	if value, found := l1.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found in l1", value)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if value, found := cache.Get("missed", nil); !found || value != "loaded missed" {
+				t.Errorf("value %+v is wrong or not found", value)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if loads != 1 {
+		t.Fatalf("loads %d != 1", loads)
+	}
+
+	for _, c := range []Cache{l1, l2} {
+		if value, found := c.Get("missed", nil); !found || value != "loaded missed" {
+			t.Fatalf("value %+v is wrong or not found", value)
+		}
+	}
+
+	if value, found := cache.Get("error", nil); found {
+		t.Fatalf("value %+v is found", value)
+	}
+
+	if len(reported) != 1 || reported[0] != "error" {
+		t.Fatalf("reported %+v is wrong", reported)
+	}
+
+	l2.Set("l2", "l2")
+	values, founds := cache.MGet([]string{"key", "l2", "mget"}, nil)
+	for i, want := range []string{"value", "l2", "loaded mget"} {
+		if !founds[i] || values[i] != want {
+			t.Fatalf("values[%d] %+v != %s", i, values[i], want)
+		}
+	}
+
+	if value := cache.Remove("key"); value != "value" {
+		t.Fatalf("value %+v != value", value)
+	}
+
+	if value, found := l1.Get("key", nil); found {
+		t.Fatalf("value %+v is found in l1", value)
+	}
+
+	if n, err := cache.IncrBy("counter", 2); err != nil || n != 2 {
+		t.Fatalf("n %d != 2 or err %+v != nil", n, err)
+	}
+
+	if value, found := cache.Get("counter", nil); !found || value != int64(2) {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	if n, err := cache.Incr("counter"); err != nil || n != 3 {
+		t.Fatalf("n %d != 3 or err %+v != nil", n, err)
+	}
+
+	if value, found := cache.Get("counter", nil); !found || value != int64(3) {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	cache.Reset()
+	if l1.Size() != 0 || l2.Size() != 0 {
+		t.Fatalf("l1 size %d or l2 size %d != 0", l1.Size(), l2.Size())
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTieredCacheL1TTL$
+func TestTieredCacheL1TTL(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+
+	l1 := NewCache(WithLRU(16), WithGC(0), WithNow(fakeClock.Now))
+	l2 := NewCache(WithLRU(64), WithGC(0), WithNow(fakeClock.Now))
+
+	tc := NewTieredCache(l1, l2, WithTieredL1TTL(time.Second))
+
+	tc.Set("key", "value")
+	tc.Set("short", "value", 500*time.Millisecond)
+
+	fakeClock.Advance(600 * time.Millisecond)
+	if value, found := l1.Get("short", nil); found {
+		t.Fatalf("value %+v is found in l1", value)
+	}
+
+	fakeClock.Advance(time.Second)
+	if value, found := l1.Get("key", nil); found {
+		t.Fatalf("value %+v is found in l1", value)
+	}
+
+	if value, found := tc.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	if value, found := l1.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found in l1", value)
+	}
+
+	// Each key set by MSet has its own ttl in l1, capped by the max ttl of l1.
+	tc.MSet([]string{"a", "b", "c"}, []interface{}{"a", "b", "c"}, 300*time.Millisecond, 300*time.Millisecond, time.Minute)
+
+	fakeClock.Advance(400 * time.Millisecond)
+	for _, key := range []string{"a", "b"} {
+		if value, found := l1.Get(key, nil); found {
+			t.Fatalf("key %s: value %+v is found in l1", key, value)
+		}
+	}
+
+	if value, found := l1.Get("c", nil); !found || value != "c" {
+		t.Fatalf("value %+v is wrong or not found in l1", value)
+	}
+
+	fakeClock.Advance(time.Second)
+	if value, found := l1.Get("c", nil); found {
+		t.Fatalf("value %+v is found in l1", value)
+	}
+
+	// Keys read from l2 live in l1 no longer than their remaining ttls in l2.
+	l2.Set("get", "value", 500*time.Millisecond)
+	l2.Set("mget", "value", 500*time.Millisecond)
+	l2.Set("getorset", "value", 500*time.Millisecond)
+
+	tc.Get("get", nil)
+	tc.MGet([]string{"mget"}, nil)
+	tc.GetOrSet("getorset", "new")
+
+	for _, key := range []string{"get", "mget", "getorset"} {
+		if value, found := l1.Get(key, nil); !found || value != "value" {
+			t.Fatalf("key %s: value %+v is wrong or not found in l1", key, value)
+		}
+	}
+
+	fakeClock.Advance(600 * time.Millisecond)
+
+	for _, key := range []string{"get", "mget", "getorset"} {
+		if value, found := l1.Get(key, nil); found {
+			t.Fatalf("key %s: value %+v is found in l1", key, value)
+		}
+	}
+
+	if err := tc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l2.Close(); err != ErrClosed {
+		t.Fatalf("err %+v != %+v", err, ErrClosed)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTieredCacheInvalidation$
+func TestTieredCacheInvalidation(t *testing.T) {
+	l2 := NewCache(WithLRU(64), WithGC(0))
+	defer l2.Close()
+
+	bus := NewMemoryBus()
+	tc1, l1 := newTestTieredCache(t, l2, WithTieredBus(bus))
+	tc2, _ := newTestTieredCache(t, l2, WithTieredBus(bus))
+
+	get := func(key string, want interface{}) {
+		t.Helper()
+
+		value, found := tc1.Get(key, nil)
+		if want == nil && found {
+			t.Fatalf("key %s: value %+v is found", key, value)
+		}
+
+		if want != nil && (!found || value != want) {
+			t.Fatalf("key %s: value %+v != %+v", key, value, want)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		tc2.Set("key"+strconv.Itoa(i), i)
+		get("key"+strconv.Itoa(i), i)
+	}
+
+	tc2.Set("key0", "new")
+	get("key0", "new")
+
+	tc2.Remove("key0")
+	get("key0", nil)
+
+	tc2.IncrBy("key1", 10)
+	get("key1", int64(11))
+
+	tc2.CompareAndSwap("key2", 2, "swapped")
+	get("key2", "swapped")
+
+	tc2.RemovePrefix("key3")
+	get("key3", nil)
+
+	tc2.RemoveMatch("key?")
+	if size := l1.Size(); size != 0 {
+		t.Fatalf("l1 size %d != 0", size)
+	}
+
+	tc1.SetWithTags("tagged", "value", NoTTL, "tag")
+	tc2.InvalidateTag("tag")
+	get("tagged", nil)
+
+	tc1.Set("key", "value")
+	tc2.Reset()
+	get("key", nil)
+
+	// Invalidations of tc1 itself are skipped.
+	tc1.Set("key", "value")
+	if value, found := l1.Get("key", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found in l1", value)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTieredCacheNamespace$
+func TestTieredCacheNamespace(t *testing.T) {
+	l2 := NewCache(WithLRU(64), WithGC(0))
+	defer l2.Close()
+
+	bus := NewMemoryBus()
+	tc1, l1 := newTestTieredCache(t, l2, WithTieredBus(bus))
+	tc2, _ := newTestTieredCache(t, l2, WithTieredBus(bus))
+
+	ns1 := tc1.Namespace("user")
+	ns2 := tc2.Namespace("user")
+
+	ns2.Set("1", "old")
+	if value, found := ns1.Get("1", nil); !found || value != "old" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	if value, found := l1.Get("user:1", nil); !found || value != "old" {
+		t.Fatalf("value %+v is wrong or not found in l1", value)
+	}
+
+	ns2.Set("1", "new")
+	if value, found := ns1.Get("1", nil); !found || value != "new" {
+		t.Fatalf("value %+v is wrong or not found", value)
+	}
+
+	tc1.Set("other", "value")
+	ns2.Reset()
+
+	if value, found := ns1.Get("1", nil); found {
+		t.Fatalf("value %+v is found", value)
+	}
+
+	if value, found := l1.Get("other", nil); !found || value != "value" {
+		t.Fatalf("value %+v is wrong or not found in l1", value)
+	}
+
+	if err := ns1.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test -v -cover -count=1 -test.cpu=1 -run=^TestTieredCacheMGetLoad$
+func TestTieredCacheMGetLoad(t *testing.T) {
+	l2, reporter := NewCacheWithReport(WithLRU(64), WithGC(0))
+	defer l2.Close()
+
+	load := func(key string) (value interface{}, ttl time.Duration, err error) {
+		return "loaded " + key, time.Minute, nil
+	}
+
+	tc, _ := newTestTieredCache(t, l2, WithTieredLoad(load))
+	tc.Set("key", "value")
+
+	values, founds := tc.MGet([]string{"key", "missed"}, nil)
+	if !founds[0] || !founds[1] || values[0] != "value" || values[1] != "loaded missed" {
+		t.Fatalf("values %+v or founds %+v are wrong", values, founds)
+	}
+
+	// The missed key is got from l2 by MGet and checked again before loading, but not got again after MGet.
+	if missed := reporter.CountMissed(); missed != 2 {
+		t.Fatalf("missed %d != 2", missed)
+	}
+}